@@ -0,0 +1,52 @@
+package app
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"github.com/alidevjimmy/user_microservice_t/middlewares/v1"
+	"github.com/alidevjimmy/user_microservice_t/utils/openapi"
+	"github.com/alidevjimmy/user_microservice_t/validators/v1"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	OpenAPIPath = "/openapi.json"
+	DocsPath    = "/docs"
+
+	apiTitle   = "User Microservice"
+	apiVersion = "1.0.0"
+)
+
+// docsUI is the page browsing the document, it is served with the service so docs work offline
+//
+//go:embed docsui
+var docsUI embed.FS
+
+// openAPIDocument describes rs, it is generated from domains so it never goes stale
+func openAPIDocument(rs []route) *openapi.Document {
+	doc := openapi.New(apiTitle, apiVersion, validators.Patterns())
+	doc.AddSecurityScheme(securityToken, echo.HeaderAuthorization)
+	doc.AddBasicSecurityScheme(securityClient)
+	doc.AddSecurityScheme(securityAPIKey, middlewares.HeaderAPIKey)
+	for _, r := range rs {
+		doc.Add(r.Route, errors.Body{})
+	}
+	return doc
+}
+
+// docs serves specification of rs and a page to browse it
+func docs(rs []route) {
+	doc := openAPIDocument(rs)
+	e.GET(OpenAPIPath, func(c echo.Context) error {
+		return c.JSON(http.StatusOK, doc)
+	})
+	page, _ := docsUI.ReadFile("docsui/index.html")
+	e.GET(DocsPath, func(c echo.Context) error {
+		return c.HTMLBlob(http.StatusOK, page)
+	})
+	ui, _ := fs.Sub(docsUI, "docsui")
+	e.GET(DocsPath+"/*", echo.WrapHandler(http.StripPrefix(DocsPath+"/", http.FileServer(http.FS(ui)))))
+}
@@ -0,0 +1,106 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/alidevjimmy/user_microservice_t/utils/openapi"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestApp() *echo.Echo {
+	e = echo.New()
+	urlMapper()
+	return e
+}
+
+// checkedInSpec is the reviewed document, tests fail when what is served or registered drifts from it
+const checkedInSpec = "testdata/openapi.json"
+
+var update = flag.Bool("update", false, "rewrite "+checkedInSpec+" with the served document")
+
+// TestOpenAPIMatchesRoutes fails when a handler is registered without being in the checked in document or the other way around
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	b, err := ioutil.ReadFile(checkedInSpec)
+	assert.Nil(t, err)
+	var doc openapi.Document
+	assert.Nil(t, json.Unmarshal(b, &doc))
+
+	var registered []string
+	for _, r := range newTestApp().Routes() {
+		if r.Path == OpenAPIPath || r.Path == DocsPath || r.Path == DocsPath+"/*" {
+			continue
+		}
+		path, _ := openapi.Path(r.Path)
+		registered = append(registered, r.Method+" "+path)
+	}
+	documented := doc.Operations()
+	sort.Strings(registered)
+	sort.Strings(documented)
+	assert.Equal(t, registered, documented)
+}
+
+// TestOpenAPIMatchesCheckedInSpec fails when the served document changes, run tests with -update to accept the change
+func TestOpenAPIMatchesCheckedInSpec(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, OpenAPIPath, nil)
+	rec := httptest.NewRecorder()
+	newTestApp().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	if *update {
+		var b bytes.Buffer
+		assert.Nil(t, json.Indent(&b, rec.Body.Bytes(), "", "  "))
+		assert.Nil(t, ioutil.WriteFile(checkedInSpec, b.Bytes(), 0644))
+	}
+	b, err := ioutil.ReadFile(checkedInSpec)
+	assert.Nil(t, err)
+	assert.JSONEq(t, string(b), rec.Body.String())
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, OpenAPIPath, nil)
+	rec := httptest.NewRecorder()
+	newTestApp().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var doc openapi.Document
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, openapi.Version, doc.OpenAPI)
+
+	register := doc.Paths["/v1/register"]["post"]
+	assert.NotNil(t, register)
+	assert.Contains(t, register.Responses, "201")
+	assert.Contains(t, register.Responses, "default")
+	schema := doc.Components.Schemas["RegisterRequest"]
+	assert.ElementsMatch(t, []string{"phone", "username", "name", "family", "age", "password"}, schema.Required)
+	assert.NotEmpty(t, schema.Properties["username"].Pattern)
+
+	block := doc.Paths["/v1/admin/users/{user_id}/block"]["post"]
+	assert.NotNil(t, block)
+	assert.Equal(t, "user_id", block.Parameters[0].Name)
+	assert.Equal(t, openapi.InPath, block.Parameters[0].In)
+	assert.NotEmpty(t, block.Security)
+}
+
+func TestDocsServed(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, DocsPath, nil)
+	rec := httptest.NewRecorder()
+	newTestApp().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), OpenAPIPath)
+	assert.NotContains(t, rec.Body.String(), "https://")
+
+	for _, asset := range []string{"/docs.js", "/docs.css"} {
+		req = httptest.NewRequest(http.MethodGet, DocsPath+asset, nil)
+		rec = httptest.NewRecorder()
+		newTestApp().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NotEmpty(t, rec.Body.Bytes())
+	}
+}
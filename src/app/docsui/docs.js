@@ -0,0 +1,118 @@
+// docs.js renders the OpenAPI document of this service, operations are grouped by tag
+(function () {
+	var root = document.getElementById("docs");
+
+	function el(tag, attrs, children) {
+		var node = document.createElement(tag);
+		Object.keys(attrs || {}).forEach(function (k) { node.setAttribute(k, attrs[k]); });
+		(children || []).forEach(function (c) {
+			node.appendChild(typeof c === "string" ? document.createTextNode(c) : c);
+		});
+		return node;
+	}
+
+	// example makes a sample value of schema, components are followed through $ref
+	function example(spec, schema, seen) {
+		if (!schema) {
+			return null;
+		}
+		if (schema.$ref) {
+			var name = schema.$ref.split("/").pop();
+			if (seen.indexOf(name) >= 0) {
+				return name;
+			}
+			return example(spec, spec.components.schemas[name], seen.concat(name));
+		}
+		switch (schema.type) {
+		case "object":
+			var obj = {};
+			Object.keys(schema.properties || {}).forEach(function (k) {
+				obj[k] = example(spec, schema.properties[k], seen);
+			});
+			return obj;
+		case "array":
+			return [example(spec, schema.items, seen)];
+		case "integer":
+		case "number":
+			return schema.minimum || 0;
+		case "boolean":
+			return false;
+		}
+		if (schema.enum) {
+			return schema.enum[0];
+		}
+		return schema.format || schema.pattern || "string";
+	}
+
+	function sample(spec, content) {
+		var types = Object.keys(content || {});
+		if (!types.length) {
+			return el("p", {}, ["no content"]);
+		}
+		return el("div", {}, [
+			el("p", {}, [types[0]]),
+			el("pre", {}, [JSON.stringify(example(spec, content[types[0]].schema, []), null, 2)])
+		]);
+	}
+
+	function operation(spec, path, method, op) {
+		var body = el("div", {"class": "operation"}, [el("p", {}, [op.operationId])]);
+		if (op.security) {
+			body.appendChild(el("p", {}, ["security: " + op.security.map(function (s) {
+				return Object.keys(s).join(", ");
+			}).join(" or ")]));
+		}
+		if (op.parameters) {
+			body.appendChild(el("h4", {}, ["Parameters"]));
+			body.appendChild(el("table", {}, op.parameters.map(function (p) {
+				return el("tr", {}, [
+					el("td", {}, [p.name + (p.required ? " *" : "")]),
+					el("td", {}, [p.in]),
+					el("td", {}, [(p.schema && (p.schema.type || p.schema.$ref)) || ""])
+				]);
+			})));
+		}
+		if (op.requestBody) {
+			body.appendChild(el("h4", {}, ["Request body"]));
+			body.appendChild(sample(spec, op.requestBody.content));
+		}
+		body.appendChild(el("h4", {}, ["Responses"]));
+		Object.keys(op.responses).sort().forEach(function (status) {
+			var res = op.responses[status];
+			body.appendChild(el("p", {}, [el("b", {}, [status]), " " + res.description]));
+			if (res.content) {
+				body.appendChild(sample(spec, res.content));
+			}
+		});
+		return el("details", {}, [
+			el("summary", {}, [
+				el("span", {"class": "method " + method}, [method.toUpperCase()]),
+				el("span", {"class": "path"}, [path]),
+				" " + (op.summary || "")
+			]),
+			body
+		]);
+	}
+
+	function render(spec) {
+		var tags = {};
+		Object.keys(spec.paths).sort().forEach(function (path) {
+			Object.keys(spec.paths[path]).forEach(function (method) {
+				var op = spec.paths[path][method];
+				var tag = (op.tags && op.tags[0]) || "default";
+				(tags[tag] = tags[tag] || []).push(operation(spec, path, method, op));
+			});
+		});
+		document.title = spec.info.title;
+		root.appendChild(el("h1", {}, [spec.info.title + " " + spec.info.version]));
+		Object.keys(tags).sort().forEach(function (tag) {
+			root.appendChild(el("h2", {}, [tag]));
+			tags[tag].forEach(function (node) { root.appendChild(node); });
+		});
+	}
+
+	fetch(root.getAttribute("data-spec"))
+		.then(function (res) { return res.json(); })
+		.then(render)
+		.catch(function (err) { root.appendChild(el("pre", {}, [String(err)])); });
+})();
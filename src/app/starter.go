@@ -1,9 +1,19 @@
 package app
 
 import (
+	"context"
+	"net"
+
 	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+	"github.com/alidevjimmy/user_microservice_t/rpc/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/alidevjimmy/user_microservice_t/utils/broker"
+	"github.com/alidevjimmy/user_microservice_t/validators/v1"
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 )
 
 var (
@@ -14,16 +24,66 @@ type Validator struct {
 	validator *validator.Validate
 }
 
+// Validate reports every failed field of i, see errors.ValidationError
 func (uv *Validator) Validate(i interface{}) error {
 	if err := uv.validator.Struct(i); err != nil {
-		return rest_errors.NewBadRequestError(err.Error())
+		return errors.NewValidationError(err)
 	}
 	return nil
 }
 
-func StartApp(port string) {
+// StartApp serves http api on port and grpc api on grpcPort
+func StartApp(port, grpcPort string) {
 	e = echo.New()
-	e.Validator = &Validator{validator: validator.New()}
+	e.HTTPErrorHandler = errors.HTTPErrorHandler
+	// panics are written by HTTPErrorHandler like any other error
+	e.Use(middleware.Recover())
+	// request ids are written to audit log
+	e.Use(middleware.RequestID())
+	v := validator.New()
+	v.RegisterTagNameFunc(errors.FieldName)
+	if err := validators.Register(v); err != nil {
+		panic(err)
+	}
+	e.Validator = &Validator{validator: v}
+	db := repositories.Connect()
+	if err := repositories.Migrate(db); err != nil {
+		panic(err)
+	}
+	repositories.UserRepository = repositories.NewUserRepository(db, false)
+	repositories.CodeRepository = repositories.NewCodeRepository(db)
+	repositories.ClientRepository = repositories.NewClientRepository(db)
+	repositories.OAuthRepository = repositories.NewOAuthRepository(db)
+	repositories.IdentityRepository = repositories.NewIdentityRepository(db)
+	repositories.APIKeyRepository = repositories.NewAPIKeyRepository(db)
+	repositories.PasskeyRepository = repositories.NewPasskeyRepository(db)
+	repositories.SessionRepository = repositories.NewSessionRepository(db)
+	repositories.AuditRepository = repositories.NewAuditRepository(db)
+	repositories.OutboxRepository = repositories.NewOutboxRepository(db)
+	repositories.WebhookRepository = repositories.NewWebhookRepository(db)
+	repositories.DataExportRepository = repositories.NewDataExportRepository(db)
+	services.SMSSender = services.CodeSMSSender()
+	if err := services.LoadSocialProviders(); err != nil {
+		panic(err)
+	}
 	urlMapper()
+	logError := func(err rest_errors.RestErr) {
+		e.Logger.Error(err)
+	}
+	relayTo := broker.Multi{services.OutboxBroker(), services.WebhookBroker()}
+	go services.RunOutboxRelay(context.Background(), relayTo, services.OutboxRelayInterval, logError)
+	go services.RunWebhookDeliveries(context.Background(), services.WebhookDeliveryInterval, logError)
+	go services.RunBlockExpiry(context.Background(), services.BlockExpiryInterval, logError)
+	go services.RunAccountPurge(context.Background(), services.AccountPurgeInterval, logError)
+	go services.RunDataExports(context.Background(), services.DataExportInterval, logError)
+	go startGRPC(grpcPort, v)
 	e.Logger.Fatal(e.Start(port))
 }
+
+func startGRPC(port string, v *validator.Validate) {
+	lis, err := net.Listen("tcp", port)
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	e.Logger.Fatal(rpc.NewServer(v).Serve(lis))
+}
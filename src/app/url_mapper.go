@@ -2,28 +2,400 @@ package app
 
 import (
 	"fmt"
+	"net/http"
 
 	"github.com/alidevjimmy/user_microservice_t/controllers/v1"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
 	"github.com/alidevjimmy/user_microservice_t/middlewares/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/alidevjimmy/user_microservice_t/utils/openapi"
+	"github.com/labstack/echo/v4"
 )
 
 const (
 	V1Prefix = "/v1/%s"
+
+	tagUsers    = "users"
+	tagCodes    = "codes"
+	tagAdmin    = "admin"
+	tagOAuth    = "oauth"
+	tagSocial   = "social"
+	tagPasskeys = "passkeys"
+	tagSessions = "sessions"
+	// securityToken is the security scheme of endpoints reading token from Authorization header
+	securityToken = "token"
+	// securityClient is the security scheme of endpoints called by clients, see middlewares.OnlyClient
+	securityClient = "client"
+	// securityAPIKey is the security scheme of admin endpoints machines may call, see middlewares.OnlyAdminOrAPIKey
+	securityAPIKey = "apiKey"
 )
 
+// ifMatch documents If-Match of endpoints changing users, a list of stale ETags fails with 412 and a malformed one with 400
+var ifMatch = openapi.Parameter{Name: "If-Match", In: openapi.InHeader, Schema: &openapi.Schema{Type: "string"}}
+
+// route is an endpoint and its documentation, every endpoint must be registered through routes
+type route struct {
+	openapi.Route
+	handler     echo.HandlerFunc
+	middlewares []echo.MiddlewareFunc
+}
+
+func routes() []route {
+	return []route{
+		// v1
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "register"), Name: "register", Tag: tagUsers,
+				Summary: "Register a new inactive user", Request: domains.RegisterRequest{}, Response: domains.RegisterResponse{}, Status: http.StatusCreated},
+			handler: controllers.UsersController.Register,
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "login"), Name: "login", Tag: tagUsers,
+				Summary: "Login by phone or username and password", Request: domains.LoginRequest{}, Response: domains.LoginResponse{}},
+			handler: controllers.UsersController.Login,
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "sendCode"), Name: "sendCode", Tag: tagCodes,
+				Summary: "Send verification or forgot password code by sms", Request: domains.SendCodeRequest{}},
+			handler: controllers.CodesController.SendCode,
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPut, Path: fmt.Sprintf(V1Prefix, "changePassword"), Name: "changePassword", Tag: tagUsers,
+				Summary: "Change forgotten password by code", Request: domains.ChangePasswordRequest{}, Response: domains.PublicUser{}},
+			handler: controllers.UsersController.ChangePassword,
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPut, Path: fmt.Sprintf(V1Prefix, "verifyUser"), Name: "verifyUser", Tag: tagUsers,
+				Summary: "Activate user by code", Request: domains.VerifyUserRequest{}, Response: domains.PublicUser{}},
+			handler: controllers.UsersController.Verify,
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: fmt.Sprintf(V1Prefix, "getUser"), Name: "getUser", Tag: tagUsers,
+				Summary: "Get user owning token", Request: domains.GetUserRequest{}, Response: domains.PublicUser{}},
+			handler: controllers.UsersController.GetUser,
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPatch, Path: fmt.Sprintf(V1Prefix, "updateUser:user_id"), Name: "updateUser", Tag: tagUsers,
+				Summary: "Update profile of signed in user, admins update any user", Request: domains.UpdateUserRequest{}, Response: domains.PublicUser{}, Security: securityToken,
+				Parameters: []openapi.Parameter{ifMatch}},
+			handler:     controllers.UsersController.UpdateUser,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyActive},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "introspect"), Name: "introspect", Tag: tagOAuth,
+				Summary: "Introspect a token (RFC 7662)", Request: domains.IntrospectionRequest{}, RequestType: openapi.MIMEApplicationForm,
+				Response: domains.IntrospectionResponse{}, Security: securityClient},
+			handler:     controllers.OAuthController.Introspect,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyClient},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: fmt.Sprintf(V1Prefix, "oauth/authorize"), Name: "authorize", Tag: tagOAuth,
+				Summary: "Authorize a client by authorization code flow with PKCE", Request: domains.AuthorizeRequest{}, RequestIn: openapi.InQuery,
+				Response: domains.AuthorizeResponse{}, Security: securityToken},
+			handler:     controllers.OAuthController.Authorize,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyActive},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "oauth/consent"), Name: "consent", Tag: tagOAuth,
+				Summary: "Approve or deny an authorization request", Request: domains.ConsentRequest{}, Response: domains.AuthorizeResponse{}, Security: securityToken},
+			handler:     controllers.OAuthController.Consent,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyActive},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "oauth/token"), Name: "token", Tag: tagOAuth,
+				Summary: "Exchange a grant for tokens (RFC 6749)", Request: domains.TokenRequest{}, RequestType: openapi.MIMEApplicationForm,
+				Response: domains.TokenResponse{}},
+			handler: controllers.OAuthController.Token,
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: fmt.Sprintf(V1Prefix, "oauth/userinfo"), Name: "userinfo", Tag: tagOAuth,
+				Summary: "Claims of user owning an openid access token", Response: domains.UserInfo{}, Security: securityToken},
+			handler: controllers.OAuthController.UserInfo,
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: "/.well-known/openid-configuration", Name: "openidConfiguration", Tag: tagOAuth,
+				Summary: "OpenID Connect discovery document", Response: domains.DiscoveryDocument{}},
+			handler: controllers.OAuthController.Discovery,
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: "/.well-known/jwks.json", Name: "jwks", Tag: tagOAuth,
+				Summary: "Keys id tokens are signed with", Response: domains.JWKS{}},
+			handler: controllers.OAuthController.JWKS,
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: fmt.Sprintf(V1Prefix, "social/providers"), Name: "socialProviders", Tag: tagSocial,
+				Summary: "Identity providers users may sign in with", Response: domains.SocialProvidersResponse{}},
+			handler: controllers.SocialController.Providers,
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: fmt.Sprintf(V1Prefix, "social/:provider/login"), Name: "socialLogin", Tag: tagSocial,
+				Summary: "Start sign in with an identity provider", Response: domains.SocialLoginResponse{}},
+			handler: controllers.SocialController.Login,
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: fmt.Sprintf(V1Prefix, "social/:provider/callback"), Name: "socialCallback", Tag: tagSocial,
+				Summary: "Finish sign in with an identity provider", Request: domains.SocialCallbackRequest{}, RequestIn: openapi.InQuery,
+				Response: domains.LoginResponse{}},
+			handler: controllers.SocialController.Callback,
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: fmt.Sprintf(V1Prefix, "me/identities"), Name: "identities", Tag: tagSocial,
+				Summary: "Identities linked to signed in user", Response: []domains.Identity{}, Security: securityToken},
+			handler:     controllers.SocialController.Identities,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyActive},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "me/identities/:provider"), Name: "linkIdentity", Tag: tagSocial,
+				Summary: "Start linking an identity of provider to signed in user", Response: domains.SocialLoginResponse{}, Security: securityToken},
+			handler:     controllers.SocialController.Link,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyActive},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodDelete, Path: fmt.Sprintf(V1Prefix, "me/identities/:provider"), Name: "unlinkIdentity", Tag: tagSocial,
+				Summary: "Unlink identities of provider from signed in user", Status: http.StatusNoContent, Security: securityToken},
+			handler:     controllers.SocialController.Unlink,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyActive},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "passkeys/login/start"), Name: "startPasskeyLogin", Tag: tagPasskeys,
+				Summary: "Start signing in by passkey, options are passed to navigator.credentials.get", Request: domains.PasskeyLoginStartRequest{},
+				Response: domains.PasskeyRequestOptions{}},
+			handler: controllers.PasskeysController.StartLogin,
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "passkeys/login/finish"), Name: "finishPasskeyLogin", Tag: tagPasskeys,
+				Summary: "Sign in by the passkey assertion", Request: domains.PasskeyLoginRequest{}, Response: domains.LoginResponse{}},
+			handler: controllers.PasskeysController.FinishLogin,
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "me/passkeys/register/start"), Name: "startPasskeyRegistration", Tag: tagPasskeys,
+				Summary: "Start registering a passkey, options are passed to navigator.credentials.create", Response: domains.PasskeyCreationOptions{},
+				Security: securityToken},
+			handler:     controllers.PasskeysController.StartRegistration,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyActive},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "me/passkeys/register/finish"), Name: "finishPasskeyRegistration", Tag: tagPasskeys,
+				Summary: "Register the passkey navigator.credentials.create made", Request: domains.PasskeyRegistrationRequest{},
+				Response: domains.Passkey{}, Status: http.StatusCreated, Security: securityToken},
+			handler:     controllers.PasskeysController.FinishRegistration,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyActive},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: fmt.Sprintf(V1Prefix, "me/passkeys"), Name: "passkeys", Tag: tagPasskeys,
+				Summary: "Passkeys of signed in user", Response: []domains.Passkey{}, Security: securityToken},
+			handler:     controllers.PasskeysController.List,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyActive},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodDelete, Path: fmt.Sprintf(V1Prefix, "me/passkeys/:id"), Name: "deletePasskey", Tag: tagPasskeys,
+				Summary: "Delete a passkey of signed in user", Status: http.StatusNoContent, Security: securityToken},
+			handler:     controllers.PasskeysController.Delete,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyActive},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodDelete, Path: fmt.Sprintf(V1Prefix, "me"), Name: "deleteAccount", Tag: tagUsers,
+				Summary: "Delete account of signed in user, logging in before purge_at restores it", Request: domains.DeleteAccountRequest{},
+				Response: domains.DeleteAccountResponse{}, Status: http.StatusAccepted, Security: securityToken},
+			handler:     controllers.UsersController.DeleteAccount,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyActive},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPut, Path: fmt.Sprintf(V1Prefix, "me/password"), Name: "updatePassword", Tag: tagUsers,
+				Summary: "Change password of signed in user by its current password, other sessions are logged out", Request: domains.UpdatePasswordRequest{},
+				Status: http.StatusNoContent, Security: securityToken},
+			handler:     controllers.UsersController.UpdatePassword,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyActive},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "me/phone"), Name: "startPhoneChange", Tag: tagUsers,
+				Summary: "Start changing phone of signed in user, a code is sent to the new phone", Request: domains.ChangePhoneRequest{},
+				Status: http.StatusNoContent, Security: securityToken},
+			handler:     controllers.UsersController.StartPhoneChange,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyActive},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "me/phone/confirm"), Name: "changePhone", Tag: tagUsers,
+				Summary: "Change phone of signed in user by the code sent to it, other sessions are logged out", Request: domains.ConfirmPhoneChangeRequest{},
+				Response: domains.LoginResponse{}, Security: securityToken},
+			handler:     controllers.UsersController.ChangePhone,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyActive},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "me/export"), Name: "requestDataExport", Tag: tagUsers,
+				Summary: "Export personal data of signed in user, the download link is shown only once and works when the export is ready",
+				Request: domains.CreateDataExportRequest{}, Response: domains.CreateDataExportResponse{}, Status: http.StatusAccepted, Security: securityToken},
+			handler:     controllers.ExportsController.Request,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyActive},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: fmt.Sprintf(V1Prefix, "me/exports/:id"), Name: "dataExport", Tag: tagUsers,
+				Summary: "State of an export of signed in user", Response: domains.DataExport{}, Security: securityToken},
+			handler:     controllers.ExportsController.Get,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyActive},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: fmt.Sprintf(V1Prefix, "exports/:id/download"), Name: "downloadDataExport", Tag: tagUsers,
+				Summary: "Download archive of a ready export by the token of its link", Request: domains.DownloadDataExportRequest{}, RequestIn: openapi.InQuery},
+			handler: controllers.ExportsController.Download,
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: fmt.Sprintf(V1Prefix, "me/sessions"), Name: "sessions", Tag: tagSessions,
+				Summary: "Devices signed in user is logged in on", Response: []domains.Session{}, Security: securityToken},
+			handler:     controllers.SessionsController.List,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyActive},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodDelete, Path: fmt.Sprintf(V1Prefix, "me/sessions/:id"), Name: "revokeSession", Tag: tagSessions,
+				Summary: "Log signed in user out of a session", Status: http.StatusNoContent, Security: securityToken},
+			handler:     controllers.SessionsController.Revoke,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyActive},
+		},
+		// admin
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: fmt.Sprintf(V1Prefix, "admin/users"), Name: "getUsers", Tag: tagAdmin,
+				Summary: "List users page by page", Request: domains.GetUsersRequest{}, RequestIn: openapi.InQuery, Response: domains.GetUsersResponse{}, Security: securityToken,
+				AltSecurity: []string{securityAPIKey}},
+			handler:     controllers.UsersController.GetUsers,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdminOrAPIKey(services.ScopeUsersRead)},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: fmt.Sprintf(V1Prefix, "admin/users/search"), Name: "searchUsers", Tag: tagAdmin,
+				Summary: "Search users by name, family, username or phone", Request: domains.SearchUsersRequest{}, RequestIn: openapi.InQuery, Response: []domains.PublicUser{}, Security: securityToken,
+				AltSecurity: []string{securityAPIKey}},
+			handler:     controllers.UsersController.SearchUsers,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdminOrAPIKey(services.ScopeUsersRead)},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "admin/users/:user_id/activate"), Name: "activateUser", Tag: tagAdmin,
+				Summary: "Activate user, activating an active user changes nothing", Request: domains.SetUserStateRequest{}, Response: domains.PublicUser{}, Security: securityToken,
+				AltSecurity: []string{securityAPIKey}, Parameters: []openapi.Parameter{ifMatch}},
+			handler:     controllers.UsersController.Activate,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdminOrAPIKey(services.ScopeUsersWrite)},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "admin/users/:user_id/deactivate"), Name: "deactivateUser", Tag: tagAdmin,
+				Summary: "Deactivate user, deactivating an inactive user changes nothing", Request: domains.SetUserStateRequest{}, Response: domains.PublicUser{}, Security: securityToken,
+				AltSecurity: []string{securityAPIKey}, Parameters: []openapi.Parameter{ifMatch}},
+			handler:     controllers.UsersController.Deactivate,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdminOrAPIKey(services.ScopeUsersWrite)},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "admin/users/:user_id/block"), Name: "blockUser", Tag: tagAdmin,
+				Summary: "Block user until a time or until unblocked, the reason is shown to user at login", Request: domains.BlockUserRequest{}, Response: domains.PublicUser{}, Security: securityToken,
+				AltSecurity: []string{securityAPIKey}, Parameters: []openapi.Parameter{ifMatch}},
+			handler:     controllers.UsersController.Block,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdminOrAPIKey(services.ScopeUsersWrite)},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "admin/users/:user_id/unblock"), Name: "unblockUser", Tag: tagAdmin,
+				Summary: "Unblock user, unblocking a user who is not blocked changes nothing", Request: domains.SetUserStateRequest{}, Response: domains.PublicUser{}, Security: securityToken,
+				AltSecurity: []string{securityAPIKey}, Parameters: []openapi.Parameter{ifMatch}},
+			handler:     controllers.UsersController.Unblock,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdminOrAPIKey(services.ScopeUsersWrite)},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: fmt.Sprintf(V1Prefix, "admin/audit"), Name: "auditLog", Tag: tagAdmin,
+				Summary: "Audit log of security relevant actions, newest first", Request: domains.GetAuditLogRequest{}, RequestIn: openapi.InQuery,
+				Response: domains.GetAuditLogResponse{}, Security: securityToken},
+			handler:     controllers.AuditController.List,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdmin},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "admin/users/:user_id/export"), Name: "requestUserDataExport", Tag: tagAdmin,
+				Summary: "Export personal data of a user, the download link is shown only once and works when the export is ready",
+				Request: domains.CreateDataExportRequest{}, Response: domains.CreateDataExportResponse{}, Status: http.StatusAccepted, Security: securityToken},
+			handler:     controllers.ExportsController.RequestForUser,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdmin},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: fmt.Sprintf(V1Prefix, "admin/exports/:id"), Name: "userDataExport", Tag: tagAdmin,
+				Summary: "State of an export of any user", Response: domains.DataExport{}, Security: securityToken},
+			handler:     controllers.ExportsController.GetForAdmin,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdmin},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: fmt.Sprintf(V1Prefix, "admin/users/:user_id/sessions"), Name: "userSessions", Tag: tagAdmin,
+				Summary: "Sessions of a user", Response: []domains.Session{}, Security: securityToken},
+			handler:     controllers.SessionsController.UserSessions,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdmin},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodDelete, Path: fmt.Sprintf(V1Prefix, "admin/users/:user_id/sessions"), Name: "revokeUserSessions", Tag: tagAdmin,
+				Summary: "Log a user out of every session", Response: domains.RevokeSessionsResponse{}, Security: securityToken},
+			handler:     controllers.SessionsController.RevokeUserSessions,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdmin},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodDelete, Path: fmt.Sprintf(V1Prefix, "admin/users/:user_id/sessions/:id"), Name: "revokeUserSession", Tag: tagAdmin,
+				Summary: "Log a user out of a session", Status: http.StatusNoContent, Security: securityToken},
+			handler:     controllers.SessionsController.RevokeUserSession,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdmin},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "admin/clients"), Name: "createClient", Tag: tagAdmin,
+				Summary: "Register an OAuth client, its secret is shown only once", Request: domains.CreateClientRequest{},
+				Response: domains.CreateClientResponse{}, Status: http.StatusCreated, Security: securityToken},
+			handler:     controllers.ClientsController.Create,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdmin},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "admin/apiKeys"), Name: "createAPIKey", Tag: tagAdmin,
+				Summary: "Create an API key for a machine client, the key is shown only once", Request: domains.CreateAPIKeyRequest{},
+				Response: domains.CreateAPIKeyResponse{}, Status: http.StatusCreated, Security: securityToken},
+			handler:     controllers.APIKeysController.Create,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdmin},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: fmt.Sprintf(V1Prefix, "admin/apiKeys"), Name: "listAPIKeys", Tag: tagAdmin,
+				Summary: "List API keys", Response: []domains.APIKey{}, Security: securityToken},
+			handler:     controllers.APIKeysController.List,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdmin},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodDelete, Path: fmt.Sprintf(V1Prefix, "admin/apiKeys/:id"), Name: "revokeAPIKey", Tag: tagAdmin,
+				Summary: "Revoke an API key", Response: domains.APIKey{}, Security: securityToken},
+			handler:     controllers.APIKeysController.Revoke,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdmin},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "admin/webhooks"), Name: "createWebhook", Tag: tagAdmin,
+				Summary: "Subscribe a URL to user events, the signing secret is shown only once", Request: domains.CreateWebhookRequest{},
+				Response: domains.CreateWebhookResponse{}, Status: http.StatusCreated, Security: securityToken},
+			handler:     controllers.WebhooksController.Create,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdmin},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: fmt.Sprintf(V1Prefix, "admin/webhooks"), Name: "listWebhooks", Tag: tagAdmin,
+				Summary: "List webhooks", Response: []domains.Webhook{}, Security: securityToken},
+			handler:     controllers.WebhooksController.List,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdmin},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodDelete, Path: fmt.Sprintf(V1Prefix, "admin/webhooks/:id"), Name: "deleteWebhook", Tag: tagAdmin,
+				Summary: "Delete a webhook, deliveries waiting for it are dropped", Status: http.StatusNoContent, Security: securityToken},
+			handler:     controllers.WebhooksController.Delete,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdmin},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodGet, Path: fmt.Sprintf(V1Prefix, "admin/webhooks/:id/deliveries"), Name: "webhookDeliveries", Tag: tagAdmin,
+				Summary: "Log of deliveries of a webhook, newest first", Request: domains.GetWebhookDeliveriesRequest{}, RequestIn: openapi.InQuery,
+				Response: domains.GetWebhookDeliveriesResponse{}, Security: securityToken},
+			handler:     controllers.WebhooksController.Deliveries,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdmin},
+		},
+		{
+			Route: openapi.Route{Method: http.MethodPost, Path: fmt.Sprintf(V1Prefix, "admin/webhooks/deliveries/:id/replay"), Name: "replayWebhookDelivery", Tag: tagAdmin,
+				Summary: "Send a delivery again, dead ones included", Response: domains.WebhookDelivery{}, Status: http.StatusAccepted, Security: securityToken},
+			handler:     controllers.WebhooksController.Replay,
+			middlewares: []echo.MiddlewareFunc{middlewares.OnlyAdmin},
+		},
+	}
+}
+
 func urlMapper() {
-	// v1
-	e.POST(fmt.Sprintf(V1Prefix, "register"), controllers.UsersController.Register)
-	e.POST(fmt.Sprintf(V1Prefix, "login"), controllers.UsersController.Login)
-	e.POST(fmt.Sprintf(V1Prefix, "sendCode"), controllers.CodesController.SendCode)
-	e.PUT(fmt.Sprintf(V1Prefix, "changePassword"), controllers.UsersController.ChangePassword)
-	e.PUT(fmt.Sprintf(V1Prefix, "verifyUser"), controllers.UsersController.Verify)
-	e.GET(fmt.Sprintf(V1Prefix, "getUser"), controllers.UsersController.GetUser)
-
-	e.PATCH(fmt.Sprintf(V1Prefix, "updateUser:user_id"), controllers.UsersController.UpdateUser, middlewares.OnlyActive)
-	// admin
-	e.Group(fmt.Sprintf(V1Prefix, "admin"), middlewares.OnlyAdmin)
-	e.GET(fmt.Sprintf(V1Prefix, "admin/users"), controllers.UsersController.GetUsers)
-	e.PATCH(fmt.Sprintf(V1Prefix, "admin/toggleActive:user_id"), controllers.UsersController.UpdateUserActiveState)
-	e.PATCH(fmt.Sprintf(V1Prefix, "admin/toggleBlock:user_id"), controllers.UsersController.UpdateUserBlockState)
+	rs := routes()
+	for _, r := range rs {
+		e.Add(r.Method, r.Path, r.handler, r.middlewares...)
+	}
+	docs(rs)
 }
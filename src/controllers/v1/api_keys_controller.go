@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	APIKeysController apiKeysControllerInterface = &apiKeysController{}
+)
+
+type apiKeysControllerInterface interface {
+	Create(c echo.Context) error
+	List(c echo.Context) error
+	Revoke(c echo.Context) error
+}
+
+type apiKeysController struct{}
+
+// Create makes an api key on behalf of admin signed in by middlewares.OnlyAdmin
+func (*apiKeysController) Create(c echo.Context) error {
+	rq := new(domains.CreateAPIKeyRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.Respond(c, errors.NewValidationError(err))
+	}
+	res, err := services.APIKeyService.Create(actorOf(c), *rq)
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusCreated, res)
+}
+
+func (*apiKeysController) List(c echo.Context) error {
+	keys, err := services.APIKeyService.List()
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, keys)
+}
+
+func (*apiKeysController) Revoke(c echo.Context) error {
+	id, convErr := strconv.ParseUint(c.Param("id"), 10, 64)
+	if convErr != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	key, err := services.APIKeyService.Revoke(uint(id), actorOf(c))
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, key)
+}
@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateAPIKeyUnknownScope(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"reports","scopes":["users:delete"]}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.Echo().Validator = &Validator{validator: newValidator()}
+
+	err := APIKeysController.Create(c)
+	var restErr RestErrStruct
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &restErr))
+	assert.EqualValues(t, http.StatusBadRequest, rec.Code)
+	assert.EqualValues(t, "oneof", restErr.Fields[0].Rule)
+}
+
+func TestRevokeAPIKeyInvalidID(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(httptest.NewRequest(http.MethodDelete, "/", nil), rec)
+	c.SetParamNames("id")
+	c.SetParamValues("abc")
+
+	err := APIKeysController.Revoke(c)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, rec.Code)
+}
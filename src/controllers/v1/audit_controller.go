@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"github.com/alidevjimmy/user_microservice_t/middlewares/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/labstack/echo/v4"
+)
+
+// maxRequestIDLength bounds request ids clients send, longer ones are cut
+const maxRequestIDLength = 64
+
+var (
+	AuditController auditControllerInterface = &auditController{}
+)
+
+type auditControllerInterface interface {
+	List(c echo.Context) error
+}
+
+type auditController struct{}
+
+// actorOf is who makes request c, user or api key put in context by middlewares and where request comes from
+func actorOf(c echo.Context) domains.Actor {
+	actor := domains.Actor{IP: c.RealIP(), RequestID: requestID(c)}
+	if user, ok := c.Get(middlewares.UserKey).(*domains.PublicUser); ok {
+		actor.UserID = user.ID
+	}
+	if key, ok := c.Get(middlewares.APIKeyKey).(*domains.APIKey); ok {
+		actor.APIKeyID = key.ID
+	}
+	return actor
+}
+
+// requestID is id of request given by RequestID middleware, or sent by client if middleware is not used
+func requestID(c echo.Context) string {
+	id := c.Response().Header().Get(echo.HeaderXRequestID)
+	if id == "" {
+		id = c.Request().Header.Get(echo.HeaderXRequestID)
+	}
+	if len(id) > maxRequestIDLength {
+		id = id[:maxRequestIDLength]
+	}
+	return id
+}
+
+// List returns audit log filtered by target user, actor, action and time
+func (*auditController) List(c echo.Context) error {
+	rq := new(domains.GetAuditLogRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.Respond(c, errors.NewValidationError(err))
+	}
+	res, err := services.AuditService.List(*rq)
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/middlewares/v1"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActorOfRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPatch, "/", nil)
+	req.Header.Set(echo.HeaderXRealIP, "10.0.0.1")
+	req.Header.Set(echo.HeaderXRequestID, strings.Repeat("r", 100))
+	c = echo.New().NewContext(req, httptest.NewRecorder())
+	key := &domains.APIKey{}
+	key.ID = 3
+	c.Set(middlewares.APIKeyKey, key)
+
+	actor := actorOf(c)
+	assert.EqualValues(t, 0, actor.UserID)
+	assert.EqualValues(t, 3, actor.APIKeyID)
+	assert.Equal(t, "10.0.0.1", actor.IP)
+	assert.Len(t, actor.RequestID, maxRequestIDLength)
+
+	c.Set(middlewares.UserKey, &domains.PublicUser{ID: 7})
+	assert.EqualValues(t, 7, actorOf(c).UserID)
+}
@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	ClientsController clientsControllerInterface = &clientsController{}
+)
+
+type clientsControllerInterface interface {
+	Create(c echo.Context) error
+}
+
+type clientsController struct{}
+
+// Create registers an OAuth client, only admins reach it
+func (*clientsController) Create(c echo.Context) error {
+	rq := new(domains.CreateClientRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.Respond(c, errors.NewValidationError(err))
+	}
+	res, err := services.ClientService.Create(*rq, actorOf(c))
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusCreated, res)
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"github.com/go-playground/validator/v10"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -33,7 +32,7 @@ func (*CodeServiceMock) Verify(phone string, code, reason int) (bool, rest_error
 
 func TestSendCodeServiceReturnedError(t *testing.T) {
 	sendCodeFunc = func(body domains.SendCodeRequest) rest_errors.RestErr {
-		return rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+		return errors.NewInternalServerError(nil)
 	}
 
 	services.CodeService = &CodeServiceMock{}
@@ -49,7 +48,7 @@ func TestSendCodeServiceReturnedError(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "sendCode"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	err = CodesController.SendCode(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
@@ -70,7 +69,7 @@ func TestSendCodePhoneRequired(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "sendCode"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	err = CodesController.SendCode(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
@@ -91,7 +90,7 @@ func TestSendCodeReasonRequired(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "sendCode"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	err = CodesController.SendCode(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
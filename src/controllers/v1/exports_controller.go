@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"github.com/alidevjimmy/user_microservice_t/middlewares/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	ExportsController exportsControllerInterface = &exportsController{}
+)
+
+type exportsControllerInterface interface {
+	Request(c echo.Context) error
+	Get(c echo.Context) error
+	RequestForUser(c echo.Context) error
+	GetForAdmin(c echo.Context) error
+	Download(c echo.Context) error
+}
+
+type exportsController struct{}
+
+// Request queues an export of data of signed in user
+func (*exportsController) Request(c echo.Context) error {
+	user := c.Get(middlewares.UserKey).(*domains.PublicUser)
+	return requestExport(c, user.ID)
+}
+
+// Get returns state of an export of signed in user
+func (*exportsController) Get(c echo.Context) error {
+	user := c.Get(middlewares.UserKey).(*domains.PublicUser)
+	return getExport(c, user.ID)
+}
+
+// RequestForUser queues an export of data of user of path for an admin
+func (*exportsController) RequestForUser(c echo.Context) error {
+	userID, convErr := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if convErr != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	return requestExport(c, uint(userID))
+}
+
+// GetForAdmin returns state of an export of any user
+func (*exportsController) GetForAdmin(c echo.Context) error {
+	return getExport(c, 0)
+}
+
+// Download sends archive of an export to whoever holds its link
+func (*exportsController) Download(c echo.Context) error {
+	id, convErr := strconv.ParseUint(c.Param("id"), 10, 64)
+	if convErr != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	rq := new(domains.DownloadDataExportRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.Respond(c, errors.NewValidationError(err))
+	}
+	export, err := services.DataExportService.Download(uint(id), rq.Token)
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	contentType := echo.MIMEApplicationJSONCharsetUTF8
+	if export.Format == domains.DataExportZIP {
+		contentType = "application/zip"
+	}
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="data-export-%d.%s"`, export.ID, export.Format))
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.Blob(http.StatusOK, contentType, export.Archive)
+}
+
+// requestExport queues an export of data of userID in format of body
+func requestExport(c echo.Context, userID uint) error {
+	rq := new(domains.CreateDataExportRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.Respond(c, errors.NewValidationError(err))
+	}
+	res, err := services.DataExportService.Request(userID, *rq, actorOf(c))
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusAccepted, res)
+}
+
+// getExport returns export of path if it is of userID, zero userID gets any export
+func getExport(c echo.Context, userID uint) error {
+	id, convErr := strconv.ParseUint(c.Param("id"), 10, 64)
+	if convErr != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	export, err := services.DataExportService.Get(uint(id), userID)
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, export)
+}
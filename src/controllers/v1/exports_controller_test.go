@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/middlewares/v1"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestExportUnknownFormat(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"format":"csv"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	c.Set(middlewares.UserKey, &domains.PublicUser{ID: 3})
+
+	err := ExportsController.Request(c)
+	var restErr RestErrStruct
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &restErr))
+	assert.EqualValues(t, http.StatusBadRequest, rec.Code)
+	assert.EqualValues(t, "oneof", restErr.Fields[0].Rule)
+}
+
+func TestDownloadExportTokenRequired(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	err := ExportsController.Download(c)
+	var restErr RestErrStruct
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &restErr))
+	assert.EqualValues(t, http.StatusBadRequest, rec.Code)
+	assert.EqualValues(t, "token", restErr.Fields[0].Field)
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"github.com/alidevjimmy/user_microservice_t/middlewares/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	OAuthController oauthControllerInterface = &oauthController{}
+)
+
+const (
+	basicRealm      = `Basic realm="user_microservice"`
+	bearerChallenge = `Bearer error="invalid_token"`
+)
+
+type oauthControllerInterface interface {
+	Introspect(c echo.Context) error
+	Authorize(c echo.Context) error
+	Consent(c echo.Context) error
+	Token(c echo.Context) error
+	UserInfo(c echo.Context) error
+	Discovery(c echo.Context) error
+	JWKS(c echo.Context) error
+}
+
+type oauthController struct{}
+
+// Introspect answers RFC 7662 introspection requests of clients authenticated by middlewares.OnlyClient
+func (*oauthController) Introspect(c echo.Context) error {
+	rq := new(domains.IntrospectionRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.Respond(c, errors.NewValidationError(err))
+	}
+	res, err := services.OAuthService.Introspect(rq.Token)
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, res)
+}
+
+// Authorize answers authorization request of user signed in by middlewares.OnlyActive,
+// user agent is sent to RedirectTo by front end or consent is asked first
+func (*oauthController) Authorize(c echo.Context) error {
+	rq := new(domains.AuthorizeRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.Respond(c, errors.NewValidationError(err))
+	}
+	user := c.Get(middlewares.UserKey).(*domains.PublicUser)
+	res, err := services.OAuthService.Authorize(user.ID, *rq)
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// Consent records whether signed in user approves authorization request
+func (*oauthController) Consent(c echo.Context) error {
+	rq := new(domains.ConsentRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.Respond(c, errors.NewValidationError(err))
+	}
+	user := c.Get(middlewares.UserKey).(*domains.PublicUser)
+	res, err := services.OAuthService.Consent(user.ID, *rq)
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// Token is RFC 6749 token endpoint, clients authenticate by http basic auth or form fields
+// and errors are written in RFC 6749 format
+func (*oauthController) Token(c echo.Context) error {
+	rq := new(domains.TokenRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.RespondOAuth(c, errors.NewBadRequestError(errors.InvalidRequest))
+	}
+	if id, secret, ok := c.Request().BasicAuth(); ok {
+		rq.ClientID, rq.ClientSecret = id, secret
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.RespondOAuth(c, errors.NewBadRequestError(errors.InvalidRequest))
+	}
+	res, err := services.OAuthService.Token(*rq)
+	if err != nil {
+		if err.Status() == http.StatusUnauthorized {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, basicRealm)
+		}
+		return errors.RespondOAuth(c, err)
+	}
+	c.Response().Header().Set("Cache-Control", "no-store")
+	c.Response().Header().Set("Pragma", "no-cache")
+	return c.JSON(http.StatusOK, res)
+}
+
+// UserInfo is OpenID Connect userinfo endpoint, token is read from Authorization header
+func (*oauthController) UserInfo(c echo.Context) error {
+	token := middlewares.BearerToken(c)
+	if token == "" {
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, bearerChallenge)
+		return errors.Respond(c, errors.NewUnauthorizedError(errors.InvalidToken))
+	}
+	info, err := services.OAuthService.UserInfo(token)
+	if err != nil {
+		if err.Status() == http.StatusUnauthorized {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, bearerChallenge)
+		}
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, info)
+}
+
+// Discovery serves OpenID Connect discovery document
+func (*oauthController) Discovery(c echo.Context) error {
+	return c.JSON(http.StatusOK, services.OAuthService.Discovery())
+}
+
+// JWKS serves keys id tokens are signed with
+func (*oauthController) JWKS(c echo.Context) error {
+	keys, err := services.OAuthService.JWKS()
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, keys)
+}
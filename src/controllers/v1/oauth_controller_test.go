@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"github.com/alidevjimmy/user_microservice_t/middlewares/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	introspectFunc func(token string) (*domains.IntrospectionResponse, rest_errors.RestErr)
+	authorizeFunc  func(userID uint, req domains.AuthorizeRequest) (*domains.AuthorizeResponse, rest_errors.RestErr)
+	tokenFunc      func(req domains.TokenRequest) (*domains.TokenResponse, rest_errors.RestErr)
+)
+
+type OAuthServiceMock struct{}
+
+func (*OAuthServiceMock) Introspect(token string) (*domains.IntrospectionResponse, rest_errors.RestErr) {
+	return introspectFunc(token)
+}
+
+func (*OAuthServiceMock) Authorize(userID uint, req domains.AuthorizeRequest) (*domains.AuthorizeResponse, rest_errors.RestErr) {
+	return authorizeFunc(userID, req)
+}
+
+func (*OAuthServiceMock) Consent(userID uint, req domains.ConsentRequest) (*domains.AuthorizeResponse, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*OAuthServiceMock) Token(req domains.TokenRequest) (*domains.TokenResponse, rest_errors.RestErr) {
+	return tokenFunc(req)
+}
+
+func (*OAuthServiceMock) UserInfo(token string) (*domains.UserInfo, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*OAuthServiceMock) Discovery() *domains.DiscoveryDocument {
+	return nil
+}
+
+func (*OAuthServiceMock) JWKS() (*domains.JWKS, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func newIntrospectContext(form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.SetPath(fmt.Sprintf(v1prefix, "introspect"))
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	return rec
+}
+
+func TestIntrospectTokenRequired(t *testing.T) {
+	rec := newIntrospectContext(url.Values{"token_type_hint": {"access_token"}})
+	err := OAuthController.Introspect(c)
+	var restErr RestErrStruct
+	assert.Nil(t, err)
+	err = json.Unmarshal(rec.Body.Bytes(), &restErr)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, rec.Code)
+	assert.EqualValues(t, errors.InvalidInputErrorMessage, restErr.Message)
+	assert.EqualValues(t, "token", restErr.Fields[0].Field)
+}
+
+func TestIntrospectServiceReturnedError(t *testing.T) {
+	introspectFunc = func(token string) (*domains.IntrospectionResponse, rest_errors.RestErr) {
+		return nil, errors.NewInternalServerError(nil)
+	}
+	services.OAuthService = &OAuthServiceMock{}
+
+	rec := newIntrospectContext(url.Values{"token": {"some.jwt.token"}})
+	err := OAuthController.Introspect(c)
+	var restErr RestErrStruct
+	assert.Nil(t, err)
+	err = json.Unmarshal(rec.Body.Bytes(), &restErr)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusInternalServerError, rec.Code)
+	assert.EqualValues(t, errors.InternalServerErrorMessage, restErr.Message)
+}
+
+func TestIntrospect(t *testing.T) {
+	active, blocked := true, false
+	introspectFunc = func(token string) (*domains.IntrospectionResponse, rest_errors.RestErr) {
+		assert.Equal(t, "some.jwt.token", token)
+		return &domains.IntrospectionResponse{Active: true, Sub: "1", Exp: 1700000000, UserActive: &active, UserBlocked: &blocked}, nil
+	}
+	services.OAuthService = &OAuthServiceMock{}
+
+	rec := newIntrospectContext(url.Values{"token": {"some.jwt.token"}})
+	err := OAuthController.Introspect(c)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	assert.JSONEq(t, `{"active":true,"sub":"1","exp":1700000000,"user_active":true,"user_blocked":false}`, rec.Body.String())
+}
+
+func newTokenContext(form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.SetBasicAuth("app", "secret")
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.SetPath(fmt.Sprintf(v1prefix, "oauth/token"))
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	return rec
+}
+
+func TestTokenErrorIsOAuthError(t *testing.T) {
+	tokenFunc = func(req domains.TokenRequest) (*domains.TokenResponse, rest_errors.RestErr) {
+		return nil, errors.NewUnauthorizedError(errors.InvalidClient)
+	}
+	services.OAuthService = &OAuthServiceMock{}
+
+	rec := newTokenContext(url.Values{"grant_type": {"client_credentials"}})
+	err := OAuthController.Token(c)
+	var body domains.OAuthErrorResponse
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.EqualValues(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "invalid_client", body.Error)
+	assert.Equal(t, errors.InvalidClientErrorMessage, body.ErrorDescription)
+	assert.NotEmpty(t, rec.Header().Get(echo.HeaderWWWAuthenticate))
+}
+
+func TestTokenGrantTypeRequired(t *testing.T) {
+	rec := newTokenContext(url.Values{})
+	err := OAuthController.Token(c)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, fmt.Sprintf(`{"error":"invalid_request","error_description":%q}`, errors.InvalidRequestErrorMessage), rec.Body.String())
+}
+
+func TestTokenReadsBasicAuth(t *testing.T) {
+	tokenFunc = func(req domains.TokenRequest) (*domains.TokenResponse, rest_errors.RestErr) {
+		assert.Equal(t, "app", req.ClientID)
+		assert.Equal(t, "secret", req.ClientSecret)
+		assert.Equal(t, "the-code", req.Code)
+		return &domains.TokenResponse{AccessToken: "access", TokenType: "Bearer", ExpiresIn: 3600}, nil
+	}
+	services.OAuthService = &OAuthServiceMock{}
+
+	rec := newTokenContext(url.Values{"grant_type": {"authorization_code"}, "code": {"the-code"}})
+	err := OAuthController.Token(c)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	assert.JSONEq(t, `{"access_token":"access","token_type":"Bearer","expires_in":3600}`, rec.Body.String())
+}
+
+func TestAuthorizeUsesSignedInUser(t *testing.T) {
+	authorizeFunc = func(userID uint, req domains.AuthorizeRequest) (*domains.AuthorizeResponse, rest_errors.RestErr) {
+		assert.EqualValues(t, 7, userID)
+		assert.Equal(t, "app", req.ClientID)
+		return &domains.AuthorizeResponse{ConsentRequired: true, ClientName: "App", Scopes: []string{"openid"}}, nil
+	}
+	services.OAuthService = &OAuthServiceMock{}
+
+	q := url.Values{"response_type": {"code"}, "client_id": {"app"}, "redirect_uri": {"https://app.example/cb"}, "scope": {"openid"}}
+	req := httptest.NewRequest(http.MethodGet, "/?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	c.Set(middlewares.UserKey, &domains.PublicUser{ID: 7, Active: true})
+
+	err := OAuthController.Authorize(c)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"consent_required":true,"client_name":"App","scopes":["openid"]}`, rec.Body.String())
+}
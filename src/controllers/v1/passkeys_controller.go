@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"github.com/alidevjimmy/user_microservice_t/middlewares/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	PasskeysController passkeysControllerInterface = &passkeysController{}
+)
+
+type passkeysControllerInterface interface {
+	StartRegistration(c echo.Context) error
+	FinishRegistration(c echo.Context) error
+	StartLogin(c echo.Context) error
+	FinishLogin(c echo.Context) error
+	List(c echo.Context) error
+	Delete(c echo.Context) error
+}
+
+type passkeysController struct{}
+
+// StartRegistration returns options front end passes to navigator.credentials.create
+func (*passkeysController) StartRegistration(c echo.Context) error {
+	user := c.Get(middlewares.UserKey).(*domains.PublicUser)
+	res, err := services.PasskeyService.StartRegistration(user)
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (*passkeysController) FinishRegistration(c echo.Context) error {
+	rq := new(domains.PasskeyRegistrationRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.Respond(c, errors.NewValidationError(err))
+	}
+	user := c.Get(middlewares.UserKey).(*domains.PublicUser)
+	passkey, err := services.PasskeyService.FinishRegistration(user.ID, *rq, actorOf(c))
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusCreated, passkey)
+}
+
+// StartLogin returns options front end passes to navigator.credentials.get
+func (*passkeysController) StartLogin(c echo.Context) error {
+	rq := new(domains.PasskeyLoginStartRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.Respond(c, errors.NewValidationError(err))
+	}
+	res, err := services.PasskeyService.StartLogin(*rq)
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (*passkeysController) FinishLogin(c echo.Context) error {
+	rq := new(domains.PasskeyLoginRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.Respond(c, errors.NewValidationError(err))
+	}
+	res, err := services.PasskeyService.FinishLogin(*rq, deviceOf(c))
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, res)
+}
+
+func (*passkeysController) List(c echo.Context) error {
+	user := c.Get(middlewares.UserKey).(*domains.PublicUser)
+	passkeys, err := services.PasskeyService.List(user.ID)
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, passkeys)
+}
+
+func (*passkeysController) Delete(c echo.Context) error {
+	id, convErr := strconv.ParseUint(c.Param("id"), 10, 64)
+	if convErr != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	user := c.Get(middlewares.UserKey).(*domains.PublicUser)
+	if err := services.PasskeyService.Delete(user.ID, uint(id), actorOf(c)); err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
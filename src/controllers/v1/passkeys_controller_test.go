@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFinishPasskeyLoginSignatureRequired(t *testing.T) {
+	body := `{"id":"abc","response":{"clientDataJSON":"e30","authenticatorData":"AAAA"}}`
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.Echo().Validator = &Validator{validator: newValidator()}
+
+	err := PasskeysController.FinishLogin(c)
+	var restErr RestErrStruct
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &restErr))
+	assert.EqualValues(t, http.StatusBadRequest, rec.Code)
+	assert.EqualValues(t, "signature", restErr.Fields[0].Field)
+	assert.EqualValues(t, "required", restErr.Fields[0].Rule)
+}
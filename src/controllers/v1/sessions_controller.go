@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"github.com/alidevjimmy/user_microservice_t/middlewares/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	SessionsController sessionsControllerInterface = &sessionsController{}
+)
+
+type sessionsControllerInterface interface {
+	List(c echo.Context) error
+	Revoke(c echo.Context) error
+	UserSessions(c echo.Context) error
+	RevokeUserSession(c echo.Context) error
+	RevokeUserSessions(c echo.Context) error
+}
+
+type sessionsController struct{}
+
+// deviceOf is where request logging in comes from
+func deviceOf(c echo.Context) domains.Device {
+	return domains.Device{UserAgent: c.Request().UserAgent(), IP: c.RealIP(), RequestID: requestID(c)}
+}
+
+// List returns sessions of signed in user, the one of this request is marked current
+func (*sessionsController) List(c echo.Context) error {
+	user := c.Get(middlewares.UserKey).(*domains.PublicUser)
+	sessions, err := services.SessionService.List(user.ID, user.SessionID)
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, sessions)
+}
+
+func (*sessionsController) Revoke(c echo.Context) error {
+	id, convErr := strconv.ParseUint(c.Param("id"), 10, 64)
+	if convErr != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	user := c.Get(middlewares.UserKey).(*domains.PublicUser)
+	if err := services.SessionService.Revoke(user.ID, uint(id), actorOf(c)); err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UserSessions lets admins see sessions of any user
+func (*sessionsController) UserSessions(c echo.Context) error {
+	userID, convErr := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if convErr != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	sessions, err := services.SessionService.List(uint(userID), 0)
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, sessions)
+}
+
+func (*sessionsController) RevokeUserSession(c echo.Context) error {
+	userID, convErr := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	id, convErr2 := strconv.ParseUint(c.Param("id"), 10, 64)
+	if convErr != nil || convErr2 != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := services.SessionService.Revoke(uint(userID), uint(id), actorOf(c)); err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RevokeUserSessions logs user out of every device
+func (*sessionsController) RevokeUserSessions(c echo.Context) error {
+	userID, convErr := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if convErr != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	res, err := services.SessionService.RevokeAll(uint(userID), actorOf(c))
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"github.com/alidevjimmy/user_microservice_t/middlewares/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	SocialController socialControllerInterface = &socialController{}
+)
+
+type socialControllerInterface interface {
+	Providers(c echo.Context) error
+	Login(c echo.Context) error
+	Callback(c echo.Context) error
+	Link(c echo.Context) error
+	Identities(c echo.Context) error
+	Unlink(c echo.Context) error
+}
+
+type socialController struct{}
+
+func (*socialController) Providers(c echo.Context) error {
+	return c.JSON(http.StatusOK, domains.SocialProvidersResponse{Providers: services.SocialService.Providers()})
+}
+
+// Login starts sign in with provider, user agent is sent to RedirectTo by front end
+func (*socialController) Login(c echo.Context) error {
+	res, err := services.SocialService.Start(c.Param("provider"), 0)
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// Callback is redirect uri of providers
+func (*socialController) Callback(c echo.Context) error {
+	rq := new(domains.SocialCallbackRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.Respond(c, errors.NewValidationError(err))
+	}
+	res, err := services.SocialService.Callback(c.Param("provider"), *rq, deviceOf(c))
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, res)
+}
+
+// Link starts sign in with provider to link its identity to signed in user
+func (*socialController) Link(c echo.Context) error {
+	user := c.Get(middlewares.UserKey).(*domains.PublicUser)
+	res, err := services.SocialService.Start(c.Param("provider"), user.ID)
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (*socialController) Identities(c echo.Context) error {
+	user := c.Get(middlewares.UserKey).(*domains.PublicUser)
+	identities, err := services.SocialService.Identities(user.ID)
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, identities)
+}
+
+func (*socialController) Unlink(c echo.Context) error {
+	user := c.Get(middlewares.UserKey).(*domains.PublicUser)
+	if err := services.SocialService.Unlink(user.ID, c.Param("provider"), actorOf(c)); err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
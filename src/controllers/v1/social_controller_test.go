@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"github.com/alidevjimmy/user_microservice_t/middlewares/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	socialCallbackFunc func(provider string, req domains.SocialCallbackRequest) (*domains.LoginResponse, rest_errors.RestErr)
+	socialUnlinkFunc   func(userID uint, provider string) rest_errors.RestErr
+)
+
+type SocialServiceMock struct{}
+
+func (*SocialServiceMock) Providers() []string {
+	return nil
+}
+
+func (*SocialServiceMock) Start(provider string, linkUserID uint) (*domains.SocialLoginResponse, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*SocialServiceMock) Callback(provider string, req domains.SocialCallbackRequest, device domains.Device) (*domains.LoginResponse, rest_errors.RestErr) {
+	return socialCallbackFunc(provider, req)
+}
+
+func (*SocialServiceMock) Identities(userID uint) ([]domains.Identity, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*SocialServiceMock) Unlink(userID uint, provider string, actor domains.Actor) rest_errors.RestErr {
+	return socialUnlinkFunc(userID, provider)
+}
+
+func newSocialContext(method, target, provider string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.SetParamNames("provider")
+	c.SetParamValues(provider)
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	return rec
+}
+
+func TestSocialCallbackStateRequired(t *testing.T) {
+	rec := newSocialContext(http.MethodGet, "/?code=abc", "google")
+	err := SocialController.Callback(c)
+	var restErr RestErrStruct
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &restErr))
+	assert.EqualValues(t, http.StatusBadRequest, rec.Code)
+	assert.EqualValues(t, "state", restErr.Fields[0].Field)
+}
+
+func TestSocialCallback(t *testing.T) {
+	socialCallbackFunc = func(provider string, req domains.SocialCallbackRequest) (*domains.LoginResponse, rest_errors.RestErr) {
+		assert.Equal(t, "google", provider)
+		assert.Equal(t, domains.SocialCallbackRequest{Code: "abc", State: "xyz"}, req)
+		return &domains.LoginResponse{Token: "token"}, nil
+	}
+	services.SocialService = &SocialServiceMock{}
+
+	rec := newSocialContext(http.MethodGet, "/?code=abc&state=xyz", "google")
+	err := SocialController.Callback(c)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"token":"token"}`, rec.Body.String())
+}
+
+func TestSocialUnlinkNotLinked(t *testing.T) {
+	socialUnlinkFunc = func(userID uint, provider string) rest_errors.RestErr {
+		assert.EqualValues(t, 3, userID)
+		assert.Equal(t, "google", provider)
+		return errors.NewNotFoundError(errors.IdentityNotFound)
+	}
+	services.SocialService = &SocialServiceMock{}
+
+	rec := newSocialContext(http.MethodDelete, "/", "google")
+	c.Set(middlewares.UserKey, &domains.PublicUser{ID: 3, Active: true})
+	err := SocialController.Unlink(c)
+	var restErr RestErrStruct
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &restErr))
+	assert.EqualValues(t, http.StatusNotFound, rec.Code)
+	assert.EqualValues(t, errors.IdentityNotFoundErrorMessage, restErr.Message)
+}
@@ -1,27 +1,43 @@
 package controllers
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/alidevjimmy/go-rest-utils/rest_errors"
 	"github.com/alidevjimmy/user_microservice_t/domains/v1"
 	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"github.com/alidevjimmy/user_microservice_t/middlewares/v1"
 	"github.com/alidevjimmy/user_microservice_t/services/v1"
 	"github.com/labstack/echo/v4"
 )
 
 var UsersController usersControllerInterface = &usersController{}
 
+const (
+	headerETag    = "ETag"
+	headerIfMatch = "If-Match"
+)
+
 type usersControllerInterface interface {
 	Register(c echo.Context) error
 	Login(c echo.Context) error
 	GetUser(c echo.Context) error
 	GetUsers(c echo.Context) error
-	UpdateUserActiveState(c echo.Context) error
-	UpdateUserBlockState(c echo.Context) error
+	SearchUsers(c echo.Context) error
+	Activate(c echo.Context) error
+	Deactivate(c echo.Context) error
+	Block(c echo.Context) error
+	Unblock(c echo.Context) error
 	UpdateUser(c echo.Context) error
 	ChangePassword(c echo.Context) error
+	UpdatePassword(c echo.Context) error
+	DeleteAccount(c echo.Context) error
 	Verify(c echo.Context) error
+	StartPhoneChange(c echo.Context) error
+	ChangePhone(c echo.Context) error
 }
 
 type usersController struct{}
@@ -29,16 +45,14 @@ type usersController struct{}
 func (*usersController) Register(c echo.Context) error {
 	rq := new(domains.RegisterRequest)
 	if err := c.Bind(rq); err != nil {
-		er := rest_errors.NewBadRequestError(errors.InvalidInputErrorMessage)
-		return c.JSON(http.StatusBadRequest, er)
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
 	}
 	if err := c.Validate(rq); err != nil {
-		er := rest_errors.NewBadRequestError(errors.InvalidInputErrorMessage)
-		return c.JSON(http.StatusBadRequest, er)
+		return errors.Respond(c, errors.NewValidationError(err))
 	}
 	user, err := services.UserService.Register(*rq)
 	if err != nil {
-		return c.JSON(err.Status(), err)
+		return errors.Respond(c, err)
 	}
 	return c.JSON(http.StatusCreated, user)
 }
@@ -46,16 +60,14 @@ func (*usersController) Register(c echo.Context) error {
 func (*usersController) Login(c echo.Context) error {
 	rq := new(domains.LoginRequest)
 	if err := c.Bind(rq); err != nil {
-		er := rest_errors.NewBadRequestError(errors.InvalidInputErrorMessage)
-		return c.JSON(http.StatusBadRequest, er)
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
 	}
 	if err := c.Validate(rq); err != nil {
-		er := rest_errors.NewBadRequestError(errors.InvalidInputErrorMessage)
-		return c.JSON(http.StatusBadRequest, er)
+		return errors.Respond(c, errors.NewValidationError(err))
 	}
-	user, err := services.UserService.Login(*rq)
+	user, err := services.UserService.Login(*rq, deviceOf(c))
 	if err != nil {
-		return c.JSON(err.Status(), err)
+		return errors.Respond(c, err)
 	}
 	return c.JSON(http.StatusOK, user)
 }
@@ -63,120 +75,271 @@ func (*usersController) Login(c echo.Context) error {
 func (*usersController) GetUser(c echo.Context) error {
 	rq := new(domains.GetUserRequest)
 	if err := c.Bind(rq); err != nil {
-		er := rest_errors.NewBadRequestError(errors.InvalidInputErrorMessage)
-		return c.JSON(http.StatusBadRequest, er)
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
 	}
 	if err := c.Validate(rq); err != nil {
-		er := rest_errors.NewBadRequestError(errors.InvalidInputErrorMessage)
-		return c.JSON(http.StatusBadRequest, er)
+		return errors.Respond(c, errors.NewValidationError(err))
 	}
 	user, err := services.UserService.GetUser(rq.Token)
 	if err != nil {
-		return c.JSON(err.Status(), err)
+		return errors.Respond(c, err)
 	}
-	return c.JSON(http.StatusOK, user)
+	return userJSON(c, user)
 }
 
 func (*usersController) GetUsers(c echo.Context) error {
 	rq := new(domains.GetUsersRequest)
 	if err := c.Bind(rq); err != nil {
-		er := rest_errors.NewBadRequestError(errors.InvalidInputErrorMessage)
-		return c.JSON(http.StatusBadRequest, er)
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
 	}
 	if err := c.Validate(rq); err != nil {
-		er := rest_errors.NewBadRequestError(errors.InvalidInputErrorMessage)
-		return c.JSON(http.StatusBadRequest, er)
+		return errors.Respond(c, errors.NewValidationError(err))
 	}
 	user, err := services.UserService.GetUsers(*rq)
 	if err != nil {
-		return c.JSON(err.Status(), err)
+		return errors.Respond(c, err)
 	}
 	return c.JSON(http.StatusOK, user)
 }
 
-func (*usersController) UpdateUserActiveState(c echo.Context) error {
-	rq := new(domains.UpdateActiveUserStateRequest)
+func (*usersController) SearchUsers(c echo.Context) error {
+	rq := new(domains.SearchUsersRequest)
 	if err := c.Bind(rq); err != nil {
-		er := rest_errors.NewBadRequestError(errors.InvalidInputErrorMessage)
-		return c.JSON(http.StatusBadRequest, er)
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
 	}
 	if err := c.Validate(rq); err != nil {
-		er := rest_errors.NewBadRequestError(errors.InvalidInputErrorMessage)
-		return c.JSON(http.StatusBadRequest, er)
+		return errors.Respond(c, errors.NewValidationError(err))
 	}
-	user, err := services.UserService.UpdateUserActiveState(rq.UserID)
+	users, err := services.UserService.SearchUsers(*rq)
 	if err != nil {
-		return c.JSON(err.Status(), err)
+		return errors.Respond(c, err)
 	}
-	return c.JSON(http.StatusOK, user)
+	return c.JSON(http.StatusOK, users)
 }
 
-func (*usersController) UpdateUserBlockState(c echo.Context) error {
-	rq := new(domains.UpdateBlockUserStateRequest)
+func (*usersController) Activate(c echo.Context) error {
+	return setState(c, func(userID uint, versions domains.Versions, reason string) (*domains.PublicUser, rest_errors.RestErr) {
+		return services.UserService.SetActiveState(userID, versions, true, reason, actorOf(c))
+	})
+}
+
+func (*usersController) Deactivate(c echo.Context) error {
+	return setState(c, func(userID uint, versions domains.Versions, reason string) (*domains.PublicUser, rest_errors.RestErr) {
+		return services.UserService.SetActiveState(userID, versions, false, reason, actorOf(c))
+	})
+}
+
+func (*usersController) Unblock(c echo.Context) error {
+	return setState(c, func(userID uint, versions domains.Versions, reason string) (*domains.PublicUser, rest_errors.RestErr) {
+		return services.UserService.Unblock(userID, versions, reason, actorOf(c))
+	})
+}
+
+// Block blocks user for a reason, until a time or until unblocked
+func (*usersController) Block(c echo.Context) error {
+	userID, convErr := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if convErr != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	rq := new(domains.BlockUserRequest)
 	if err := c.Bind(rq); err != nil {
-		er := rest_errors.NewBadRequestError(errors.InvalidInputErrorMessage)
-		return c.JSON(http.StatusBadRequest, er)
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
 	}
 	if err := c.Validate(rq); err != nil {
-		er := rest_errors.NewBadRequestError(errors.InvalidInputErrorMessage)
-		return c.JSON(http.StatusBadRequest, er)
+		return errors.Respond(c, errors.NewValidationError(err))
 	}
-	user, err := services.UserService.UpdateUserBlockState(rq.UserID)
+	versions, err := ifMatchOf(c)
 	if err != nil {
-		return c.JSON(err.Status(), err)
+		return errors.Respond(c, err)
 	}
-	return c.JSON(http.StatusOK, user)
+	user, err := services.UserService.Block(uint(userID), versions, *rq, actorOf(c))
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return userJSON(c, user)
+}
+
+// setState reads user of path, reason of body and versions of If-Match and sets state of user by set
+func setState(c echo.Context, set func(userID uint, versions domains.Versions, reason string) (*domains.PublicUser, rest_errors.RestErr)) error {
+	userID, convErr := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if convErr != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	rq := new(domains.SetUserStateRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.Respond(c, errors.NewValidationError(err))
+	}
+	versions, err := ifMatchOf(c)
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	user, err := set(uint(userID), versions, rq.Reason)
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return userJSON(c, user)
 }
 
 func (*usersController) UpdateUser(c echo.Context) error {
 	rq := new(domains.UpdateUserRequest)
 	if err := c.Bind(rq); err != nil {
-		er := rest_errors.NewBadRequestError(errors.InvalidInputErrorMessage)
-		return c.JSON(http.StatusBadRequest, er)
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
 	}
 	if err := c.Validate(rq); err != nil {
-		er := rest_errors.NewBadRequestError(errors.InvalidInputErrorMessage)
-		return c.JSON(http.StatusBadRequest, er)
+		return errors.Respond(c, errors.NewValidationError(err))
 	}
-	token := c.QueryParam("token")
-	userID := c.Param("user_id")
-	user, err := services.UserService.UpdateUser(userID, token, *rq)
+	versions, err := ifMatchOf(c)
 	if err != nil {
-		return c.JSON(err.Status(), err)
+		return errors.Respond(c, err)
 	}
-	return c.JSON(http.StatusOK, user)
+	caller, _ := c.Get(middlewares.UserKey).(*domains.PublicUser)
+	user, err := services.UserService.UpdateUser(caller, c.Param("user_id"), versions, *rq, actorOf(c))
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return userJSON(c, user)
 }
 
 func (*usersController) ChangePassword(c echo.Context) error {
 	rq := new(domains.ChangePasswordRequest)
 	if err := c.Bind(rq); err != nil {
-		er := rest_errors.NewBadRequestError(errors.InvalidInputErrorMessage)
-		return c.JSON(http.StatusBadRequest, er)
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
 	}
 	if err := c.Validate(rq); err != nil {
-		er := rest_errors.NewBadRequestError(errors.InvalidInputErrorMessage)
-		return c.JSON(http.StatusBadRequest, er)
+		return errors.Respond(c, errors.NewValidationError(err))
 	}
-	user, err := services.UserService.ChangeForgotPassword(*rq)
+	user, err := services.UserService.ChangeForgotPassword(*rq, actorOf(c))
 	if err != nil {
-		return c.JSON(err.Status(), err)
+		return errors.Respond(c, err)
 	}
-	return c.JSON(http.StatusOK, user)
+	return userJSON(c, user)
+}
+
+// UpdatePassword changes password of signed in user, its other sessions are logged out
+func (*usersController) UpdatePassword(c echo.Context) error {
+	rq := new(domains.UpdatePasswordRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.Respond(c, errors.NewValidationError(err))
+	}
+	user := c.Get(middlewares.UserKey).(*domains.PublicUser)
+	if err := services.UserService.UpdatePassword(user, *rq, actorOf(c)); err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DeleteAccount deletes account of signed in user, logging in before purge_at restores it
+func (*usersController) DeleteAccount(c echo.Context) error {
+	rq := new(domains.DeleteAccountRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.Respond(c, errors.NewValidationError(err))
+	}
+	user := c.Get(middlewares.UserKey).(*domains.PublicUser)
+	res, err := services.UserService.DeleteAccount(user, *rq, actorOf(c))
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusAccepted, res)
 }
 
 func (*usersController) Verify(c echo.Context) error {
 	rq := new(domains.VerifyUserRequest)
 	if err := c.Bind(rq); err != nil {
-		er := rest_errors.NewBadRequestError(errors.InvalidInputErrorMessage)
-		return c.JSON(http.StatusBadRequest, er)
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
 	}
 	if err := c.Validate(rq); err != nil {
-		er := rest_errors.NewBadRequestError(errors.InvalidInputErrorMessage)
-		return c.JSON(http.StatusBadRequest, er)
+		return errors.Respond(c, errors.NewValidationError(err))
 	}
-	user, err := services.UserService.VerifyUser(*rq)
+	user, err := services.UserService.VerifyUser(*rq, actorOf(c))
 	if err != nil {
-		return c.JSON(err.Status(), err)
+		return errors.Respond(c, err)
+	}
+	return userJSON(c, user)
+}
+
+// StartPhoneChange sends codes confirming the new phone of signed in user
+func (*usersController) StartPhoneChange(c echo.Context) error {
+	rq := new(domains.ChangePhoneRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.Respond(c, errors.NewValidationError(err))
+	}
+	user := c.Get(middlewares.UserKey).(*domains.PublicUser)
+	if err := services.UserService.StartPhoneChange(user, *rq); err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ChangePhone changes phone of signed in user, its other sessions are logged out and a new token is returned
+func (*usersController) ChangePhone(c echo.Context) error {
+	rq := new(domains.ConfirmPhoneChangeRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.Respond(c, errors.NewValidationError(err))
+	}
+	user := c.Get(middlewares.UserKey).(*domains.PublicUser)
+	res, err := services.UserService.ChangePhone(user, *rq, actorOf(c), deviceOf(c))
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// userJSON responds user with its version as ETag, clients send it back in If-Match of their changes
+func userJSON(c echo.Context, user *domains.PublicUser) error {
+	if user != nil {
+		c.Response().Header().Set(headerETag, fmt.Sprintf(`"%d"`, user.Version))
 	}
 	return c.JSON(http.StatusOK, user)
 }
+
+// ifMatchOf returns versions of user sent in If-Match, nil if it is missing or * so any version is changed.
+// Tags are compared weakly so W/"3" is version 3 as well, tags which are not of a user never match.
+// Headers which are not a list of entity tags are refused with 400
+func ifMatchOf(c echo.Context) (domains.Versions, rest_errors.RestErr) {
+	header := strings.TrimSpace(c.Request().Header.Get(headerIfMatch))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+	var versions domains.Versions
+	// empty elements of lists are allowed, see RFC 9110 section 5.6.1
+	for rest := header; rest != ""; rest = strings.TrimLeft(rest, " \t") {
+		if rest[0] == ',' {
+			rest = rest[1:]
+			continue
+		}
+		tag := strings.TrimPrefix(rest, "W/")
+		if !strings.HasPrefix(tag, `"`) {
+			return nil, errors.NewBadRequestError(errors.InvalidInput)
+		}
+		end := strings.IndexByte(tag[1:], '"') + 1
+		if end == 0 {
+			return nil, errors.NewBadRequestError(errors.InvalidInput)
+		}
+		if version, err := strconv.ParseUint(tag[1:end], 10, 64); err == nil && version != 0 {
+			versions = append(versions, uint(version))
+		}
+		rest = strings.TrimLeft(tag[end+1:], " \t")
+		if rest != "" && rest[0] != ',' {
+			return nil, errors.NewBadRequestError(errors.InvalidInput)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, errors.NewError(errors.UserVersionMismatch, http.StatusPreconditionFailed)
+	}
+	return versions, nil
+}
@@ -7,17 +7,24 @@ import (
 	"github.com/go-playground/validator/v10"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/alidevjimmy/go-rest-utils/rest_errors"
 	"github.com/alidevjimmy/user_microservice_t/domains/v1"
 	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"github.com/alidevjimmy/user_microservice_t/middlewares/v1"
 	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/alidevjimmy/user_microservice_t/validators/v1"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 )
 
 var (
+	// userService is the real service, tests swap services.UserService for mocks
+	userService = services.UserService
+
 	LoginRequest domains.LoginRequest = domains.LoginRequest{
 		PhoneOrUsername: "09122334344",
 		Password:        "password",
@@ -28,14 +35,18 @@ var (
 
 	c echo.Context
 	getUserFunc               func(token string) (*domains.PublicUser, rest_errors.RestErr)
-	getUsersFunc              func(params domains.GetUsersRequest) ([]domains.PublicUser, rest_errors.RestErr)
+	getUsersFunc              func(params domains.GetUsersRequest) (*domains.GetUsersResponse, rest_errors.RestErr)
 	registerFunc              func(body domains.RegisterRequest) (*domains.RegisterResponse, rest_errors.RestErr)
 	loginFunc                 func(body domains.LoginRequest) (*domains.LoginResponse, rest_errors.RestErr)
-	updateUserActiveStateFunc func(userId uint) (*domains.PublicUser, rest_errors.RestErr)
-	updateUserBlockStateFunc  func(userId uint) (*domains.PublicUser, rest_errors.RestErr)
+	searchUsersFunc           func(params domains.SearchUsersRequest) ([]domains.PublicUser, rest_errors.RestErr)
+	setActiveStateFunc        func(userId uint, active bool, reason string) (*domains.PublicUser, rest_errors.RestErr)
+	blockFunc                 func(userId uint, req domains.BlockUserRequest) (*domains.PublicUser, rest_errors.RestErr)
 	changePasswordFunc        func(body domains.ChangePasswordRequest) (*domains.PublicUser, rest_errors.RestErr)
+	updatePasswordFunc        func(user *domains.PublicUser, body domains.UpdatePasswordRequest) rest_errors.RestErr
+	deleteAccountFunc         func(user *domains.PublicUser, body domains.DeleteAccountRequest) (*domains.DeleteAccountResponse, rest_errors.RestErr)
+	changePhoneFunc           func(user *domains.PublicUser, body domains.ConfirmPhoneChangeRequest) (*domains.LoginResponse, rest_errors.RestErr)
 	verifyUserFunc            func(body domains.VerifyUserRequest) (*domains.PublicUser, rest_errors.RestErr)
-	updateUserFunc            func(userId, token string, body domains.UpdateUserRequest) (*domains.PublicUser, rest_errors.RestErr)
+	updateUserFunc            func(caller *domains.PublicUser, userId string, versions domains.Versions, body domains.UpdateUserRequest) (*domains.PublicUser, rest_errors.RestErr)
 )
 
 const (
@@ -49,7 +60,7 @@ func (*UserServiceMock) Register(body domains.RegisterRequest) (*domains.Registe
 	return registerFunc(body)
 }
 
-func (*UserServiceMock) Login(body domains.LoginRequest) (*domains.LoginResponse, rest_errors.RestErr) {
+func (*UserServiceMock) Login(body domains.LoginRequest, device domains.Device) (*domains.LoginResponse, rest_errors.RestErr) {
 	return loginFunc(body)
 }
 
@@ -58,49 +69,103 @@ func (*UserServiceMock) GetUser(token string) (*domains.PublicUser, rest_errors.
 	return getUserFunc(token)
 }
 
+func (*UserServiceMock) GetUserByID(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*UserServiceMock) GetUsersByIDs(ids []uint) ([]domains.PublicUser, rest_errors.RestErr) {
+	return nil, nil
+}
+
 // GetUsers returns all users by filter
-func (*UserServiceMock) GetUsers(params domains.GetUsersRequest) ([]domains.PublicUser, rest_errors.RestErr) {
+func (*UserServiceMock) GetUsers(params domains.GetUsersRequest) (*domains.GetUsersResponse, rest_errors.RestErr) {
 	return getUsersFunc(params)
 }
 
-// UpdateUserActiveState makes state of active field of user opposite
-func (*UserServiceMock) UpdateUserActiveState(userId uint) (*domains.PublicUser, rest_errors.RestErr) {
-	return updateUserActiveStateFunc(userId)
+func (*UserServiceMock) SearchUsers(params domains.SearchUsersRequest) ([]domains.PublicUser, rest_errors.RestErr) {
+	return searchUsersFunc(params)
+}
+
+func (*UserServiceMock) SetActiveState(userId uint, versions domains.Versions, active bool, reason string, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
+	return setActiveStateFunc(userId, active, reason)
+}
+
+func (*UserServiceMock) Block(userId uint, versions domains.Versions, req domains.BlockUserRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
+	return blockFunc(userId, req)
+}
+
+func (*UserServiceMock) Unblock(userId uint, versions domains.Versions, reason string, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*UserServiceMock) LiftExpiredBlocks() (int, rest_errors.RestErr) {
+	return 0, nil
+}
+
+func (*UserServiceMock) DeleteAccount(user *domains.PublicUser, body domains.DeleteAccountRequest, actor domains.Actor) (*domains.DeleteAccountResponse, rest_errors.RestErr) {
+	return deleteAccountFunc(user, body)
 }
 
-// UpdateUserBlockState makes state of blocked field of user opposite
-func (*UserServiceMock) UpdateUserBlockState(userId uint) (*domains.PublicUser, rest_errors.RestErr) {
-	return updateUserBlockStateFunc(userId)
+func (*UserServiceMock) PurgeDeletedAccounts() (int, rest_errors.RestErr) {
+	return 0, nil
 }
 
-func (*UserServiceMock) UpdateUser(userId, token string, body domains.UpdateUserRequest) (*domains.PublicUser, rest_errors.RestErr) {
-	return updateUserFunc(userId,token,body)
+func (*UserServiceMock) UpdateUser(caller *domains.PublicUser, userId string, versions domains.Versions, body domains.UpdateUserRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
+	return updateUserFunc(caller,userId,versions,body)
 }
 
 // ChangeForgotPassword helps people who forgot their password using verification code
-func (*UserServiceMock) ChangeForgotPassword(body domains.ChangePasswordRequest) (*domains.PublicUser, rest_errors.RestErr) {
+func (*UserServiceMock) ChangeForgotPassword(body domains.ChangePasswordRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
 	// return token
 	return changePasswordFunc(body)
 }
 
 // ActiveUser Change user active state to true using verification code
-func (*UserServiceMock) VerifyUser(body domains.VerifyUserRequest) (*domains.PublicUser, rest_errors.RestErr) {
+func (*UserServiceMock) VerifyUser(body domains.VerifyUserRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
 	// return token
 	return verifyUserFunc(body)
 }
 
+func (*UserServiceMock) UpdatePassword(user *domains.PublicUser, body domains.UpdatePasswordRequest, actor domains.Actor) rest_errors.RestErr {
+	return updatePasswordFunc(user, body)
+}
+
+func (*UserServiceMock) StartPhoneChange(user *domains.PublicUser, body domains.ChangePhoneRequest) rest_errors.RestErr {
+	return nil
+}
+
+func (*UserServiceMock) ChangePhone(user *domains.PublicUser, body domains.ConfirmPhoneChangeRequest, actor domains.Actor, device domains.Device) (*domains.LoginResponse, rest_errors.RestErr) {
+	return changePhoneFunc(user, body)
+}
+
 type RestErrStruct struct {
 	Message string `json:"message"`
 	Error   string `json:"error"`
 	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Fields  []struct {
+		Field   string `json:"field"`
+		Rule    string `json:"rule"`
+		Param   string `json:"param"`
+		Message string `json:"message"`
+	} `json:"fields"`
 }
 type Validator struct {
 	validator *validator.Validate
 }
 
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(errors.FieldName)
+	if err := validators.Register(v); err != nil {
+		panic(err)
+	}
+	return v
+}
+
 func (uv *Validator) Validate(i interface{}) error {
 	if err := uv.validator.Struct(i); err != nil {
-		return rest_errors.NewBadRequestError(err.Error())
+		return errors.NewValidationError(err)
 	}
 	return nil
 }
@@ -121,13 +186,46 @@ func TestRegisterPhoneRequired(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "register"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	err = UsersController.Register(c)
+	var restErr RestErrStruct
+	assert.Nil(t, err)
+	err = json.Unmarshal(rec.Body.Bytes(), &restErr)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestRegisterReportsFailedFields(t *testing.T) {
+	body := domains.RegisterRequest{
+		Phone:    "",
+		Username: "bad-name",
+		Name:     "ali",
+		Family:   "hamrani",
+		Age:      uint(20),
+		Password: "password",
+	}
+	j, err := json.Marshal(body)
+	rb := bytes.NewReader(j)
+	req := httptest.NewRequest(http.MethodPost, "/", rb)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	req.Header.Set(errors.HeaderAcceptLanguage, "en")
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.SetPath(fmt.Sprintf(v1prefix, "register"))
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	err = UsersController.Register(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
 	err = json.Unmarshal(rec.Body.Bytes(), &restErr)
 	assert.Nil(t, err)
 	assert.EqualValues(t, http.StatusBadRequest, rec.Code)
+	assert.EqualValues(t, errors.InvalidInput, restErr.Code)
+	assert.Len(t, restErr.Fields, 2)
+	assert.EqualValues(t, "phone", restErr.Fields[0].Field)
+	assert.EqualValues(t, "required", restErr.Fields[0].Rule)
+	assert.EqualValues(t, "This field is required", restErr.Fields[0].Message)
+	assert.EqualValues(t, "username", restErr.Fields[1].Field)
+	assert.EqualValues(t, validators.UsernameTag, restErr.Fields[1].Rule)
 }
 
 func TestRegisterUsernameRequired(t *testing.T) {
@@ -146,7 +244,33 @@ func TestRegisterUsernameRequired(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "register"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	err = UsersController.Register(c)
+	var restErr RestErrStruct
+	assert.Nil(t, err)
+	err = json.Unmarshal(rec.Body.Bytes(), &restErr)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, rec.Code)
+	assert.EqualValues(t, errors.InvalidInputErrorMessage, restErr.Message)
+}
+
+func TestRegisterUsernameInvalid(t *testing.T) {
+	body := domains.RegisterRequest{
+		Phone:    "09122334344",
+		Username: "sdff-dfd",
+		Name:     "ali",
+		Family:   "hamrani",
+		Age:      uint(20),
+		Password: "password",
+	}
+	j, err := json.Marshal(body)
+	rb := bytes.NewReader(j)
+	req := httptest.NewRequest(http.MethodPost, "/", rb)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.SetPath(fmt.Sprintf(v1prefix, "register"))
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	err = UsersController.Register(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
@@ -172,7 +296,7 @@ func TestRegisterNameRequired(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "register"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	err = UsersController.Register(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
@@ -198,7 +322,7 @@ func TestRegisterFamilyRequired(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "register"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	err = UsersController.Register(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
@@ -223,7 +347,7 @@ func TestRegisterAgeRequired(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "register"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	err = UsersController.Register(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
@@ -248,7 +372,7 @@ func TestRegisterPasswordRequired(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "register"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	err = UsersController.Register(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
@@ -271,7 +395,7 @@ func TestRegisterFailToBindReqBody(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "register"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	err = UsersController.Register(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
@@ -283,7 +407,7 @@ func TestRegisterFailToBindReqBody(t *testing.T) {
 
 func TestRegisterServiceReturnedError(t *testing.T) {
 	registerFunc = func(body domains.RegisterRequest) (*domains.RegisterResponse, rest_errors.RestErr) {
-		return nil, rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+		return nil, errors.NewInternalServerError(nil)
 	}
 	services.UserService = &UserServiceMock{}
 
@@ -302,7 +426,7 @@ func TestRegisterServiceReturnedError(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "register"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	err = UsersController.Register(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
@@ -314,7 +438,7 @@ func TestRegisterServiceReturnedError(t *testing.T) {
 
 func TestLoginServiceReturnedError(t *testing.T) {
 	loginFunc = func(body domains.LoginRequest) (*domains.LoginResponse, rest_errors.RestErr) {
-		return nil, rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+		return nil, errors.NewInternalServerError(nil)
 	}
 
 	services.UserService = &UserServiceMock{}
@@ -327,7 +451,7 @@ func TestLoginServiceReturnedError(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "login"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	err = UsersController.Login(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
@@ -350,7 +474,7 @@ func TestLoginFailToBindReqBody(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "login"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	err = UsersController.Login(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
@@ -370,7 +494,7 @@ func TestLoginPasswordRequired(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "login"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	err = UsersController.Login(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
@@ -390,7 +514,7 @@ func TestLoginPhoneOrUsernameRequired(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "login"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	err = UsersController.Login(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
@@ -413,7 +537,7 @@ func TestGetUserFailToBindReqBody(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "getUser"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	err = UsersController.GetUser(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
@@ -425,7 +549,7 @@ func TestGetUserFailToBindReqBody(t *testing.T) {
 
 func TestGetUserServiceReturnedError(t *testing.T) {
 	getUserFunc = func(token string) (*domains.PublicUser, rest_errors.RestErr) {
-		return nil, rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+		return nil, errors.NewInternalServerError(nil)
 	}
 
 	services.UserService = &UserServiceMock{}
@@ -438,7 +562,7 @@ func TestGetUserServiceReturnedError(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "getUser"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	err = UsersController.GetUser(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
@@ -458,7 +582,7 @@ func TestGetUserTokenRequired(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "getUser"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	err = UsersController.GetUser(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
@@ -469,8 +593,8 @@ func TestGetUserTokenRequired(t *testing.T) {
 }
 
 func TestGetUsersServiceReturnedError(t *testing.T) {
-	getUsersFunc = func(param domains.GetUsersRequest) ([]domains.PublicUser, rest_errors.RestErr) {
-		return nil, rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+	getUsersFunc = func(param domains.GetUsersRequest) (*domains.GetUsersResponse, rest_errors.RestErr) {
+		return nil, errors.NewInternalServerError(nil)
 	}
 
 	services.UserService = &UserServiceMock{}
@@ -483,7 +607,7 @@ func TestGetUsersServiceReturnedError(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "admin/users"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	err = UsersController.GetUsers(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
@@ -492,6 +616,61 @@ func TestGetUsersServiceReturnedError(t *testing.T) {
 	assert.EqualValues(t, http.StatusInternalServerError, rec.Code)
 	assert.EqualValues(t, errors.InternalServerErrorMessage, restErr.Message)
 }
+func TestSearchUsersQueryRequired(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/?q=", nil)
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.SetPath(fmt.Sprintf(v1prefix, "admin/users/search"))
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	err := UsersController.SearchUsers(c)
+	var restErr RestErrStruct
+	assert.Nil(t, err)
+	err = json.Unmarshal(rec.Body.Bytes(), &restErr)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, rec.Code)
+	assert.EqualValues(t, errors.InvalidInputErrorMessage, restErr.Message)
+}
+
+func TestSearchUsersQueryRequiredInEnglish(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/?q=", nil)
+	req.Header.Set(errors.HeaderAcceptLanguage, "en-US,en;q=0.9")
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.SetPath(fmt.Sprintf(v1prefix, "admin/users/search"))
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	err := UsersController.SearchUsers(c)
+	var restErr RestErrStruct
+	assert.Nil(t, err)
+	err = json.Unmarshal(rec.Body.Bytes(), &restErr)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, rec.Code)
+	assert.EqualValues(t, "en", rec.Header().Get(errors.HeaderContentLanguage))
+	assert.EqualValues(t, "Input is not valid", restErr.Message)
+	assert.EqualValues(t, errors.InvalidInput, restErr.Code)
+}
+
+func TestSearchUsersServiceReturnedError(t *testing.T) {
+	searchUsersFunc = func(params domains.SearchUsersRequest) ([]domains.PublicUser, rest_errors.RestErr) {
+		assert.Equal(t, "علی", params.Query)
+		return nil, errors.NewInternalServerError(nil)
+	}
+
+	services.UserService = &UserServiceMock{}
+
+	req := httptest.NewRequest(http.MethodGet, "/?q=%D8%B9%D9%84%DB%8C", nil)
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.SetPath(fmt.Sprintf(v1prefix, "admin/users/search"))
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	err := UsersController.SearchUsers(c)
+	var restErr RestErrStruct
+	assert.Nil(t, err)
+	err = json.Unmarshal(rec.Body.Bytes(), &restErr)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusInternalServerError, rec.Code)
+	assert.EqualValues(t, errors.InternalServerErrorMessage, restErr.Message)
+}
+
 //func TestGetUsersFailToBindReqBody(t *testing.T) {
 //	body := struct {
 //		Phone string
@@ -505,7 +684,7 @@ func TestGetUsersServiceReturnedError(t *testing.T) {
 //	rec := httptest.NewRecorder()
 //	c = echo.New().NewContext(req, rec)
 //	c.SetPath(fmt.Sprintf(v1prefix, "admin/users"))
-//	c.Echo().Validator = &Validator{validator: validator.New()}
+//	c.Echo().Validator = &Validator{validator: newValidator()}
 //	err = UsersController.GetUsers(c)
 //	var restErr RestErrStruct
 //	assert.Nil(t, err)
@@ -515,16 +694,16 @@ func TestGetUsersServiceReturnedError(t *testing.T) {
 //	assert.EqualValues(t, errors.InvalidInputErrorMessage, restErr.Message)
 //}
 
-func TestUpdateUserActiveStateFailToBindReqBody(t *testing.T) {
-	req := httptest.NewRequest(http.MethodPost, "/", nil)
+func TestDeactivateUserFailToBindReqBody(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{"))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
-	c.SetPath(fmt.Sprintf(v1prefix, "admin/toggleActive:user_id"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.SetPath(fmt.Sprintf(v1prefix, "admin/users/:user_id/deactivate"))
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	c.SetParamNames("user_id")
 	c.SetParamValues("1")
-	err := UsersController.UpdateUserActiveState(c)
+	err := UsersController.Deactivate(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
 	err = json.Unmarshal(rec.Body.Bytes(), &restErr)
@@ -533,15 +712,18 @@ func TestUpdateUserActiveStateFailToBindReqBody(t *testing.T) {
 	assert.EqualValues(t, errors.InvalidInputErrorMessage, restErr.Message)
 }
 
-func TestUpdateUserActiveStateServiceReturnedError(t *testing.T) {
-	updateUserActiveStateFunc = func(userId uint) (*domains.PublicUser, rest_errors.RestErr) {
-		return nil, rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+func TestDeactivateUserServiceReturnedError(t *testing.T) {
+	setActiveStateFunc = func(userId uint, active bool, reason string) (*domains.PublicUser, rest_errors.RestErr) {
+		assert.EqualValues(t, 1, userId)
+		assert.False(t, active)
+		assert.Equal(t, "left the company", reason)
+		return nil, errors.NewInternalServerError(nil)
 	}
 
 	services.UserService = &UserServiceMock{}
 
-	body := domains.UpdateActiveUserStateRequest{
-		UserID: uint(1),
+	body := domains.SetUserStateRequest{
+		Reason: "left the company",
 	}
 	j, err := json.Marshal(body)
 	rb := bytes.NewReader(j)
@@ -549,9 +731,11 @@ func TestUpdateUserActiveStateServiceReturnedError(t *testing.T) {
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
-	c.SetPath(fmt.Sprintf(v1prefix, "admin/toggleActive:user_id"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
-	err = UsersController.UpdateUserActiveState(c)
+	c.SetPath(fmt.Sprintf(v1prefix, "admin/users/:user_id/deactivate"))
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	c.SetParamNames("user_id")
+	c.SetParamValues("1")
+	err = UsersController.Deactivate(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
 	err = json.Unmarshal(rec.Body.Bytes(), &restErr)
@@ -560,81 +744,75 @@ func TestUpdateUserActiveStateServiceReturnedError(t *testing.T) {
 	assert.EqualValues(t, errors.InternalServerErrorMessage, restErr.Message)
 }
 
-func TestUpdateUserActiveStateUserIdRequired(t *testing.T) {
-	body := domains.UpdateActiveUserStateRequest{}
+func TestActivateUserReasonRequired(t *testing.T) {
+	body := domains.SetUserStateRequest{}
 	j, err := json.Marshal(body)
 	rb := bytes.NewReader(j)
 	req := httptest.NewRequest(http.MethodPost, "/", rb)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
-	c.SetPath(fmt.Sprintf(v1prefix, "admin/toggleActive:user_id"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
-	err = UsersController.UpdateUserActiveState(c)
+	c.SetPath(fmt.Sprintf(v1prefix, "admin/users/:user_id/activate"))
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	c.SetParamNames("user_id")
+	c.SetParamValues("1")
+	err = UsersController.Activate(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
 	err = json.Unmarshal(rec.Body.Bytes(), &restErr)
 	assert.Nil(t, err)
 	assert.EqualValues(t, http.StatusBadRequest, rec.Code)
-	assert.EqualValues(t, errors.InvalidInputErrorMessage, restErr.Message)
+	assert.EqualValues(t, "reason", restErr.Fields[0].Field)
+	assert.EqualValues(t, "required", restErr.Fields[0].Rule)
 }
 
-func TestUpdateUserBlockStateFailToBindReqBody(t *testing.T) {
-	req := httptest.NewRequest(http.MethodPost, "/", nil)
+func TestActivateUserInvalidUserID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"reason":"verified by support"}`))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
-	c.SetPath(fmt.Sprintf(v1prefix, "admin/toggleBlock:user_id"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	c.SetParamNames("user_id")
-	c.SetParamValues("1")
-	err := UsersController.UpdateUserBlockState(c)
-	var restErr RestErrStruct
-	assert.Nil(t, err)
-	err = json.Unmarshal(rec.Body.Bytes(), &restErr)
+	c.SetParamValues("abc")
+	err := UsersController.Activate(c)
 	assert.Nil(t, err)
 	assert.EqualValues(t, http.StatusBadRequest, rec.Code)
-	assert.EqualValues(t, errors.InvalidInputErrorMessage, restErr.Message)
 }
 
-func TestUpdateUserBlockStateServiceReturnedError(t *testing.T) {
-	updateUserBlockStateFunc = func(userId uint) (*domains.PublicUser, rest_errors.RestErr) {
-		return nil, rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+func TestBlockUserUntil(t *testing.T) {
+	var got domains.BlockUserRequest
+	blockFunc = func(userId uint, req domains.BlockUserRequest) (*domains.PublicUser, rest_errors.RestErr) {
+		got = req
+		return &domains.PublicUser{ID: userId, Blocked: true, BlockReason: req.Reason, BlockedUntil: req.Until}, nil
 	}
 
 	services.UserService = &UserServiceMock{}
 
-	body := domains.UpdateBlockUserStateRequest{
-		UserID: uint(1),
-	}
-	j, err := json.Marshal(body)
-	rb := bytes.NewReader(j)
-	req := httptest.NewRequest(http.MethodPost, "/", rb)
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"reason":"spam","until":"2030-01-02T03:04:05Z"}`))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
-	c.SetPath(fmt.Sprintf(v1prefix, "admin/toggleBlock:user_id"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
-	err = UsersController.UpdateUserBlockState(c)
-	var restErr RestErrStruct
-	assert.Nil(t, err)
-	err = json.Unmarshal(rec.Body.Bytes(), &restErr)
+	c.SetPath(fmt.Sprintf(v1prefix, "admin/users/:user_id/block"))
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	c.SetParamNames("user_id")
+	c.SetParamValues("7")
+	err := UsersController.Block(c)
 	assert.Nil(t, err)
-	assert.EqualValues(t, http.StatusInternalServerError, rec.Code)
-	assert.EqualValues(t, errors.InternalServerErrorMessage, restErr.Message)
+	assert.EqualValues(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "spam", got.Reason)
+	assert.True(t, got.Until.Equal(time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)))
 }
 
-func TestUpdateUserBlockStateUserIdRequired(t *testing.T) {
-	body := domains.UpdateBlockUserStateRequest{}
-	j, err := json.Marshal(body)
-	rb := bytes.NewReader(j)
-	req := httptest.NewRequest(http.MethodPost, "/", rb)
+func TestBlockUserReasonRequired(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
-	c.SetPath(fmt.Sprintf(v1prefix, "admin/toggleBlock:user_id"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
-	err = UsersController.UpdateUserBlockState(c)
+	c.SetPath(fmt.Sprintf(v1prefix, "admin/users/:user_id/block"))
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	c.SetParamNames("user_id")
+	c.SetParamValues("7")
+	err := UsersController.Block(c)
 	var restErr RestErrStruct
 	assert.Nil(t, err)
 	err = json.Unmarshal(rec.Body.Bytes(), &restErr)
@@ -644,8 +822,8 @@ func TestUpdateUserBlockStateUserIdRequired(t *testing.T) {
 }
 
 func TestChangePasswordFailToBindReqBody(t *testing.T) {
-	body := domains.UpdateActiveUserStateRequest{
-		UserID: uint(1),
+	body := map[string]uint{
+		"user_id": 1,
 	}
 	j, err := json.Marshal(body)
 	rb := bytes.NewReader(j)
@@ -665,7 +843,7 @@ func TestChangePasswordFailToBindReqBody(t *testing.T) {
 
 func TestChangePasswordServiceReturnedError(t *testing.T) {
 	changePasswordFunc = func(body domains.ChangePasswordRequest) (*domains.PublicUser, rest_errors.RestErr) {
-		return nil, rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+		return nil, errors.NewInternalServerError(nil)
 	}
 
 	services.UserService = &UserServiceMock{}
@@ -691,6 +869,57 @@ func TestChangePasswordServiceReturnedError(t *testing.T) {
 	assert.EqualValues(t, errors.InvalidInputErrorMessage, restErr.Message)
 }
 
+func TestChangePasswordSuccessfully(t *testing.T) {
+	changePasswordFunc = func(body domains.ChangePasswordRequest) (*domains.PublicUser, rest_errors.RestErr) {
+		assert.Equal(t, "new_password1", body.NewPassword)
+		return &domains.PublicUser{ID: 1, Phone: "+989122334344", Active: true}, nil
+	}
+	services.UserService = &UserServiceMock{}
+
+	body := domains.ChangePasswordRequest{
+		NewPassword: "new_password1",
+		Phone:       "09122334344",
+		Code:        23123,
+	}
+	j, err := json.Marshal(body)
+	rb := bytes.NewReader(j)
+	req := httptest.NewRequest(http.MethodPut, "/", rb)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	c.SetPath(fmt.Sprintf(v1prefix, "changePassword"))
+	err = UsersController.ChangePassword(c)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, rec.Code)
+	var user domains.PublicUser
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &user))
+	assert.EqualValues(t, 1, user.ID)
+}
+
+func TestChangePasswordWeakPassword(t *testing.T) {
+	body := domains.ChangePasswordRequest{
+		NewPassword: "12345678",
+		Phone:       "09122334344",
+		Code:        23123,
+	}
+	j, err := json.Marshal(body)
+	rb := bytes.NewReader(j)
+	req := httptest.NewRequest(http.MethodPut, "/", rb)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	c.SetPath(fmt.Sprintf(v1prefix, "changePassword"))
+	err = UsersController.ChangePassword(c)
+	var restErr RestErrStruct
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &restErr))
+	assert.EqualValues(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "new_password", restErr.Fields[0].Field)
+	assert.Equal(t, "password", restErr.Fields[0].Rule)
+}
+
 func TestChangePasswordPhoneRequired(t *testing.T) {
 	body := domains.ChangePasswordRequest{
 		NewPassword: "1234556",
@@ -758,8 +987,8 @@ func TestChangePasswordNewPasswordRequired(t *testing.T) {
 // verify user test
 
 func TestVerifyUserFailToBindReqBody(t *testing.T) {
-	body := domains.UpdateActiveUserStateRequest{
-		UserID: uint(1),
+	body := map[string]uint{
+		"user_id": 1,
 	}
 	j, err := json.Marshal(body)
 	rb := bytes.NewReader(j)
@@ -779,7 +1008,7 @@ func TestVerifyUserFailToBindReqBody(t *testing.T) {
 
 func TestVerifyUserServiceReturnedError(t *testing.T) {
 	verifyUserFunc = func(body domains.VerifyUserRequest) (*domains.PublicUser, rest_errors.RestErr) {
-		return nil, rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+		return nil, errors.NewInternalServerError(nil)
 	}
 
 	services.UserService = &UserServiceMock{}
@@ -845,8 +1074,8 @@ func TestVerifyUserCodeRequired(t *testing.T) {
 }
 
 func TestUpdateUserServiceReturnedError(t *testing.T) {
-	updateUserFunc = func(userId, token string, body domains.UpdateUserRequest) (*domains.PublicUser, rest_errors.RestErr) {
-		return nil, rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+	updateUserFunc = func(caller *domains.PublicUser, userId string, versions domains.Versions, body domains.UpdateUserRequest) (*domains.PublicUser, rest_errors.RestErr) {
+		return nil, errors.NewInternalServerError(nil)
 	}
 
 	services.UserService = &UserServiceMock{}
@@ -861,7 +1090,7 @@ func TestUpdateUserServiceReturnedError(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c = echo.New().NewContext(req, rec)
 	c.SetPath(fmt.Sprintf(v1prefix, "updateUser:user_id"))
-	c.Echo().Validator = &Validator{validator: validator.New()}
+	c.Echo().Validator = &Validator{validator: newValidator()}
 	c.SetParamNames("user_id")
 	c.SetParamValues("1")
 	assert.EqualValues(t, http.MethodPatch, c.Request().Method)
@@ -873,3 +1102,188 @@ func TestUpdateUserServiceReturnedError(t *testing.T) {
 	assert.EqualValues(t, http.StatusInternalServerError, rec.Code)
 	assert.EqualValues(t, errors.InternalServerErrorMessage, restErr.Message)
 }
+
+// updateUserRequest patches user 1 with If-Match set to ifMatch unless it is empty
+func updateUserRequest(ifMatch string) (echo.Context, *httptest.ResponseRecorder) {
+	j, _ := json.Marshal(domains.UpdateUserRequest{Name: "Ali"})
+	req := httptest.NewRequest(http.MethodPatch, "/", bytes.NewReader(j))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetPath(fmt.Sprintf(v1prefix, "updateUser:user_id"))
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	c.SetParamNames("user_id")
+	c.SetParamValues("1")
+	return c, rec
+}
+
+func TestUpdateUserIfMatch(t *testing.T) {
+	var gotVersions domains.Versions
+	updateUserFunc = func(caller *domains.PublicUser, userId string, versions domains.Versions, body domains.UpdateUserRequest) (*domains.PublicUser, rest_errors.RestErr) {
+		gotVersions = versions
+		return &domains.PublicUser{ID: 1, Name: body.Name, Version: 4}, nil
+	}
+	services.UserService = &UserServiceMock{}
+
+	for ifMatch, versions := range map[string]domains.Versions{
+		"":                nil,
+		"*":               nil,
+		`"3"`:             {3},
+		`W/"3"`:           {3},
+		`"3", "4"`:        {3, 4},
+		`"abc",W/"5"`:     {5},
+		` "3" ,	W/"4" `: {3, 4},
+		`"3",, "4",`:      {3, 4},
+	} {
+		c, rec := updateUserRequest(ifMatch)
+		assert.Nil(t, UsersController.UpdateUser(c))
+		assert.EqualValues(t, http.StatusOK, rec.Code)
+		assert.Equal(t, versions, gotVersions, ifMatch)
+		assert.Equal(t, `"4"`, rec.Header().Get("ETag"))
+	}
+}
+
+func TestUpdateUserIfMatchOfNoUser(t *testing.T) {
+	updateUserFunc = func(caller *domains.PublicUser, userId string, versions domains.Versions, body domains.UpdateUserRequest) (*domains.PublicUser, rest_errors.RestErr) {
+		t.Fatal("user is updated despite If-Match of no user")
+		return nil, nil
+	}
+	services.UserService = &UserServiceMock{}
+
+	for _, ifMatch := range []string{`"0"`, `"abc"`, `""`, `"abc", W/"x"`} {
+		c, rec := updateUserRequest(ifMatch)
+		assert.Nil(t, UsersController.UpdateUser(c))
+		var restErr RestErrStruct
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &restErr))
+		assert.EqualValues(t, http.StatusPreconditionFailed, rec.Code, ifMatch)
+		assert.EqualValues(t, errors.UserVersionMismatchErrorMessage, restErr.Message)
+	}
+}
+
+func TestUpdateUserMalformedIfMatch(t *testing.T) {
+	updateUserFunc = func(caller *domains.PublicUser, userId string, versions domains.Versions, body domains.UpdateUserRequest) (*domains.PublicUser, rest_errors.RestErr) {
+		t.Fatal("user is updated despite a malformed If-Match")
+		return nil, nil
+	}
+	services.UserService = &UserServiceMock{}
+
+	for _, ifMatch := range []string{"3", `"3`, `w/"3"`, `"3" "4"`, `"3", *`, `W/`} {
+		c, rec := updateUserRequest(ifMatch)
+		assert.Nil(t, UsersController.UpdateUser(c))
+		var restErr RestErrStruct
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &restErr))
+		assert.EqualValues(t, http.StatusBadRequest, rec.Code, ifMatch)
+		assert.EqualValues(t, errors.InvalidInputErrorMessage, restErr.Message)
+	}
+}
+
+func TestUpdateOtherUserForbidden(t *testing.T) {
+	services.UserService = userService
+	defer func() { services.UserService = &UserServiceMock{} }()
+
+	c, rec := updateUserRequest("")
+	c.Set(middlewares.UserKey, &domains.PublicUser{ID: 2, Active: true})
+	assert.Nil(t, UsersController.UpdateUser(c))
+	var restErr RestErrStruct
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &restErr))
+	assert.EqualValues(t, http.StatusForbidden, rec.Code)
+	assert.EqualValues(t, errors.UserUpdateForbiddenErrorMessage, restErr.Message)
+}
+
+func TestChangePhone(t *testing.T) {
+	changePhoneFunc = func(user *domains.PublicUser, body domains.ConfirmPhoneChangeRequest) (*domains.LoginResponse, rest_errors.RestErr) {
+		assert.EqualValues(t, 3, user.ID)
+		assert.Equal(t, "09121234567", body.Phone)
+		assert.Equal(t, 12345, body.Code)
+		return &domains.LoginResponse{Token: "new token"}, nil
+	}
+	services.UserService = &UserServiceMock{}
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"phone":"09121234567","code":12345}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	c.Set(middlewares.UserKey, &domains.PublicUser{ID: 3, Phone: "+989122334344"})
+	assert.Nil(t, UsersController.ChangePhone(c))
+	assert.EqualValues(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "new token")
+}
+
+func TestChangePhoneCodeRequired(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"phone":"09121234567"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	c.Set(middlewares.UserKey, &domains.PublicUser{ID: 3})
+	assert.Nil(t, UsersController.ChangePhone(c))
+	assert.EqualValues(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestUpdatePassword(t *testing.T) {
+	updatePasswordFunc = func(user *domains.PublicUser, body domains.UpdatePasswordRequest) rest_errors.RestErr {
+		assert.EqualValues(t, 3, user.ID)
+		assert.Equal(t, "old password", body.CurrentPassword)
+		assert.Equal(t, "new password 2", body.NewPassword)
+		return nil
+	}
+	services.UserService = &UserServiceMock{}
+
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"current_password":"old password","new_password":"new password 2"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	c.Set(middlewares.UserKey, &domains.PublicUser{ID: 3})
+	assert.Nil(t, UsersController.UpdatePassword(c))
+	assert.EqualValues(t, http.StatusNoContent, rec.Code)
+}
+
+func TestUpdatePasswordWeakPassword(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"current_password":"old password","new_password":"short"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	c.Set(middlewares.UserKey, &domains.PublicUser{ID: 3})
+	assert.Nil(t, UsersController.UpdatePassword(c))
+	var restErr RestErrStruct
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &restErr))
+	assert.EqualValues(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "new_password", restErr.Fields[0].Field)
+}
+
+func TestDeleteAccount(t *testing.T) {
+	purgeAt := time.Now().Add(720 * time.Hour)
+	deleteAccountFunc = func(user *domains.PublicUser, body domains.DeleteAccountRequest) (*domains.DeleteAccountResponse, rest_errors.RestErr) {
+		assert.EqualValues(t, 3, user.ID)
+		assert.Equal(t, "password1", body.Password)
+		return &domains.DeleteAccountResponse{PurgeAt: purgeAt}, nil
+	}
+	services.UserService = &UserServiceMock{}
+
+	req := httptest.NewRequest(http.MethodDelete, "/", strings.NewReader(`{"password":"password1"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	c.Set(middlewares.UserKey, &domains.PublicUser{ID: 3})
+	assert.Nil(t, UsersController.DeleteAccount(c))
+	assert.EqualValues(t, http.StatusAccepted, rec.Code)
+	assert.Contains(t, rec.Body.String(), "purge_at")
+}
+
+func TestDeleteAccountPasswordRequired(t *testing.T) {
+	req := httptest.NewRequest(http.MethodDelete, "/", strings.NewReader(`{}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	rec := httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.Echo().Validator = &Validator{validator: newValidator()}
+	c.Set(middlewares.UserKey, &domains.PublicUser{ID: 3})
+	assert.Nil(t, UsersController.DeleteAccount(c))
+	assert.EqualValues(t, http.StatusBadRequest, rec.Code)
+}
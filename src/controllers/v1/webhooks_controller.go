@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	WebhooksController webhooksControllerInterface = &webhooksController{}
+)
+
+type webhooksControllerInterface interface {
+	Create(c echo.Context) error
+	List(c echo.Context) error
+	Delete(c echo.Context) error
+	Deliveries(c echo.Context) error
+	Replay(c echo.Context) error
+}
+
+type webhooksController struct{}
+
+func (*webhooksController) Create(c echo.Context) error {
+	rq := new(domains.CreateWebhookRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.Respond(c, errors.NewValidationError(err))
+	}
+	res, err := services.WebhookService.Create(*rq, actorOf(c))
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusCreated, res)
+}
+
+func (*webhooksController) List(c echo.Context) error {
+	webhooks, err := services.WebhookService.List()
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, webhooks)
+}
+
+func (*webhooksController) Delete(c echo.Context) error {
+	id, convErr := strconv.ParseUint(c.Param("id"), 10, 64)
+	if convErr != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := services.WebhookService.Delete(uint(id), actorOf(c)); err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Deliveries returns log of deliveries of webhook, filtered by status
+func (*webhooksController) Deliveries(c echo.Context) error {
+	id, convErr := strconv.ParseUint(c.Param("id"), 10, 64)
+	if convErr != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	rq := new(domains.GetWebhookDeliveriesRequest)
+	if err := c.Bind(rq); err != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	if err := c.Validate(rq); err != nil {
+		return errors.Respond(c, errors.NewValidationError(err))
+	}
+	res, err := services.WebhookService.Deliveries(uint(id), *rq)
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (*webhooksController) Replay(c echo.Context) error {
+	id, convErr := strconv.ParseUint(c.Param("id"), 10, 64)
+	if convErr != nil {
+		return errors.Respond(c, errors.NewBadRequestError(errors.InvalidInput))
+	}
+	delivery, err := services.WebhookService.Replay(uint(id), actorOf(c))
+	if err != nil {
+		return errors.Respond(c, err)
+	}
+	return c.JSON(http.StatusAccepted, delivery)
+}
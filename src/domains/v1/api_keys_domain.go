@@ -0,0 +1,41 @@
+package domains
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type (
+	// APIKey lets a machine call admin endpoints allowed by its scopes, only hash of key is stored
+	APIKey struct {
+		gorm.Model
+		Name string `json:"name" gorm:"column:name"`
+		// Prefix is the public, unique start of key, keys are looked up and recognized by it
+		Prefix  string `json:"prefix" gorm:"column:prefix"`
+		KeyHash string `json:"-" gorm:"column:key_hash"`
+		// Scopes is space separated list of what key may do
+		Scopes     string     `json:"scopes" gorm:"column:scopes"`
+		CreatedBy  uint       `json:"created_by" gorm:"column:created_by"`
+		ExpiresAt  *time.Time `json:"expires_at" gorm:"column:expires_at"`
+		LastUsedAt *time.Time `json:"last_used_at" gorm:"column:last_used_at"`
+		RevokedAt  *time.Time `json:"revoked_at" gorm:"column:revoked_at"`
+	}
+
+	CreateAPIKeyRequest struct {
+		Name   string   `json:"name" validate:"required,max=255"`
+		Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=users:read users:write"`
+		// ExpiresInDays is lifetime of key, zero keys never expire
+		ExpiresInDays uint `json:"expires_in_days" validate:"max=3650"`
+	}
+
+	// CreateAPIKeyResponse carries the key, it is shown only once
+	CreateAPIKeyResponse struct {
+		APIKey APIKey `json:"api_key"`
+		Key    string `json:"key"`
+	}
+)
+
+func (k *APIKey) TableName() string {
+	return "api_keys"
+}
@@ -0,0 +1,103 @@
+package domains
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type (
+	// AuditEntry records a security relevant action, entries are only ever inserted
+	AuditEntry struct {
+		ID        uint      `json:"id" gorm:"primarykey"`
+		CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+		// ActorID is user who acted, nil for anonymous requests like password reset by code
+		ActorID       *uint  `json:"actor_id" gorm:"column:actor_id"`
+		ActorAPIKeyID *uint  `json:"actor_api_key_id,omitempty" gorm:"column:actor_api_key_id"`
+		TargetID      *uint  `json:"target_id" gorm:"column:target_id"`
+		Action        string `json:"action" gorm:"column:action"`
+		// Changes is what the action changed, by field
+		Changes   AuditChanges `json:"changes" gorm:"column:changes;type:jsonb"`
+		IP        string       `json:"ip" gorm:"column:ip"`
+		RequestID string       `json:"request_id" gorm:"column:request_id"`
+	}
+
+	// AuditChanges maps each changed field to its values before and after the action
+	AuditChanges map[string]AuditChange
+
+	// AuditChange is a field before and after an action. Secrets and personal data of users (phone, username,
+	// name, family and age) are logged as changed with no values, audit log outlives users it tells about
+	AuditChange struct {
+		Before interface{} `json:"before"`
+		After  interface{} `json:"after"`
+	}
+
+	// Actor is who makes a request, its audit entries are stamped with it
+	Actor struct {
+		UserID    uint
+		APIKeyID  uint
+		IP        string
+		RequestID string
+	}
+
+	// GetAuditLogRequest filters audit log, zero filters are ignored
+	GetAuditLogRequest struct {
+		// UserID is target of actions
+		UserID  uint       `json:"user_id" query:"user_id"`
+		ActorID uint       `json:"actor_id" query:"actor_id"`
+		Action  string     `json:"action" query:"action" validate:"max=64"`
+		From    *time.Time `json:"from" query:"from"`
+		To      *time.Time `json:"to" query:"to"`
+		Cursor  string     `json:"cursor" query:"cursor"`
+		Limit   int        `json:"limit" query:"limit" validate:"omitempty,min=1,max=100"`
+	}
+
+	GetAuditLogResponse struct {
+		Entries    []AuditEntry `json:"entries"`
+		NextCursor string       `json:"next_cursor,omitempty"`
+	}
+)
+
+func (a *AuditEntry) TableName() string {
+	return "audit_log"
+}
+
+// Audit makes an entry of action actor takes on user targetID
+func (a Actor) Audit(action string, targetID uint, changes AuditChanges) *AuditEntry {
+	entry := &AuditEntry{Action: action, Changes: changes, IP: a.IP, RequestID: a.RequestID}
+	if a.UserID != 0 {
+		actorID := a.UserID
+		entry.ActorID = &actorID
+	}
+	if a.APIKeyID != 0 {
+		apiKeyID := a.APIKeyID
+		entry.ActorAPIKeyID = &apiKeyID
+	}
+	if targetID != 0 {
+		entry.TargetID = &targetID
+	}
+	return entry
+}
+
+// Value stores changes as json
+func (c AuditChanges) Value() (driver.Value, error) {
+	if c == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+func (c *AuditChanges) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	case nil:
+		*c = nil
+		return nil
+	}
+	return fmt.Errorf("audit changes: cannot scan %T", src)
+}
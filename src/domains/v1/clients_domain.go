@@ -0,0 +1,91 @@
+package domains
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type (
+	// Client is a machine registered to talk to this service by client credentials
+	Client struct {
+		gorm.Model
+		ClientID   string `json:"client_id" gorm:"column:client_id"`
+		SecretHash string `json:"-" gorm:"column:secret_hash"`
+		Name       string `json:"name" gorm:"column:name"`
+		// Scopes is space separated list of scopes client may ask for
+		Scopes string `json:"scopes" gorm:"column:scopes"`
+		// RedirectURIs is space separated list of exact uris codes may be sent to
+		RedirectURIs string `json:"redirect_uris" gorm:"column:redirect_uris"`
+		// GrantTypes is space separated list of grant types client may use
+		GrantTypes string `json:"grant_types" gorm:"column:grant_types"`
+		// Public clients have no secret and must use PKCE
+		Public bool `json:"public" gorm:"column:public"`
+	}
+
+	CreateClientRequest struct {
+		Name         string   `json:"name" validate:"required,max=255"`
+		RedirectURIs []string `json:"redirect_uris" validate:"dive,url"`
+		GrantTypes   []string `json:"grant_types" validate:"required,min=1,dive,oneof=authorization_code client_credentials refresh_token"`
+		Scopes       []string `json:"scopes" validate:"dive,oneof=openid profile phone offline_access introspect"`
+		Public       bool     `json:"public"`
+	}
+
+	// CreateClientResponse carries secret of client, it is shown only once
+	CreateClientResponse struct {
+		Client       Client `json:"client"`
+		ClientSecret string `json:"client_secret,omitempty"`
+	}
+
+	// IntrospectionRequest is RFC 7662 introspection request, sent as form or json
+	IntrospectionRequest struct {
+		Token         string `json:"token" form:"token" validate:"required"`
+		TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"`
+	}
+
+	// IntrospectionResponse is RFC 7662 introspection response, inactive tokens only have Active
+	IntrospectionResponse struct {
+		Active      bool   `json:"active"`
+		Sub         string `json:"sub,omitempty"`
+		Exp         int64  `json:"exp,omitempty"`
+		Scope       string `json:"scope,omitempty"`
+		Username    string `json:"username,omitempty"`
+		TokenType   string `json:"token_type,omitempty"`
+		UserActive  *bool  `json:"user_active,omitempty"`
+		UserBlocked *bool  `json:"user_blocked,omitempty"`
+	}
+)
+
+func (c *Client) TableName() string {
+	return "clients"
+}
+
+// HasGrantType reports whether client may use grantType
+func (c *Client) HasGrantType(grantType string) bool {
+	return contains(strings.Fields(c.GrantTypes), grantType)
+}
+
+// HasRedirectURI reports whether uri is exactly one of registered redirect uris of client
+func (c *Client) HasRedirectURI(uri string) bool {
+	return contains(strings.Fields(c.RedirectURIs), uri)
+}
+
+// HasScopes reports whether client may ask for all of scopes
+func (c *Client) HasScopes(scopes []string) bool {
+	allowed := strings.Fields(c.Scopes)
+	for _, s := range scopes {
+		if !contains(allowed, s) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
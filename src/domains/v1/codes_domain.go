@@ -13,11 +13,15 @@ type (
 		Code           int       `json:"code"`
 		CodePurpose    int       `json:"code_purpose"`
 		CodeExpiration time.Time `json:"code_expiration"`
+		// FailedAttempts counts wrong codes tried while this code was the latest of its phone and purpose
+		FailedAttempts int `json:"-" gorm:"column:failed_attempts"`
 	}
 
+	// SendCodeRequest sends a verification (1) or password reset (2) code, phone change codes are sent by
+	// starting a phone change only
 	SendCodeRequest struct {
-		Phone  string `json:"phone" validate:"required"`
-		Reason int    `json:"reason" validate:"required"`
+		Phone  string `json:"phone" validate:"required,max=20"`
+		Reason int    `json:"reason" validate:"required,oneof=1 2"`
 	}
 )
 
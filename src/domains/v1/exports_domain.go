@@ -0,0 +1,84 @@
+package domains
+
+import (
+	"time"
+)
+
+// states of data exports
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	// DataExportFailed is an export which failed every attempt, it has to be requested again
+	DataExportFailed = "failed"
+)
+
+// formats of data export archives
+const (
+	DataExportJSON = "json"
+	DataExportZIP  = "zip"
+)
+
+type (
+	// DataExport is an archive of personal data of a user, it is assembled in background and downloaded by
+	// a link holding its token until ExpiresAt
+	DataExport struct {
+		ID     uint   `json:"id" gorm:"primarykey"`
+		UserID uint   `json:"user_id" gorm:"column:user_id"`
+		Format string `json:"format" gorm:"column:format"`
+		Status string `json:"status" gorm:"column:status"`
+		// RequestedBy is user or admin who asked for the export
+		RequestedBy uint `json:"requested_by" gorm:"column:requested_by"`
+		// TokenHash is sha256 of token of download link, the link is shown only once
+		TokenHash     string     `json:"-" gorm:"column:token_hash"`
+		Archive       []byte     `json:"-" gorm:"column:archive"`
+		Attempts      int        `json:"-" gorm:"column:attempts"`
+		NextAttemptAt time.Time  `json:"-" gorm:"column:next_attempt_at"`
+		LastError     string     `json:"-" gorm:"column:last_error"`
+		CompletedAt   *time.Time `json:"completed_at" gorm:"column:completed_at"`
+		// ExpiresAt is when archive is removed and link stops working, nil until export is ready
+		ExpiresAt *time.Time `json:"expires_at" gorm:"column:expires_at"`
+		CreatedAt time.Time  `json:"created_at" gorm:"column:created_at"`
+		UpdatedAt time.Time  `json:"updated_at" gorm:"column:updated_at"`
+	}
+
+	// DataExportArchive is personal data of a user as exported, zip archives hold each part in a file of its own
+	DataExportArchive struct {
+		ExportedAt   time.Time         `json:"exported_at"`
+		Profile      PublicUser        `json:"profile"`
+		Sessions     []ExportedSession `json:"sessions"`
+		AuditEntries []AuditEntry      `json:"audit_entries"`
+		Codes        []ExportedCode    `json:"codes"`
+	}
+
+	// ExportedSession is a session of the user, revoked and expired ones included
+	ExportedSession struct {
+		Session
+		RevokedAt *time.Time `json:"revoked_at"`
+	}
+
+	// ExportedCode is a code sent to phone of the user, the code itself is left out
+	ExportedCode struct {
+		Purpose   int       `json:"purpose"`
+		SentAt    time.Time `json:"sent_at"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	CreateDataExportRequest struct {
+		// Format of archive, json if empty
+		Format string `json:"format" validate:"omitempty,oneof=json zip"`
+	}
+
+	// CreateDataExportResponse carries the download link of export, it is shown only once
+	CreateDataExportResponse struct {
+		Export      DataExport `json:"export"`
+		DownloadURL string     `json:"download_url"`
+	}
+
+	DownloadDataExportRequest struct {
+		Token string `json:"token" query:"token" validate:"required,max=64"`
+	}
+)
+
+func (d *DataExport) TableName() string {
+	return "data_exports"
+}
@@ -0,0 +1,54 @@
+package domains
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type (
+	// Identity links an account of an external OpenID Connect provider to a user
+	Identity struct {
+		gorm.Model
+		UserID   uint   `json:"-" gorm:"column:user_id"`
+		Provider string `json:"provider" gorm:"column:provider"`
+		// Subject is sub claim of provider, stable id of account there
+		Subject string `json:"subject" gorm:"column:subject"`
+		Email   string `json:"email,omitempty" gorm:"column:email"`
+	}
+
+	// SocialLoginState remembers a sign in started at a provider until it calls back, only hash of state is stored
+	SocialLoginState struct {
+		gorm.Model
+		StateHash    string `gorm:"column:state_hash"`
+		Provider     string `gorm:"column:provider"`
+		Nonce        string `gorm:"column:nonce"`
+		CodeVerifier string `gorm:"column:code_verifier"`
+		// LinkUserID is set when a signed in user links a new identity
+		LinkUserID uint      `gorm:"column:link_user_id"`
+		ExpiresAt  time.Time `gorm:"column:expires_at"`
+	}
+
+	SocialLoginResponse struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+
+	// SocialCallbackRequest is what provider sends back to redirect uri
+	SocialCallbackRequest struct {
+		Code  string `json:"code" query:"code"`
+		State string `json:"state" query:"state" validate:"required"`
+		Error string `json:"error" query:"error"`
+	}
+
+	SocialProvidersResponse struct {
+		Providers []string `json:"providers"`
+	}
+)
+
+func (i *Identity) TableName() string {
+	return "identities"
+}
+
+func (s *SocialLoginState) TableName() string {
+	return "social_login_states"
+}
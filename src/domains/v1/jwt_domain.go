@@ -6,5 +6,11 @@ type (
 	Jwt struct {
 		Sub string
 		Exp time.Time
+		// Scope is space separated list of scopes token was issued for
+		Scope string
+		// ClientID is the client token was issued to, empty for tokens of first party login
+		ClientID string
+		// SessionID is the session of first party login token belongs to, zero for tokens issued before sessions
+		SessionID uint
 	}
 )
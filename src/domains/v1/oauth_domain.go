@@ -0,0 +1,148 @@
+package domains
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type (
+	// AuthorizationCode is a one time code of authorization code flow, only hash of code is stored
+	AuthorizationCode struct {
+		gorm.Model
+		CodeHash            string     `gorm:"column:code_hash"`
+		ClientID            string     `gorm:"column:client_id"`
+		UserID              uint       `gorm:"column:user_id"`
+		RedirectURI         string     `gorm:"column:redirect_uri"`
+		Scope               string     `gorm:"column:scope"`
+		Nonce               string     `gorm:"column:nonce"`
+		CodeChallenge       string     `gorm:"column:code_challenge"`
+		CodeChallengeMethod string     `gorm:"column:code_challenge_method"`
+		AuthTime            time.Time  `gorm:"column:auth_time"`
+		ExpiresAt           time.Time  `gorm:"column:expires_at"`
+		UsedAt              *time.Time `gorm:"column:used_at"`
+	}
+
+	// RefreshToken is rotated on every use, only hash of token is stored
+	RefreshToken struct {
+		gorm.Model
+		TokenHash string     `gorm:"column:token_hash"`
+		ClientID  string     `gorm:"column:client_id"`
+		UserID    uint       `gorm:"column:user_id"`
+		Scope     string     `gorm:"column:scope"`
+		ExpiresAt time.Time  `gorm:"column:expires_at"`
+		RevokedAt *time.Time `gorm:"column:revoked_at"`
+	}
+
+	// Consent remembers scopes user granted to client
+	Consent struct {
+		gorm.Model
+		UserID   uint   `gorm:"column:user_id"`
+		ClientID string `gorm:"column:client_id"`
+		Scope    string `gorm:"column:scope"`
+	}
+
+	AuthorizeRequest struct {
+		ResponseType        string `json:"response_type" query:"response_type" validate:"required"`
+		ClientID            string `json:"client_id" query:"client_id" validate:"required"`
+		RedirectURI         string `json:"redirect_uri" query:"redirect_uri" validate:"required"`
+		Scope               string `json:"scope" query:"scope"`
+		State               string `json:"state" query:"state"`
+		Nonce               string `json:"nonce" query:"nonce"`
+		CodeChallenge       string `json:"code_challenge" query:"code_challenge"`
+		CodeChallengeMethod string `json:"code_challenge_method" query:"code_challenge_method"`
+	}
+
+	ConsentRequest struct {
+		AuthorizeRequest
+		Approve bool `json:"approve"`
+	}
+
+	// AuthorizeResponse either asks user for consent or tells where to send user agent
+	AuthorizeResponse struct {
+		RedirectTo      string   `json:"redirect_to,omitempty"`
+		ConsentRequired bool     `json:"consent_required"`
+		ClientName      string   `json:"client_name,omitempty"`
+		Scopes          []string `json:"scopes,omitempty"`
+	}
+
+	TokenRequest struct {
+		GrantType    string `json:"grant_type" form:"grant_type" validate:"required"`
+		Code         string `json:"code" form:"code"`
+		RedirectURI  string `json:"redirect_uri" form:"redirect_uri"`
+		CodeVerifier string `json:"code_verifier" form:"code_verifier"`
+		RefreshToken string `json:"refresh_token" form:"refresh_token"`
+		Scope        string `json:"scope" form:"scope"`
+		ClientID     string `json:"client_id" form:"client_id"`
+		ClientSecret string `json:"client_secret" form:"client_secret"`
+	}
+
+	TokenResponse struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int64  `json:"expires_in"`
+		RefreshToken string `json:"refresh_token,omitempty"`
+		IDToken      string `json:"id_token,omitempty"`
+		Scope        string `json:"scope,omitempty"`
+	}
+
+	// OAuthErrorResponse is RFC 6749 error body of token endpoint
+	OAuthErrorResponse struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description,omitempty"`
+	}
+
+	// UserInfo holds OpenID Connect standard claims of a user, released by scope
+	UserInfo struct {
+		Sub                 string `json:"sub"`
+		Name                string `json:"name,omitempty"`
+		GivenName           string `json:"given_name,omitempty"`
+		FamilyName          string `json:"family_name,omitempty"`
+		PreferredUsername   string `json:"preferred_username,omitempty"`
+		PhoneNumber         string `json:"phone_number,omitempty"`
+		PhoneNumberVerified *bool  `json:"phone_number_verified,omitempty"`
+	}
+
+	DiscoveryDocument struct {
+		Issuer                            string   `json:"issuer"`
+		AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+		TokenEndpoint                     string   `json:"token_endpoint"`
+		UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+		JwksURI                           string   `json:"jwks_uri"`
+		IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+		ScopesSupported                   []string `json:"scopes_supported"`
+		ResponseTypesSupported            []string `json:"response_types_supported"`
+		GrantTypesSupported               []string `json:"grant_types_supported"`
+		SubjectTypesSupported             []string `json:"subject_types_supported"`
+		IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+		TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+		CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+		ClaimsSupported                   []string `json:"claims_supported"`
+	}
+
+	// JWK is public part of an RSA signing key
+	JWK struct {
+		Kty string `json:"kty"`
+		Use string `json:"use"`
+		Kid string `json:"kid"`
+		Alg string `json:"alg"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	}
+
+	JWKS struct {
+		Keys []JWK `json:"keys"`
+	}
+)
+
+func (c *AuthorizationCode) TableName() string {
+	return "authorization_codes"
+}
+
+func (t *RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+func (c *Consent) TableName() string {
+	return "consents"
+}
@@ -0,0 +1,53 @@
+package domains
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// types of domain events, data of each is the user after the change
+const (
+	EventUserVerified    = "UserVerified"
+	EventUserActivated   = "UserActivated"
+	EventUserDeactivated = "UserDeactivated"
+	EventUserBlocked     = "UserBlocked"
+	EventUserUnblocked   = "UserUnblocked"
+	EventPasswordChanged = "PasswordChanged"
+	EventPhoneChanged    = "PhoneChanged"
+	EventUserDeleted     = "UserDeleted"
+	EventUserRestored    = "UserRestored"
+	// EventUserProfileChanged tells username, name, family or age of user changed
+	EventUserProfileChanged = "UserProfileChanged"
+	// EventUserPurged carries id of user only, personal data of user is gone
+	EventUserPurged = "UserPurged"
+)
+
+type (
+	// OutboxEvent is a domain event written in the transaction of the change it tells about,
+	// outbox relay publishes it to broker after the change commits
+	OutboxEvent struct {
+		ID        uint      `gorm:"primarykey"`
+		Type      string    `gorm:"column:type"`
+		UserID    uint      `gorm:"column:user_id"`
+		Payload   string    `gorm:"column:payload;type:jsonb"`
+		CreatedAt time.Time `gorm:"column:created_at"`
+		// NextAttemptAt is when relay may take event, it is pushed forward while a relay publishes it and after failures
+		NextAttemptAt time.Time  `gorm:"column:next_attempt_at"`
+		PublishedAt   *time.Time `gorm:"column:published_at"`
+		Attempts      int        `gorm:"column:attempts"`
+		LastError     string     `gorm:"column:last_error"`
+	}
+
+	// Event is body of messages published to broker
+	Event struct {
+		ID         uint            `json:"id"`
+		Type       string          `json:"type"`
+		UserID     uint            `json:"user_id"`
+		OccurredAt time.Time       `json:"occurred_at"`
+		Data       json.RawMessage `json:"data"`
+	}
+)
+
+func (e *OutboxEvent) TableName() string {
+	return "outbox"
+}
@@ -0,0 +1,119 @@
+package domains
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type (
+	// Passkey is a WebAuthn credential a user signs in with
+	Passkey struct {
+		gorm.Model
+		UserID uint   `json:"-" gorm:"column:user_id"`
+		Name   string `json:"name" gorm:"column:name"`
+		// CredentialID is base64url encoded id authenticator gave the credential
+		CredentialID string `json:"credential_id" gorm:"column:credential_id"`
+		// PublicKey is COSE encoded
+		PublicKey []byte `json:"-" gorm:"column:public_key"`
+		// SignCount is the last counter authenticator sent, a counter not increasing means a cloned authenticator
+		SignCount      uint32     `json:"-" gorm:"column:sign_count"`
+		BackupEligible bool       `json:"backup_eligible" gorm:"column:backup_eligible"`
+		LastUsedAt     *time.Time `json:"last_used_at" gorm:"column:last_used_at"`
+	}
+
+	// PasskeyChallenge remembers a started ceremony until its response arrives, only hash of challenge is stored
+	PasskeyChallenge struct {
+		gorm.Model
+		ChallengeHash string `gorm:"column:challenge_hash"`
+		Ceremony      string `gorm:"column:ceremony"`
+		// UserID is the user registering a passkey or signing in, zero when user is not known yet
+		UserID    uint      `gorm:"column:user_id"`
+		ExpiresAt time.Time `gorm:"column:expires_at"`
+	}
+
+	// PasskeyCreationOptions are passed to navigator.credentials.create, binary fields are base64url encoded
+	PasskeyCreationOptions struct {
+		Challenge              string                        `json:"challenge"`
+		RP                     PasskeyRelyingParty           `json:"rp"`
+		User                   PasskeyUser                   `json:"user"`
+		PubKeyCredParams       []PasskeyCredentialParameter  `json:"pubKeyCredParams"`
+		Timeout                int64                         `json:"timeout"`
+		ExcludeCredentials     []PasskeyCredentialDescriptor `json:"excludeCredentials"`
+		AuthenticatorSelection PasskeyAuthenticatorSelection `json:"authenticatorSelection"`
+		Attestation            string                        `json:"attestation"`
+	}
+
+	// PasskeyRequestOptions are passed to navigator.credentials.get, binary fields are base64url encoded
+	PasskeyRequestOptions struct {
+		Challenge        string                        `json:"challenge"`
+		RPID             string                        `json:"rpId"`
+		Timeout          int64                         `json:"timeout"`
+		AllowCredentials []PasskeyCredentialDescriptor `json:"allowCredentials"`
+		UserVerification string                        `json:"userVerification"`
+	}
+
+	PasskeyRelyingParty struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+
+	PasskeyUser struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	}
+
+	PasskeyCredentialParameter struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	}
+
+	PasskeyCredentialDescriptor struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	}
+
+	PasskeyAuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	}
+
+	// PasskeyRegistrationRequest is the credential navigator.credentials.create returned, as its toJSON encodes it
+	PasskeyRegistrationRequest struct {
+		Name     string                     `json:"name" validate:"max=64"`
+		ID       string                     `json:"id" validate:"required,max=1400"`
+		Response PasskeyAttestationResponse `json:"response"`
+	}
+
+	PasskeyAttestationResponse struct {
+		ClientDataJSON    string `json:"clientDataJSON" validate:"required"`
+		AttestationObject string `json:"attestationObject" validate:"required"`
+	}
+
+	// PasskeyLoginStartRequest names the user signing in, without it any discoverable passkey is accepted
+	PasskeyLoginStartRequest struct {
+		PhoneOrUsername string `json:"phoneOrUsername" validate:"max=50"`
+	}
+
+	// PasskeyLoginRequest is the credential navigator.credentials.get returned, as its toJSON encodes it
+	PasskeyLoginRequest struct {
+		ID       string                   `json:"id" validate:"required,max=1400"`
+		Response PasskeyAssertionResponse `json:"response"`
+	}
+
+	PasskeyAssertionResponse struct {
+		ClientDataJSON    string `json:"clientDataJSON" validate:"required"`
+		AuthenticatorData string `json:"authenticatorData" validate:"required"`
+		Signature         string `json:"signature" validate:"required"`
+		UserHandle        string `json:"userHandle"`
+	}
+)
+
+func (p *Passkey) TableName() string {
+	return "passkeys"
+}
+
+func (p *PasskeyChallenge) TableName() string {
+	return "passkey_challenges"
+}
@@ -0,0 +1,39 @@
+package domains
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type (
+	// Session is a login of a user on a device, tokens of the login carry its id as sid claim
+	Session struct {
+		gorm.Model
+		UserID    uint   `json:"-" gorm:"column:user_id"`
+		UserAgent string `json:"user_agent" gorm:"column:user_agent"`
+		// Device is a readable summary of UserAgent, e.g. "Chrome on Android"
+		Device     string     `json:"device" gorm:"column:device"`
+		IP         string     `json:"ip" gorm:"column:ip"`
+		LastSeenAt time.Time  `json:"last_seen_at" gorm:"column:last_seen_at"`
+		ExpiresAt  time.Time  `json:"expires_at" gorm:"column:expires_at"`
+		RevokedAt  *time.Time `json:"-" gorm:"column:revoked_at"`
+		// Current marks the session of the request listing sessions
+		Current bool `json:"current" gorm:"-"`
+	}
+
+	// Device is where a login comes from
+	Device struct {
+		UserAgent string
+		IP        string
+		RequestID string
+	}
+
+	RevokeSessionsResponse struct {
+		Revoked int64 `json:"revoked"`
+	}
+)
+
+func (s *Session) TableName() string {
+	return "sessions"
+}
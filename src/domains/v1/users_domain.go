@@ -1,9 +1,20 @@
 package domains
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
+// states of accounts, see PublicUser.Status
+const (
+	AccountActive      = "active"
+	AccountUnverified  = "unverified"
+	AccountDeactivated = "deactivated"
+	AccountBlocked     = "blocked"
+	AccountLocked      = "locked"
+)
+
 type (
 	User struct {
 		gorm.Model
@@ -14,25 +25,45 @@ type (
 		Age      uint   `json:"age" gorm:"column:age"`
 		Active   bool   `json:"active" gorm:"column:active"`
 		Blocked  bool   `json:"blocked" gorm:"column:blocked"`
-		Password bool   `gorm:"column:password"`
-		IsAdmin  bool   `json:"is_admin" gorm:"column:is_admin"`
+		// BlockReason is told to user when login is refused
+		BlockReason string `json:"block_reason" gorm:"column:block_reason"`
+		// BlockedUntil is when block is lifted, nil keeps user blocked until unblocked
+		BlockedUntil *time.Time `json:"blocked_until" gorm:"column:blocked_until"`
+		// DeactivatedAt tells inactive users deactivated by admins from those not verified yet
+		DeactivatedAt *time.Time `json:"deactivated_at" gorm:"column:deactivated_at"`
+		// FailedLogins counts wrong passwords since the last login or lock, see LockedUntil
+		FailedLogins int        `json:"-" gorm:"column:failed_logins"`
+		LockedUntil  *time.Time `json:"locked_until" gorm:"column:locked_until"`
+		Password     string     `json:"-" gorm:"column:password"`
+		IsAdmin      bool       `json:"is_admin" gorm:"column:is_admin"`
+		// Version is bumped by every change of user, updates sent with a stale version are refused
+		Version uint `json:"version" gorm:"column:version;default:1"`
 	}
 
 	PublicUser struct {
-		ID       uint   `json:"id"`
-		Phone    string `json:"phone"`
-		Username string `json:"username"`
-		Name     string `json:"name"`
-		Family   string `json:"family"`
-		Age      uint   `json:"age"`
-		Active   bool   `json:"active"`
-		Blocked  bool   `json:"blocked"`
-		IsAdmin  bool   `json:"is_admin"`
+		ID            uint       `json:"id"`
+		Phone         string     `json:"phone"`
+		Username      string     `json:"username"`
+		Name          string     `json:"name"`
+		Family        string     `json:"family"`
+		Age           uint       `json:"age"`
+		Active        bool       `json:"active"`
+		Blocked       bool       `json:"blocked"`
+		BlockReason   string     `json:"block_reason,omitempty"`
+		BlockedUntil  *time.Time `json:"blocked_until,omitempty"`
+		DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
+		LockedUntil   *time.Time `json:"locked_until,omitempty"`
+		IsAdmin       bool       `json:"is_admin"`
+		CreatedAt     time.Time  `json:"created_at"`
+		// Version is sent as ETag, see User.Version
+		Version uint `json:"version"`
+		// SessionID is the session of token user was read by, see UserService.GetUser
+		SessionID uint `json:"-" gorm:"-"`
 	}
 
 	RegisterRequest struct {
-		Phone    string `json:"phone" validate:"required"`
-		Username string `json:"username" validate:"required"`
+		Phone    string `json:"phone" validate:"required,max=20"`
+		Username string `json:"username" validate:"required,username"`
 		Name     string `json:"name" validate:"required"`
 		Family   string `json:"family" validate:"required"`
 		Age      uint   `json:"age" validate:"required"`
@@ -53,38 +84,99 @@ type (
 	}
 
 	UpdateUserRequest struct {
-		Username string `json:"username"`
+		Username string `json:"username" validate:"omitempty,username"`
 		Name     string `json:"name"`
 		Family   string `json:"family"`
 		Age      uint   `json:"age"`
-		Password string `json:"password"`
+	}
+
+	// UpdatePasswordRequest changes password of signed in user, NewPassword must follow the password policy
+	UpdatePasswordRequest struct {
+		CurrentPassword string `json:"current_password" validate:"required,max=300"`
+		NewPassword     string `json:"new_password" validate:"required,password"`
+	}
+
+	// DeleteAccountRequest deletes account of signed in user, Password is its current password
+	DeleteAccountRequest struct {
+		Password string `json:"password" validate:"required,max=300"`
+	}
+
+	// DeleteAccountResponse tells until when logging in restores the deleted account
+	DeleteAccountResponse struct {
+		PurgeAt time.Time `json:"purge_at"`
 	}
 
 	GetUserRequest struct {
 		Token string `json:"token" validate:"required"`
 	}
 
+	// GetUsersRequest filters, sorts and pages the admin user list. nil filters are ignored.
 	GetUsersRequest struct {
-		Active  bool `json:"active"`
-		Blocked bool `json:"blocked"`
+		Active      *bool      `json:"active" query:"active"`
+		Blocked     *bool      `json:"blocked" query:"blocked"`
+		IsAdmin     *bool      `json:"is_admin" query:"is_admin"`
+		CreatedFrom *time.Time `json:"created_from" query:"created_from"`
+		CreatedTo   *time.Time `json:"created_to" query:"created_to"`
+		Search      string     `json:"search" query:"search" validate:"max=100"`
+		SearchMode  string     `json:"search_mode" query:"search_mode" validate:"omitempty,oneof=prefix fuzzy"`
+		Sort        string     `json:"sort" query:"sort" validate:"omitempty,oneof=id created_at username name family age"`
+		Order       string     `json:"order" query:"order" validate:"omitempty,oneof=asc desc"`
+		Cursor      string     `json:"cursor" query:"cursor"`
+		Limit       int        `json:"limit" query:"limit" validate:"omitempty,min=1,max=100"`
+	}
+
+	GetUsersResponse struct {
+		Users      []PublicUser `json:"users"`
+		Total      int64        `json:"total"`
+		NextCursor string       `json:"next_cursor,omitempty"`
+	}
+
+	SearchUsersRequest struct {
+		Query string `json:"q" query:"q" validate:"required,max=100"`
+		Limit int    `json:"limit" query:"limit" validate:"omitempty,min=1,max=100"`
 	}
 
-	UpdateActiveUserStateRequest struct {
-		UserID uint `json:"user_id" validate:"required"`
+	// UsersCursor points at the last user of a page, by its sort value and id. It is valid for the
+	// sort and order it was made in only, Value is a time.Time, uint or string like the sorted column
+	UsersCursor struct {
+		Sort  string      `json:"s"`
+		Order string      `json:"o"`
+		Value interface{} `json:"v"`
+		ID    uint        `json:"id"`
 	}
 
-	UpdateBlockUserStateRequest struct {
-		UserID uint `json:"user_id" validate:"required"`
+	// SetUserStateRequest activates, deactivates or unblocks user, reason is kept in audit log
+	SetUserStateRequest struct {
+		Reason string `json:"reason" validate:"required,max=500"`
+	}
+
+	// BlockUserRequest blocks user until Until, or until unblocked if it is nil. Reason is told to user at login
+	BlockUserRequest struct {
+		Reason string     `json:"reason" validate:"required,max=500"`
+		Until  *time.Time `json:"until"`
 	}
 
 	ChangePasswordRequest struct {
-		Phone       string `json:"phone" validate:"required,max=12"`
+		Phone       string `json:"phone" validate:"required,max=20"`
 		Code        int    `json:"code"  validate:"required"`
-		NewPassword string `json:"new_password"  validate:"required, max=12"`
+		NewPassword string `json:"new_password" validate:"required,password"`
+	}
+
+	// ChangePhoneRequest starts changing phone of signed in user to Phone, a code is sent to it
+	ChangePhoneRequest struct {
+		Phone string `json:"phone" validate:"required,max=20"`
+	}
+
+	// ConfirmPhoneChangeRequest changes phone to Phone by Code sent to it. OldCode is the one sent to
+	// the current phone, it is required only when changes are confirmed on the old number too
+	ConfirmPhoneChangeRequest struct {
+		Phone   string `json:"phone" validate:"required,max=20"`
+		Code    int    `json:"code" validate:"required"`
+		OldCode int    `json:"old_code"`
 	}
 
 	VerifyUserRequest struct {
-		Phone string `json:"phone" validate:"required,max=12"`
+		Phone string `json:"phone" validate:"required,max=20"`
 		Code  int    `json:"code"  validate:"required"`
 	}
 )
@@ -92,3 +184,56 @@ type (
 func (u *User) TableName() string {
 	return "users"
 }
+
+// Public strips private fields of user
+func (u *User) Public() PublicUser {
+	return PublicUser{
+		ID:            u.ID,
+		Phone:         u.Phone,
+		Username:      u.Username,
+		Name:          u.Name,
+		Family:        u.Family,
+		Age:           u.Age,
+		Active:        u.Active,
+		Blocked:       u.Blocked,
+		BlockReason:   u.BlockReason,
+		BlockedUntil:  u.BlockedUntil,
+		DeactivatedAt: u.DeactivatedAt,
+		LockedUntil:   u.LockedUntil,
+		IsAdmin:       u.IsAdmin,
+		CreatedAt:     u.CreatedAt,
+		Version:       u.Version,
+	}
+}
+
+// Status is state of account of user at, the most restrictive state wins.
+// Blocks and locks past their expiry do not count even if they are not lifted yet
+func (u *PublicUser) Status(at time.Time) string {
+	switch {
+	case u.Blocked && (u.BlockedUntil == nil || u.BlockedUntil.After(at)):
+		return AccountBlocked
+	case !u.Active && u.DeactivatedAt != nil:
+		return AccountDeactivated
+	case !u.Active:
+		return AccountUnverified
+	case u.LockedUntil != nil && u.LockedUntil.After(at):
+		return AccountLocked
+	}
+	return AccountActive
+}
+
+// Versions are versions of user a change is made against, as sent in If-Match. Empty lets any version change
+type Versions []uint
+
+// Allow reports whether user at version may be changed
+func (v Versions) Allow(version uint) bool {
+	if len(v) == 0 {
+		return true
+	}
+	for _, allowed := range v {
+		if allowed == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package domains
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// states of webhook deliveries
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	// WebhookDeliveryDead is a delivery which failed every attempt, it is sent again only if replayed
+	WebhookDeliveryDead = "dead"
+)
+
+type (
+	// Webhook posts domain events to URL of a partner, payloads are signed by Secret
+	Webhook struct {
+		gorm.Model
+		URL         string `json:"url" gorm:"column:url"`
+		Description string `json:"description" gorm:"column:description"`
+		// Events is space separated types of events sent, empty sends every event
+		Events string `json:"events" gorm:"column:events"`
+		// Secret signs payloads so it is kept as is, it is shown only once
+		Secret    string `json:"-" gorm:"column:secret"`
+		CreatedBy uint   `json:"created_by" gorm:"column:created_by"`
+	}
+
+	// WebhookDelivery is an event to be sent or sent to a webhook, it logs the last attempt
+	WebhookDelivery struct {
+		ID        uint   `json:"id" gorm:"primarykey"`
+		WebhookID uint   `json:"webhook_id" gorm:"column:webhook_id"`
+		EventID   uint   `json:"event_id" gorm:"column:event_id"`
+		EventType string `json:"event_type" gorm:"column:event_type"`
+		// Payload is the json body posted, see Event
+		Payload        string     `json:"-" gorm:"column:payload;type:jsonb"`
+		Status         string     `json:"status" gorm:"column:status"`
+		Attempts       int        `json:"attempts" gorm:"column:attempts"`
+		NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"column:next_attempt_at"`
+		LastStatusCode int        `json:"last_status_code" gorm:"column:last_status_code"`
+		LastError      string     `json:"last_error" gorm:"column:last_error"`
+		DeliveredAt    *time.Time `json:"delivered_at" gorm:"column:delivered_at"`
+		CreatedAt      time.Time  `json:"created_at" gorm:"column:created_at"`
+		UpdatedAt      time.Time  `json:"updated_at" gorm:"column:updated_at"`
+	}
+
+	CreateWebhookRequest struct {
+		URL         string   `json:"url" validate:"required,url,max=2048"`
+		Description string   `json:"description" validate:"max=255"`
+		Events      []string `json:"events" validate:"dive,oneof=UserVerified UserActivated UserDeactivated UserBlocked UserUnblocked PasswordChanged PhoneChanged UserDeleted UserRestored UserPurged UserProfileChanged"`
+	}
+
+	// CreateWebhookResponse carries secret of webhook, it is shown only once
+	CreateWebhookResponse struct {
+		Webhook Webhook `json:"webhook"`
+		Secret  string  `json:"secret"`
+	}
+
+	GetWebhookDeliveriesRequest struct {
+		Status string `json:"status" query:"status" validate:"omitempty,oneof=pending succeeded dead"`
+		Cursor string `json:"cursor" query:"cursor"`
+		Limit  int    `json:"limit" query:"limit" validate:"omitempty,min=1,max=100"`
+	}
+
+	GetWebhookDeliveriesResponse struct {
+		Deliveries []WebhookDelivery `json:"deliveries"`
+		NextCursor string            `json:"next_cursor,omitempty"`
+	}
+)
+
+func (w *Webhook) TableName() string {
+	return "webhooks"
+}
+
+func (d *WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
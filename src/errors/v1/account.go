@@ -0,0 +1,55 @@
+package errors
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+)
+
+// AccountError refuses a user by state of its account, it tells the user why and until when
+type AccountError struct {
+	code   Code
+	status int
+	Reason string
+	// Until is when account is usable again, nil if it is not known
+	Until *time.Time
+}
+
+// NewAccountBlockedError refuses a blocked user, reason is the one given by admin
+func NewAccountBlockedError(reason string, until *time.Time) rest_errors.RestErr {
+	return &AccountError{code: AccountBlocked, status: http.StatusForbidden, Reason: reason, Until: until}
+}
+
+// NewAccountUnverifiedError refuses a user who did not verify its phone yet
+func NewAccountUnverifiedError() rest_errors.RestErr {
+	return &AccountError{code: AccountUnverified, status: http.StatusForbidden}
+}
+
+// NewAccountDeactivatedError refuses a user deactivated by admins
+func NewAccountDeactivatedError() rest_errors.RestErr {
+	return &AccountError{code: AccountDeactivated, status: http.StatusForbidden}
+}
+
+// NewAccountLockedError refuses password of a user locked by failed logins until until
+func NewAccountLockedError(until *time.Time) rest_errors.RestErr {
+	return &AccountError{code: AccountLocked, status: http.StatusForbidden, Until: until}
+}
+
+func (e *AccountError) Code() Code {
+	return e.code
+}
+
+func (e *AccountError) Message() string {
+	msg, _ := Translate(DefaultLocale, e.code)
+	return msg
+}
+
+func (e *AccountError) Status() int {
+	return e.status
+}
+
+func (e *AccountError) Error() string {
+	return fmt.Sprintf("message: %s - status: %d - reason: %s", e.Message(), e.status, e.Reason)
+}
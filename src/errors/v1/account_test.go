@@ -0,0 +1,24 @@
+package errors
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalizeAccountError(t *testing.T) {
+	until := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	body := Localize(NewAccountBlockedError("spam", &until), LocaleEn)
+	assert.Equal(t, http.StatusForbidden, body.Status)
+	assert.Equal(t, AccountBlocked, body.Code)
+	assert.Equal(t, "Your account is blocked", body.Message)
+	assert.Equal(t, "spam", body.Reason)
+	assert.Equal(t, &until, body.Until)
+
+	p := NewProblem(NewAccountBlockedError("spam", nil), LocaleFa, "/v1/login")
+	assert.Equal(t, AccountBlockedErrorMessage, p.Detail)
+	assert.Equal(t, "spam", p.Reason)
+	assert.Nil(t, p.Until)
+}
@@ -0,0 +1,259 @@
+package errors
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"golang.org/x/text/language"
+)
+
+// Code is stable machine-readable identifier of an error, clients must rely on it instead of messages
+type Code string
+
+const (
+	LocaleFa      = "fa"
+	LocaleEn      = "en"
+	DefaultLocale = LocaleFa
+)
+
+const (
+	DuplicateUsername        Code = "duplicate_username"
+	DuplicatePhone           Code = "duplicate_phone"
+	InternalServer           Code = "internal_server_error"
+	PhoneIsRequired          Code = "phone_required"
+	UsernameIsRequired       Code = "username_required"
+	NameIsRequired           Code = "name_required"
+	FamilyIsRequired         Code = "family_required"
+	AgeIsRequired            Code = "age_required"
+	PasswordIsRequired       Code = "password_required"
+	InvalidUsername          Code = "invalid_username"
+	UsernameIsReserved       Code = "username_reserved"
+	PhoneOrUsernameRequired  Code = "phone_or_username_required"
+	UserNotFound             Code = "user_not_found"
+	UserAlreadyActive        Code = "user_already_active"
+	CodeOrPhoneDoesNotExist  Code = "invalid_code"
+	CodeIsExpired            Code = "code_expired"
+	InvalidInput             Code = "invalid_input"
+	UnAuthorizedAdmin        Code = "admin_required"
+	UnAuthorizedActive       Code = "active_account_required"
+	InvalidPhone             Code = "invalid_phone"
+	PhoneIsNotMobile         Code = "phone_not_mobile"
+	InvalidCursor            Code = "invalid_cursor"
+	SearchQueryTooShort      Code = "search_query_too_short"
+	InvalidCreatedRange      Code = "invalid_created_range"
+	InvalidClient            Code = "invalid_client"
+	InvalidCredentials       Code = "invalid_credentials"
+	InvalidToken             Code = "invalid_token"
+	InvalidRequest           Code = "invalid_request"
+	UnauthorizedClient       Code = "unauthorized_client"
+	InvalidGrant             Code = "invalid_grant"
+	UnsupportedGrantType     Code = "unsupported_grant_type"
+	UnsupportedResponseType  Code = "unsupported_response_type"
+	InvalidScope             Code = "invalid_scope"
+	AccessDenied             Code = "access_denied"
+	InvalidRedirectURI       Code = "invalid_redirect_uri"
+	UnknownProvider          Code = "unknown_provider"
+	InvalidState             Code = "invalid_state"
+	SocialLoginFailed        Code = "social_login_failed"
+	IdentityNotLinked        Code = "identity_not_linked"
+	IdentityAlreadyLinked    Code = "identity_already_linked"
+	IdentityNotFound         Code = "identity_not_found"
+	InvalidAPIKey            Code = "invalid_api_key"
+	InsufficientScope        Code = "insufficient_scope"
+	APIKeyNotFound           Code = "api_key_not_found"
+	InvalidPasskey           Code = "invalid_passkey"
+	PasskeyNotFound          Code = "passkey_not_found"
+	PasskeyAlreadyRegistered Code = "passkey_already_registered"
+	SessionNotFound          Code = "session_not_found"
+	InvalidTimeRange         Code = "invalid_time_range"
+	WebhookNotFound          Code = "webhook_not_found"
+	WebhookDeliveryNotFound  Code = "webhook_delivery_not_found"
+	AccountBlocked           Code = "account_blocked"
+	BlockExpiryInPast        Code = "block_expiry_in_past"
+	AccountUnverified        Code = "account_unverified"
+	AccountDeactivated       Code = "account_deactivated"
+	AccountLocked            Code = "account_locked"
+	PhoneUnchanged           Code = "phone_unchanged"
+	WrongCurrentPassword     Code = "wrong_current_password"
+	WeakPassword             Code = "weak_password"
+	DataExportNotFound       Code = "data_export_not_found"
+	DataExportNotReady       Code = "data_export_not_ready"
+	UserVersionMismatch      Code = "user_version_mismatch"
+	UserUpdateForbidden      Code = "user_update_forbidden"
+	TooManyCodeAttempts      Code = "too_many_code_attempts"
+)
+
+var (
+	catalogs = map[string]map[Code]string{
+		LocaleFa: {
+			DuplicateUsername:        DuplicateUsernameErrorMessage,
+			DuplicatePhone:           DuplicatePhoneErrorMessage,
+			InternalServer:           InternalServerErrorMessage,
+			PhoneIsRequired:          PhoneIsRequiredErrorMessage,
+			UsernameIsRequired:       UsernameIsRequiredErrorMessage,
+			NameIsRequired:           NameIsRequiredErrorMessage,
+			FamilyIsRequired:         FamilyIsRequiredErrorMessage,
+			AgeIsRequired:            AgeIsRequiredErrorMessage,
+			PasswordIsRequired:       PasswordIsRequiredErrorMessage,
+			InvalidUsername:          UsernameOnlyCanContainUnderlineAndEnglishWordsAndNumbersErrorMessage,
+			UsernameIsReserved:       UsernameIsReservedErrorMessage,
+			PhoneOrUsernameRequired:  PhoneOrUsernameIsRequiredErrorMessage,
+			UserNotFound:             UserNotFoundError,
+			UserAlreadyActive:        UserAlreadyActiveErrorMessage,
+			CodeOrPhoneDoesNotExist:  CodeOrPhoneDoesNotExistsErrorMessage,
+			CodeIsExpired:            CodeIsExpiredErrorMessage,
+			InvalidInput:             InvalidInputErrorMessage,
+			UnAuthorizedAdmin:        UnAuthorizedAdminErrorMessage,
+			UnAuthorizedActive:       UnAuthorizedActiveErrorMessage,
+			InvalidPhone:             InvalidPhoneErrorMessage,
+			PhoneIsNotMobile:         PhoneIsNotMobileErrorMessage,
+			InvalidCursor:            InvalidCursorErrorMessage,
+			SearchQueryTooShort:      SearchQueryTooShortErrorMessage,
+			InvalidCreatedRange:      InvalidCreatedRangeErrorMessage,
+			InvalidClient:            InvalidClientErrorMessage,
+			InvalidCredentials:       InvalidCredentialsErrorMessage,
+			InvalidToken:             InvalidTokenErrorMessage,
+			InvalidRequest:           InvalidRequestErrorMessage,
+			UnauthorizedClient:       UnauthorizedClientErrorMessage,
+			InvalidGrant:             InvalidGrantErrorMessage,
+			UnsupportedGrantType:     UnsupportedGrantTypeErrorMessage,
+			UnsupportedResponseType:  UnsupportedResponseTypeErrorMessage,
+			InvalidScope:             InvalidScopeErrorMessage,
+			AccessDenied:             AccessDeniedErrorMessage,
+			InvalidRedirectURI:       InvalidRedirectURIErrorMessage,
+			UnknownProvider:          UnknownProviderErrorMessage,
+			InvalidState:             InvalidStateErrorMessage,
+			SocialLoginFailed:        SocialLoginFailedErrorMessage,
+			IdentityNotLinked:        IdentityNotLinkedErrorMessage,
+			IdentityAlreadyLinked:    IdentityAlreadyLinkedErrorMessage,
+			IdentityNotFound:         IdentityNotFoundErrorMessage,
+			InvalidAPIKey:            InvalidAPIKeyErrorMessage,
+			InsufficientScope:        InsufficientScopeErrorMessage,
+			APIKeyNotFound:           APIKeyNotFoundErrorMessage,
+			InvalidPasskey:           InvalidPasskeyErrorMessage,
+			PasskeyNotFound:          PasskeyNotFoundErrorMessage,
+			PasskeyAlreadyRegistered: PasskeyAlreadyRegisteredErrorMessage,
+			SessionNotFound:          SessionNotFoundErrorMessage,
+			InvalidTimeRange:         InvalidTimeRangeErrorMessage,
+			WebhookNotFound:          WebhookNotFoundErrorMessage,
+			WebhookDeliveryNotFound:  WebhookDeliveryNotFoundErrorMessage,
+			AccountBlocked:           AccountBlockedErrorMessage,
+			BlockExpiryInPast:        BlockExpiryInPastErrorMessage,
+			AccountUnverified:        AccountUnverifiedErrorMessage,
+			AccountDeactivated:       AccountDeactivatedErrorMessage,
+			AccountLocked:            AccountLockedErrorMessage,
+			PhoneUnchanged:           PhoneUnchangedErrorMessage,
+			WrongCurrentPassword:     WrongCurrentPasswordErrorMessage,
+			WeakPassword:             WeakPasswordErrorMessage,
+			DataExportNotFound:       DataExportNotFoundErrorMessage,
+			DataExportNotReady:       DataExportNotReadyErrorMessage,
+			UserVersionMismatch:      UserVersionMismatchErrorMessage,
+			UserUpdateForbidden:      UserUpdateForbiddenErrorMessage,
+			TooManyCodeAttempts:      TooManyCodeAttemptsErrorMessage,
+		},
+		LocaleEn: {
+			DuplicateUsername:        "This username belongs to someone else",
+			DuplicatePhone:           "This phone number belongs to someone else",
+			InternalServer:           "Something went wrong, please contact support",
+			PhoneIsRequired:          "Phone number is required",
+			UsernameIsRequired:       "Username is required",
+			NameIsRequired:           "Name is required",
+			FamilyIsRequired:         "Family name is required",
+			AgeIsRequired:            "Age is required",
+			PasswordIsRequired:       "Password is required",
+			InvalidUsername:          "Username can only contain english letters, numbers and underline",
+			UsernameIsReserved:       "This username is reserved",
+			PhoneOrUsernameRequired:  "Username or phone number is required",
+			UserNotFound:             "User not found",
+			UserAlreadyActive:        "Your account is already active",
+			CodeOrPhoneDoesNotExist:  "Verification code or phone number is wrong",
+			CodeIsExpired:            "Your verification code is expired",
+			InvalidInput:             "Input is not valid",
+			UnAuthorizedAdmin:        "You do not have permission",
+			UnAuthorizedActive:       "Your account must be active",
+			InvalidPhone:             "Phone number is not valid",
+			PhoneIsNotMobile:         "Phone number must be a mobile number",
+			InvalidCursor:            "Page cursor is not valid",
+			SearchQueryTooShort:      "Search query must be at least two letters",
+			InvalidCreatedRange:      "Creation date range is not valid",
+			InvalidClient:            "Client authentication failed",
+			InvalidCredentials:       "Username or password is wrong",
+			InvalidToken:             "Token is invalid or expired",
+			InvalidRequest:           "Request is missing a parameter or is malformed",
+			UnauthorizedClient:       "Client is not allowed to use this grant type",
+			InvalidGrant:             "Authorization code or refresh token is invalid, expired or already used",
+			UnsupportedGrantType:     "Grant type is not supported",
+			UnsupportedResponseType:  "Response type is not supported",
+			InvalidScope:             "Requested scope is invalid",
+			AccessDenied:             "User denied access",
+			InvalidRedirectURI:       "Redirect URI is not registered for this client",
+			UnknownProvider:          "Unknown identity provider",
+			InvalidState:             "Sign in request is invalid or expired",
+			SocialLoginFailed:        "Sign in with identity provider failed",
+			IdentityNotLinked:        "No account is linked to this identity, sign in and link it first",
+			IdentityAlreadyLinked:    "Identity is linked to another account",
+			IdentityNotFound:         "No identity of this provider is linked",
+			InvalidAPIKey:            "API key is invalid, expired or revoked",
+			InsufficientScope:        "API key lacks the scope this request needs",
+			APIKeyNotFound:           "API key not found",
+			InvalidPasskey:           "Passkey verification failed",
+			PasskeyNotFound:          "Passkey not found",
+			PasskeyAlreadyRegistered: "Passkey is already registered",
+			SessionNotFound:          "Session not found",
+			InvalidTimeRange:         "Time range is invalid",
+			WebhookNotFound:          "Webhook was not found",
+			WebhookDeliveryNotFound:  "Webhook delivery was not found",
+			AccountBlocked:           "Your account is blocked",
+			BlockExpiryInPast:        "Block expiry must be in the future",
+			AccountUnverified:        "Your account is not verified yet",
+			AccountDeactivated:       "Your account is deactivated",
+			AccountLocked:            "Your account is locked for too many failed logins",
+			PhoneUnchanged:           "New phone number is the same as the current one",
+			WrongCurrentPassword:     "Current password is wrong",
+			WeakPassword:             "Password must be at least 8 characters and at most 72 bytes long (non latin letters take more than one) and contain letters and digits",
+			DataExportNotFound:       "Data export was not found",
+			DataExportNotReady:       "Data export is not ready yet",
+			UserVersionMismatch:      "User was changed meanwhile, read it again and retry",
+			UserUpdateForbidden:      "Only the user itself or an admin may update the user",
+			TooManyCodeAttempts:      "Too many wrong codes, request a new code",
+		},
+	}
+
+	locales = language.NewMatcher([]language.Tag{language.Persian, language.English})
+)
+
+// Locale picks the best supported locale for an Accept-Language header value
+func Locale(acceptLanguage string) string {
+	if acceptLanguage == "" {
+		return DefaultLocale
+	}
+	tag, _ := language.MatchStrings(locales, acceptLanguage)
+	base, _ := tag.Base()
+	if _, ok := catalogs[base.String()]; !ok {
+		return DefaultLocale
+	}
+	return base.String()
+}
+
+// Translate returns message of code in locale, falling back to default locale
+func Translate(locale string, code Code) (string, bool) {
+	if msg, ok := catalogs[locale][code]; ok {
+		return msg, true
+	}
+	msg, ok := catalogs[DefaultLocale][code]
+	return msg, ok
+}
+
+// CodeOf returns code of err, errors made without a code, e.g. by rest_errors, get a code made of their status
+func CodeOf(err rest_errors.RestErr) Code {
+	if c, ok := err.(coder); ok {
+		return c.Code()
+	}
+	return statusCode(err.Status())
+}
+
+// statusCode makes a code like not_found out of http status
+func statusCode(status int) Code {
+	return Code(strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_"))
+}
@@ -0,0 +1,71 @@
+package errors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCatalogsHaveSameCodes(t *testing.T) {
+	for locale, catalog := range catalogs {
+		assert.Len(t, catalog, len(catalogs[DefaultLocale]), locale)
+		for code := range catalogs[DefaultLocale] {
+			assert.Contains(t, catalog, code, locale)
+		}
+	}
+}
+
+func TestCodedErrorMessage(t *testing.T) {
+	err := NewNotFoundError(UserNotFound)
+	assert.Equal(t, UserNotFoundError, err.Message())
+	assert.Equal(t, http.StatusNotFound, err.Status())
+
+	err = NewInternalServerError(nil)
+	assert.Equal(t, InternalServerErrorMessage, err.Message())
+	assert.Equal(t, http.StatusInternalServerError, err.Status())
+}
+
+func TestLocale(t *testing.T) {
+	assert.Equal(t, LocaleFa, Locale(""))
+	assert.Equal(t, LocaleEn, Locale("en-US,en;q=0.9"))
+	assert.Equal(t, LocaleFa, Locale("fa-IR"))
+	assert.Equal(t, LocaleEn, Locale("de-DE;q=1,en;q=0.5"))
+	assert.Equal(t, LocaleFa, Locale("de-DE"))
+}
+
+func TestCodeOf(t *testing.T) {
+	assert.Equal(t, UserNotFound, CodeOf(NewNotFoundError(UserNotFound)))
+	assert.Equal(t, AccountLocked, CodeOf(NewAccountLockedError(nil)))
+	assert.Equal(t, InvalidInput, CodeOf(&ValidationError{}))
+	assert.Equal(t, Code("bad_request"), CodeOf(rest_errors.NewBadRequestError("some validation error")))
+	// codes are never guessed from messages
+	assert.Equal(t, Code("not_found"), CodeOf(rest_errors.NewNotFoundError(UserNotFoundError)))
+}
+
+func TestLocalize(t *testing.T) {
+	b := Localize(NewNotFoundError(UserNotFound), LocaleEn)
+	assert.Equal(t, "User not found", b.Message)
+	assert.Equal(t, http.StatusNotFound, b.Status)
+	assert.Equal(t, "not_found", b.Error)
+	assert.Equal(t, UserNotFound, b.Code)
+
+	b = Localize(rest_errors.NewBadRequestError("some validation error"), LocaleEn)
+	assert.Equal(t, "some validation error", b.Message)
+}
+
+func TestRespond(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(HeaderAcceptLanguage, "en")
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	err := Respond(c, NewUnauthorizedError(UnAuthorizedAdmin))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, LocaleEn, rec.Header().Get(HeaderContentLanguage))
+	assert.JSONEq(t, `{"message":"You do not have permission","status":401,"error":"unauthorized","code":"admin_required"}`, rec.Body.String())
+}
@@ -0,0 +1,59 @@
+package errors
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+)
+
+// CodedError is an error known by its code, its message is the one of code in default locale
+type CodedError struct {
+	code   Code
+	status int
+	cause  error
+}
+
+// coder is implemented by errors which know their code, CodeOf asks them
+type coder interface {
+	Code() Code
+}
+
+// NewError makes error of code answered with status
+func NewError(code Code, status int) rest_errors.RestErr {
+	return &CodedError{code: code, status: status}
+}
+
+func NewBadRequestError(code Code) rest_errors.RestErr {
+	return NewError(code, http.StatusBadRequest)
+}
+
+func NewNotFoundError(code Code) rest_errors.RestErr {
+	return NewError(code, http.StatusNotFound)
+}
+
+func NewUnauthorizedError(code Code) rest_errors.RestErr {
+	return NewError(code, http.StatusUnauthorized)
+}
+
+// NewInternalServerError hides cause from clients behind InternalServer, cause is kept for logs
+func NewInternalServerError(cause error) rest_errors.RestErr {
+	return &CodedError{code: InternalServer, status: http.StatusInternalServerError, cause: cause}
+}
+
+func (e *CodedError) Code() Code {
+	return e.code
+}
+
+func (e *CodedError) Message() string {
+	msg, _ := Translate(DefaultLocale, e.code)
+	return msg
+}
+
+func (e *CodedError) Status() int {
+	return e.status
+}
+
+func (e *CodedError) Error() string {
+	return fmt.Sprintf("message: %s - status: %d - code: %s - cause: %v", e.Message(), e.status, e.code, e.cause)
+}
@@ -1,16 +1,18 @@
 package errors
 
+// Persian messages, services build errors by these and Persian catalog is made of them
 const (
-	DuplicateUsernameErrorMessage                                        = "این نام کاربری مطعلق به مشخص دیگیری است"
-	DuplicatePhoneErrorMessage                                           = "این شماره مطعلق به شخص دیگیری است"
+	DuplicateUsernameErrorMessage                                        = "این نام کاربری متعلق به شخص دیگری است"
+	DuplicatePhoneErrorMessage                                           = "این شماره متعلق به شخص دیگری است"
 	InternalServerErrorMessage                                           = "خطایی رخ داده است لطفا با پشتیبانی تماس بگیرید"
 	PhoneIsRequiredErrorMessage                                          = "شماره تلفن اجباری است"
 	UsernameIsRequiredErrorMessage                                       = "نام کاربری اجباری است"
 	NameIsRequiredErrorMessage                                           = "نام اجباری است"
 	FamilyIsRequiredErrorMessage                                         = "نام خانوادگی اجباری است"
 	AgeIsRequiredErrorMessage                                            = "سن اجباری است"
-	PasswordIsRequiredErrorMessage                                       = "رمز عبور است"
-	UsernameOnlyCanContainUnderlineAndEnglishWordsAndNumbersErrorMessage = "نام کاربری فقط می‌تواند شامل حروف انگلیسی، عدد و خط تیره باشه"
+	PasswordIsRequiredErrorMessage                                       = "رمز عبور اجباری است"
+	UsernameOnlyCanContainUnderlineAndEnglishWordsAndNumbersErrorMessage = "نام کاربری فقط می‌تواند شامل حروف انگلیسی، عدد و خط زیر باشد"
+	UsernameIsReservedErrorMessage                                       = "این نام کاربری رزرو شده است"
 	PhoneOrUsernameIsRequiredErrorMessage                                = "نام کاربری یا شماره تماس اجباری است"
 	UserNotFoundError                                                    = "کاربر یافت نشد"
 	UserAlreadyActiveErrorMessage                                        = "حساب کاربری شما فعال است"
@@ -19,4 +21,49 @@ const (
 	InvalidInputErrorMessage                                             = "ورودی معتبر نیست"
 	UnAuthorizedAdminErrorMessage                                        = "شما مجوز دسترسی ندارید"
 	UnAuthorizedActiveErrorMessage                                       = "حساب کاربری شما باید فعال باشد"
+	InvalidPhoneErrorMessage                                             = "شماره تلفن معتبر نیست"
+	PhoneIsNotMobileErrorMessage                                         = "شماره تلفن باید شماره همراه باشد"
+	InvalidCursorErrorMessage                                            = "نشانگر صفحه معتبر نیست"
+	SearchQueryTooShortErrorMessage                                      = "عبارت جستجو باید حداقل دو حرف باشد"
+	InvalidCreatedRangeErrorMessage                                      = "بازه تاریخ ساخت معتبر نیست"
+	InvalidClientErrorMessage                                            = "کلاینت نامعتبر است"
+	InvalidCredentialsErrorMessage                                       = "نام کاربری یا رمز عبور اشتباه است"
+	InvalidTokenErrorMessage                                             = "توکن نامعتبر یا منقضی شده است"
+	InvalidRequestErrorMessage                                           = "درخواست ناقص یا نامعتبر است"
+	UnauthorizedClientErrorMessage                                       = "این کلاینت اجازه استفاده از این روش را ندارد"
+	InvalidGrantErrorMessage                                             = "کد یا توکن ارائه شده نامعتبر، منقضی یا مصرف شده است"
+	UnsupportedGrantTypeErrorMessage                                     = "این نوع مجوز پشتیبانی نمی‌شود"
+	UnsupportedResponseTypeErrorMessage                                  = "این نوع پاسخ پشتیبانی نمی‌شود"
+	InvalidScopeErrorMessage                                             = "دسترسی درخواست شده نامعتبر است"
+	AccessDeniedErrorMessage                                             = "کاربر اجازه دسترسی نداد"
+	InvalidRedirectURIErrorMessage                                       = "آدرس بازگشت برای این کلاینت ثبت نشده است"
+	UnknownProviderErrorMessage                                          = "ارائه‌دهنده ورود ناشناخته است"
+	InvalidStateErrorMessage                                             = "درخواست ورود نامعتبر یا منقضی شده است"
+	SocialLoginFailedErrorMessage                                        = "ورود با ارائه‌دهنده خارجی ناموفق بود"
+	IdentityNotLinkedErrorMessage                                        = "هیچ حسابی به این هویت متصل نیست، ابتدا وارد شوید و آن را متصل کنید"
+	IdentityAlreadyLinkedErrorMessage                                    = "این هویت به حساب دیگری متصل است"
+	IdentityNotFoundErrorMessage                                         = "هویت متصلی با این ارائه‌دهنده یافت نشد"
+	InvalidAPIKeyErrorMessage                                            = "کلید API نامعتبر، منقضی یا باطل شده است"
+	InsufficientScopeErrorMessage                                        = "کلید API دسترسی لازم برای این درخواست را ندارد"
+	APIKeyNotFoundErrorMessage                                           = "کلید API یافت نشد"
+	InvalidPasskeyErrorMessage                                           = "تایید کلید عبور ناموفق بود"
+	PasskeyNotFoundErrorMessage                                          = "کلید عبور یافت نشد"
+	PasskeyAlreadyRegisteredErrorMessage                                 = "این کلید عبور قبلا ثبت شده است"
+	SessionNotFoundErrorMessage                                          = "نشست یافت نشد"
+	InvalidTimeRangeErrorMessage                                         = "بازه زمانی معتبر نیست"
+	WebhookNotFoundErrorMessage                                          = "وب‌هوک یافت نشد"
+	WebhookDeliveryNotFoundErrorMessage                                  = "ارسال وب‌هوک یافت نشد"
+	AccountBlockedErrorMessage                                           = "حساب کاربری شما مسدود شده است"
+	BlockExpiryInPastErrorMessage                                        = "زمان پایان مسدودیت باید در آینده باشد"
+	AccountUnverifiedErrorMessage                                        = "حساب کاربری شما هنوز تایید نشده است"
+	AccountDeactivatedErrorMessage                                       = "حساب کاربری شما غیرفعال شده است"
+	AccountLockedErrorMessage                                            = "حساب کاربری شما به دلیل تلاش‌های ناموفق ورود موقتا قفل شده است"
+	PhoneUnchangedErrorMessage                                           = "شماره جدید با شماره فعلی شما یکسان است"
+	WrongCurrentPasswordErrorMessage                                     = "رمز عبور فعلی اشتباه است"
+	WeakPasswordErrorMessage                                             = "رمز عبور باید حداقل ۸ کاراکتر و حداکثر ۷۲ بایت (هر حرف فارسی دو بایت) و شامل حرف و عدد باشد"
+	DataExportNotFoundErrorMessage                                       = "خروجی داده یافت نشد"
+	DataExportNotReadyErrorMessage                                       = "خروجی داده هنوز آماده نیست"
+	UserVersionMismatchErrorMessage                                      = "کاربر در این فاصله تغییر کرده است، دوباره آن را بخوانید و تلاش کنید"
+	UserUpdateForbiddenErrorMessage                                      = "فقط خود کاربر یا مدیر می‌تواند کاربر را ویرایش کند"
+	TooManyCodeAttemptsErrorMessage                                      = "تعداد تلاش‌های نادرست بیش از حد مجاز است، کد جدیدی درخواست کنید"
 )
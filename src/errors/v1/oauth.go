@@ -0,0 +1,45 @@
+package errors
+
+import (
+	"net/http"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// ServerError is RFC 6749 code of failures of the server itself
+	ServerError Code = "server_error"
+)
+
+var (
+	// oauthCodes are error codes RFC 6749 lets token endpoint answer with
+	oauthCodes = map[Code]bool{
+		InvalidRequest:       true,
+		InvalidClient:        true,
+		InvalidGrant:         true,
+		UnauthorizedClient:   true,
+		UnsupportedGrantType: true,
+		InvalidScope:         true,
+	}
+)
+
+// RespondOAuth writes err as RFC 6749 error body, codes out of the RFC are sent as invalid_request
+func RespondOAuth(c echo.Context, err rest_errors.RestErr) error {
+	code := CodeOf(err)
+	switch {
+	case err.Status() >= http.StatusInternalServerError:
+		code = ServerError
+	case !oauthCodes[code]:
+		code = InvalidRequest
+	}
+	locale := Locale(c.Request().Header.Get(HeaderAcceptLanguage))
+	desc, ok := Translate(locale, CodeOf(err))
+	if !ok {
+		desc = err.Message()
+	}
+	c.Response().Header().Set(HeaderContentLanguage, locale)
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(err.Status(), domains.OAuthErrorResponse{Error: string(code), ErrorDescription: desc})
+}
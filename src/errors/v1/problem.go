@@ -0,0 +1,98 @@
+package errors
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	MIMEApplicationProblemJSON = "application/problem+json"
+	// ProblemTypePrefix prefixes codes to make type of problems
+	ProblemTypePrefix = "urn:user-microservice:problem:"
+)
+
+// Problem is RFC 7807 shape of errors, code and fields are extension members
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail"`
+	Instance string       `json:"instance,omitempty"`
+	Code     Code         `json:"code"`
+	Fields   []FieldError `json:"fields,omitempty"`
+	Reason   string       `json:"reason,omitempty"`
+	Until    *time.Time   `json:"until,omitempty"`
+}
+
+// NewProblem makes problem of err for request path instance
+func NewProblem(err rest_errors.RestErr, locale, instance string) Problem {
+	b := Localize(err, locale)
+	return Problem{
+		Type:     ProblemTypePrefix + string(b.Code),
+		Title:    http.StatusText(b.Status),
+		Status:   b.Status,
+		Detail:   b.Message,
+		Instance: instance,
+		Code:     b.Code,
+		Fields:   b.Fields,
+		Reason:   b.Reason,
+		Until:    b.Until,
+	}
+}
+
+// HTTPErrorHandler is the only place errors are written, handlers either return errors or pass them to Respond.
+// Clients asking for application/problem+json get RFC 7807 bodies, others get Body
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	restErr := toRestErr(err)
+	locale := Locale(c.Request().Header.Get(HeaderAcceptLanguage))
+	c.Response().Header().Set(HeaderContentLanguage, locale)
+
+	var werr error
+	switch {
+	case c.Request().Method == http.MethodHead:
+		werr = c.NoContent(restErr.Status())
+	case acceptsProblem(c.Request()):
+		werr = writeProblem(c, NewProblem(restErr, locale, c.Request().URL.Path))
+	default:
+		werr = c.JSON(restErr.Status(), Localize(restErr, locale))
+	}
+	if werr != nil {
+		c.Logger().Error(werr)
+	}
+}
+
+// toRestErr turns errors raised by echo itself or by panics to RestErr
+func toRestErr(err error) rest_errors.RestErr {
+	switch e := err.(type) {
+	case rest_errors.RestErr:
+		return e
+	case *echo.HTTPError:
+		switch e.Code {
+		case http.StatusInternalServerError:
+			return NewInternalServerError(e)
+		case http.StatusBadRequest:
+			return NewBadRequestError(InvalidInput)
+		}
+		return rest_errors.NewRestError(fmt.Sprint(e.Message), e.Code, string(statusCode(e.Code)))
+	default:
+		return NewInternalServerError(err)
+	}
+}
+
+func acceptsProblem(r *http.Request) bool {
+	return strings.Contains(r.Header.Get(echo.HeaderAccept), MIMEApplicationProblemJSON)
+}
+
+func writeProblem(c echo.Context, p Problem) error {
+	c.Response().Header().Set(echo.HeaderContentType, MIMEApplicationProblemJSON)
+	c.Response().WriteHeader(p.Status)
+	return c.Echo().JSONSerializer.Serialize(c, p, "")
+}
@@ -0,0 +1,82 @@
+package errors
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEcho() *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.GET("/users/:id", func(c echo.Context) error {
+		return NewNotFoundError(UserNotFound)
+	})
+	e.GET("/fail", func(c echo.Context) error {
+		return fmt.Errorf("database is down")
+	})
+	return e
+}
+
+func TestHTTPErrorHandlerProblem(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/users/12", nil)
+	req.Header.Set(echo.HeaderAccept, MIMEApplicationProblemJSON)
+	req.Header.Set(HeaderAcceptLanguage, LocaleEn)
+	rec := httptest.NewRecorder()
+	newTestEcho().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, MIMEApplicationProblemJSON, rec.Header().Get(echo.HeaderContentType))
+	var p Problem
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	assert.Equal(t, Problem{
+		Type:     ProblemTypePrefix + string(UserNotFound),
+		Title:    "Not Found",
+		Status:   http.StatusNotFound,
+		Detail:   "User not found",
+		Instance: "/users/12",
+		Code:     UserNotFound,
+	}, p)
+}
+
+func TestHTTPErrorHandlerDefaultsToBody(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/users/12", nil)
+	rec := httptest.NewRecorder()
+	newTestEcho().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Header().Get(echo.HeaderContentType), echo.MIMEApplicationJSON)
+	var b Body
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &b))
+	assert.Equal(t, UserNotFoundError, b.Message)
+	assert.Equal(t, UserNotFound, b.Code)
+}
+
+func TestHTTPErrorHandlerEchoErrors(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/unknown", nil)
+	req.Header.Set(echo.HeaderAccept, MIMEApplicationProblemJSON)
+	rec := httptest.NewRecorder()
+	newTestEcho().ServeHTTP(rec, req)
+
+	var p Problem
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	assert.Equal(t, http.StatusNotFound, p.Status)
+	assert.Equal(t, Code("not_found"), p.Code)
+}
+
+func TestHTTPErrorHandlerHidesUnknownErrors(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/fail", nil)
+	rec := httptest.NewRecorder()
+	newTestEcho().ServeHTTP(rec, req)
+
+	var b Body
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &b))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, InternalServerErrorMessage, b.Message)
+	assert.Equal(t, InternalServer, b.Code)
+}
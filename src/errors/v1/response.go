@@ -0,0 +1,54 @@
+package errors
+
+import (
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	HeaderAcceptLanguage  = "Accept-Language"
+	HeaderContentLanguage = "Content-Language"
+)
+
+// Body is what every error response looks like
+type Body struct {
+	Message string `json:"message"`
+	Status  int    `json:"status"`
+	Error   string `json:"error"`
+	Code    Code   `json:"code"`
+	// Fields lists failed fields of a request, only validation errors have it
+	Fields []FieldError `json:"fields,omitempty"`
+	// Reason and Until tell why and until when an account is refused, only account errors have them
+	Reason string     `json:"reason,omitempty"`
+	Until  *time.Time `json:"until,omitempty"`
+}
+
+// Localize translates err to locale, messages out of catalog are kept as they are
+func Localize(err rest_errors.RestErr, locale string) Body {
+	code := CodeOf(err)
+	msg, ok := Translate(locale, code)
+	if !ok {
+		msg = err.Message()
+	}
+	body := Body{
+		Message: msg,
+		Status:  err.Status(),
+		Error:   string(statusCode(err.Status())),
+		Code:    code,
+	}
+	if verr, ok := err.(*ValidationError); ok {
+		body.Fields = localizeFields(verr.Fields, locale)
+	}
+	if aerr, ok := err.(*AccountError); ok {
+		body.Reason, body.Until = aerr.Reason, aerr.Until
+	}
+	return body
+}
+
+// Respond writes err by HTTPErrorHandler, in the language client asked by Accept-Language header
+func Respond(c echo.Context, err rest_errors.RestErr) error {
+	HTTPErrorHandler(err, c)
+	return nil
+}
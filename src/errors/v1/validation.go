@@ -0,0 +1,121 @@
+package errors
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError tells which field of request failed which validation rule
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationError is a bad request error carrying every failed field of request
+type ValidationError struct {
+	Fields []FieldError
+}
+
+var (
+	// rules holds messages of validation rules, %s is replaced by rule param
+	rules = map[string]map[string]string{
+		LocaleFa: {
+			"required": "این فیلد اجباری است",
+			"min":      "مقدار این فیلد باید حداقل %s باشد",
+			"max":      "مقدار این فیلد باید حداکثر %s باشد",
+			"oneof":    "مقدار این فیلد باید یکی از %s باشد",
+			"username": UsernameOnlyCanContainUnderlineAndEnglishWordsAndNumbersErrorMessage,
+			"password": WeakPasswordErrorMessage,
+		},
+		LocaleEn: {
+			"required": "This field is required",
+			"min":      "This field must be at least %s",
+			"max":      "This field must be at most %s",
+			"oneof":    "This field must be one of %s",
+			"username": "Username can only contain english letters, numbers and underscore",
+			"password": "Password must be at least 8 characters and at most 72 bytes long (non latin letters take more than one) and contain letters and digits",
+		},
+	}
+)
+
+// NewValidationError converts errors of validator to ValidationError, other errors become invalid input
+func NewValidationError(err error) rest_errors.RestErr {
+	if restErr, ok := err.(rest_errors.RestErr); ok {
+		return restErr
+	}
+	verrs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return NewBadRequestError(InvalidInput)
+	}
+	fields := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		fields = append(fields, FieldError{
+			Field: fe.Field(),
+			Rule:  fe.Tag(),
+			Param: fe.Param(),
+		})
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// FieldName makes validator report fields by their json name, use it with validator.RegisterTagNameFunc
+func FieldName(f reflect.StructField) string {
+	for _, tag := range []string{"json", "query", "param"} {
+		name := strings.SplitN(f.Tag.Get(tag), ",", 2)[0]
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+func (*ValidationError) Code() Code {
+	return InvalidInput
+}
+
+func (*ValidationError) Message() string {
+	return InvalidInputErrorMessage
+}
+
+func (*ValidationError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		fields[i] = f.Field + ":" + f.Rule
+	}
+	return fmt.Sprintf("message: %s - status: %d - fields: %s", e.Message(), e.Status(), strings.Join(fields, ","))
+}
+
+// localizeFields fills message of every field in locale
+func localizeFields(fields []FieldError, locale string) []FieldError {
+	localized := make([]FieldError, len(fields))
+	for i, f := range fields {
+		f.Message = ruleMessage(locale, f.Rule, f.Param)
+		localized[i] = f
+	}
+	return localized
+}
+
+func ruleMessage(locale, rule, param string) string {
+	msg, ok := rules[locale][rule]
+	if !ok {
+		msg, ok = rules[DefaultLocale][rule]
+	}
+	if !ok {
+		msg, _ = Translate(locale, InvalidInput)
+	}
+	if strings.Contains(msg, "%s") {
+		return fmt.Sprintf(msg, param)
+	}
+	return msg
+}
@@ -0,0 +1,60 @@
+package errors
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+type validationTestRequest struct {
+	Name  string `json:"name" validate:"required"`
+	Age   uint   `json:"age" validate:"max=150"`
+	Sort  string `query:"sort" validate:"omitempty,oneof=asc desc"`
+	Inner string `json:"-" validate:"required"`
+}
+
+func newTestValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(FieldName)
+	return v
+}
+
+func TestNewValidationError(t *testing.T) {
+	err := newTestValidator().Struct(validationTestRequest{Age: 200, Sort: "up"})
+	restErr := NewValidationError(err)
+	assert.EqualValues(t, http.StatusBadRequest, restErr.Status())
+	assert.EqualValues(t, InvalidInputErrorMessage, restErr.Message())
+
+	verr, ok := restErr.(*ValidationError)
+	assert.True(t, ok)
+	assert.Equal(t, []FieldError{
+		{Field: "name", Rule: "required"},
+		{Field: "age", Rule: "max", Param: "150"},
+		{Field: "sort", Rule: "oneof", Param: "asc desc"},
+		{Field: "Inner", Rule: "required"},
+	}, verr.Fields)
+}
+
+func TestNewValidationErrorKeepsRestErr(t *testing.T) {
+	restErr := NewNotFoundError(UserNotFound)
+	assert.Equal(t, restErr, NewValidationError(restErr))
+	assert.EqualValues(t, InvalidInputErrorMessage, NewValidationError(assert.AnError).Message())
+}
+
+func TestLocalizeValidationError(t *testing.T) {
+	verr := &ValidationError{Fields: []FieldError{
+		{Field: "age", Rule: "max", Param: "150"},
+		{Field: "code", Rule: "len", Param: "6"},
+	}}
+	b := Localize(verr, LocaleEn)
+	assert.Equal(t, InvalidInput, b.Code)
+	assert.Equal(t, "This field must be at most 150", b.Fields[0].Message)
+	assert.Equal(t, "Input is not valid", b.Fields[1].Message)
+	assert.Empty(t, verr.Fields[0].Message)
+
+	b = Localize(verr, LocaleFa)
+	assert.Equal(t, "مقدار این فیلد باید حداکثر 150 باشد", b.Fields[0].Message)
+	assert.Nil(t, Localize(NewBadRequestError(InvalidInput), LocaleEn).Fields)
+}
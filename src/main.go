@@ -3,5 +3,5 @@ package main
 import "github.com/alidevjimmy/user_microservice_t/app"
 
 func main() {
-	app.StartApp(":8080")
+	app.StartApp(":8080", ":9090")
 }
@@ -4,7 +4,9 @@ import (
 	"github.com/alidevjimmy/user_microservice_t/errors/v1"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/alidevjimmy/go-rest-utils/rest_errors"
 	"github.com/alidevjimmy/user_microservice_t/domains/v1"
@@ -13,6 +15,29 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// userService is the real UserService, tests replace services.UserService by mocks
+var userService = services.UserService
+
+func TestOnlyActiveRefusesOAuthAccessToken(t *testing.T) {
+	os.Setenv("JWT_SECRET", "secret")
+	defer os.Unsetenv("JWT_SECRET")
+	services.UserService = userService
+	token, err := services.AccessToken("1", "client", "openid profile", time.Now())
+	assert.Nil(t, err)
+
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusNotImplemented, "")
+	}, OnlyActive)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+}
+
 func TestOnlyActiveMiddlewareTokenDoesNotExists(t *testing.T) {
 	e := echo.New()
 	e.GET("/", func(c echo.Context) error {
@@ -63,6 +88,7 @@ func TestOnlyActiveUserIsNotActive(t *testing.T) {
 	e.ServeHTTP(res, req)
 
 	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Contains(t, res.Body.String(), `"code":"`+string(errors.UnAuthorizedActive)+`"`)
 }
 
 func TestOnlyActive(t *testing.T) {
@@ -92,7 +118,7 @@ func TestOnlyActive(t *testing.T) {
 
 func TestOnlyActiveFailToGetUser(t *testing.T) {
 	getUserFunc = func(token string) (*domains.PublicUser, rest_errors.RestErr) {
-		return nil,rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+		return nil,errors.NewInternalServerError(nil)
 	}
 
 	services.UserService = &UserServiceMock{}
@@ -111,3 +137,23 @@ func TestOnlyActiveFailToGetUser(t *testing.T) {
 	e.ServeHTTP(res, req)
 	assert.EqualValues(t, http.StatusInternalServerError, res.Code)
 }
+
+func TestOnlyActiveUserDoesNotExist(t *testing.T) {
+	getUserFunc = func(token string) (*domains.PublicUser, rest_errors.RestErr) {
+		return nil, nil
+	}
+
+	services.UserService = &UserServiceMock{}
+
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusNotImplemented, "")
+	}, OnlyActive)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "token")
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+}
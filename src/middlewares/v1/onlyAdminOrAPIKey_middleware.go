@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// APIKeyKey is where OnlyAdminOrAPIKey puts authenticated *domains.APIKey in context
+	APIKeyKey = "api_key"
+
+	HeaderAPIKey = "X-API-Key"
+)
+
+// OnlyAdminOrAPIKey Middleware lets admins in like OnlyAdmin, and machines holding an api key having scope.
+// Key is read from X-API-Key header or from Authorization header in place of a jwt
+func OnlyAdminOrAPIKey(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		admin := OnlyAdmin(next)
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(HeaderAPIKey)
+			if token := BearerToken(c); key == "" && services.IsAPIKey(token) {
+				key = token
+			}
+			if key == "" {
+				return admin(c)
+			}
+			apiKey, err := services.APIKeyService.Authenticate(key, scope)
+			if err != nil {
+				return errors.Respond(c, err)
+			}
+			c.Set(APIKeyKey, apiKey)
+			return next(c)
+		}
+	}
+}
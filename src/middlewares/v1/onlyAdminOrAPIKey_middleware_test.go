@@ -0,0 +1,94 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	authenticateAPIKeyFunc func(key, scope string) (*domains.APIKey, rest_errors.RestErr)
+)
+
+type APIKeyServiceMock struct{}
+
+func (*APIKeyServiceMock) Create(actor domains.Actor, req domains.CreateAPIKeyRequest) (*domains.CreateAPIKeyResponse, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*APIKeyServiceMock) List() ([]domains.APIKey, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*APIKeyServiceMock) Revoke(id uint, actor domains.Actor) (*domains.APIKey, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*APIKeyServiceMock) Authenticate(key, scope string) (*domains.APIKey, rest_errors.RestErr) {
+	return authenticateAPIKeyFunc(key, scope)
+}
+
+func newAPIKeyEcho() *echo.Echo {
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error {
+		if key, ok := c.Get(APIKeyKey).(*domains.APIKey); ok {
+			return c.String(http.StatusNotImplemented, key.Name)
+		}
+		return c.String(http.StatusNotImplemented, "admin")
+	}, OnlyAdminOrAPIKey(services.ScopeUsersRead))
+	return e
+}
+
+func TestOnlyAdminOrAPIKeyHeader(t *testing.T) {
+	authenticateAPIKeyFunc = func(key, scope string) (*domains.APIKey, rest_errors.RestErr) {
+		assert.Equal(t, "umk_abc_secret", key)
+		assert.Equal(t, services.ScopeUsersRead, scope)
+		return &domains.APIKey{Name: "reports"}, nil
+	}
+	services.APIKeyService = &APIKeyServiceMock{}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(HeaderAPIKey, "umk_abc_secret")
+	res := httptest.NewRecorder()
+	newAPIKeyEcho().ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusNotImplemented, res.Code)
+	assert.Equal(t, "reports", res.Body.String())
+}
+
+func TestOnlyAdminOrAPIKeyInAuthorization(t *testing.T) {
+	authenticateAPIKeyFunc = func(key, scope string) (*domains.APIKey, rest_errors.RestErr) {
+		return nil, errors.NewError(errors.InsufficientScope, http.StatusForbidden)
+	}
+	services.APIKeyService = &APIKeyServiceMock{}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer umk_abc_secret")
+	res := httptest.NewRecorder()
+	newAPIKeyEcho().ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusForbidden, res.Code)
+}
+
+func TestOnlyAdminOrAPIKeyFallsBackToAdmin(t *testing.T) {
+	getUserFunc = func(token string) (*domains.PublicUser, rest_errors.RestErr) {
+		assert.Equal(t, "jwt", token)
+		return &domains.PublicUser{ID: 1, IsAdmin: true}, nil
+	}
+	services.UserService = &UserServiceMock{}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "jwt")
+	res := httptest.NewRecorder()
+	newAPIKeyEcho().ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusNotImplemented, res.Code)
+	assert.Equal(t, "admin", res.Body.String())
+}
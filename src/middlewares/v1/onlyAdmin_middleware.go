@@ -1,31 +1,28 @@
 package middlewares
 
 import (
-	"github.com/alidevjimmy/go-rest-utils/rest_errors"
 	"github.com/alidevjimmy/user_microservice_t/errors/v1"
 	"github.com/alidevjimmy/user_microservice_t/services/v1"
 	"github.com/labstack/echo/v4"
-	"net/http"
 )
 
 // OnlyAdmin Middleware make sure who requested is admin
 func OnlyAdmin(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error{
 		// get token from request header
-		token := c.Request().Header.Get(echo.HeaderAuthorization)
+		token := BearerToken(c)
 		if token == "" {
-			er := rest_errors.NewUnauthorizedError(errors.InvalidInputErrorMessage)
-			return c.JSON(http.StatusUnauthorized, er)
+			return errors.Respond(c, errors.NewUnauthorizedError(errors.InvalidInput))
 		}
 		// get user by token
 		user , err := services.UserService.GetUser(token)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, err)
+			return errors.Respond(c, err)
 		}
-		if !user.IsAdmin {
-			er := rest_errors.NewUnauthorizedError(errors.UnAuthorizedAdminErrorMessage)
-			return c.JSON(http.StatusUnauthorized, er)
+		if user == nil || !user.IsAdmin {
+			return errors.Respond(c, errors.NewUnauthorizedError(errors.UnAuthorizedAdmin))
 		}
+		c.Set(UserKey, user)
 		return next(c)
 	}
 }
@@ -23,7 +23,7 @@ func (*UserServiceMock) Register(body domains.RegisterRequest) (*domains.Registe
 	return nil, nil
 }
 
-func (*UserServiceMock) Login(body domains.LoginRequest) (*domains.LoginResponse, rest_errors.RestErr) {
+func (*UserServiceMock) Login(body domains.LoginRequest, device domains.Device) (*domains.LoginResponse, rest_errors.RestErr) {
 	return nil, nil
 }
 
@@ -32,37 +32,75 @@ func (*UserServiceMock) GetUser(token string) (*domains.PublicUser, rest_errors.
 	return getUserFunc(token)
 }
 
+func (*UserServiceMock) GetUserByID(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*UserServiceMock) GetUsersByIDs(ids []uint) ([]domains.PublicUser, rest_errors.RestErr) {
+	return nil, nil
+}
+
 // GetUsers returns all users by filter
-func (*UserServiceMock) GetUsers(params domains.GetUsersRequest) ([]domains.PublicUser, rest_errors.RestErr) {
+func (*UserServiceMock) GetUsers(params domains.GetUsersRequest) (*domains.GetUsersResponse, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*UserServiceMock) SearchUsers(params domains.SearchUsersRequest) ([]domains.PublicUser, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*UserServiceMock) SetActiveState(userId uint, versions domains.Versions, active bool, reason string, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*UserServiceMock) Block(userId uint, versions domains.Versions, req domains.BlockUserRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
 	return nil, nil
 }
 
-// UpdateUserActiveState makes state of active field of user opposite
-func (*UserServiceMock) UpdateUserActiveState(userId uint) (*domains.PublicUser, rest_errors.RestErr) {
+func (*UserServiceMock) Unblock(userId uint, versions domains.Versions, reason string, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
 	return nil, nil
 }
 
-// UpdateUserBlockState makes state of blocked field of user opposite
-func (*UserServiceMock) UpdateUserBlockState(userId uint) (*domains.PublicUser, rest_errors.RestErr) {
+func (*UserServiceMock) LiftExpiredBlocks() (int, rest_errors.RestErr) {
+	return 0, nil
+}
+
+func (*UserServiceMock) DeleteAccount(user *domains.PublicUser, body domains.DeleteAccountRequest, actor domains.Actor) (*domains.DeleteAccountResponse, rest_errors.RestErr) {
 	return nil, nil
 }
 
-func (*UserServiceMock) UpdateUser(userId, token string, body domains.UpdateUserRequest) (*domains.PublicUser, rest_errors.RestErr) {
+func (*UserServiceMock) PurgeDeletedAccounts() (int, rest_errors.RestErr) {
+	return 0, nil
+}
+
+func (*UserServiceMock) UpdateUser(caller *domains.PublicUser, userId string, versions domains.Versions, body domains.UpdateUserRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
 	return nil, nil
 }
 
 // ChangeForgotPassword helps people who forgot their password using verification code
-func (*UserServiceMock) ChangeForgotPassword(body domains.ChangePasswordRequest) (*domains.PublicUser, rest_errors.RestErr) {
+func (*UserServiceMock) ChangeForgotPassword(body domains.ChangePasswordRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
 	// return token
 	return nil, nil
 }
 
 // ActiveUser Change user active state to true using verification code
-func (*UserServiceMock) VerifyUser(body domains.VerifyUserRequest) (*domains.PublicUser, rest_errors.RestErr) {
+func (*UserServiceMock) VerifyUser(body domains.VerifyUserRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
 	// return token
 	return nil, nil
 }
 
+func (*UserServiceMock) UpdatePassword(user *domains.PublicUser, body domains.UpdatePasswordRequest, actor domains.Actor) rest_errors.RestErr {
+	return nil
+}
+
+func (*UserServiceMock) StartPhoneChange(user *domains.PublicUser, body domains.ChangePhoneRequest) rest_errors.RestErr {
+	return nil
+}
+
+func (*UserServiceMock) ChangePhone(user *domains.PublicUser, body domains.ConfirmPhoneChangeRequest, actor domains.Actor, device domains.Device) (*domains.LoginResponse, rest_errors.RestErr) {
+	return nil, nil
+}
+
 func TestOnlyAdminMiddlewareTokenDoesNotExists(t *testing.T) {
 	e := echo.New()
 	e.GET("/", func(c echo.Context) error {
@@ -142,7 +180,7 @@ func TestOnlyAdmin(t *testing.T) {
 
 func TestOnlyAdminFailToGetUser(t *testing.T) {
 	getUserFunc = func(token string) (*domains.PublicUser, rest_errors.RestErr) {
-		return nil,rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+		return nil,errors.NewInternalServerError(nil)
 	}
 
 	services.UserService = &UserServiceMock{}
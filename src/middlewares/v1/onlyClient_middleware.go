@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// ClientKey is where OnlyClient puts authenticated *domains.Client in context
+	ClientKey = "client"
+
+	basicRealm = `Basic realm="user_microservice"`
+)
+
+// OnlyClient Middleware make sure request is sent by a registered client, by http basic auth or client_id and client_secret form fields
+func OnlyClient(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, secret, ok := c.Request().BasicAuth()
+		if !ok {
+			id, secret = c.FormValue("client_id"), c.FormValue("client_secret")
+		}
+		client, err := services.ClientService.Authenticate(id, secret)
+		if err != nil {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, basicRealm)
+			return errors.Respond(c, err)
+		}
+		c.Set(ClientKey, client)
+		return next(c)
+	}
+}
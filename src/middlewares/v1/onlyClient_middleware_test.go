@@ -0,0 +1,88 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	authenticateFunc func(clientID, secret string) (*domains.Client, rest_errors.RestErr)
+)
+
+type ClientServiceMock struct{}
+
+func (*ClientServiceMock) Authenticate(clientID, secret string) (*domains.Client, rest_errors.RestErr) {
+	return authenticateFunc(clientID, secret)
+}
+
+func (*ClientServiceMock) Create(req domains.CreateClientRequest, actor domains.Actor) (*domains.CreateClientResponse, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func newClientEcho() *echo.Echo {
+	e := echo.New()
+	e.POST("/", func(c echo.Context) error {
+		client := c.Get(ClientKey).(*domains.Client)
+		return c.String(http.StatusNotImplemented, client.ClientID)
+	}, OnlyClient)
+	return e
+}
+
+func TestOnlyClientWrongCredentials(t *testing.T) {
+	authenticateFunc = func(clientID, secret string) (*domains.Client, rest_errors.RestErr) {
+		return nil, errors.NewUnauthorizedError(errors.InvalidClient)
+	}
+	services.ClientService = &ClientServiceMock{}
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.SetBasicAuth("gateway", "wrong")
+	res := httptest.NewRecorder()
+	newClientEcho().ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.NotEmpty(t, res.Header().Get(echo.HeaderWWWAuthenticate))
+}
+
+func TestOnlyClientBasicAuth(t *testing.T) {
+	authenticateFunc = func(clientID, secret string) (*domains.Client, rest_errors.RestErr) {
+		assert.Equal(t, "gateway", clientID)
+		assert.Equal(t, "secret", secret)
+		return &domains.Client{ClientID: clientID}, nil
+	}
+	services.ClientService = &ClientServiceMock{}
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.SetBasicAuth("gateway", "secret")
+	res := httptest.NewRecorder()
+	newClientEcho().ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusNotImplemented, res.Code)
+	assert.Equal(t, "gateway", res.Body.String())
+}
+
+func TestOnlyClientFormCredentials(t *testing.T) {
+	authenticateFunc = func(clientID, secret string) (*domains.Client, rest_errors.RestErr) {
+		assert.Equal(t, "gateway", clientID)
+		assert.Equal(t, "secret", secret)
+		return &domains.Client{ClientID: clientID}, nil
+	}
+	services.ClientService = &ClientServiceMock{}
+
+	form := url.Values{"client_id": {"gateway"}, "client_secret": {"secret"}}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	res := httptest.NewRecorder()
+	newClientEcho().ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusNotImplemented, res.Code)
+}
@@ -0,0 +1,23 @@
+package middlewares
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// UserKey is where OnlyActive and OnlyAdmin put authenticated *domains.PublicUser in context
+	UserKey = "user"
+
+	bearerPrefix = "bearer "
+)
+
+// BearerToken reads token from Authorization header, "Bearer " prefix is optional
+func BearerToken(c echo.Context) string {
+	token := strings.TrimSpace(c.Request().Header.Get(echo.HeaderAuthorization))
+	if len(token) > len(bearerPrefix) && strings.EqualFold(token[:len(bearerPrefix)], bearerPrefix) {
+		return strings.TrimSpace(token[len(bearerPrefix):])
+	}
+	return token
+}
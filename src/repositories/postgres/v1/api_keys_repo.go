@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"gorm.io/gorm"
+)
+
+var (
+	APIKeyRepository apiKeyRepositoryInterface = &apiKeyRepository{}
+)
+
+type apiKeyRepository struct {
+	DB *gorm.DB
+}
+
+type apiKeyRepositoryInterface interface {
+	CreateAPIKey(key *domains.APIKey, audit *domains.AuditEntry) rest_errors.RestErr
+	GetAPIKeyByPrefix(prefix string) (*domains.APIKey, rest_errors.RestErr)
+	GetAPIKeys() ([]domains.APIKey, rest_errors.RestErr)
+	RevokeAPIKey(id uint, audit *domains.AuditEntry) (*domains.APIKey, rest_errors.RestErr)
+	TouchAPIKey(id uint, at time.Time) rest_errors.RestErr
+}
+
+func NewAPIKeyRepository(db *gorm.DB) *apiKeyRepository {
+	return &apiKeyRepository{DB: db}
+}
+
+func (a *apiKeyRepository) CreateAPIKey(key *domains.APIKey, audit *domains.AuditEntry) rest_errors.RestErr {
+	err := audited(a.DB, audit, func(tx *gorm.DB) error {
+		return tx.Create(key).Error
+	})
+	if err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// GetAPIKeyByPrefix returns key by its prefix, nil if there is no such key
+func (a *apiKeyRepository) GetAPIKeyByPrefix(prefix string) (*domains.APIKey, rest_errors.RestErr) {
+	key := new(domains.APIKey)
+	err := a.DB.Where("prefix = ?", prefix).First(key).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return key, nil
+}
+
+func (a *apiKeyRepository) GetAPIKeys() ([]domains.APIKey, rest_errors.RestErr) {
+	keys := []domains.APIKey{}
+	if err := a.DB.Order("id").Find(&keys).Error; err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes key by its id and returns it, nil if there is no such key.
+// audit is written only if key was live
+func (a *apiKeyRepository) RevokeAPIKey(id uint, audit *domains.AuditEntry) (*domains.APIKey, rest_errors.RestErr) {
+	key := new(domains.APIKey)
+	err := audited(a.DB, audit, func(tx *gorm.DB) error {
+		if err := tx.First(key, id).Error; err != nil {
+			return err
+		}
+		if key.RevokedAt != nil {
+			return errNothingChanged
+		}
+		now := time.Now()
+		key.RevokedAt = &now
+		return tx.Model(key).Update("revoked_at", now).Error
+	})
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err == errNothingChanged {
+		return key, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return key, nil
+}
+
+// TouchAPIKey records when key was used last
+func (a *apiKeyRepository) TouchAPIKey(id uint, at time.Time) rest_errors.RestErr {
+	err := a.DB.Model(&domains.APIKey{}).Where("id = ?", id).UpdateColumn("last_used_at", at).Error
+	if err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
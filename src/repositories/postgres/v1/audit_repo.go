@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	goerrors "errors"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"gorm.io/gorm"
+)
+
+var (
+	AuditRepository auditRepositoryInterface = &auditRepository{}
+
+	// errNothingChanged rolls back an audited change which found nothing to change, so nothing is logged
+	errNothingChanged = goerrors.New("nothing changed")
+)
+
+type auditRepository struct {
+	DB *gorm.DB
+}
+
+type auditRepositoryInterface interface {
+	GetAuditEntries(params domains.GetAuditLogRequest, beforeID uint, limit int) ([]domains.AuditEntry, rest_errors.RestErr)
+}
+
+func NewAuditRepository(db *gorm.DB) *auditRepository {
+	return &auditRepository{DB: db}
+}
+
+// GetAuditEntries returns at most limit entries matching params, newest first, older than beforeID if it is not zero
+func (a *auditRepository) GetAuditEntries(params domains.GetAuditLogRequest, beforeID uint, limit int) ([]domains.AuditEntry, rest_errors.RestErr) {
+	q := a.DB.Model(&domains.AuditEntry{})
+	if params.UserID != 0 {
+		q = q.Where("target_id = ?", params.UserID)
+	}
+	if params.ActorID != 0 {
+		q = q.Where("actor_id = ?", params.ActorID)
+	}
+	if params.Action != "" {
+		q = q.Where("action = ?", params.Action)
+	}
+	if params.From != nil {
+		q = q.Where("created_at >= ?", *params.From)
+	}
+	if params.To != nil {
+		q = q.Where("created_at <= ?", *params.To)
+	}
+	if beforeID != 0 {
+		q = q.Where("id < ?", beforeID)
+	}
+	entries := []domains.AuditEntry{}
+	if err := q.Order("id DESC").Limit(limit).Find(&entries).Error; err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return entries, nil
+}
+
+// audited runs change and writes entry in one transaction, so the log neither misses nor invents a change.
+// change may fill in Changes of entry, nil entry is not written
+func audited(db *gorm.DB, entry *domains.AuditEntry, change func(tx *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := change(tx); err != nil {
+			return err
+		}
+		if entry == nil {
+			return nil
+		}
+		return tx.Create(entry).Error
+	})
+}
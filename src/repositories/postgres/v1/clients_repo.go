@@ -0,0 +1,48 @@
+package repositories
+
+import (
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"gorm.io/gorm"
+)
+
+var (
+	ClientRepository clientRepositoryInterface = &clientRepository{}
+)
+
+type clientRepository struct {
+	DB *gorm.DB
+}
+
+type clientRepositoryInterface interface {
+	GetClientByClientID(clientID string) (*domains.Client, rest_errors.RestErr)
+	CreateClient(client *domains.Client, audit *domains.AuditEntry) rest_errors.RestErr
+}
+
+func NewClientRepository(db *gorm.DB) *clientRepository {
+	return &clientRepository{DB: db}
+}
+
+// GetClientByClientID returns client by its public id, nil if there is no such client
+func (c *clientRepository) GetClientByClientID(clientID string) (*domains.Client, rest_errors.RestErr) {
+	client := new(domains.Client)
+	err := c.DB.Where("client_id = ?", clientID).First(client).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return client, nil
+}
+
+func (c *clientRepository) CreateClient(client *domains.Client, audit *domains.AuditEntry) rest_errors.RestErr {
+	err := audited(c.DB, audit, func(tx *gorm.DB) error {
+		return tx.Create(client).Error
+	})
+	if err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
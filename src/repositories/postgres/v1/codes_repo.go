@@ -1,9 +1,14 @@
 package repositories
 
 import (
+	"time"
+
 	"github.com/alidevjimmy/go-rest-utils/rest_errors"
 	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	phoneutil "github.com/alidevjimmy/user_microservice_t/utils/phone"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 const ()
@@ -17,13 +22,51 @@ type codeRepository struct {
 }
 
 type codeRepositoryInterface interface {
-	FindCode(phone string, code, reason int) (*domains.Code, rest_errors.RestErr)
+	CreateCode(code *domains.Code) rest_errors.RestErr
+	UseCode(phone string, code, reason, maxAttempts int) (*domains.Code, bool, rest_errors.RestErr)
 }
 
 func NewCodeRepository(db *gorm.DB) *codeRepository {
 	return &codeRepository{DB: db}
 }
 
-func (c *codeRepository) FindCode(phone string, code, reason int) (*domains.Code, rest_errors.RestErr) {
-	return nil, nil
+// CreateCode stores code sent to its phone, phone is expected to be normalized
+func (c *codeRepository) CreateCode(code *domains.Code) rest_errors.RestErr {
+	if err := c.DB.Create(code).Error; err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// UseCode checks code against the latest code sent to phone for reason and deletes it if they match, so a code
+// is used once. A wrong code counts as a failed attempt, codes which expired or failed maxAttempts times are left
+// as they are and never match. It returns the latest code and whether it was used, nil if there is no code
+func (c *codeRepository) UseCode(phone string, code, reason, maxAttempts int) (*domains.Code, bool, rest_errors.RestErr) {
+	latest := new(domains.Code)
+	used := false
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("phone = ? AND code_purpose = ?", phoneutil.NormalizeOrKeep(phone), reason).
+			Order("id DESC").
+			First(latest).Error
+		if err != nil {
+			return err
+		}
+		if latest.FailedAttempts >= maxAttempts || !latest.CodeExpiration.After(time.Now()) {
+			return nil
+		}
+		if latest.Code != code {
+			latest.FailedAttempts++
+			return tx.Model(latest).UpdateColumn("failed_attempts", gorm.Expr("failed_attempts + 1")).Error
+		}
+		used = true
+		return tx.Delete(latest).Error
+	})
+	if err == gorm.ErrRecordNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.NewInternalServerError(err)
+	}
+	return latest, used, nil
 }
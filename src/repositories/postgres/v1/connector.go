@@ -5,6 +5,11 @@ import (
 	"gorm.io/gorm"
 )
 
+// Connect opens the database repositories share
+func Connect() *gorm.DB {
+	return postgresConnector()
+}
+
 func postgresConnector() *gorm.DB {
 	dialector := postgres.New(postgres.Config{
 		DSN: "postgres_db",
@@ -0,0 +1,155 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"gorm.io/gorm"
+)
+
+var (
+	DataExportRepository dataExportRepositoryInterface = &dataExportRepository{}
+)
+
+type dataExportRepository struct {
+	DB *gorm.DB
+}
+
+type dataExportRepositoryInterface interface {
+	CreateDataExport(export *domains.DataExport, audit *domains.AuditEntry) rest_errors.RestErr
+	GetDataExport(id uint) (*domains.DataExport, rest_errors.RestErr)
+	GetDataExportArchive(id uint) (*domains.DataExport, rest_errors.RestErr)
+	ClaimDataExports(limit int, lease time.Duration) ([]domains.DataExport, rest_errors.RestErr)
+	UpdateDataExport(export *domains.DataExport) rest_errors.RestErr
+	DeleteExpiredDataExports(at time.Time) (int64, rest_errors.RestErr)
+	CollectUserData(userID uint) (*domains.DataExportArchive, rest_errors.RestErr)
+}
+
+func NewDataExportRepository(db *gorm.DB) *dataExportRepository {
+	return &dataExportRepository{DB: db}
+}
+
+// CreateDataExport queues export, audit is told id of the export
+func (d *dataExportRepository) CreateDataExport(export *domains.DataExport, audit *domains.AuditEntry) rest_errors.RestErr {
+	err := audited(d.DB, audit, func(tx *gorm.DB) error {
+		if err := tx.Create(export).Error; err != nil {
+			return err
+		}
+		if audit != nil {
+			if audit.Changes == nil {
+				audit.Changes = domains.AuditChanges{}
+			}
+			audit.Changes["export_id"] = domains.AuditChange{After: export.ID}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// GetDataExport returns export by id without its archive, nil if there is no such export
+func (d *dataExportRepository) GetDataExport(id uint) (*domains.DataExport, rest_errors.RestErr) {
+	return d.getDataExport(d.DB.Omit("archive"), id)
+}
+
+// GetDataExportArchive returns export by id with its archive, nil if there is no such export
+func (d *dataExportRepository) GetDataExportArchive(id uint) (*domains.DataExport, rest_errors.RestErr) {
+	return d.getDataExport(d.DB, id)
+}
+
+func (d *dataExportRepository) getDataExport(q *gorm.DB, id uint) (*domains.DataExport, rest_errors.RestErr) {
+	export := new(domains.DataExport)
+	err := q.First(export, id).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return export, nil
+}
+
+// ClaimDataExports takes at most limit due pending exports, oldest first, and hides them from other workers for lease
+func (d *dataExportRepository) ClaimDataExports(limit int, lease time.Duration) ([]domains.DataExport, rest_errors.RestErr) {
+	exports := []domains.DataExport{}
+	now := time.Now()
+	err := d.DB.Raw(`UPDATE data_exports SET next_attempt_at = ? WHERE id IN (
+			SELECT id FROM data_exports WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY next_attempt_at, id LIMIT ? FOR UPDATE SKIP LOCKED)
+		RETURNING *`, now.Add(lease), domains.DataExportPending, now, limit).Scan(&exports).Error
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return exports, nil
+}
+
+// UpdateDataExport saves outcome of an attempt to assemble export
+func (d *dataExportRepository) UpdateDataExport(export *domains.DataExport) rest_errors.RestErr {
+	err := d.DB.Model(export).Select("status", "archive", "attempts", "next_attempt_at", "last_error", "completed_at", "expires_at").
+		Updates(export).Error
+	if err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// DeleteExpiredDataExports removes exports whose links expired before at with their archives, and failed ones
+// older than a day. It returns how many were removed
+func (d *dataExportRepository) DeleteExpiredDataExports(at time.Time) (int64, rest_errors.RestErr) {
+	res := d.DB.Where("expires_at < ? OR (status = ? AND updated_at < ?)", at, domains.DataExportFailed, at.Add(-24*time.Hour)).
+		Delete(&domains.DataExport{})
+	if res.Error != nil {
+		return 0, errors.NewInternalServerError(res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+// CollectUserData reads personal data of user from one snapshot, so parts of the archive agree with each other.
+// Users deleted in grace period are collected too, it returns nil if there is no such user
+func (d *dataExportRepository) CollectUserData(userID uint) (*domains.DataExportArchive, rest_errors.RestErr) {
+	var archive *domains.DataExportArchive
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		user := new(domains.User)
+		if err := tx.Unscoped().First(user, userID).Error; err != nil {
+			return err
+		}
+		sessions := []domains.Session{}
+		if err := tx.Where("user_id = ?", userID).Order("id").Find(&sessions).Error; err != nil {
+			return err
+		}
+		entries := []domains.AuditEntry{}
+		if err := tx.Where("target_id = ? OR actor_id = ?", userID, userID).Order("id").Find(&entries).Error; err != nil {
+			return err
+		}
+		codes := []domains.Code{}
+		if err := tx.Unscoped().Where("phone = ?", user.Phone).Order("id").Find(&codes).Error; err != nil {
+			return err
+		}
+		archive = &domains.DataExportArchive{
+			ExportedAt:   time.Now(),
+			Profile:      user.Public(),
+			Sessions:     make([]domains.ExportedSession, len(sessions)),
+			AuditEntries: entries,
+			Codes:        make([]domains.ExportedCode, len(codes)),
+		}
+		for i, session := range sessions {
+			archive.Sessions[i] = domains.ExportedSession{Session: session, RevokedAt: session.RevokedAt}
+		}
+		for i, code := range codes {
+			archive.Codes[i] = domains.ExportedCode{Purpose: code.CodePurpose, SentAt: code.CreatedAt, ExpiresAt: code.CodeExpiration}
+		}
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return archive, nil
+}
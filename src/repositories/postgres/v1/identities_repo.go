@@ -0,0 +1,113 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"gorm.io/gorm"
+)
+
+var (
+	IdentityRepository identityRepositoryInterface = &identityRepository{}
+)
+
+type identityRepository struct {
+	DB *gorm.DB
+}
+
+type identityRepositoryInterface interface {
+	GetIdentity(provider, subject string) (*domains.Identity, rest_errors.RestErr)
+	GetIdentitiesByUserID(userID uint) ([]domains.Identity, rest_errors.RestErr)
+	CreateIdentity(identity *domains.Identity, audit *domains.AuditEntry) rest_errors.RestErr
+	DeleteIdentity(userID uint, provider string, audit *domains.AuditEntry) (bool, rest_errors.RestErr)
+	CreateSocialLoginState(state *domains.SocialLoginState) rest_errors.RestErr
+	ConsumeSocialLoginState(stateHash string) (*domains.SocialLoginState, rest_errors.RestErr)
+}
+
+func NewIdentityRepository(db *gorm.DB) *identityRepository {
+	return &identityRepository{DB: db}
+}
+
+// GetIdentity returns identity by its provider and subject, nil if no user linked it
+func (i *identityRepository) GetIdentity(provider, subject string) (*domains.Identity, rest_errors.RestErr) {
+	identity := new(domains.Identity)
+	err := i.DB.Where("provider = ? AND subject = ?", provider, subject).First(identity).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return identity, nil
+}
+
+func (i *identityRepository) GetIdentitiesByUserID(userID uint) ([]domains.Identity, rest_errors.RestErr) {
+	identities := []domains.Identity{}
+	if err := i.DB.Where("user_id = ?", userID).Order("id").Find(&identities).Error; err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return identities, nil
+}
+
+func (i *identityRepository) CreateIdentity(identity *domains.Identity, audit *domains.AuditEntry) rest_errors.RestErr {
+	err := audited(i.DB, audit, func(tx *gorm.DB) error {
+		return tx.Create(identity).Error
+	})
+	if err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// DeleteIdentity unlinks identities of provider from user and reports whether there was any,
+// rows are really deleted so the identity can be linked again
+func (i *identityRepository) DeleteIdentity(userID uint, provider string, audit *domains.AuditEntry) (bool, rest_errors.RestErr) {
+	err := audited(i.DB, audit, func(tx *gorm.DB) error {
+		res := tx.Unscoped().Where("user_id = ? AND provider = ?", userID, provider).Delete(&domains.Identity{})
+		if res.Error == nil && res.RowsAffected == 0 {
+			return errNothingChanged
+		}
+		return res.Error
+	})
+	if err == errNothingChanged {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.NewInternalServerError(err)
+	}
+	return true, nil
+}
+
+func (i *identityRepository) CreateSocialLoginState(state *domains.SocialLoginState) rest_errors.RestErr {
+	if err := i.DB.Create(state).Error; err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// ConsumeSocialLoginState deletes live state and returns it, nil if state does not exist, is expired or is used already
+func (i *identityRepository) ConsumeSocialLoginState(stateHash string) (*domains.SocialLoginState, rest_errors.RestErr) {
+	state := new(domains.SocialLoginState)
+	err := i.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("state_hash = ? AND expires_at > ?", stateHash, time.Now()).First(state).Error; err != nil {
+			return err
+		}
+		res := tx.Unscoped().Delete(state)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return state, nil
+}
@@ -1,29 +1,315 @@
 CREATE TABLE IF NOT EXISTS users
 (
     id         SERIAL PRIMARY KEY,
-    phone      VARCHAR(12)  NOT NULL UNIQUE,
+    phone      VARCHAR(16)  NOT NULL UNIQUE, -- E.164, see utils/phone
     username   VARCHAR(50)  NOT NULL UNIQUE,
-    password   VARCHAR(300) NOT NULL,
+    password   VARCHAR(300) NOT NULL, -- bcrypt, legacy sha256 hashes are rehashed at login, see utils/password
     name       VARCHAR(255) NOT NULL,
     family     VARCHAR(255) NOT NULL,
     age        INT          NOT NULL,
     active     BOOL         NOT NULL DEFAULT (FALSE),
     blocked    BOOL         NOT NULL DEFAULT (FALSE),
+    block_reason   VARCHAR(500) NOT NULL DEFAULT '',
+    blocked_until  TIMESTAMP, -- NULL blocks until unblocked, see services.RunBlockExpiry
+    deactivated_at TIMESTAMP, -- NULL for active users and users not verified yet
+    failed_logins  INT          NOT NULL DEFAULT 0,
+    locked_until   TIMESTAMP,
     is_admin   BOOL         NOT NULL DEFAULT (FALSE),
+    version    INT          NOT NULL DEFAULT 1, -- bumped by every change, see If-Match of user updates
     created_at TIMESTAMP    NOT NULL DEFAULT now(),
     updated_at TIMESTAMP    NOT NULL DEFAULT now(),
     deleted_at TIMESTAMP    
 );
 
-CREATE TYPE code_purposes AS ENUM ('RESET_PASSWORD','ACTIVATION');
+CREATE INDEX IF NOT EXISTS users_created_at_id_idx ON users (created_at, id);
+CREATE INDEX IF NOT EXISTS users_blocked_until_idx ON users (blocked_until) WHERE blocked AND blocked_until IS NOT NULL;
+-- deleted users are purged after grace period, see services.RunAccountPurge
+CREATE INDEX IF NOT EXISTS users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+-- usernames are unique regardless of case, lookups use lower(username) as well
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_lower_idx ON users (lower(username));
 
-CREATE TABLE IF NOT EXISTS verification_codes
+-- normalize_fa must stay in sync with utils/persian.Normalize
+CREATE OR REPLACE FUNCTION normalize_fa(s TEXT) RETURNS TEXT AS
+$$
+SELECT btrim(regexp_replace(lower(translate(s,
+    'يىئكةۀأإٱ۰۱۲۳۴۵۶۷۸۹٠١٢٣٤٥٦٧٨٩' || U&'\200C\200D\200F\0640\064B\064C\064D\064E\064F\0650\0651\0652',
+    'یییکههااا01234567890123456789')), '\s+', ' ', 'g'))
+$$ LANGUAGE SQL IMMUTABLE STRICT;
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS users_name_trgm_idx ON users USING gin (normalize_fa(name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_family_trgm_idx ON users USING gin (normalize_fa(family) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_username_trgm_idx ON users USING gin (normalize_fa(username) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_phone_trgm_idx ON users USING gin (phone gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_fts_idx ON users
+    USING gin (to_tsvector('simple', normalize_fa(name || ' ' || family || ' ' || username)));
+
+CREATE TABLE IF NOT EXISTS codes
+(
+    id              SERIAL PRIMARY KEY,
+    phone           VARCHAR(16) NOT NULL,
+    code            INT         NOT NULL,
+    code_purpose    INT         NOT NULL,
+    code_expiration TIMESTAMP   NOT NULL,
+    failed_attempts INT         NOT NULL DEFAULT 0, -- wrong codes tried against this one, see services.MaxCodeAttempts
+    created_at      TIMESTAMP   NOT NULL DEFAULT now(),
+    updated_at      TIMESTAMP   NOT NULL DEFAULT now(),
+    deleted_at      TIMESTAMP -- phone is not a reference to users, codes of phone changes go to numbers no user has yet
+);
+
+-- only the latest code of a phone and purpose is verified, used codes are deleted
+CREATE INDEX IF NOT EXISTS codes_phone_purpose_idx ON codes (phone, code_purpose, id) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS clients
+(
+    id            SERIAL PRIMARY KEY,
+    client_id     VARCHAR(64)  NOT NULL UNIQUE,
+    secret_hash   VARCHAR(64)  NOT NULL DEFAULT '', -- sha256 of secret, empty for public clients
+    name          VARCHAR(255) NOT NULL,
+    scopes        TEXT         NOT NULL DEFAULT '',
+    redirect_uris TEXT         NOT NULL DEFAULT '',
+    grant_types   TEXT         NOT NULL DEFAULT 'client_credentials',
+    public        BOOL         NOT NULL DEFAULT (FALSE),
+    created_at    TIMESTAMP    NOT NULL DEFAULT now(),
+    updated_at    TIMESTAMP    NOT NULL DEFAULT now(),
+    deleted_at    TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS authorization_codes
+(
+    id                    SERIAL PRIMARY KEY,
+    code_hash             VARCHAR(64)  NOT NULL UNIQUE,
+    client_id             VARCHAR(64)  NOT NULL REFERENCES clients (client_id) ON DELETE CASCADE,
+    user_id               INT          NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    redirect_uri          TEXT         NOT NULL,
+    scope                 TEXT         NOT NULL DEFAULT '',
+    nonce                 VARCHAR(255) NOT NULL DEFAULT '',
+    code_challenge        VARCHAR(128) NOT NULL DEFAULT '',
+    code_challenge_method VARCHAR(10)  NOT NULL DEFAULT '',
+    auth_time             TIMESTAMP    NOT NULL,
+    expires_at            TIMESTAMP    NOT NULL,
+    used_at               TIMESTAMP,
+    created_at            TIMESTAMP    NOT NULL DEFAULT now(),
+    updated_at            TIMESTAMP    NOT NULL DEFAULT now(),
+    deleted_at            TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens
+(
+    id         SERIAL PRIMARY KEY,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    client_id  VARCHAR(64) NOT NULL REFERENCES clients (client_id) ON DELETE CASCADE,
+    user_id    INT         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    scope      TEXT        NOT NULL DEFAULT '',
+    expires_at TIMESTAMP   NOT NULL,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP   NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP   NOT NULL DEFAULT now(),
+    deleted_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS consents
+(
+    id         SERIAL PRIMARY KEY,
+    user_id    INT         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    client_id  VARCHAR(64) NOT NULL REFERENCES clients (client_id) ON DELETE CASCADE,
+    scope      TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMP   NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP   NOT NULL DEFAULT now(),
+    deleted_at TIMESTAMP,
+    UNIQUE (user_id, client_id)
+);
+
+CREATE TABLE IF NOT EXISTS identities
+(
+    id         SERIAL PRIMARY KEY,
+    user_id    INT          NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    provider   VARCHAR(32)  NOT NULL,
+    subject    VARCHAR(255) NOT NULL,
+    email      VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP    NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP    NOT NULL DEFAULT now(),
+    deleted_at TIMESTAMP,
+    UNIQUE (provider, subject)
+);
+
+CREATE TABLE IF NOT EXISTS social_login_states
+(
+    id            SERIAL PRIMARY KEY,
+    state_hash    VARCHAR(64)  NOT NULL UNIQUE,
+    provider      VARCHAR(32)  NOT NULL,
+    nonce         VARCHAR(255) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    link_user_id  INT          NOT NULL DEFAULT 0,
+    expires_at    TIMESTAMP    NOT NULL,
+    created_at    TIMESTAMP    NOT NULL DEFAULT now(),
+    updated_at    TIMESTAMP    NOT NULL DEFAULT now(),
+    deleted_at    TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS api_keys
+(
+    id           SERIAL PRIMARY KEY,
+    name         VARCHAR(255) NOT NULL,
+    prefix       VARCHAR(32)  NOT NULL UNIQUE,
+    key_hash     VARCHAR(64)  NOT NULL,
+    scopes       TEXT         NOT NULL DEFAULT '',
+    created_by   INT          REFERENCES users (id) ON DELETE SET NULL,
+    expires_at   TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at   TIMESTAMP,
+    created_at   TIMESTAMP    NOT NULL DEFAULT now(),
+    updated_at   TIMESTAMP    NOT NULL DEFAULT now(),
+    deleted_at   TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS passkeys
 (
     id              SERIAL PRIMARY KEY,
-    phone         INT           NOT NULL,
-    code            INT           NOT NULL,
-    code_purpose    code_purposes NOT NULL,
-    expiration_time TIMESTAMP     NOT NULL,
+    user_id         INT           NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name            VARCHAR(64)   NOT NULL DEFAULT '',
+    credential_id   VARCHAR(1400) NOT NULL UNIQUE,
+    public_key      BYTEA         NOT NULL,
+    sign_count      BIGINT        NOT NULL DEFAULT 0,
+    backup_eligible BOOLEAN       NOT NULL DEFAULT false,
+    last_used_at    TIMESTAMP,
     created_at      TIMESTAMP     NOT NULL DEFAULT now(),
-    CONSTRAINT users_phone_fkey FOREIGN KEY (phone) REFERENCES users (phone) ON DELETE CASCADE
-);
\ No newline at end of file
+    updated_at      TIMESTAMP     NOT NULL DEFAULT now(),
+    deleted_at      TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS passkey_challenges
+(
+    id             SERIAL PRIMARY KEY,
+    challenge_hash VARCHAR(64) NOT NULL UNIQUE,
+    ceremony       VARCHAR(16) NOT NULL,
+    user_id        INT         NOT NULL DEFAULT 0,
+    expires_at     TIMESTAMP   NOT NULL,
+    created_at     TIMESTAMP   NOT NULL DEFAULT now(),
+    updated_at     TIMESTAMP   NOT NULL DEFAULT now(),
+    deleted_at     TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS sessions
+(
+    id           SERIAL PRIMARY KEY,
+    user_id      INT          NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    user_agent   TEXT         NOT NULL DEFAULT '',
+    device       VARCHAR(128) NOT NULL DEFAULT '',
+    ip           VARCHAR(64)  NOT NULL DEFAULT '',
+    last_seen_at TIMESTAMP    NOT NULL,
+    expires_at   TIMESTAMP    NOT NULL,
+    revoked_at   TIMESTAMP,
+    created_at   TIMESTAMP    NOT NULL DEFAULT now(),
+    updated_at   TIMESTAMP    NOT NULL DEFAULT now(),
+    deleted_at   TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+
+-- audit_log is append-only, actor and target are kept after their users are deleted
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id               BIGSERIAL PRIMARY KEY,
+    actor_id         INT,
+    actor_api_key_id INT,
+    target_id        INT,
+    action           VARCHAR(64) NOT NULL,
+    changes          JSONB       NOT NULL DEFAULT '{}',
+    ip               VARCHAR(64) NOT NULL DEFAULT '',
+    request_id       VARCHAR(64) NOT NULL DEFAULT '',
+    created_at       TIMESTAMP   NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_target_id_idx ON audit_log (target_id, id);
+CREATE INDEX IF NOT EXISTS audit_log_actor_id_idx ON audit_log (actor_id, id);
+CREATE INDEX IF NOT EXISTS audit_log_action_idx ON audit_log (action, id);
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE
+    ON audit_log
+    FOR EACH STATEMENT
+EXECUTE PROCEDURE audit_log_append_only();
+
+-- outbox holds domain events written with the change they tell about until relay publishes them
+CREATE TABLE IF NOT EXISTS outbox
+(
+    id              BIGSERIAL PRIMARY KEY,
+    type            VARCHAR(64) NOT NULL,
+    user_id         INT         NOT NULL,
+    payload         JSONB       NOT NULL,
+    created_at      TIMESTAMP   NOT NULL DEFAULT now(),
+    next_attempt_at TIMESTAMP   NOT NULL DEFAULT now(),
+    published_at    TIMESTAMP,
+    attempts        INT         NOT NULL DEFAULT 0,
+    last_error      TEXT        NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (next_attempt_at, id) WHERE published_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS webhooks
+(
+    id          SERIAL PRIMARY KEY,
+    url         VARCHAR(2048) NOT NULL,
+    description VARCHAR(255)  NOT NULL DEFAULT '',
+    events      TEXT          NOT NULL DEFAULT '',
+    secret      VARCHAR(128)  NOT NULL,
+    created_by  INT REFERENCES users (id) ON DELETE SET NULL,
+    created_at  TIMESTAMP     NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMP     NOT NULL DEFAULT now(),
+    deleted_at  TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id               BIGSERIAL PRIMARY KEY,
+    webhook_id       INT         NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    event_id         BIGINT      NOT NULL,
+    event_type       VARCHAR(64) NOT NULL,
+    payload          JSONB       NOT NULL,
+    status           VARCHAR(16) NOT NULL DEFAULT 'pending',
+    attempts         INT         NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMP   NOT NULL DEFAULT now(),
+    last_status_code INT         NOT NULL DEFAULT 0,
+    last_error       TEXT        NOT NULL DEFAULT '',
+    delivered_at     TIMESTAMP,
+    created_at       TIMESTAMP   NOT NULL DEFAULT now(),
+    updated_at       TIMESTAMP   NOT NULL DEFAULT now(),
+    -- relay publishes events at least once, an event is queued once per webhook
+    UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at, id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id, id);
+
+-- data_exports are assembled by services.RunDataExports and removed with their archives once links expire
+CREATE TABLE IF NOT EXISTS data_exports
+(
+    id              SERIAL PRIMARY KEY,
+    user_id         INT         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    format          VARCHAR(8)  NOT NULL DEFAULT 'json',
+    status          VARCHAR(16) NOT NULL DEFAULT 'pending',
+    requested_by    INT         NOT NULL,
+    token_hash      VARCHAR(64) NOT NULL UNIQUE,
+    archive         BYTEA,
+    attempts        INT         NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP   NOT NULL DEFAULT now(),
+    last_error      TEXT        NOT NULL DEFAULT '',
+    completed_at    TIMESTAMP,
+    expires_at      TIMESTAMP,
+    created_at      TIMESTAMP   NOT NULL DEFAULT now(),
+    updated_at      TIMESTAMP   NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS data_exports_pending_idx ON data_exports (next_attempt_at, id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS data_exports_expires_at_idx ON data_exports (expires_at);
@@ -0,0 +1,27 @@
+package repositories
+
+import (
+	_ "embed"
+
+	"gorm.io/gorm"
+)
+
+// initSQL creates whatever table, index and function of the schema is missing
+//
+//go:embed init.sql
+var initSQL string
+
+// migrateSQL upgrades tables made by older versions of initSQL, it must run first as initSQL indexes new columns
+//
+//go:embed migrate.sql
+var migrateSQL string
+
+// Migrate brings schema of db up to date, every statement of it is idempotent so it runs on every start
+func Migrate(db *gorm.DB) error {
+	for _, script := range []string{migrateSQL, initSQL} {
+		if err := db.Exec(script).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+-- migrate.sql upgrades tables made by older versions of init.sql, it runs before init.sql on every start so
+-- each statement must be harmless when run again, see Migrate. Tables missing here are created by init.sql
+
+-- phones are stored in E.164 form, see utils/phone. Two users having one number in different forms stop the
+-- migration, they have to be merged by hand
+ALTER TABLE IF EXISTS users ALTER COLUMN phone TYPE VARCHAR(16);
+
+DO
+$$
+BEGIN
+    IF to_regclass('users') IS NOT NULL THEN
+        UPDATE users
+        SET phone = CASE
+                        WHEN phone ~ '^0098[0-9]{10}$' THEN '+' || substr(phone, 3)
+                        WHEN phone ~ '^0[0-9]{10}$' THEN '+98' || substr(phone, 2)
+                        WHEN phone ~ '^98[0-9]{10}$' THEN '+' || phone
+                        WHEN phone ~ '^9[0-9]{9}$' THEN '+98' || phone
+                        ELSE phone
+            END
+        WHERE phone !~ '^\+';
+    END IF;
+END;
+$$;
+
+-- verification_codes is replaced by codes. Its phones were numbers without trunk zero and its purposes an enum,
+-- they are copied in forms codes keep and the old table is dropped so its codes are not copied twice
+DO
+$$
+BEGIN
+    IF to_regclass('verification_codes') IS NULL THEN
+        RETURN;
+    END IF;
+    IF to_regclass('codes') IS NULL THEN
+        ALTER TABLE verification_codes RENAME TO codes;
+        ALTER TABLE codes DROP CONSTRAINT IF EXISTS users_phone_fkey;
+        ALTER TABLE codes ALTER COLUMN phone TYPE VARCHAR(16) USING '+98' || phone::TEXT;
+        ALTER TABLE codes ALTER COLUMN code_purpose TYPE INT
+            USING CASE code_purpose::TEXT WHEN 'ACTIVATION' THEN 1 ELSE 2 END;
+        ALTER TABLE codes RENAME COLUMN expiration_time TO code_expiration;
+    ELSE
+        INSERT INTO codes (phone, code, code_purpose, code_expiration, created_at, updated_at)
+        SELECT '+98' || phone::TEXT,
+               code,
+               CASE code_purpose::TEXT WHEN 'ACTIVATION' THEN 1 ELSE 2 END,
+               expiration_time,
+               created_at,
+               created_at
+        FROM verification_codes;
+        DROP TABLE verification_codes;
+    END IF;
+END;
+$$;
+
+DROP TYPE IF EXISTS code_purposes;
+
+ALTER TABLE IF EXISTS codes
+    ADD COLUMN IF NOT EXISTS updated_at      TIMESTAMP NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS deleted_at      TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS failed_attempts INT       NOT NULL DEFAULT 0;
+
+-- users are blocked with a reason and optionally until a time, and locked for a while after failed logins
+ALTER TABLE IF EXISTS users
+    ADD COLUMN IF NOT EXISTS block_reason  VARCHAR(500) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS blocked_until TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS locked_until  TIMESTAMP;
+
+-- deactivated users are told from users not verified yet by deactivated_at, failed logins count towards a lock
+ALTER TABLE IF EXISTS users
+    ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS failed_logins  INT NOT NULL DEFAULT 0;
+
+-- existing users start at version 1 like new ones, see If-Match of user updates
+ALTER TABLE IF EXISTS users
+    ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
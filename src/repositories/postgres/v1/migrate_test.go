@@ -0,0 +1,37 @@
+package repositories
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func migrateTest(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+	gdb, err := gorm.Open(postgres.New(postgres.Config{Conn: db, PreferSimpleProtocol: true}), &gorm.Config{})
+	assert.Nil(t, err)
+	return gdb, mock
+}
+
+func TestMigrateUpgradesTablesBeforeCreatingMissingOnes(t *testing.T) {
+	gdb, mock := migrateTest(t)
+	mock.ExpectExec(`(?s)^-- migrate.sql .*ALTER TABLE IF EXISTS users ALTER COLUMN phone`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^CREATE TABLE IF NOT EXISTS users`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Nil(t, Migrate(gdb))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrateStopsAtFailedScript(t *testing.T) {
+	gdb, mock := migrateTest(t)
+	mock.ExpectExec(`^-- migrate.sql`).WillReturnError(errors.New("duplicate key value violates unique constraint"))
+
+	assert.NotNil(t, Migrate(gdb))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,122 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"gorm.io/gorm"
+)
+
+var (
+	OAuthRepository oauthRepositoryInterface = &oauthRepository{}
+)
+
+type oauthRepository struct {
+	DB *gorm.DB
+}
+
+type oauthRepositoryInterface interface {
+	CreateAuthorizationCode(code *domains.AuthorizationCode) rest_errors.RestErr
+	ConsumeAuthorizationCode(codeHash string) (*domains.AuthorizationCode, rest_errors.RestErr)
+	CreateRefreshToken(token *domains.RefreshToken) rest_errors.RestErr
+	RotateRefreshToken(tokenHash, clientID string, next *domains.RefreshToken) (*domains.RefreshToken, rest_errors.RestErr)
+	GetConsent(userID uint, clientID string) (*domains.Consent, rest_errors.RestErr)
+	SaveConsent(consent *domains.Consent) rest_errors.RestErr
+}
+
+func NewOAuthRepository(db *gorm.DB) *oauthRepository {
+	return &oauthRepository{DB: db}
+}
+
+func (o *oauthRepository) CreateAuthorizationCode(code *domains.AuthorizationCode) rest_errors.RestErr {
+	if err := o.DB.Create(code).Error; err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// ConsumeAuthorizationCode marks code used and returns it, nil if code does not exist or is used already
+func (o *oauthRepository) ConsumeAuthorizationCode(codeHash string) (*domains.AuthorizationCode, rest_errors.RestErr) {
+	code := new(domains.AuthorizationCode)
+	err := o.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("code_hash = ? AND used_at IS NULL", codeHash).First(code).Error; err != nil {
+			return err
+		}
+		res := tx.Model(code).Where("used_at IS NULL").Update("used_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return code, nil
+}
+
+func (o *oauthRepository) CreateRefreshToken(token *domains.RefreshToken) rest_errors.RestErr {
+	if err := o.DB.Create(token).Error; err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// RotateRefreshToken revokes live token of client with tokenHash and stores next in its place, nil if there is no such live token
+func (o *oauthRepository) RotateRefreshToken(tokenHash, clientID string, next *domains.RefreshToken) (*domains.RefreshToken, rest_errors.RestErr) {
+	current := new(domains.RefreshToken)
+	err := o.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("token_hash = ? AND client_id = ? AND revoked_at IS NULL AND expires_at > ?", tokenHash, clientID, time.Now()).
+			First(current).Error
+		if err != nil {
+			return err
+		}
+		res := tx.Model(current).Where("revoked_at IS NULL").Update("revoked_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		next.ClientID, next.UserID, next.Scope = current.ClientID, current.UserID, current.Scope
+		return tx.Create(next).Error
+	})
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return current, nil
+}
+
+// GetConsent returns scopes user granted to client, nil if user never granted any
+func (o *oauthRepository) GetConsent(userID uint, clientID string) (*domains.Consent, rest_errors.RestErr) {
+	consent := new(domains.Consent)
+	err := o.DB.Where("user_id = ? AND client_id = ?", userID, clientID).First(consent).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return consent, nil
+}
+
+// SaveConsent creates consent of user to client or replaces its scopes
+func (o *oauthRepository) SaveConsent(consent *domains.Consent) rest_errors.RestErr {
+	err := o.DB.Where(domains.Consent{UserID: consent.UserID, ClientID: consent.ClientID}).
+		Assign(domains.Consent{Scope: consent.Scope}).
+		FirstOrCreate(consent).Error
+	if err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"gorm.io/gorm"
+)
+
+var (
+	OutboxRepository outboxRepositoryInterface = &outboxRepository{}
+)
+
+type outboxRepository struct {
+	DB *gorm.DB
+}
+
+type outboxRepositoryInterface interface {
+	ClaimOutboxEvents(limit int, lease time.Duration) ([]domains.OutboxEvent, rest_errors.RestErr)
+	MarkOutboxEventPublished(id uint, at time.Time) rest_errors.RestErr
+	MarkOutboxEventFailed(id uint, reason string, retryAt time.Time) rest_errors.RestErr
+}
+
+func NewOutboxRepository(db *gorm.DB) *outboxRepository {
+	return &outboxRepository{DB: db}
+}
+
+// ClaimOutboxEvents takes at most limit due events, oldest first, and hides them from other relays for lease.
+// Events of a user are not taken while an earlier event of the user waits, so they are published in order
+func (o *outboxRepository) ClaimOutboxEvents(limit int, lease time.Duration) ([]domains.OutboxEvent, rest_errors.RestErr) {
+	events := []domains.OutboxEvent{}
+	now := time.Now()
+	err := o.DB.Raw(`UPDATE outbox SET next_attempt_at = ? WHERE id IN (
+			SELECT id FROM outbox o WHERE published_at IS NULL AND next_attempt_at <= ?
+			AND NOT EXISTS (SELECT 1 FROM outbox e WHERE e.user_id = o.user_id AND e.published_at IS NULL AND e.id < o.id)
+			ORDER BY id LIMIT ? FOR UPDATE SKIP LOCKED)
+		RETURNING *`, now.Add(lease), now, limit).Scan(&events).Error
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return events, nil
+}
+
+func (o *outboxRepository) MarkOutboxEventPublished(id uint, at time.Time) rest_errors.RestErr {
+	err := o.DB.Model(&domains.OutboxEvent{}).Where("id = ?", id).Update("published_at", at).Error
+	if err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// MarkOutboxEventFailed records why publishing failed, event is taken again at retryAt
+func (o *outboxRepository) MarkOutboxEventFailed(id uint, reason string, retryAt time.Time) rest_errors.RestErr {
+	err := o.DB.Model(&domains.OutboxEvent{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"last_error":      reason,
+		"next_attempt_at": retryAt,
+	}).Error
+	if err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// publish writes event of user to outbox in tx, data of event is user as it is in tx
+func publish(tx *gorm.DB, eventType string, user *domains.User) error {
+	data, err := json.Marshal(user.Public())
+	if err != nil {
+		return err
+	}
+	return tx.Create(&domains.OutboxEvent{Type: eventType, UserID: user.ID, Payload: string(data), NextAttemptAt: time.Now()}).Error
+}
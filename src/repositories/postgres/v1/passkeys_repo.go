@@ -0,0 +1,126 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"gorm.io/gorm"
+)
+
+var (
+	PasskeyRepository passkeyRepositoryInterface = &passkeyRepository{}
+)
+
+type passkeyRepository struct {
+	DB *gorm.DB
+}
+
+type passkeyRepositoryInterface interface {
+	GetPasskeyByCredentialID(credentialID string) (*domains.Passkey, rest_errors.RestErr)
+	GetPasskeysByUserID(userID uint) ([]domains.Passkey, rest_errors.RestErr)
+	CreatePasskey(passkey *domains.Passkey, audit *domains.AuditEntry) rest_errors.RestErr
+	UpdatePasskeySignCount(id uint, signCount uint32, usedAt time.Time) rest_errors.RestErr
+	DeletePasskey(userID, id uint, audit *domains.AuditEntry) (bool, rest_errors.RestErr)
+	CreatePasskeyChallenge(challenge *domains.PasskeyChallenge) rest_errors.RestErr
+	ConsumePasskeyChallenge(challengeHash, ceremony string) (*domains.PasskeyChallenge, rest_errors.RestErr)
+}
+
+func NewPasskeyRepository(db *gorm.DB) *passkeyRepository {
+	return &passkeyRepository{DB: db}
+}
+
+// GetPasskeyByCredentialID returns passkey by its credential id, nil if it is not registered
+func (p *passkeyRepository) GetPasskeyByCredentialID(credentialID string) (*domains.Passkey, rest_errors.RestErr) {
+	passkey := new(domains.Passkey)
+	err := p.DB.Where("credential_id = ?", credentialID).First(passkey).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return passkey, nil
+}
+
+func (p *passkeyRepository) GetPasskeysByUserID(userID uint) ([]domains.Passkey, rest_errors.RestErr) {
+	passkeys := []domains.Passkey{}
+	if err := p.DB.Where("user_id = ?", userID).Order("id").Find(&passkeys).Error; err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return passkeys, nil
+}
+
+func (p *passkeyRepository) CreatePasskey(passkey *domains.Passkey, audit *domains.AuditEntry) rest_errors.RestErr {
+	err := audited(p.DB, audit, func(tx *gorm.DB) error {
+		return tx.Create(passkey).Error
+	})
+	if err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
+
+func (p *passkeyRepository) UpdatePasskeySignCount(id uint, signCount uint32, usedAt time.Time) rest_errors.RestErr {
+	err := p.DB.Model(&domains.Passkey{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"sign_count": signCount, "last_used_at": usedAt}).Error
+	if err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// DeletePasskey removes passkey of user and reports whether there was one,
+// rows are really deleted so the authenticator can be registered again
+func (p *passkeyRepository) DeletePasskey(userID, id uint, audit *domains.AuditEntry) (bool, rest_errors.RestErr) {
+	err := audited(p.DB, audit, func(tx *gorm.DB) error {
+		res := tx.Unscoped().Where("user_id = ? AND id = ?", userID, id).Delete(&domains.Passkey{})
+		if res.Error == nil && res.RowsAffected == 0 {
+			return errNothingChanged
+		}
+		return res.Error
+	})
+	if err == errNothingChanged {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.NewInternalServerError(err)
+	}
+	return true, nil
+}
+
+func (p *passkeyRepository) CreatePasskeyChallenge(challenge *domains.PasskeyChallenge) rest_errors.RestErr {
+	if err := p.DB.Create(challenge).Error; err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// ConsumePasskeyChallenge deletes live challenge of ceremony and returns it, nil if challenge does not exist,
+// is expired or is used already
+func (p *passkeyRepository) ConsumePasskeyChallenge(challengeHash, ceremony string) (*domains.PasskeyChallenge, rest_errors.RestErr) {
+	challenge := new(domains.PasskeyChallenge)
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("challenge_hash = ? AND ceremony = ? AND expires_at > ?", challengeHash, ceremony, time.Now()).
+			First(challenge).Error
+		if err != nil {
+			return err
+		}
+		res := tx.Unscoped().Delete(challenge)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return challenge, nil
+}
@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"gorm.io/gorm"
+)
+
+var (
+	SessionRepository sessionRepositoryInterface = &sessionRepository{}
+)
+
+type sessionRepository struct {
+	DB *gorm.DB
+}
+
+type sessionRepositoryInterface interface {
+	CreateSession(session *domains.Session) rest_errors.RestErr
+	GetSession(id uint) (*domains.Session, rest_errors.RestErr)
+	GetSessionsByUserID(userID uint) ([]domains.Session, rest_errors.RestErr)
+	TouchSession(id uint, at time.Time) rest_errors.RestErr
+	RevokeSession(userID, id uint, audit *domains.AuditEntry) (bool, rest_errors.RestErr)
+	RevokeSessions(userID, exceptID uint, audit *domains.AuditEntry) (int64, rest_errors.RestErr)
+}
+
+func NewSessionRepository(db *gorm.DB) *sessionRepository {
+	return &sessionRepository{DB: db}
+}
+
+func (s *sessionRepository) CreateSession(session *domains.Session) rest_errors.RestErr {
+	if err := s.DB.Create(session).Error; err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// GetSession returns session by its id, revoked and expired sessions too, nil if there is no such session
+func (s *sessionRepository) GetSession(id uint) (*domains.Session, rest_errors.RestErr) {
+	session := new(domains.Session)
+	err := s.DB.Where("id = ?", id).First(session).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return session, nil
+}
+
+// GetSessionsByUserID returns live sessions of user, most recently seen first
+func (s *sessionRepository) GetSessionsByUserID(userID uint) ([]domains.Session, rest_errors.RestErr) {
+	sessions := []domains.Session{}
+	err := s.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").Find(&sessions).Error
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return sessions, nil
+}
+
+func (s *sessionRepository) TouchSession(id uint, at time.Time) rest_errors.RestErr {
+	if err := s.DB.Model(&domains.Session{}).Where("id = ?", id).Update("last_seen_at", at).Error; err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// RevokeSession revokes live session of user and reports whether there was one
+func (s *sessionRepository) RevokeSession(userID, id uint, audit *domains.AuditEntry) (bool, rest_errors.RestErr) {
+	err := audited(s.DB, audit, func(tx *gorm.DB) error {
+		res := tx.Model(&domains.Session{}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", id, userID, time.Now()).
+			Update("revoked_at", time.Now())
+		if res.Error == nil && res.RowsAffected == 0 {
+			return errNothingChanged
+		}
+		return res.Error
+	})
+	if err == errNothingChanged {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.NewInternalServerError(err)
+	}
+	return true, nil
+}
+
+// RevokeSessions revokes every live session of user but exceptID and returns how many there were,
+// 0 exceptID keeps none. Audit is written with the count only if there was any
+func (s *sessionRepository) RevokeSessions(userID, exceptID uint, audit *domains.AuditEntry) (int64, rest_errors.RestErr) {
+	var revoked int64
+	err := audited(s.DB, audit, func(tx *gorm.DB) error {
+		res := tx.Model(&domains.Session{}).
+			Where("user_id = ? AND id <> ? AND revoked_at IS NULL AND expires_at > ?", userID, exceptID, time.Now()).
+			Update("revoked_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if revoked = res.RowsAffected; revoked == 0 {
+			return errNothingChanged
+		}
+		if audit != nil {
+			audit.Changes = domains.AuditChanges{"sessions": {Before: revoked, After: 0}}
+		}
+		return nil
+	})
+	if err == errNothingChanged {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.NewInternalServerError(err)
+	}
+	return revoked, nil
+}
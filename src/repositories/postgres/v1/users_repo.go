@@ -1,13 +1,38 @@
 package repositories
 
 import (
+	goerrors "errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
 	"github.com/alidevjimmy/go-rest-utils/rest_errors"
 	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	passwordutil "github.com/alidevjimmy/user_microservice_t/utils/password"
+	phoneutil "github.com/alidevjimmy/user_microservice_t/utils/phone"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
 	UserRepository userRepositoryInterface = &userRepository{}
+
+	// usersSortColumns whitelists columns users can be sorted by
+	usersSortColumns = map[string]string{
+		"":           "id",
+		"id":         "id",
+		"created_at": "created_at",
+		"username":   "username",
+		"name":       "name",
+		"family":     "family",
+		"age":        "age",
+	}
+	usersSearchColumns = []string{"username", "name", "family", "phone"}
+
+	// errVersionMismatch rolls back a change made against a version of user which is not the current one
+	errVersionMismatch = goerrors.New("version mismatch")
 )
 
 type userRepository struct {
@@ -16,13 +41,28 @@ type userRepository struct {
 
 type userRepositoryInterface interface {
 	GetUserByID(id uint) (*domains.PublicUser, rest_errors.RestErr)
+	GetUsersByIDs(ids []uint) ([]domains.PublicUser, rest_errors.RestErr)
 	GetUserByPhone(phone string) (*domains.PublicUser, rest_errors.RestErr)
 	GetUserByUsername(username string) (*domains.PublicUser, rest_errors.RestErr)
 	GetUserByPhoneOrUsernameAndPassword(pou, password string) (*domains.User, rest_errors.RestErr)
-	UpdateUser(userId uint, body domains.UpdateUserRequest) (*domains.PublicUser, rest_errors.RestErr)
-	UpdatePasswordByPhone(newPass, phone string) (*domains.PublicUser, rest_errors.RestErr)
-	UpdateActiveStateByPhone(phone string) (*domains.PublicUser, rest_errors.RestErr)
-	UpdateActiveStateById(userId uint) (*domains.PublicUser, rest_errors.RestErr)
+	GetUsers(params domains.GetUsersRequest, cursor *domains.UsersCursor, limit int) ([]domains.PublicUser, rest_errors.RestErr)
+	CountUsers(params domains.GetUsersRequest) (int64, rest_errors.RestErr)
+	SearchUsers(query string, limit int) ([]domains.PublicUser, rest_errors.RestErr)
+	UpdateUser(userId uint, versions domains.Versions, body domains.UpdateUserRequest, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr)
+	UpdatePasswordByPhone(newPass, phone string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr)
+	UpdatePassword(userId uint, newPass string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr)
+	UpdateActiveStateByPhone(phone string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr)
+	UpdatePhone(userId uint, phone string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr)
+	SetActiveState(userId uint, versions domains.Versions, active bool, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr)
+	SetBlockState(userId uint, versions domains.Versions, blocked bool, reason string, until *time.Time, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr)
+	GetExpiredBlocks(at time.Time, limit int) ([]uint, rest_errors.RestErr)
+	RecordFailedLogin(pou string, maxFailures int, lockFor time.Duration) (*time.Time, rest_errors.RestErr)
+	ResetFailedLogins(userId uint) rest_errors.RestErr
+	LiftExpiredBlock(userId uint, at time.Time, audit *domains.AuditEntry) (bool, rest_errors.RestErr)
+	DeleteUser(userId uint, audit *domains.AuditEntry) (bool, rest_errors.RestErr)
+	RestoreUser(pou, password string, deletedSince time.Time, audit *domains.AuditEntry) (*domains.User, rest_errors.RestErr)
+	GetPurgeableUsers(deletedBefore time.Time, limit int) ([]uint, rest_errors.RestErr)
+	PurgeUser(userId uint, deletedBefore time.Time, audit *domains.AuditEntry) (bool, rest_errors.RestErr)
 }
 
 func NewUserRepository(db *gorm.DB ,debugMode bool) userRepositoryInterface {
@@ -35,43 +75,596 @@ func NewUserRepository(db *gorm.DB ,debugMode bool) userRepositoryInterface {
 	return &userRepository{db : db}
 }
 
+// GetUserByID returns user by its id, nil if there is no such user
 func (u *userRepository) GetUserByID(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+	user := new(domains.User)
+	err := u.db.First(user, id).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	pu := user.Public()
+	return &pu, nil
+}
 
-	return nil, nil
+// GetUsersByIDs returns users having any of ids, ids without user are skipped
+func (u *userRepository) GetUsersByIDs(ids []uint) ([]domains.PublicUser, rest_errors.RestErr) {
+	var users []domains.User
+	if err := u.db.Where("id IN ?", ids).Order("id").Find(&users).Error; err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	res := make([]domains.PublicUser, len(users))
+	for i := range users {
+		res[i] = users[i].Public()
+	}
+	return res, nil
 }
 
+// GetUserByPhone returns user owning phone in any of its written forms, nil if there is no such user
 func (u *userRepository) GetUserByPhone(phone string) (*domains.PublicUser, rest_errors.RestErr) {
-	return nil, nil
+	user := new(domains.User)
+	err := u.db.Where("phone = ?", phoneutil.NormalizeOrKeep(phone)).First(user).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	pu := user.Public()
+	return &pu, nil
 }
 
+// GetUserByUsername returns user owning username case-insensitively, nil if there is no such user
 func (u *userRepository) GetUserByUsername(username string) (*domains.PublicUser, rest_errors.RestErr) {
-	return nil, nil
+	user := new(domains.User)
+	err := u.db.Where("lower(username) = lower(?)", username).First(user).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	pu := user.Public()
+	return &pu, nil
 }
 
+// GetUserByPhoneOrUsernameAndPassword returns user having phone or username pou if password is its password,
+// nil otherwise. Legacy or cheaper hashes of the password are replaced by Hash of it
 func (u *userRepository) GetUserByPhoneOrUsernameAndPassword(pou, password string) (*domains.User, rest_errors.RestErr) {
+	user, err := userByPassword(u.db, u.db, pou, password)
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return user, nil
+}
+
+// userByPassword finds users of q having phone or username pou and returns the one whose password is password,
+// nil if there is none. A hash which needs rehashing is replaced through tx
+func userByPassword(tx, q *gorm.DB, pou, password string) (*domains.User, error) {
+	users := []domains.User{}
+	if err := q.Where("phone = ? OR lower(username) = lower(?)", phoneutil.NormalizeOrKeep(pou), pou).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for i := range users {
+		ok, rehash := passwordutil.Check(users[i].Password, password)
+		if !ok {
+			continue
+		}
+		if rehash {
+			hash, err := passwordutil.Hash(password)
+			if err != nil {
+				return nil, err
+			}
+			if err := tx.Unscoped().Model(&users[i]).UpdateColumn("password", hash).Error; err != nil {
+				return nil, err
+			}
+		}
+		return &users[i], nil
+	}
 	return nil, nil
 }
 
-func (u *userRepository) GetUsers(params map[string]interface{}) ([]domains.PublicUser, rest_errors.RestErr) {
-	return []domains.PublicUser{}, nil
+// GetUsers returns at most limit users matching params, starting after cursor
+func (u *userRepository) GetUsers(params domains.GetUsersRequest, cursor *domains.UsersCursor, limit int) ([]domains.PublicUser, rest_errors.RestErr) {
+	column := usersSortColumns[params.Sort]
+	order, op := "ASC", ">"
+	if params.Order == "desc" {
+		order, op = "DESC", "<"
+	}
+	q := filterUsers(u.db.Model(&domains.User{}), params)
+	if cursor != nil {
+		q = q.Where(fmt.Sprintf("(%s, id) %s (?, ?)", column, op), cursor.Value, cursor.ID)
+	}
+	var users []domains.User
+	err := q.Order(fmt.Sprintf("%s %s", column, order)).
+		Order(fmt.Sprintf("id %s", order)).
+		Limit(limit).
+		Find(&users).Error
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	result := make([]domains.PublicUser, 0, len(users))
+	for _, user := range users {
+		result = append(result, user.Public())
+	}
+	return result, nil
+}
+
+// CountUsers returns number of all users matching params regardless of paging
+func (u *userRepository) CountUsers(params domains.GetUsersRequest) (int64, rest_errors.RestErr) {
+	var total int64
+	if err := filterUsers(u.db.Model(&domains.User{}), params).Count(&total).Error; err != nil {
+		return 0, errors.NewInternalServerError(err)
+	}
+	return total, nil
 }
 
-func (u *userRepository) UpdateActiveStateById(userId uint) (*domains.PublicUser, rest_errors.RestErr) {
-	return nil, nil
+// SearchUsers ranks users by similarity of their name, family, username and phone to query.
+// query must already be normalized by persian.Normalize, indexes in init.sql back every condition
+func (u *userRepository) SearchUsers(query string, limit int) ([]domains.PublicUser, rest_errors.RestErr) {
+	like := "%" + escapeLike(query) + "%"
+	// phones are stored in E.164 form, so national trunk zero of partial numbers never matches
+	phoneLike := "%" + escapeLike(strings.TrimPrefix(query, "0")) + "%"
+	var users []domains.User
+	err := u.db.Model(&domains.User{}).
+		Select("*, GREATEST(similarity(normalize_fa(name), ?), similarity(normalize_fa(family), ?), "+
+			"similarity(normalize_fa(username), ?), similarity(normalize_fa(name || ' ' || family), ?)) AS search_rank",
+			query, query, query, query).
+		Where("to_tsvector('simple', normalize_fa(name || ' ' || family || ' ' || username)) @@ plainto_tsquery('simple', ?) "+
+			"OR normalize_fa(name) % ? OR normalize_fa(family) % ? OR normalize_fa(username) % ? "+
+			"OR normalize_fa(name) LIKE ? OR normalize_fa(family) LIKE ? OR normalize_fa(username) LIKE ? OR phone LIKE ?",
+			query, query, query, query, like, like, like, phoneLike).
+		Order("search_rank DESC").
+		Order("id").
+		Limit(limit).
+		Find(&users).Error
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	result := make([]domains.PublicUser, 0, len(users))
+	for _, user := range users {
+		result = append(result, user.Public())
+	}
+	return result, nil
 }
 
-func (u *userRepository) UpdateActiveStateByPhone(phone string) (*domains.PublicUser, rest_errors.RestErr) {
-	return nil, nil
+func filterUsers(q *gorm.DB, params domains.GetUsersRequest) *gorm.DB {
+	if params.Active != nil {
+		q = q.Where("active = ?", *params.Active)
+	}
+	if params.Blocked != nil {
+		q = q.Where("blocked = ?", *params.Blocked)
+	}
+	if params.IsAdmin != nil {
+		q = q.Where("is_admin = ?", *params.IsAdmin)
+	}
+	if params.CreatedFrom != nil {
+		q = q.Where("created_at >= ?", *params.CreatedFrom)
+	}
+	if params.CreatedTo != nil {
+		q = q.Where("created_at <= ?", *params.CreatedTo)
+	}
+	if params.Search != "" {
+		pattern := escapeLike(params.Search) + "%"
+		if params.SearchMode == "fuzzy" {
+			pattern = "%" + pattern
+		}
+		conditions := make([]string, 0, len(usersSearchColumns))
+		args := make([]interface{}, 0, len(usersSearchColumns))
+		for _, column := range usersSearchColumns {
+			conditions = append(conditions, fmt.Sprintf("%s ILIKE ?", column))
+			if column == "phone" {
+				args = append(args, phonePattern(params.Search, params.SearchMode, pattern))
+				continue
+			}
+			args = append(args, pattern)
+		}
+		q = q.Where(strings.Join(conditions, " OR "), args...)
+	}
+	return q
 }
 
-func (u *userRepository) UpdateBlockState(userId uint) (*domains.PublicUser, rest_errors.RestErr) {
-	return nil, nil
+// phonePattern is pattern of phone column for search, phones are stored in E.164 form so numbers searched in
+// national or any other form Normalize takes are searched by their E.164 form. Fuzzy search looks for digits
+// after country code of iranian numbers, anything else falls back to pattern
+func phonePattern(search, mode, pattern string) string {
+	prefix, ok := phoneutil.Prefix(search)
+	if !ok {
+		return pattern
+	}
+	if mode == "fuzzy" {
+		digits := strings.TrimPrefix(strings.TrimPrefix(prefix, "+"+phoneutil.IranCountryCode), "+")
+		return "%" + escapeLike(digits) + "%"
+	}
+	return escapeLike(prefix) + "%"
 }
 
-func (u *userRepository) UpdateUser(userId uint, body domains.UpdateUserRequest) (*domains.PublicUser, rest_errors.RestErr) {
-	return nil, nil
+// escapeLike escapes LIKE wildcards so search terms match literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
 }
 
-func (u *userRepository) UpdatePasswordByPhone(newPass, phone string) (*domains.PublicUser, rest_errors.RestErr) {
-	return nil, nil
+// SetActiveState activates or deactivates user, nil if there is no such user. User already in state is returned as it is.
+// Deactivated users are told from users not verified yet by deactivated_at. Non empty versions must have the current one
+func (u *userRepository) SetActiveState(userId uint, versions domains.Versions, active bool, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+	return u.setState(userId, versions, audit, func(user *domains.User) (map[string]interface{}, domains.AuditChanges, string) {
+		if user.Active == active {
+			return nil, nil, ""
+		}
+		values := map[string]interface{}{"active": active, "deactivated_at": nil}
+		event := domains.EventUserActivated
+		if !active {
+			values["deactivated_at"] = time.Now()
+			event = domains.EventUserDeactivated
+		}
+		return values, domains.AuditChanges{"active": {Before: user.Active, After: active}}, event
+	})
+}
+
+// UpdateActiveStateByPhone activates user owning phone
+func (u *userRepository) UpdateActiveStateByPhone(phone string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+	return u.updateByPhone(phone, map[string]interface{}{"active": true}, domains.EventUserVerified, audit, func(user *domains.User) domains.AuditChanges {
+		return domains.AuditChanges{"active": {Before: user.Active, After: true}}
+	})
+}
+
+// UpdatePhone sets phone of user, nil if there is no such user. Phone is expected to be normalized and free
+func (u *userRepository) UpdatePhone(userId uint, phone string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+	return u.setState(userId, nil, audit, func(user *domains.User) (map[string]interface{}, domains.AuditChanges, string) {
+		if user.Phone == phone {
+			return nil, nil, ""
+		}
+		return map[string]interface{}{"phone": phone},
+			domains.AuditChanges{"phone": {}},
+			domains.EventPhoneChanged
+	})
+}
+
+// SetBlockState blocks user by reason until until, nil until blocks until unblocked, or unblocks user.
+// Blocking a blocked user only changes its reason and expiry, nil if there is no such user. Non empty versions must have the current one
+func (u *userRepository) SetBlockState(userId uint, versions domains.Versions, blocked bool, reason string, until *time.Time, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+	return u.setState(userId, versions, audit, func(user *domains.User) (map[string]interface{}, domains.AuditChanges, string) {
+		if !blocked {
+			return unblock(user)
+		}
+		values := map[string]interface{}{}
+		changes := domains.AuditChanges{}
+		event := ""
+		if !user.Blocked {
+			values["blocked"] = true
+			changes["blocked"] = domains.AuditChange{Before: false, After: true}
+			event = domains.EventUserBlocked
+		}
+		if user.BlockReason != reason {
+			values["block_reason"] = reason
+			changes["block_reason"] = domains.AuditChange{Before: user.BlockReason, After: reason}
+		}
+		if !sameTime(user.BlockedUntil, until) {
+			values["blocked_until"] = until
+			changes["blocked_until"] = domains.AuditChange{Before: user.BlockedUntil, After: until}
+		}
+		return values, changes, event
+	})
+}
+
+// RecordFailedLogin counts a wrong password for user having phone or username pou, the maxFailures-th one locks
+// user for lockFor and starts counting again. It returns when lock of user ends if user is locked, wrong
+// passwords of locked users are not counted so a lock is not extended by whoever guesses passwords
+func (u *userRepository) RecordFailedLogin(pou string, maxFailures int, lockFor time.Duration) (*time.Time, rest_errors.RestErr) {
+	user := new(domains.User)
+	err := u.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("phone = ? OR lower(username) = lower(?)", phoneutil.NormalizeOrKeep(pou), pou).First(user).Error
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if user.LockedUntil != nil && user.LockedUntil.After(now) {
+			return nil
+		}
+		values := map[string]interface{}{"failed_logins": user.FailedLogins + 1}
+		user.LockedUntil = nil
+		if user.FailedLogins+1 >= maxFailures {
+			lockedUntil := now.Add(lockFor)
+			user.LockedUntil = &lockedUntil
+			values = map[string]interface{}{"failed_logins": 0, "locked_until": lockedUntil}
+		}
+		return tx.Model(user).Updates(values).Error
+	})
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return user.LockedUntil, nil
+}
+
+// ResetFailedLogins forgets wrong passwords of user, it is called when user logs in
+func (u *userRepository) ResetFailedLogins(userId uint) rest_errors.RestErr {
+	err := u.db.Model(&domains.User{}).Where("id = ? AND failed_logins > 0", userId).Update("failed_logins", 0).Error
+	if err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// GetExpiredBlocks returns ids of at most limit users whose block expired by at, earliest expired first
+func (u *userRepository) GetExpiredBlocks(at time.Time, limit int) ([]uint, rest_errors.RestErr) {
+	ids := []uint{}
+	err := u.db.Model(&domains.User{}).Where("blocked AND blocked_until <= ?", at).
+		Order("blocked_until").Limit(limit).Pluck("id", &ids).Error
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return ids, nil
+}
+
+// LiftExpiredBlock unblocks user if its block expired by at and reports whether it did,
+// a block extended or lifted meanwhile is left as it is
+func (u *userRepository) LiftExpiredBlock(userId uint, at time.Time, audit *domains.AuditEntry) (bool, rest_errors.RestErr) {
+	lifted := false
+	_, err := u.setState(userId, nil, audit, func(user *domains.User) (map[string]interface{}, domains.AuditChanges, string) {
+		if !user.Blocked || user.BlockedUntil == nil || user.BlockedUntil.After(at) {
+			return nil, nil, ""
+		}
+		lifted = true
+		return unblock(user)
+	})
+	return lifted, err
+}
+
+// UpdateUser sets non empty fields of body on user, nil if there is no such user. Non empty versions must have the current one.
+// Username is expected to be free
+func (u *userRepository) UpdateUser(userId uint, versions domains.Versions, body domains.UpdateUserRequest, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+	return u.setState(userId, versions, audit, func(user *domains.User) (map[string]interface{}, domains.AuditChanges, string) {
+		values := map[string]interface{}{}
+		changes := domains.AuditChanges{}
+		if body.Username != "" && body.Username != user.Username {
+			values["username"] = body.Username
+			changes["username"] = domains.AuditChange{}
+		}
+		if body.Name != "" && body.Name != user.Name {
+			values["name"] = body.Name
+			changes["name"] = domains.AuditChange{}
+		}
+		if body.Family != "" && body.Family != user.Family {
+			values["family"] = body.Family
+			changes["family"] = domains.AuditChange{}
+		}
+		if body.Age != 0 && body.Age != user.Age {
+			values["age"] = body.Age
+			changes["age"] = domains.AuditChange{}
+		}
+		return values, changes, domains.EventUserProfileChanged
+	})
+}
+
+// UpdatePasswordByPhone sets password of user owning phone and lifts lock of failed logins,
+// audit tells a password changed but not which
+func (u *userRepository) UpdatePasswordByPhone(newPass, phone string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+	hash, err := passwordutil.Hash(newPass)
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	values := map[string]interface{}{"password": hash, "failed_logins": 0, "locked_until": nil}
+	return u.updateByPhone(phone, values, domains.EventPasswordChanged, audit, func(*domains.User) domains.AuditChanges {
+		return domains.AuditChanges{"password": {}}
+	})
+}
+
+// UpdatePassword sets password of user and lifts lock of failed logins, nil if there is no such user
+func (u *userRepository) UpdatePassword(userId uint, newPass string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+	hash, err := passwordutil.Hash(newPass)
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return u.setState(userId, nil, audit, func(*domains.User) (map[string]interface{}, domains.AuditChanges, string) {
+		return map[string]interface{}{"password": hash, "failed_logins": 0, "locked_until": nil},
+			domains.AuditChanges{"password": {}},
+			domains.EventPasswordChanged
+	})
+}
+
+// DeleteUser soft deletes user, it is not found by other methods until restored. False if there is no such user
+func (u *userRepository) DeleteUser(userId uint, audit *domains.AuditEntry) (bool, rest_errors.RestErr) {
+	user := new(domains.User)
+	err := audited(u.db, audit, func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(user, userId).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(user).Error; err != nil {
+			return err
+		}
+		return publish(tx, domains.EventUserDeleted, user)
+	})
+	if err == gorm.ErrRecordNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.NewInternalServerError(err)
+	}
+	return true, nil
+}
+
+// RestoreUser undeletes user having phone or username pou and password if it was deleted after deletedSince,
+// nil if there is no such user. Audit is of the restored user
+func (u *userRepository) RestoreUser(pou, password string, deletedSince time.Time, audit *domains.AuditEntry) (*domains.User, rest_errors.RestErr) {
+	var user *domains.User
+	err := audited(u.db, audit, func(tx *gorm.DB) error {
+		var err error
+		user, err = userByPassword(tx, tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Where("deleted_at > ?", deletedSince), pou, password)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Unscoped().Model(user).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		user.DeletedAt = gorm.DeletedAt{}
+		if audit != nil {
+			audit.TargetID = &user.ID
+			audit.ActorID = &user.ID
+		}
+		return publish(tx, domains.EventUserRestored, user)
+	})
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return user, nil
+}
+
+// GetPurgeableUsers returns ids of at most limit users deleted before deletedBefore, longest deleted first
+func (u *userRepository) GetPurgeableUsers(deletedBefore time.Time, limit int) ([]uint, rest_errors.RestErr) {
+	var ids []uint
+	err := u.db.Unscoped().Model(&domains.User{}).
+		Where("deleted_at IS NOT NULL AND deleted_at <= ?", deletedBefore).
+		Order("deleted_at").Limit(limit).Pluck("id", &ids).Error
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return ids, nil
+}
+
+// PurgeUser removes user deleted before deletedBefore for good. Its sessions, passkeys, identities and grants go
+// with it, codes sent to its phone, all of its outbox events and their webhook deliveries are removed too, pending
+// ones included as their payloads carry user's data and it is gone anyway. Audit log is kept, it has
+// ids of user and which of its fields changed but never their values, see domains.AuditChange.
+// False if user is not deleted before deletedBefore, e.g. it was restored meanwhile
+func (u *userRepository) PurgeUser(userId uint, deletedBefore time.Time, audit *domains.AuditEntry) (bool, rest_errors.RestErr) {
+	user := new(domains.User)
+	err := audited(u.db, audit, func(tx *gorm.DB) error {
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND deleted_at IS NOT NULL AND deleted_at <= ?", userId, deletedBefore).
+			First(user).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("phone = ?", user.Phone).Unscoped().Delete(&domains.Code{}).Error; err != nil {
+			return err
+		}
+		events := tx.Model(&domains.OutboxEvent{}).Select("id").Where("user_id = ?", user.ID)
+		if err := tx.Where("event_id IN (?)", events).Delete(&domains.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&domains.OutboxEvent{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(user).Error; err != nil {
+			return err
+		}
+		return publish(tx, domains.EventUserPurged, &domains.User{Model: gorm.Model{ID: user.ID}})
+	})
+	if err == gorm.ErrRecordNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.NewInternalServerError(err)
+	}
+	return true, nil
+}
+
+// setState locks user and writes values change returns given user before update, changes describe them for audit.
+// Nothing is written when values are empty so setting a state twice is harmless, event is published if it is not empty.
+// Writes bump version of user, non empty versions not having the current one are refused with 412
+func (u *userRepository) setState(userId uint, versions domains.Versions, audit *domains.AuditEntry,
+	change func(user *domains.User) (map[string]interface{}, domains.AuditChanges, string)) (*domains.PublicUser, rest_errors.RestErr) {
+	user := new(domains.User)
+	err := audited(u.db, audit, func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(user, userId).Error; err != nil {
+			return err
+		}
+		if !versions.Allow(user.Version) {
+			return errVersionMismatch
+		}
+		values, changes, event := change(user)
+		if len(values) == 0 {
+			return errNothingChanged
+		}
+		values["version"] = gorm.Expr("version + 1")
+		if audit != nil {
+			if audit.Changes == nil {
+				audit.Changes = domains.AuditChanges{}
+			}
+			for field, c := range changes {
+				audit.Changes[field] = c
+			}
+		}
+		if err := tx.Model(user).Updates(values).Error; err != nil {
+			return err
+		}
+		if err := tx.First(user, user.ID).Error; err != nil {
+			return err
+		}
+		if event == "" {
+			return nil
+		}
+		return publish(tx, event, user)
+	})
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err == errVersionMismatch {
+		return nil, errors.NewError(errors.UserVersionMismatch, http.StatusPreconditionFailed)
+	}
+	if err != nil && err != errNothingChanged {
+		return nil, errors.NewInternalServerError(err)
+	}
+	pu := user.Public()
+	return &pu, nil
+}
+
+// unblock is the change of setState lifting block of user
+func unblock(user *domains.User) (map[string]interface{}, domains.AuditChanges, string) {
+	if !user.Blocked {
+		return nil, nil, ""
+	}
+	return map[string]interface{}{"blocked": false, "block_reason": "", "blocked_until": nil},
+		domains.AuditChanges{"blocked": {Before: true, After: false}},
+		domains.EventUserUnblocked
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// updateByPhone sets values of user owning phone and publishes event, changes describes them for audit given user before update
+func (u *userRepository) updateByPhone(phone string, values map[string]interface{}, event string, audit *domains.AuditEntry,
+	changes func(user *domains.User) domains.AuditChanges) (*domains.PublicUser, rest_errors.RestErr) {
+	user := new(domains.User)
+	err := audited(u.db, audit, func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("phone = ?", phoneutil.NormalizeOrKeep(phone)).First(user).Error; err != nil {
+			return err
+		}
+		if audit != nil {
+			audit.TargetID = &user.ID
+			audit.Changes = changes(user)
+		}
+		values["version"] = gorm.Expr("version + 1")
+		if err := tx.Model(user).Updates(values).Error; err != nil {
+			return err
+		}
+		if err := tx.First(user, user.ID).Error; err != nil {
+			return err
+		}
+		return publish(tx, event, user)
+	})
+	if err == gorm.ErrRecordNotFound {
+		return nil, errors.NewNotFoundError(errors.UserNotFound)
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	pu := user.Public()
+	return &pu, nil
 }
@@ -3,12 +3,14 @@ package repositories
 import (
 	"database/sql"
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
 	"github.com/alidevjimmy/user_microservice_t/errors/v1"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"net/http"
 	"testing"
+	"time"
 )
 
 type Suite struct {
@@ -559,3 +561,102 @@ func TestUserRepository_GetUsers(t *testing.T) {
 	}
 
 }
+
+// expectNameUpdate expects UpdateUser of user 1 renaming it, up to writing its UserProfileChanged event
+func expectNameUpdate(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+	gdb, err := gorm.Open(postgres.New(postgres.Config{Conn: db, PreferSimpleProtocol: true}), &gorm.Config{})
+	assert.Nil(t, err)
+	columns := []string{"id", "phone", "username", "name", "family", "age", "version"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "users" .* FOR UPDATE`).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "+989123456789", "username", "name", "family", 20, 1))
+	mock.ExpectExec(`UPDATE "users" SET`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT \* FROM "users"`).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "+989123456789", "username", "renamed", "family", 20, 2))
+	mock.ExpectQuery(`INSERT INTO "outbox"`).
+		WithArgs(domains.EventUserProfileChanged, 1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	return gdb, mock
+}
+
+func TestUserRepository_UpdateUserWritesProfileChangedEvent(t *testing.T) {
+	gdb, mock := expectNameUpdate(t)
+	mock.ExpectCommit()
+
+	u, rErr := NewUserRepository(gdb, false).UpdateUser(1, domains.Versions{1}, domains.UpdateUserRequest{Name: "renamed"}, nil)
+	assert.Nil(t, rErr)
+	assert.Equal(t, "renamed", u.Name)
+	assert.Equal(t, uint(2), u.Version)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_UpdateUserAuditsNoPersonalData(t *testing.T) {
+	gdb, mock := expectNameUpdate(t)
+	mock.ExpectQuery(`INSERT INTO "audit_log"`).
+		WithArgs(sqlmock.AnyArg(), 1, nil, 1, "user.updated", `{"name":{"before":null,"after":null}}`, "", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	audit := domains.Actor{UserID: 1}.Audit("user.updated", 1, nil)
+	_, rErr := NewUserRepository(gdb, false).UpdateUser(1, domains.Versions{1}, domains.UpdateUserRequest{Name: "renamed"}, audit)
+	assert.Nil(t, rErr)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_PurgeUserRemovesPendingEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+	gdb, err := gorm.Open(postgres.New(postgres.Config{Conn: db, PreferSimpleProtocol: true}), &gorm.Config{})
+	assert.Nil(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "users" .* FOR UPDATE`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "phone"}).AddRow(1, "+989123456789"))
+	mock.ExpectExec(`DELETE FROM "codes" WHERE phone = \$1`).WithArgs("+989123456789").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// user has an event still waiting for relay and a delivery still waiting for its webhook, they go as well
+	mock.ExpectExec(`DELETE FROM "webhook_deliveries" WHERE event_id IN \(SELECT "id" FROM "outbox" WHERE user_id = \$1\)$`).
+		WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM "outbox" WHERE user_id = \$1$`).
+		WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "outbox"`).
+		WithArgs(domains.EventUserPurged, 1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectCommit()
+
+	ok, rErr := NewUserRepository(gdb, false).PurgeUser(1, time.Now(), nil)
+	assert.Nil(t, rErr)
+	assert.True(t, ok)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_GetUsersSearchesPhoneInNationalForm(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+	gdb, err := gorm.Open(postgres.New(postgres.Config{Conn: db, PreferSimpleProtocol: true}), &gorm.Config{})
+	assert.Nil(t, err)
+
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE \(username ILIKE \$1 OR name ILIKE \$2 OR family ILIKE \$3 OR phone ILIKE \$4\)`).
+		WithArgs("0912%", "0912%", "0912%", "+98912%").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "phone"}).AddRow(1, "+989123456789"))
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE \(username ILIKE \$1 OR name ILIKE \$2 OR family ILIKE \$3 OR phone ILIKE \$4\)`).
+		WithArgs("%0912%", "%0912%", "%0912%", "%912%").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "phone"}).AddRow(1, "+989123456789"))
+
+	repo := NewUserRepository(gdb, false)
+	users, rErr := repo.GetUsers(domains.GetUsersRequest{Search: "0912"}, nil, 20)
+	assert.Nil(t, rErr)
+	assert.Len(t, users, 1)
+	users, rErr = repo.GetUsers(domains.GetUsersRequest{Search: "0912", SearchMode: "fuzzy"}, nil, 20)
+	assert.Nil(t, rErr)
+	assert.Len(t, users, 1)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
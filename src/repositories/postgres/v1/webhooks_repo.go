@@ -0,0 +1,176 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	WebhookRepository webhookRepositoryInterface = &webhookRepository{}
+)
+
+type webhookRepository struct {
+	DB *gorm.DB
+}
+
+type webhookRepositoryInterface interface {
+	CreateWebhook(webhook *domains.Webhook, audit *domains.AuditEntry) rest_errors.RestErr
+	GetWebhook(id uint) (*domains.Webhook, rest_errors.RestErr)
+	GetWebhooks() ([]domains.Webhook, rest_errors.RestErr)
+	DeleteWebhook(id uint, audit *domains.AuditEntry) (bool, rest_errors.RestErr)
+	CreateWebhookDeliveries(deliveries []domains.WebhookDelivery) rest_errors.RestErr
+	ClaimWebhookDeliveries(limit int, lease time.Duration) ([]domains.WebhookDelivery, rest_errors.RestErr)
+	UpdateWebhookDelivery(delivery *domains.WebhookDelivery) rest_errors.RestErr
+	GetWebhookDeliveries(webhookID uint, status string, beforeID uint, limit int) ([]domains.WebhookDelivery, rest_errors.RestErr)
+	ReplayWebhookDelivery(id uint, audit *domains.AuditEntry) (*domains.WebhookDelivery, rest_errors.RestErr)
+}
+
+func NewWebhookRepository(db *gorm.DB) *webhookRepository {
+	return &webhookRepository{DB: db}
+}
+
+func (w *webhookRepository) CreateWebhook(webhook *domains.Webhook, audit *domains.AuditEntry) rest_errors.RestErr {
+	err := audited(w.DB, audit, func(tx *gorm.DB) error {
+		return tx.Create(webhook).Error
+	})
+	if err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// GetWebhook returns webhook by id, nil if there is no such webhook
+func (w *webhookRepository) GetWebhook(id uint) (*domains.Webhook, rest_errors.RestErr) {
+	webhook := new(domains.Webhook)
+	err := w.DB.First(webhook, id).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return webhook, nil
+}
+
+func (w *webhookRepository) GetWebhooks() ([]domains.Webhook, rest_errors.RestErr) {
+	webhooks := []domains.Webhook{}
+	if err := w.DB.Order("id").Find(&webhooks).Error; err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook soft deletes webhook and drops deliveries still waiting for it, it reports whether there was one
+func (w *webhookRepository) DeleteWebhook(id uint, audit *domains.AuditEntry) (bool, rest_errors.RestErr) {
+	err := audited(w.DB, audit, func(tx *gorm.DB) error {
+		res := tx.Delete(&domains.Webhook{}, id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errNothingChanged
+		}
+		return tx.Where("webhook_id = ? AND status = ?", id, domains.WebhookDeliveryPending).
+			Delete(&domains.WebhookDelivery{}).Error
+	})
+	if err == errNothingChanged {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.NewInternalServerError(err)
+	}
+	return true, nil
+}
+
+// CreateWebhookDeliveries queues deliveries, a delivery of an event already queued for the webhook is skipped
+func (w *webhookRepository) CreateWebhookDeliveries(deliveries []domains.WebhookDelivery) rest_errors.RestErr {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	err := w.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "webhook_id"}, {Name: "event_id"}},
+		DoNothing: true,
+	}).Create(&deliveries).Error
+	if err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// ClaimWebhookDeliveries takes at most limit due pending deliveries, oldest first, and hides them from other
+// workers for lease
+func (w *webhookRepository) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]domains.WebhookDelivery, rest_errors.RestErr) {
+	deliveries := []domains.WebhookDelivery{}
+	now := time.Now()
+	err := w.DB.Raw(`UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id IN (
+			SELECT id FROM webhook_deliveries WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY next_attempt_at, id LIMIT ? FOR UPDATE SKIP LOCKED)
+		RETURNING *`, now.Add(lease), domains.WebhookDeliveryPending, now, limit).Scan(&deliveries).Error
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery saves outcome of an attempt to send delivery
+func (w *webhookRepository) UpdateWebhookDelivery(delivery *domains.WebhookDelivery) rest_errors.RestErr {
+	err := w.DB.Model(delivery).Select("status", "attempts", "next_attempt_at", "last_status_code", "last_error", "delivered_at").
+		Updates(delivery).Error
+	if err != nil {
+		return errors.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// GetWebhookDeliveries returns at most limit deliveries of webhook, newest first, older than beforeID if it is not zero.
+// Empty status returns deliveries of any status
+func (w *webhookRepository) GetWebhookDeliveries(webhookID uint, status string, beforeID uint, limit int) ([]domains.WebhookDelivery, rest_errors.RestErr) {
+	q := w.DB.Where("webhook_id = ?", webhookID)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if beforeID != 0 {
+		q = q.Where("id < ?", beforeID)
+	}
+	deliveries := []domains.WebhookDelivery{}
+	if err := q.Order("id DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return deliveries, nil
+}
+
+// ReplayWebhookDelivery queues delivery to be sent now with fresh attempts, whatever its status is.
+// It returns nil if there is no such delivery or its webhook is deleted
+func (w *webhookRepository) ReplayWebhookDelivery(id uint, audit *domains.AuditEntry) (*domains.WebhookDelivery, rest_errors.RestErr) {
+	delivery := new(domains.WebhookDelivery)
+	err := audited(w.DB, audit, func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND webhook_id IN (?)", id, tx.Model(&domains.Webhook{}).Select("id")).
+			First(delivery).Error
+		if err == gorm.ErrRecordNotFound {
+			return errNothingChanged
+		}
+		if err != nil {
+			return err
+		}
+		if audit != nil {
+			audit.Changes = domains.AuditChanges{"status": {Before: delivery.Status, After: domains.WebhookDeliveryPending}}
+		}
+		delivery.Status = domains.WebhookDeliveryPending
+		delivery.Attempts = 0
+		delivery.NextAttemptAt = time.Now()
+		return tx.Model(delivery).Select("status", "attempts", "next_attempt_at").Updates(delivery).Error
+	})
+	if err == errNothingChanged {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	return delivery, nil
+}
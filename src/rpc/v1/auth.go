@@ -0,0 +1,64 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	userpb "github.com/alidevjimmy/user_microservice_t/proto/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// MetadataAPIKey is metadata callers send their api key in, like X-API-Key header of http api
+	MetadataAPIKey = "x-api-key"
+
+	metadataAuthorization = "authorization"
+	bearerPrefix          = "bearer "
+)
+
+// methodScopes is scope an api key needs to call each method, methods missing here are refused
+var methodScopes = map[string]string{
+	"/" + userpb.Users_ServiceDesc.ServiceName + "/GetUser":       services.ScopeUsersRead,
+	"/" + userpb.Users_ServiceDesc.ServiceName + "/GetUsersByIDs": services.ScopeUsersRead,
+	"/" + userpb.Users_ServiceDesc.ServiceName + "/ValidateToken": services.ScopeUsersRead,
+	"/" + userpb.Users_ServiceDesc.ServiceName + "/Register":      services.ScopeUsersWrite,
+	"/" + userpb.Users_ServiceDesc.ServiceName + "/Login":         services.ScopeUsersWrite,
+}
+
+// authenticate lets in calls carrying an api key having scope of the called method, see methodScopes.
+// Key is read from x-api-key metadata or from authorization metadata as a bearer token
+func authenticate(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	scope, ok := methodScopes[info.FullMethod]
+	if !ok {
+		return nil, statusOf(ctx, errors.NewError(errors.InsufficientScope, http.StatusForbidden))
+	}
+	key := apiKeyOf(ctx)
+	if key == "" {
+		return nil, statusOf(ctx, errors.NewUnauthorizedError(errors.InvalidAPIKey))
+	}
+	if _, err := services.APIKeyService.Authenticate(key, scope); err != nil {
+		return nil, statusOf(ctx, err)
+	}
+	return handler(ctx, req)
+}
+
+func apiKeyOf(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if keys := md.Get(MetadataAPIKey); len(keys) > 0 {
+		return strings.TrimSpace(keys[0])
+	}
+	if auth := md.Get(metadataAuthorization); len(auth) > 0 {
+		token := strings.TrimSpace(auth[0])
+		if len(token) > len(bearerPrefix) && strings.EqualFold(token[:len(bearerPrefix)], bearerPrefix) {
+			return strings.TrimSpace(token[len(bearerPrefix):])
+		}
+	}
+	return ""
+}
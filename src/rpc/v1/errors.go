@@ -0,0 +1,68 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ErrorDomain is domain of ErrorInfo details attached to errors
+	ErrorDomain = "user_microservice"
+
+	metadataAcceptLanguage = "accept-language"
+)
+
+var (
+	httpCodes = map[int]codes.Code{
+		http.StatusBadRequest:          codes.InvalidArgument,
+		http.StatusUnauthorized:        codes.Unauthenticated,
+		http.StatusForbidden:           codes.PermissionDenied,
+		http.StatusNotFound:            codes.NotFound,
+		http.StatusConflict:            codes.AlreadyExists,
+		http.StatusPreconditionFailed:  codes.FailedPrecondition,
+		http.StatusTooManyRequests:     codes.ResourceExhausted,
+		http.StatusNotImplemented:      codes.Unimplemented,
+		http.StatusServiceUnavailable:  codes.Unavailable,
+		http.StatusInternalServerError: codes.Internal,
+	}
+)
+
+// statusOf converts err to grpc status in the language caller asked by accept-language metadata,
+// error code goes to ErrorInfo.Reason and failed fields to BadRequest details
+func statusOf(ctx context.Context, err rest_errors.RestErr) error {
+	code, ok := httpCodes[err.Status()]
+	if !ok {
+		code = codes.Unknown
+	}
+	body := errors.Localize(err, locale(ctx))
+	st := status.New(code, body.Message)
+	withDetails, detailsErr := st.WithDetails(&errdetails.ErrorInfo{Reason: string(body.Code), Domain: ErrorDomain})
+	if detailsErr != nil {
+		return st.Err()
+	}
+	if len(body.Fields) > 0 {
+		br := &errdetails.BadRequest{}
+		for _, f := range body.Fields {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: f.Field, Description: f.Message})
+		}
+		if withFields, err := withDetails.WithDetails(br); err == nil {
+			withDetails = withFields
+		}
+	}
+	return withDetails.Err()
+}
+
+func locale(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(metadataAcceptLanguage); len(v) > 0 {
+		return errors.Locale(v[0])
+	}
+	return errors.DefaultLocale
+}
@@ -0,0 +1,149 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	userpb "github.com/alidevjimmy/user_microservice_t/proto/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/go-playground/validator/v10"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// usersServer exposes UserService and JwtService to internal callers, it is the grpc twin of controllers
+type usersServer struct {
+	userpb.UnimplementedUsersServer
+	validator *validator.Validate
+}
+
+// NewServer makes a grpc server serving Users api, requests are checked by v like http ones.
+// Callers authenticate with api keys, see authenticate
+func NewServer(v *validator.Validate, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(append([]grpc.ServerOption{grpc.ChainUnaryInterceptor(authenticate)}, opts...)...)
+	userpb.RegisterUsersServer(s, &usersServer{validator: v})
+	return s
+}
+
+func (s *usersServer) GetUser(ctx context.Context, rq *userpb.GetUserRequest) (*userpb.User, error) {
+	user, err := services.UserService.GetUserByID(uint(rq.GetId()))
+	if err != nil {
+		return nil, statusOf(ctx, err)
+	}
+	return toUser(user), nil
+}
+
+func (s *usersServer) GetUsersByIDs(ctx context.Context, rq *userpb.GetUsersByIDsRequest) (*userpb.GetUsersByIDsResponse, error) {
+	ids := make([]uint, len(rq.GetIds()))
+	for i, id := range rq.GetIds() {
+		ids[i] = uint(id)
+	}
+	users, err := services.UserService.GetUsersByIDs(ids)
+	if err != nil {
+		return nil, statusOf(ctx, err)
+	}
+	res := &userpb.GetUsersByIDsResponse{Users: make([]*userpb.User, len(users))}
+	for i := range users {
+		res.Users[i] = toUser(&users[i])
+	}
+	return res, nil
+}
+
+// ValidateToken reports token valid only if http api would let it in, it is checked by UserService.GetUser so
+// tokens of revoked sessions, of users refused by CheckAccount and access tokens of oauth clients are not valid
+func (s *usersServer) ValidateToken(ctx context.Context, rq *userpb.ValidateTokenRequest) (*userpb.ValidateTokenResponse, error) {
+	if rq.GetToken() == "" {
+		return &userpb.ValidateTokenResponse{}, nil
+	}
+	if _, err := services.UserService.GetUser(rq.GetToken()); err != nil {
+		if err.Status() >= http.StatusInternalServerError {
+			return nil, statusOf(ctx, err)
+		}
+		return &userpb.ValidateTokenResponse{}, nil
+	}
+	j, err := services.JwtService.VerifyJwtToken(rq.GetToken())
+	if err != nil || j == nil {
+		return &userpb.ValidateTokenResponse{}, nil
+	}
+	res := &userpb.ValidateTokenResponse{Valid: true, Subject: j.Sub}
+	if !j.Exp.IsZero() {
+		res.ExpiresAt = timestamppb.New(j.Exp)
+	}
+	return res, nil
+}
+
+func (s *usersServer) Register(ctx context.Context, rq *userpb.RegisterRequest) (*userpb.TokenResponse, error) {
+	body := domains.RegisterRequest{
+		Phone:    rq.GetPhone(),
+		Username: rq.GetUsername(),
+		Name:     rq.GetName(),
+		Family:   rq.GetFamily(),
+		Age:      uint(rq.GetAge()),
+		Password: rq.GetPassword(),
+	}
+	if err := s.validator.Struct(body); err != nil {
+		return nil, statusOf(ctx, errors.NewValidationError(err))
+	}
+	res, err := services.UserService.Register(body)
+	if err != nil {
+		return nil, statusOf(ctx, err)
+	}
+	if res == nil {
+		return &userpb.TokenResponse{}, nil
+	}
+	return &userpb.TokenResponse{Token: res.Token}, nil
+}
+
+func (s *usersServer) Login(ctx context.Context, rq *userpb.LoginRequest) (*userpb.TokenResponse, error) {
+	body := domains.LoginRequest{
+		PhoneOrUsername: rq.GetPhoneOrUsername(),
+		Password:        rq.GetPassword(),
+	}
+	if err := s.validator.Struct(body); err != nil {
+		return nil, statusOf(ctx, errors.NewValidationError(err))
+	}
+	res, err := services.UserService.Login(body, deviceOf(ctx))
+	if err != nil {
+		return nil, statusOf(ctx, err)
+	}
+	if res == nil {
+		return &userpb.TokenResponse{}, nil
+	}
+	return &userpb.TokenResponse{Token: res.Token}, nil
+}
+
+// deviceOf is where call logging in comes from, callers may forward user agent of their user as user-agent metadata
+func deviceOf(ctx context.Context) domains.Device {
+	var device domains.Device
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		device.UserAgent = strings.Join(md.Get("user-agent"), " ")
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		device.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(device.IP); err == nil {
+			device.IP = host
+		}
+	}
+	return device
+}
+
+func toUser(u *domains.PublicUser) *userpb.User {
+	return &userpb.User{
+		Id:        uint64(u.ID),
+		Phone:     u.Phone,
+		Username:  u.Username,
+		Name:      u.Name,
+		Family:    u.Family,
+		Age:       uint32(u.Age),
+		Active:    u.Active,
+		Blocked:   u.Blocked,
+		IsAdmin:   u.IsAdmin,
+		CreatedAt: timestamppb.New(u.CreatedAt),
+	}
+}
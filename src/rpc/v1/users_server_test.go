@@ -0,0 +1,395 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	userpb "github.com/alidevjimmy/user_microservice_t/proto/v1"
+	"github.com/alidevjimmy/user_microservice_t/services/v1"
+	"github.com/alidevjimmy/user_microservice_t/validators/v1"
+	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var (
+	getUserFunc       func(token string) (*domains.PublicUser, rest_errors.RestErr)
+	getUserByIDFunc   func(id uint) (*domains.PublicUser, rest_errors.RestErr)
+	getUsersByIDsFunc func(ids []uint) ([]domains.PublicUser, rest_errors.RestErr)
+	registerFunc      func(body domains.RegisterRequest) (*domains.RegisterResponse, rest_errors.RestErr)
+	loginFunc         func(body domains.LoginRequest) (*domains.LoginResponse, rest_errors.RestErr)
+	verifyJwtFunc     func(token string) (*domains.Jwt, rest_errors.RestErr)
+	authenticateFunc  func(key, scope string) (*domains.APIKey, rest_errors.RestErr)
+)
+
+const testAPIKey = "umk_abc_secret"
+
+type UserServiceMock struct{}
+
+func (*UserServiceMock) Register(body domains.RegisterRequest) (*domains.RegisterResponse, rest_errors.RestErr) {
+	return registerFunc(body)
+}
+
+func (*UserServiceMock) Login(body domains.LoginRequest, device domains.Device) (*domains.LoginResponse, rest_errors.RestErr) {
+	return loginFunc(body)
+}
+
+func (*UserServiceMock) GetUser(token string) (*domains.PublicUser, rest_errors.RestErr) {
+	return getUserFunc(token)
+}
+
+func (*UserServiceMock) GetUserByID(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+	return getUserByIDFunc(id)
+}
+
+func (*UserServiceMock) GetUsersByIDs(ids []uint) ([]domains.PublicUser, rest_errors.RestErr) {
+	return getUsersByIDsFunc(ids)
+}
+
+func (*UserServiceMock) GetUsers(params domains.GetUsersRequest) (*domains.GetUsersResponse, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*UserServiceMock) SearchUsers(params domains.SearchUsersRequest) ([]domains.PublicUser, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*UserServiceMock) SetActiveState(userId uint, versions domains.Versions, active bool, reason string, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*UserServiceMock) Block(userId uint, versions domains.Versions, req domains.BlockUserRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*UserServiceMock) Unblock(userId uint, versions domains.Versions, reason string, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*UserServiceMock) LiftExpiredBlocks() (int, rest_errors.RestErr) {
+	return 0, nil
+}
+
+func (*UserServiceMock) DeleteAccount(user *domains.PublicUser, body domains.DeleteAccountRequest, actor domains.Actor) (*domains.DeleteAccountResponse, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*UserServiceMock) PurgeDeletedAccounts() (int, rest_errors.RestErr) {
+	return 0, nil
+}
+
+func (*UserServiceMock) UpdateUser(caller *domains.PublicUser, userId string, versions domains.Versions, body domains.UpdateUserRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*UserServiceMock) ChangeForgotPassword(body domains.ChangePasswordRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*UserServiceMock) VerifyUser(body domains.VerifyUserRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*UserServiceMock) UpdatePassword(user *domains.PublicUser, body domains.UpdatePasswordRequest, actor domains.Actor) rest_errors.RestErr {
+	return nil
+}
+
+func (*UserServiceMock) StartPhoneChange(user *domains.PublicUser, body domains.ChangePhoneRequest) rest_errors.RestErr {
+	return nil
+}
+
+func (*UserServiceMock) ChangePhone(user *domains.PublicUser, body domains.ConfirmPhoneChangeRequest, actor domains.Actor, device domains.Device) (*domains.LoginResponse, rest_errors.RestErr) {
+	return nil, nil
+}
+
+type JwtServiceMock struct{}
+
+func (*JwtServiceMock) GenerateJwtToken(data jwt.MapClaims) (string, rest_errors.RestErr) {
+	return "", nil
+}
+
+func (*JwtServiceMock) VerifyJwtToken(token string) (*domains.Jwt, rest_errors.RestErr) {
+	return verifyJwtFunc(token)
+}
+
+type APIKeyServiceMock struct{}
+
+func (*APIKeyServiceMock) Create(actor domains.Actor, req domains.CreateAPIKeyRequest) (*domains.CreateAPIKeyResponse, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*APIKeyServiceMock) List() ([]domains.APIKey, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*APIKeyServiceMock) Revoke(id uint, actor domains.Actor) (*domains.APIKey, rest_errors.RestErr) {
+	return nil, nil
+}
+
+func (*APIKeyServiceMock) Authenticate(key, scope string) (*domains.APIKey, rest_errors.RestErr) {
+	return authenticateFunc(key, scope)
+}
+
+// newClient serves Users api over an in-memory connection, calls carry testAPIKey
+func newClient(t *testing.T) userpb.UsersClient {
+	return dial(t, grpc.WithUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(metadata.AppendToOutgoingContext(ctx, MetadataAPIKey, testAPIKey), method, req, reply, cc, opts...)
+	}))
+}
+
+func dial(t *testing.T, opts ...grpc.DialOption) userpb.UsersClient {
+	services.UserService = &UserServiceMock{}
+	services.JwtService = &JwtServiceMock{}
+	services.APIKeyService = &APIKeyServiceMock{}
+	authenticateFunc = func(key, scope string) (*domains.APIKey, rest_errors.RestErr) {
+		if key != testAPIKey {
+			return nil, errors.NewUnauthorizedError(errors.InvalidAPIKey)
+		}
+		return &domains.APIKey{Scopes: services.ScopeUsersRead + " " + services.ScopeUsersWrite}, nil
+	}
+
+	v := validator.New()
+	v.RegisterTagNameFunc(errors.FieldName)
+	if err := validators.Register(v); err != nil {
+		t.Fatal(err)
+	}
+	lis := bufconn.Listen(1024 * 1024)
+	s := NewServer(v)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet", append([]grpc.DialOption{
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return lis.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return userpb.NewUsersClient(conn)
+}
+
+func errorInfo(t *testing.T, err error) (*status.Status, *errdetails.ErrorInfo) {
+	st, ok := status.FromError(err)
+	assert.True(t, ok)
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			return st, info
+		}
+	}
+	t.Fatal("error has no ErrorInfo")
+	return nil, nil
+}
+
+func TestGetUser(t *testing.T) {
+	client := newClient(t)
+	createdAt := time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)
+	getUserByIDFunc = func(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{ID: id, Username: "ali", Age: 20, Active: true, CreatedAt: createdAt}, nil
+	}
+
+	u, err := client.GetUser(context.Background(), &userpb.GetUserRequest{Id: 7})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 7, u.GetId())
+	assert.Equal(t, "ali", u.GetUsername())
+	assert.EqualValues(t, 20, u.GetAge())
+	assert.True(t, u.GetActive())
+	assert.Equal(t, createdAt, u.GetCreatedAt().AsTime())
+}
+
+func TestGetUserNotFound(t *testing.T) {
+	client := newClient(t)
+	getUserByIDFunc = func(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+		return nil, errors.NewNotFoundError(errors.UserNotFound)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "accept-language", "en")
+	_, err := client.GetUser(ctx, &userpb.GetUserRequest{Id: 7})
+	st, info := errorInfo(t, err)
+	assert.Equal(t, codes.NotFound, st.Code())
+	assert.Equal(t, "User not found", st.Message())
+	assert.Equal(t, string(errors.UserNotFound), info.GetReason())
+	assert.Equal(t, ErrorDomain, info.GetDomain())
+}
+
+func TestGetUsersByIDs(t *testing.T) {
+	client := newClient(t)
+	getUsersByIDsFunc = func(ids []uint) ([]domains.PublicUser, rest_errors.RestErr) {
+		assert.Equal(t, []uint{1, 2, 3}, ids)
+		return []domains.PublicUser{{ID: 1}, {ID: 3}}, nil
+	}
+
+	res, err := client.GetUsersByIDs(context.Background(), &userpb.GetUsersByIDsRequest{Ids: []uint64{1, 2, 3}})
+	assert.Nil(t, err)
+	assert.Len(t, res.GetUsers(), 2)
+	assert.EqualValues(t, 3, res.GetUsers()[1].GetId())
+}
+
+func TestValidateToken(t *testing.T) {
+	client := newClient(t)
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	verifyJwtFunc = func(token string) (*domains.Jwt, rest_errors.RestErr) {
+		if token != "good" {
+			return nil, errors.NewInternalServerError(nil)
+		}
+		return &domains.Jwt{Sub: "12", Exp: exp}, nil
+	}
+	getUserFunc = func(token string) (*domains.PublicUser, rest_errors.RestErr) {
+		if token != "good" {
+			return nil, errors.NewUnauthorizedError(errors.InvalidToken)
+		}
+		return &domains.PublicUser{ID: 12}, nil
+	}
+
+	res, err := client.ValidateToken(context.Background(), &userpb.ValidateTokenRequest{Token: "good"})
+	assert.Nil(t, err)
+	assert.True(t, res.GetValid())
+	assert.Equal(t, "12", res.GetSubject())
+	assert.True(t, exp.Equal(res.GetExpiresAt().AsTime()))
+
+	res, err = client.ValidateToken(context.Background(), &userpb.ValidateTokenRequest{Token: "bad"})
+	assert.Nil(t, err)
+	assert.False(t, res.GetValid())
+
+	res, err = client.ValidateToken(context.Background(), &userpb.ValidateTokenRequest{})
+	assert.Nil(t, err)
+	assert.False(t, res.GetValid())
+}
+
+func TestValidateTokenRefusedByGetUser(t *testing.T) {
+	client := newClient(t)
+	verifyJwtFunc = func(token string) (*domains.Jwt, rest_errors.RestErr) {
+		return &domains.Jwt{Sub: "12", Exp: time.Now().Add(time.Hour)}, nil
+	}
+	// signature is fine but session is revoked, or user is blocked, or token belongs to an oauth client
+	getUserFunc = func(token string) (*domains.PublicUser, rest_errors.RestErr) {
+		return nil, errors.NewUnauthorizedError(errors.SessionNotFound)
+	}
+
+	res, err := client.ValidateToken(context.Background(), &userpb.ValidateTokenRequest{Token: "revoked"})
+	assert.Nil(t, err)
+	assert.False(t, res.GetValid())
+	assert.Empty(t, res.GetSubject())
+}
+
+func TestValidateTokenFailToGetUser(t *testing.T) {
+	client := newClient(t)
+	getUserFunc = func(token string) (*domains.PublicUser, rest_errors.RestErr) {
+		return nil, errors.NewInternalServerError(nil)
+	}
+
+	_, err := client.ValidateToken(context.Background(), &userpb.ValidateTokenRequest{Token: "token"})
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
+
+func TestRegisterInvalidInput(t *testing.T) {
+	client := newClient(t)
+	registerFunc = func(body domains.RegisterRequest) (*domains.RegisterResponse, rest_errors.RestErr) {
+		t.Fatal("service must not be called")
+		return nil, nil
+	}
+
+	_, err := client.Register(context.Background(), &userpb.RegisterRequest{Username: "ali", Name: "ali", Family: "hamrani", Age: 20, Password: "password"})
+	st, info := errorInfo(t, err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	assert.Equal(t, string(errors.InvalidInput), info.GetReason())
+	var violations *errdetails.BadRequest
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			violations = br
+		}
+	}
+	assert.NotNil(t, violations)
+	assert.Equal(t, "phone", violations.GetFieldViolations()[0].GetField())
+}
+
+func TestRegister(t *testing.T) {
+	client := newClient(t)
+	registerFunc = func(body domains.RegisterRequest) (*domains.RegisterResponse, rest_errors.RestErr) {
+		assert.Equal(t, "09122334344", body.Phone)
+		return &domains.RegisterResponse{Token: "token"}, nil
+	}
+
+	res, err := client.Register(context.Background(), &userpb.RegisterRequest{
+		Phone: "09122334344", Username: "ali", Name: "ali", Family: "hamrani", Age: 20, Password: "password",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "token", res.GetToken())
+}
+
+func TestLoginServiceReturnedError(t *testing.T) {
+	client := newClient(t)
+	loginFunc = func(body domains.LoginRequest) (*domains.LoginResponse, rest_errors.RestErr) {
+		return nil, errors.NewError(errors.UserNotFound, http.StatusUnauthorized)
+	}
+
+	_, err := client.Login(context.Background(), &userpb.LoginRequest{PhoneOrUsername: "ali", Password: "password"})
+	st, info := errorInfo(t, err)
+	assert.Equal(t, codes.Unauthenticated, st.Code())
+	assert.Equal(t, errors.UserNotFoundError, st.Message())
+	assert.Equal(t, string(errors.UserNotFound), info.GetReason())
+}
+
+func TestLogin(t *testing.T) {
+	client := newClient(t)
+	loginFunc = func(body domains.LoginRequest) (*domains.LoginResponse, rest_errors.RestErr) {
+		return &domains.LoginResponse{Token: "token"}, nil
+	}
+
+	res, err := client.Login(context.Background(), &userpb.LoginRequest{PhoneOrUsername: "ali", Password: "password"})
+	assert.Nil(t, err)
+	assert.Equal(t, "token", res.GetToken())
+}
+
+func TestCallWithoutAPIKeyIsRejected(t *testing.T) {
+	getUserByIDFunc = func(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+		t.Fatal("unauthenticated call reached service")
+		return nil, nil
+	}
+	_, err := dial(t).GetUser(context.Background(), &userpb.GetUserRequest{Id: 1})
+	st, info := errorInfo(t, err)
+	assert.Equal(t, codes.Unauthenticated, st.Code())
+	assert.EqualValues(t, errors.InvalidAPIKey, info.Reason)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), MetadataAPIKey, "umk_abc_wrong")
+	_, err = dial(t).GetUser(ctx, &userpb.GetUserRequest{Id: 1})
+	st, _ = errorInfo(t, err)
+	assert.Equal(t, codes.Unauthenticated, st.Code())
+}
+
+func TestCallNeedsScopeOfMethod(t *testing.T) {
+	client := newClient(t)
+	authenticateFunc = func(key, scope string) (*domains.APIKey, rest_errors.RestErr) {
+		assert.Equal(t, services.ScopeUsersWrite, scope)
+		return nil, errors.NewError(errors.InsufficientScope, http.StatusForbidden)
+	}
+	_, err := client.Login(context.Background(), &userpb.LoginRequest{PhoneOrUsername: "ali", Password: "password"})
+	st, _ := errorInfo(t, err)
+	assert.Equal(t, codes.PermissionDenied, st.Code())
+}
+
+func TestCallWithBearerAPIKey(t *testing.T) {
+	getUserByIDFunc = func(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{ID: id}, nil
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+testAPIKey)
+	user, err := dial(t).GetUser(ctx, &userpb.GetUserRequest{Id: 1})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, user.Id)
+}
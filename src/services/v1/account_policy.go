@@ -0,0 +1,71 @@
+package services
+
+import (
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+)
+
+const (
+	// MaxFailedLogins wrong passwords in a row lock user for LoginLockDuration
+	MaxFailedLogins   = 5
+	LoginLockDuration = 15 * time.Minute
+)
+
+// AccountUse is what a user is about to do with its account, CheckAccount allows states by it
+type AccountUse int
+
+const (
+	// AccountUseSession is using a token or signing in without password, by passkey or social login
+	AccountUseSession AccountUse = iota
+	// AccountUsePassword is signing in by password, locked users are refused too
+	AccountUsePassword
+	// AccountUseVerification is verifying phone, the only use of users not verified yet
+	AccountUseVerification
+	// AccountUsePasswordReset is resetting password, which lifts the lock of failed logins
+	AccountUsePasswordReset
+)
+
+// CheckAccount is the one policy telling whether user may use its account for use,
+// every way into an account asks it so users are refused the same way everywhere
+func CheckAccount(user *domains.PublicUser, use AccountUse) rest_errors.RestErr {
+	switch user.Status(time.Now()) {
+	case domains.AccountBlocked:
+		return errors.NewAccountBlockedError(user.BlockReason, user.BlockedUntil)
+	case domains.AccountDeactivated:
+		return errors.NewAccountDeactivatedError()
+	case domains.AccountUnverified:
+		if use != AccountUseVerification {
+			return errors.NewAccountUnverifiedError()
+		}
+	case domains.AccountLocked:
+		if use == AccountUsePassword {
+			return errors.NewAccountLockedError(user.LockedUntil)
+		}
+	}
+	return nil
+}
+
+// checkAccountOf is CheckAccount of user having userID
+func checkAccountOf(userID uint, use AccountUse) rest_errors.RestErr {
+	user, err := repositories.UserRepository.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return errors.NewNotFoundError(errors.UserNotFound)
+	}
+	return CheckAccount(user, use)
+}
+
+// checkAccountOfPhone is CheckAccount of user owning phone, phones of no user are left to the caller
+func checkAccountOfPhone(phone string, use AccountUse) rest_errors.RestErr {
+	user, err := repositories.UserRepository.GetUserByPhone(phone)
+	if err != nil || user == nil {
+		return err
+	}
+	return CheckAccount(user, use)
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckAccount(t *testing.T) {
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Minute)
+	active := domains.PublicUser{Active: true}
+	unverified := domains.PublicUser{}
+	deactivated := domains.PublicUser{DeactivatedAt: &past}
+	blocked := domains.PublicUser{Active: true, Blocked: true, BlockReason: "spam", BlockedUntil: &future}
+	blockExpired := domains.PublicUser{Active: true, Blocked: true, BlockedUntil: &past}
+	locked := domains.PublicUser{Active: true, LockedUntil: &future}
+
+	for _, c := range []struct {
+		user    domains.PublicUser
+		use     AccountUse
+		message string
+	}{
+		{active, AccountUseSession, ""},
+		{active, AccountUsePassword, ""},
+		{unverified, AccountUseSession, errors.AccountUnverifiedErrorMessage},
+		{unverified, AccountUsePassword, errors.AccountUnverifiedErrorMessage},
+		{unverified, AccountUsePasswordReset, errors.AccountUnverifiedErrorMessage},
+		{unverified, AccountUseVerification, ""},
+		{deactivated, AccountUseSession, errors.AccountDeactivatedErrorMessage},
+		{deactivated, AccountUseVerification, errors.AccountDeactivatedErrorMessage},
+		{blocked, AccountUseSession, errors.AccountBlockedErrorMessage},
+		{blocked, AccountUsePasswordReset, errors.AccountBlockedErrorMessage},
+		{blockExpired, AccountUsePassword, ""},
+		{locked, AccountUsePassword, errors.AccountLockedErrorMessage},
+		{locked, AccountUseSession, ""},
+		{locked, AccountUsePasswordReset, ""},
+	} {
+		err := CheckAccount(&c.user, c.use)
+		if c.message == "" {
+			assert.Nil(t, err, "%s use %d", c.user.Status(time.Now()), c.use)
+			continue
+		}
+		if assert.NotNil(t, err, "%s use %d", c.user.Status(time.Now()), c.use) {
+			assert.Equal(t, c.message, err.Message())
+		}
+	}
+
+	err := CheckAccount(&blocked, AccountUseSession).(*errors.AccountError)
+	assert.Equal(t, "spam", err.Reason)
+	assert.Equal(t, &future, err.Until)
+}
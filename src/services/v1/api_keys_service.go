@@ -0,0 +1,128 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/crypto"
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+)
+
+const (
+	// APIKeyPrefix starts every api key so keys are told apart from jwts and found by secret scanners
+	APIKeyPrefix = "umk_"
+
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+
+	// apiKeyTouchInterval limits how often last use of a key is written
+	apiKeyTouchInterval = time.Minute
+)
+
+var (
+	APIKeyService apiKeyServiceInterface = &apiKeyService{}
+)
+
+type apiKeyServiceInterface interface {
+	Create(actor domains.Actor, req domains.CreateAPIKeyRequest) (*domains.CreateAPIKeyResponse, rest_errors.RestErr)
+	List() ([]domains.APIKey, rest_errors.RestErr)
+	Revoke(id uint, actor domains.Actor) (*domains.APIKey, rest_errors.RestErr)
+	Authenticate(key, scope string) (*domains.APIKey, rest_errors.RestErr)
+}
+
+type apiKeyService struct{}
+
+// IsAPIKey reports whether token looks like an api key rather than a jwt
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// Create makes a key of form umk_<prefix>_<secret> owned by actor, key is returned once and only its hash is kept
+func (*apiKeyService) Create(actor domains.Actor, req domains.CreateAPIKeyRequest) (*domains.CreateAPIKeyResponse, rest_errors.RestErr) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return nil, errors.NewInternalServerError(err)
+	}
+	secret, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	prefix := APIKeyPrefix + hex.EncodeToString(id)
+	key := prefix + "_" + secret
+	apiKey := &domains.APIKey{
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   crypto.GenerateSha256(key),
+		Scopes:    strings.Join(req.Scopes, " "),
+		CreatedBy: actor.UserID,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, int(req.ExpiresInDays))
+		apiKey.ExpiresAt = &expiresAt
+	}
+	audit := actor.Audit(AuditAPIKeyCreated, 0, domains.AuditChanges{
+		"prefix": {After: apiKey.Prefix},
+		"scopes": {After: apiKey.Scopes},
+	})
+	if err := repositories.APIKeyRepository.CreateAPIKey(apiKey, audit); err != nil {
+		return nil, err
+	}
+	return &domains.CreateAPIKeyResponse{APIKey: *apiKey, Key: key}, nil
+}
+
+func (*apiKeyService) List() ([]domains.APIKey, rest_errors.RestErr) {
+	return repositories.APIKeyRepository.GetAPIKeys()
+}
+
+// Revoke stops key from working, revoking a revoked key is not an error
+func (*apiKeyService) Revoke(id uint, actor domains.Actor) (*domains.APIKey, rest_errors.RestErr) {
+	audit := actor.Audit(AuditAPIKeyRevoked, 0, domains.AuditChanges{"api_key_id": {After: id}})
+	key, err := repositories.APIKeyRepository.RevokeAPIKey(id, audit)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, errors.NewNotFoundError(errors.APIKeyNotFound)
+	}
+	return key, nil
+}
+
+// Authenticate returns live key having scope, unknown, wrong, revoked and expired keys look the same
+func (*apiKeyService) Authenticate(key, scope string) (*domains.APIKey, rest_errors.RestErr) {
+	invalid := errors.NewUnauthorizedError(errors.InvalidAPIKey)
+	if !IsAPIKey(key) {
+		return nil, invalid
+	}
+	parts := strings.SplitN(strings.TrimPrefix(key, APIKeyPrefix), "_", 2)
+	if len(parts) != 2 {
+		return nil, invalid
+	}
+	apiKey, err := repositories.APIKeyRepository.GetAPIKeyByPrefix(APIKeyPrefix + parts[0])
+	if err != nil {
+		return nil, err
+	}
+	if apiKey == nil || subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(crypto.GenerateSha256(key))) != 1 {
+		return nil, invalid
+	}
+	now := time.Now()
+	if apiKey.RevokedAt != nil || (apiKey.ExpiresAt != nil && now.After(*apiKey.ExpiresAt)) {
+		return nil, invalid
+	}
+	if !containsAll(strings.Fields(apiKey.Scopes), []string{scope}) {
+		return nil, errors.NewError(errors.InsufficientScope, http.StatusForbidden)
+	}
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyTouchInterval {
+		if err := repositories.APIKeyRepository.TouchAPIKey(apiKey.ID, now); err != nil {
+			return nil, err
+		}
+		apiKey.LastUsedAt = &now
+	}
+	return apiKey, nil
+}
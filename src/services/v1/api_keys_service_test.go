@@ -0,0 +1,140 @@
+package services
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// APIKeyRepositoryMock keeps keys in memory
+type APIKeyRepositoryMock struct {
+	keys    []*domains.APIKey
+	touches int
+}
+
+func (m *APIKeyRepositoryMock) CreateAPIKey(key *domains.APIKey, audit *domains.AuditEntry) rest_errors.RestErr {
+	key.ID = uint(len(m.keys) + 1)
+	m.keys = append(m.keys, key)
+	return nil
+}
+
+func (m *APIKeyRepositoryMock) GetAPIKeyByPrefix(prefix string) (*domains.APIKey, rest_errors.RestErr) {
+	for _, key := range m.keys {
+		if key.Prefix == prefix {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *APIKeyRepositoryMock) GetAPIKeys() ([]domains.APIKey, rest_errors.RestErr) {
+	keys := []domains.APIKey{}
+	for _, key := range m.keys {
+		keys = append(keys, *key)
+	}
+	return keys, nil
+}
+
+func (m *APIKeyRepositoryMock) RevokeAPIKey(id uint, audit *domains.AuditEntry) (*domains.APIKey, rest_errors.RestErr) {
+	for _, key := range m.keys {
+		if key.ID == id {
+			now := time.Now()
+			key.RevokedAt = &now
+			return key, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *APIKeyRepositoryMock) TouchAPIKey(id uint, at time.Time) rest_errors.RestErr {
+	m.touches++
+	m.keys[id-1].LastUsedAt = &at
+	return nil
+}
+
+func newAPIKey(t *testing.T, req domains.CreateAPIKeyRequest) (*APIKeyRepositoryMock, string) {
+	repo := &APIKeyRepositoryMock{}
+	repositories.APIKeyRepository = repo
+	res, err := APIKeyService.Create(domains.Actor{UserID: 1}, req)
+	assert.Nil(t, err)
+	return repo, res.Key
+}
+
+func TestCreateAPIKeyStoresOnlyHash(t *testing.T) {
+	repo, key := newAPIKey(t, domains.CreateAPIKeyRequest{Name: "reports", Scopes: []string{ScopeUsersRead}, ExpiresInDays: 30})
+
+	assert.True(t, IsAPIKey(key))
+	stored := repo.keys[0]
+	assert.True(t, strings.HasPrefix(key, stored.Prefix+"_"))
+	assert.NotContains(t, stored.KeyHash, key)
+	assert.Equal(t, ScopeUsersRead, stored.Scopes)
+	assert.EqualValues(t, 1, stored.CreatedBy)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, 30), *stored.ExpiresAt, time.Minute)
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	repo, key := newAPIKey(t, domains.CreateAPIKeyRequest{Name: "reports", Scopes: []string{ScopeUsersRead}})
+
+	apiKey, err := APIKeyService.Authenticate(key, ScopeUsersRead)
+	assert.Nil(t, err)
+	assert.Equal(t, "reports", apiKey.Name)
+	assert.NotNil(t, apiKey.LastUsedAt)
+
+	// last use is not written on every request
+	_, err = APIKeyService.Authenticate(key, ScopeUsersRead)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, repo.touches)
+}
+
+func TestAuthenticateAPIKeyMissingScope(t *testing.T) {
+	_, key := newAPIKey(t, domains.CreateAPIKeyRequest{Name: "reports", Scopes: []string{ScopeUsersRead}})
+
+	apiKey, err := APIKeyService.Authenticate(key, ScopeUsersWrite)
+	assert.Nil(t, apiKey)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusForbidden, err.Status())
+	assert.Equal(t, errors.InsufficientScopeErrorMessage, err.Message())
+}
+
+func TestAuthenticateAPIKeyWrongSecret(t *testing.T) {
+	_, key := newAPIKey(t, domains.CreateAPIKeyRequest{Name: "reports", Scopes: []string{ScopeUsersRead}})
+
+	for _, wrong := range []string{key + "x", key[:strings.LastIndex(key, "_")], "umk_", "not-a-key"} {
+		_, err := APIKeyService.Authenticate(wrong, ScopeUsersRead)
+		assert.NotNil(t, err, wrong)
+		assert.Equal(t, errors.InvalidAPIKeyErrorMessage, err.Message())
+	}
+}
+
+func TestAuthenticateRevokedAndExpiredAPIKey(t *testing.T) {
+	repo, key := newAPIKey(t, domains.CreateAPIKeyRequest{Name: "reports", Scopes: []string{ScopeUsersRead}})
+
+	past := time.Now().Add(-time.Hour)
+	repo.keys[0].ExpiresAt = &past
+	_, err := APIKeyService.Authenticate(key, ScopeUsersRead)
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.InvalidAPIKeyErrorMessage, err.Message())
+
+	repo.keys[0].ExpiresAt = nil
+	_, err = APIKeyService.Revoke(1, domains.Actor{UserID: 1})
+	assert.Nil(t, err)
+	_, err = APIKeyService.Authenticate(key, ScopeUsersRead)
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.InvalidAPIKeyErrorMessage, err.Message())
+}
+
+func TestRevokeUnknownAPIKey(t *testing.T) {
+	repositories.APIKeyRepository = &APIKeyRepositoryMock{}
+
+	_, err := APIKeyService.Revoke(9, domains.Actor{UserID: 1})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.APIKeyNotFoundErrorMessage, err.Message())
+}
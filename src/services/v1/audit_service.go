@@ -0,0 +1,93 @@
+package services
+
+import (
+	"encoding/base64"
+	"strconv"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+)
+
+// actions written to audit log
+const (
+	AuditUserActiveState   = "user.active_state"
+	AuditUserBlockState    = "user.block_state"
+	AuditUserUpdated       = "user.updated"
+	AuditUserVerified      = "user.verified"
+	AuditPasswordReset     = "user.password_reset"
+	AuditPasswordChanged   = "user.password_changed"
+	AuditPhoneChanged      = "user.phone_changed"
+	AuditUserDeleted       = "user.deleted"
+	AuditUserRestored      = "user.restored"
+	AuditUserPurged        = "user.purged"
+	AuditExportRequested   = "user.export_requested"
+	AuditSessionRevoked    = "session.revoked"
+	AuditSessionsRevoked   = "session.revoked_all"
+	AuditAPIKeyCreated     = "api_key.created"
+	AuditAPIKeyRevoked     = "api_key.revoked"
+	AuditPasskeyRegistered = "passkey.registered"
+	AuditPasskeyDeleted    = "passkey.deleted"
+	AuditIdentityLinked    = "identity.linked"
+	AuditIdentityUnlinked  = "identity.unlinked"
+	AuditClientCreated     = "client.created"
+	AuditWebhookCreated    = "webhook.created"
+	AuditWebhookDeleted    = "webhook.deleted"
+	AuditWebhookReplayed   = "webhook.delivery_replayed"
+
+	DefaultAuditPageSize = 50
+)
+
+var (
+	AuditService auditServiceInterface = &auditService{}
+)
+
+type auditServiceInterface interface {
+	List(params domains.GetAuditLogRequest) (*domains.GetAuditLogResponse, rest_errors.RestErr)
+}
+
+type auditService struct{}
+
+// List returns a page of audit log by filter, newest first
+func (*auditService) List(params domains.GetAuditLogRequest) (*domains.GetAuditLogResponse, rest_errors.RestErr) {
+	if params.From != nil && params.To != nil && params.From.After(*params.To) {
+		return nil, errors.NewBadRequestError(errors.InvalidTimeRange)
+	}
+	if params.Limit == 0 {
+		params.Limit = DefaultAuditPageSize
+	}
+	beforeID, err := decodeCursor(params.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	// one extra row tells whether there is a next page
+	entries, err := repositories.AuditRepository.GetAuditEntries(params, beforeID, params.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+	res := &domains.GetAuditLogResponse{Entries: entries}
+	if len(entries) > params.Limit {
+		res.Entries = entries[:params.Limit]
+		res.NextCursor = encodeCursor(res.Entries[params.Limit-1].ID)
+	}
+	return res, nil
+}
+
+// encodeCursor makes an opaque cursor of pages ordered by id descending, next page starts after id
+func encodeCursor(id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(id), 10)))
+}
+
+// decodeCursor returns id made into cursor by encodeCursor, zero for empty cursor
+func decodeCursor(cursor string) (uint, rest_errors.RestErr) {
+	if cursor == "" {
+		return 0, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	id, convErr := strconv.ParseUint(string(b), 10, 64)
+	if err != nil || convErr != nil || id == 0 {
+		return 0, errors.NewBadRequestError(errors.InvalidCursor)
+	}
+	return uint(id), nil
+}
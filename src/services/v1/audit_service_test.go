@@ -0,0 +1,73 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// AuditRepositoryMock keeps entries in memory, oldest first
+type AuditRepositoryMock struct {
+	entries []domains.AuditEntry
+}
+
+func (m *AuditRepositoryMock) GetAuditEntries(params domains.GetAuditLogRequest, beforeID uint, limit int) ([]domains.AuditEntry, rest_errors.RestErr) {
+	entries := []domains.AuditEntry{}
+	for i := len(m.entries) - 1; i >= 0 && len(entries) < limit; i-- {
+		entry := m.entries[i]
+		if beforeID != 0 && entry.ID >= beforeID {
+			continue
+		}
+		if params.Action != "" && entry.Action != params.Action {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func newAuditTest(actions ...string) *AuditRepositoryMock {
+	repo := &AuditRepositoryMock{}
+	for i, action := range actions {
+		repo.entries = append(repo.entries, domains.AuditEntry{ID: uint(i + 1), Action: action})
+	}
+	repositories.AuditRepository = repo
+	return repo
+}
+
+func TestListAuditLogPages(t *testing.T) {
+	newAuditTest(AuditUserBlockState, AuditPasswordReset, AuditUserBlockState, AuditUserBlockState)
+
+	res, err := AuditService.List(domains.GetAuditLogRequest{Action: AuditUserBlockState, Limit: 2})
+	assert.Nil(t, err)
+	assert.Len(t, res.Entries, 2)
+	assert.EqualValues(t, 4, res.Entries[0].ID)
+	assert.EqualValues(t, 3, res.Entries[1].ID)
+	assert.NotEmpty(t, res.NextCursor)
+
+	res, err = AuditService.List(domains.GetAuditLogRequest{Action: AuditUserBlockState, Limit: 2, Cursor: res.NextCursor})
+	assert.Nil(t, err)
+	assert.Len(t, res.Entries, 1)
+	assert.EqualValues(t, 1, res.Entries[0].ID)
+	assert.Empty(t, res.NextCursor)
+}
+
+func TestListAuditLogInvalidInput(t *testing.T) {
+	newAuditTest()
+
+	_, err := AuditService.List(domains.GetAuditLogRequest{Cursor: "!"})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.InvalidCursorErrorMessage, err.Message())
+
+	from, to := time.Now(), time.Now().Add(-time.Hour)
+	_, err = AuditService.List(domains.GetAuditLogRequest{From: &from, To: &to})
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.Status())
+	assert.Equal(t, errors.InvalidTimeRangeErrorMessage, err.Message())
+}
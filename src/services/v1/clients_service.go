@@ -0,0 +1,78 @@
+package services
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/alidevjimmy/go-rest-utils/crypto"
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+)
+
+var (
+	ClientService clientServiceInterface = &clientService{}
+)
+
+type clientServiceInterface interface {
+	Authenticate(clientID, secret string) (*domains.Client, rest_errors.RestErr)
+	Create(req domains.CreateClientRequest, actor domains.Actor) (*domains.CreateClientResponse, rest_errors.RestErr)
+}
+
+type clientService struct{}
+
+// Authenticate returns client owning clientID and secret, unknown clients and wrong secrets look the same
+func (*clientService) Authenticate(clientID, secret string) (*domains.Client, rest_errors.RestErr) {
+	if clientID == "" || secret == "" {
+		return nil, errors.NewUnauthorizedError(errors.InvalidClient)
+	}
+	client, err := repositories.ClientRepository.GetClientByClientID(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil || subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(crypto.GenerateSha256(secret))) != 1 {
+		return nil, errors.NewUnauthorizedError(errors.InvalidClient)
+	}
+	return client, nil
+}
+
+// Create registers a client, secret of confidential clients is returned once and only its hash is kept
+func (*clientService) Create(req domains.CreateClientRequest, actor domains.Actor) (*domains.CreateClientResponse, rest_errors.RestErr) {
+	grantTypes := &domains.Client{GrantTypes: strings.Join(req.GrantTypes, " ")}
+	if req.Public && grantTypes.HasGrantType(GrantTypeClientCredentials) {
+		return nil, errors.NewBadRequestError(errors.UnauthorizedClient)
+	}
+	if grantTypes.HasGrantType(GrantTypeAuthorizationCode) && len(req.RedirectURIs) == 0 {
+		return nil, errors.NewBadRequestError(errors.InvalidRedirectURI)
+	}
+	clientID, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	client := &domains.Client{
+		ClientID:     clientID,
+		Name:         req.Name,
+		Scopes:       strings.Join(req.Scopes, " "),
+		RedirectURIs: strings.Join(req.RedirectURIs, " "),
+		GrantTypes:   grantTypes.GrantTypes,
+		Public:       req.Public,
+	}
+	res := &domains.CreateClientResponse{}
+	if !req.Public {
+		if res.ClientSecret, err = randomToken(); err != nil {
+			return nil, err
+		}
+		client.SecretHash = crypto.GenerateSha256(res.ClientSecret)
+	}
+	audit := actor.Audit(AuditClientCreated, 0, domains.AuditChanges{
+		"client_id":   {After: client.ClientID},
+		"scopes":      {After: client.Scopes},
+		"grant_types": {After: client.GrantTypes},
+	})
+	if err := repositories.ClientRepository.CreateClient(client, audit); err != nil {
+		return nil, err
+	}
+	res.Client = *client
+	return res, nil
+}
@@ -1,20 +1,44 @@
 package services
 
 import (
-	"math/rand"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
 	"time"
 
 	"github.com/alidevjimmy/go-rest-utils/rest_errors"
 	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+	"github.com/alidevjimmy/user_microservice_t/utils/sms"
 )
 
 var (
 	CodeService codeServiceInterface = &codeService{}
+	// SMSSender delivers codes, StartApp sets it by environment, see CodeSMSSender
+	SMSSender sms.Sender = sms.NewLocal()
 )
 
 const (
-	VERIFICATION = 1
+	VERIFICATION  = 1
 	RESETPASSWORD = 2
+	// CHANGEPHONE codes are sent to the new phone of user, and to the old one if changes are confirmed on it
+	CHANGEPHONE = 3
+
+	// CodeTTL is how long a sent code may be verified
+	CodeTTL = 5 * time.Minute
+	// MaxCodeAttempts is how many wrong codes are tried against a code before it stops working
+	MaxCodeAttempts = 5
+
+	// envKavenegarAPIKey is the api key codes are sent by, codes are kept in process when it is not set
+	envKavenegarAPIKey = "KAVENEGAR_API_CODE"
+	// envKavenegarSender is the line codes are sent from, the default line of the account if it is not set
+	envKavenegarSender = "KAVENEGAR_SENDER"
+
+	codeMessage = "کد تایید شما: %d"
 )
 
 type codeServiceInterface interface {
@@ -23,17 +47,90 @@ type codeServiceInterface interface {
 }
 type codeService struct{}
 
+// CodeSMSSender returns sender configured by environment, see envKavenegarAPIKey
+func CodeSMSSender() sms.Sender {
+	if key := os.Getenv(envKavenegarAPIKey); key != "" {
+		return sms.NewKavenegar(key, os.Getenv(envKavenegarSender))
+	}
+	return sms.NewLocal()
+}
+
+// Send texts a new code for reason to phone of body. Verification and password reset codes go to phones
+// of users only, phone change codes go to the new phone which has no user yet
 func (*codeService) Send(body domains.SendCodeRequest) rest_errors.RestErr {
+	p, err := NormalizePhone(body.Phone)
+	if err != nil {
+		return err
+	}
+	body.Phone = p
+	use := AccountUseVerification
+	switch body.Reason {
+	case VERIFICATION:
+	case RESETPASSWORD:
+		use = AccountUsePasswordReset
+	case CHANGEPHONE:
+		use = AccountUseSession
+	default:
+		return errors.NewBadRequestError(errors.InvalidInput)
+	}
+	user, err := repositories.UserRepository.GetUserByPhone(body.Phone)
+	if err != nil {
+		return err
+	}
+	if user == nil && body.Reason != CHANGEPHONE {
+		return errors.NewNotFoundError(errors.UserNotFound)
+	}
+	if user != nil {
+		if err := CheckAccount(user, use); err != nil {
+			return err
+		}
+	}
+	code, err := RandomCodeGenerator()
+	if err != nil {
+		return err
+	}
+	c := &domains.Code{Phone: body.Phone, Code: code, CodePurpose: body.Reason, CodeExpiration: time.Now().Add(CodeTTL)}
+	if err := repositories.CodeRepository.CreateCode(c); err != nil {
+		return err
+	}
+	msg := sms.Message{Receptor: body.Phone, Text: fmt.Sprintf(codeMessage, code)}
+	if err := SMSSender.Send(context.Background(), msg); err != nil {
+		return errors.NewInternalServerError(err)
+	}
 	return nil
 }
 
+// Verify uses code if it is the latest code sent to phone for reason, a code is verified once.
+// After MaxCodeAttempts wrong codes a new code has to be sent
 func (*codeService) Verify(phone string, code, reason int) (bool, rest_errors.RestErr) {
-	return false, nil
+	phone, err := NormalizePhone(phone)
+	if err != nil {
+		return false, err
+	}
+	c, used, err := repositories.CodeRepository.UseCode(phone, code, reason, MaxCodeAttempts)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case used:
+		return true, nil
+	case c == nil:
+		return false, errors.NewNotFoundError(errors.CodeOrPhoneDoesNotExist)
+	case IsExpired(c.CodeExpiration):
+		return false, errors.NewBadRequestError(errors.CodeIsExpired)
+	case c.FailedAttempts >= MaxCodeAttempts:
+		return false, errors.NewError(errors.TooManyCodeAttempts, http.StatusTooManyRequests)
+	}
+	return false, errors.NewNotFoundError(errors.CodeOrPhoneDoesNotExist)
 }
 
-func RandomCodeGenerator() int {
-	rand.Seed(time.Now().UnixNano())
-	return rand.Intn(99999-10000+1) + 10000
+// RandomCodeGenerator returns a random 5 digit code
+func RandomCodeGenerator() (int, rest_errors.RestErr) {
+	n, err := rand.Int(rand.Reader, big.NewInt(90000))
+	if err != nil {
+		return 0, errors.NewInternalServerError(err)
+	}
+	return int(n.Int64()) + 10000, nil
 }
 
 func IsExpired(exp time.Time) bool {
@@ -11,26 +11,55 @@ import (
 	"github.com/alidevjimmy/user_microservice_t/domains/v1"
 	"github.com/alidevjimmy/user_microservice_t/errors/v1"
 	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+	"github.com/alidevjimmy/user_microservice_t/utils/sms"
 	"github.com/jarcoal/httpmock"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/gorm"
 )
 
 var (
-	findCodeFunc func(phone string, code, reason int) (*domains.Code, rest_errors.RestErr)
+	useCodeFunc func(phone string, code, reason, maxAttempts int) (*domains.Code, bool, rest_errors.RestErr)
 )
 
+// CodeRepoMock answers UseCode by useCodeFunc, or by codes created like the repository does when it is nil
 type CodeRepoMock struct {
-	DB *gorm.DB
+	DB    *gorm.DB
+	codes []domains.Code
 }
 
-func (c *CodeRepoMock) FindCode(phone string, code, reason int) (*domains.Code, rest_errors.RestErr) {
-	return findCodeFunc(phone, code, reason)
+func (c *CodeRepoMock) CreateCode(code *domains.Code) rest_errors.RestErr {
+	code.ID = uint(len(c.codes) + 1)
+	c.codes = append(c.codes, *code)
+	return nil
+}
+
+func (c *CodeRepoMock) UseCode(phone string, code, reason, maxAttempts int) (*domains.Code, bool, rest_errors.RestErr) {
+	if useCodeFunc != nil {
+		return useCodeFunc(phone, code, reason, maxAttempts)
+	}
+	for i := len(c.codes) - 1; i >= 0; i-- {
+		latest := &c.codes[i]
+		if latest.Phone != phone || latest.CodePurpose != reason {
+			continue
+		}
+		found := *latest
+		if latest.FailedAttempts >= maxAttempts || IsExpired(latest.CodeExpiration) {
+			return &found, false, nil
+		}
+		if latest.Code != code {
+			latest.FailedAttempts++
+			found.FailedAttempts++
+			return &found, false, nil
+		}
+		c.codes = append(c.codes[:i], c.codes[i+1:]...)
+		return &found, true, nil
+	}
+	return nil, false, nil
 }
 
 func TestSendCodeFailToGetDataFromRepo(t *testing.T) {
 	getUserFunc = func(userId uint) (*domains.PublicUser, rest_errors.RestErr) {
-		return nil, rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+		return nil, errors.NewInternalServerError(nil)
 	}
 	repositories.UserRepository = &UserRespositoryMock{}
 	body := domains.SendCodeRequest{
@@ -184,8 +213,8 @@ func TestSendForgetPasswordCodeSuccessfully(t *testing.T) {
 }
 
 func TestVerifyCodeFailToGetDataFromRepo(t *testing.T) {
-	findCodeFunc = func(phone string, code, reason int) (*domains.Code, rest_errors.RestErr) {
-		return nil, rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+	useCodeFunc = func(phone string, code, reason, maxAttempts int) (*domains.Code, bool, rest_errors.RestErr) {
+		return nil, false, errors.NewInternalServerError(nil)
 	}
 	repositories.CodeRepository = &CodeRepoMock{}
 
@@ -197,8 +226,8 @@ func TestVerifyCodeFailToGetDataFromRepo(t *testing.T) {
 }
 
 func TestVerifyCodeNotFound(t *testing.T) {
-	findCodeFunc = func(phone string, code, reason int) (*domains.Code, rest_errors.RestErr) {
-		return nil, nil
+	useCodeFunc = func(phone string, code, reason, maxAttempts int) (*domains.Code, bool, rest_errors.RestErr) {
+		return nil, false, nil
 	}
 	repositories.CodeRepository = &CodeRepoMock{}
 
@@ -210,13 +239,13 @@ func TestVerifyCodeNotFound(t *testing.T) {
 }
 
 func TestVerifyCodeSuccessfully(t *testing.T) {
-	findCodeFunc = func(phone string, code, reason int) (*domains.Code, rest_errors.RestErr) {
+	useCodeFunc = func(phone string, code, reason, maxAttempts int) (*domains.Code, bool, rest_errors.RestErr) {
 		return &domains.Code{
 			Code:           2313123,
 			Phone:          "09231212",
 			CodeExpiration: time.Unix(0, time.Now().UnixNano()+10000),
 			CodePurpose:    VERIFICATION,
-		}, nil
+		}, true, nil
 	}
 	repositories.CodeRepository = &CodeRepoMock{}
 
@@ -238,13 +267,13 @@ func TestIsNotExpired(t *testing.T) {
 }
 
 func TestVerificationCodeIsExpired(t *testing.T) {
-	findCodeFunc = func(phone string, code, reason int) (*domains.Code, rest_errors.RestErr) {
+	useCodeFunc = func(phone string, code, reason, maxAttempts int) (*domains.Code, bool, rest_errors.RestErr) {
 		return &domains.Code{
 			Code:           2313123,
 			Phone:          "09231212",
 			CodeExpiration: time.Unix(0, time.Now().UnixNano()-10000),
 			CodePurpose:    VERIFICATION,
-		}, nil
+		}, false, nil
 	}
 	repositories.CodeRepository = &CodeRepoMock{}
 
@@ -255,3 +284,84 @@ func TestVerificationCodeIsExpired(t *testing.T) {
 	assert.Equal(t, errors.CodeIsExpiredErrorMessage, err.Message())
 	assert.Equal(t, http.StatusBadRequest, err.Status())
 }
+
+func TestSendThenVerifyCode(t *testing.T) {
+	getUserByPhoneFunc = func(phone string) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{ID: 1, Phone: phone}, nil
+	}
+	defer func() { getUserByPhoneFunc = nil }()
+	useCodeFunc = nil
+	repositories.UserRepository = &UserRespositoryMock{}
+	repo := &CodeRepoMock{}
+	repositories.CodeRepository = repo
+	sender := sms.NewLocal()
+	SMSSender = sender
+
+	err := CodeService.Send(domains.SendCodeRequest{Phone: "09122334344", Reason: VERIFICATION})
+	assert.Nil(t, err)
+	assert.Len(t, repo.codes, 1)
+	code := repo.codes[0]
+	assert.Equal(t, "+989122334344", code.Phone)
+	assert.Equal(t, VERIFICATION, code.CodePurpose)
+	assert.True(t, code.Code >= 10000 && code.Code <= 99999)
+	assert.WithinDuration(t, time.Now().Add(CodeTTL), code.CodeExpiration, time.Minute)
+	messages := sender.Messages()
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "+989122334344", messages[0].Receptor)
+	assert.Contains(t, messages[0].Text, fmt.Sprint(code.Code))
+
+	ok, err := CodeService.Verify("09122334344", code.Code, VERIFICATION)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// a used code does not work again
+	ok, err = CodeService.Verify("09122334344", code.Code, VERIFICATION)
+	assert.NotNil(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, errors.CodeOrPhoneDoesNotExistsErrorMessage, err.Message())
+
+}
+
+func TestVerifyCodeStopsAfterMaxAttempts(t *testing.T) {
+	useCodeFunc = nil
+	repo := &CodeRepoMock{}
+	repositories.CodeRepository = repo
+	repo.CreateCode(&domains.Code{Phone: "+989122334344", Code: 12345, CodePurpose: RESETPASSWORD, CodeExpiration: time.Now().Add(CodeTTL)})
+
+	// codes are of their reason only
+	ok, err := CodeService.Verify("09122334344", 12345, VERIFICATION)
+	assert.False(t, ok)
+	assert.Equal(t, errors.CodeOrPhoneDoesNotExistsErrorMessage, err.Message())
+
+	for i := 1; i < MaxCodeAttempts; i++ {
+		ok, err = CodeService.Verify("09122334344", 54321, RESETPASSWORD)
+		assert.False(t, ok)
+		assert.Equal(t, errors.CodeOrPhoneDoesNotExistsErrorMessage, err.Message())
+	}
+	ok, err = CodeService.Verify("09122334344", 54321, RESETPASSWORD)
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusTooManyRequests, err.Status())
+
+	// the right code does not work either once attempts are spent
+	ok, err = CodeService.Verify("09122334344", 12345, RESETPASSWORD)
+	assert.False(t, ok)
+	assert.Equal(t, errors.TooManyCodeAttemptsErrorMessage, err.Message())
+}
+
+func TestSendChangePhoneCodeToNewPhone(t *testing.T) {
+	getUserByPhoneFunc = nil
+	repositories.UserRepository = &UserRespositoryMock{}
+	repositories.CodeRepository = &CodeRepoMock{}
+	sender := sms.NewLocal()
+	SMSSender = sender
+
+	// phone changes go to phones no user has
+	assert.Nil(t, CodeService.Send(domains.SendCodeRequest{Phone: "09122334344", Reason: CHANGEPHONE}))
+	assert.Len(t, sender.Messages(), 1)
+
+	// other codes go to users only
+	err := CodeService.Send(domains.SendCodeRequest{Phone: "09122334344", Reason: VERIFICATION})
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusNotFound, err.Status())
+	assert.Len(t, sender.Messages(), 1)
+}
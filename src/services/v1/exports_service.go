@@ -0,0 +1,215 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/crypto"
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+)
+
+const (
+	DataExportInterval = 10 * time.Second
+	// DataExportTTL is how long a ready export may be downloaded, its archive is removed after that
+	DataExportTTL = 24 * time.Hour
+	// DataExportMaxAttempts is how many times an export is tried before it is failed
+	DataExportMaxAttempts = 3
+
+	dataExportBatchSize = 5
+	// dataExportLease is how long a worker has to assemble exports it took before another worker may take them
+	dataExportLease      = 5 * time.Minute
+	dataExportRetryDelay = time.Minute
+)
+
+var (
+	DataExportService dataExportServiceInterface = &dataExportService{}
+)
+
+type dataExportServiceInterface interface {
+	Request(userID uint, req domains.CreateDataExportRequest, actor domains.Actor) (*domains.CreateDataExportResponse, rest_errors.RestErr)
+	Get(id, userID uint) (*domains.DataExport, rest_errors.RestErr)
+	Download(id uint, token string) (*domains.DataExport, rest_errors.RestErr)
+	Export() (int, rest_errors.RestErr)
+}
+
+type dataExportService struct{}
+
+// RunDataExports assembles requested exports and removes expired ones every interval until ctx is done
+func RunDataExports(ctx context.Context, interval time.Duration, onError func(rest_errors.RestErr)) {
+	for {
+		n, err := DataExportService.Export()
+		if err != nil {
+			onError(err)
+		}
+		// a full batch means more exports are waiting
+		if err == nil && n == dataExportBatchSize && ctx.Err() == nil {
+			continue
+		}
+		if _, err := repositories.DataExportRepository.DeleteExpiredDataExports(time.Now()); err != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Request queues an export of personal data of user, the download link is returned once and works when
+// the export is ready until it expires
+func (*dataExportService) Request(userID uint, req domains.CreateDataExportRequest, actor domains.Actor) (*domains.CreateDataExportResponse, rest_errors.RestErr) {
+	user, err := repositories.UserRepository.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.NewNotFoundError(errors.UserNotFound)
+	}
+	if req.Format == "" {
+		req.Format = domains.DataExportJSON
+	}
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	export := &domains.DataExport{
+		UserID:        userID,
+		Format:        req.Format,
+		Status:        domains.DataExportPending,
+		RequestedBy:   actor.UserID,
+		TokenHash:     crypto.GenerateSha256(token),
+		NextAttemptAt: time.Now(),
+	}
+	audit := actor.Audit(AuditExportRequested, userID, domains.AuditChanges{"format": {After: export.Format}})
+	if err := repositories.DataExportRepository.CreateDataExport(export, audit); err != nil {
+		return nil, err
+	}
+	return &domains.CreateDataExportResponse{
+		Export:      *export,
+		DownloadURL: fmt.Sprintf("%s/v1/exports/%d/download?token=%s", Issuer(), export.ID, token),
+	}, nil
+}
+
+// Get returns export by id, exports of other users than userID are not found. Zero userID gets any export
+func (*dataExportService) Get(id, userID uint) (*domains.DataExport, rest_errors.RestErr) {
+	export, err := repositories.DataExportRepository.GetDataExport(id)
+	if err != nil {
+		return nil, err
+	}
+	if export == nil || (userID != 0 && export.UserID != userID) {
+		return nil, errors.NewNotFoundError(errors.DataExportNotFound)
+	}
+	return export, nil
+}
+
+// Download returns export with its archive if token is of its link and the link has not expired
+func (*dataExportService) Download(id uint, token string) (*domains.DataExport, rest_errors.RestErr) {
+	export, err := repositories.DataExportRepository.GetDataExportArchive(id)
+	if err != nil {
+		return nil, err
+	}
+	if export == nil || subtle.ConstantTimeCompare([]byte(export.TokenHash), []byte(crypto.GenerateSha256(token))) != 1 {
+		return nil, errors.NewNotFoundError(errors.DataExportNotFound)
+	}
+	if export.Status != domains.DataExportReady {
+		return nil, errors.NewError(errors.DataExportNotReady, http.StatusConflict)
+	}
+	if export.ExpiresAt == nil || !export.ExpiresAt.After(time.Now()) {
+		return nil, errors.NewNotFoundError(errors.DataExportNotFound)
+	}
+	return export, nil
+}
+
+// Export assembles a batch of due exports and returns how many were taken. A failed export is retried
+// later until DataExportMaxAttempts, then it is failed
+func (*dataExportService) Export() (int, rest_errors.RestErr) {
+	exports, err := repositories.DataExportRepository.ClaimDataExports(dataExportBatchSize, dataExportLease)
+	if err != nil {
+		return 0, err
+	}
+	for i := range exports {
+		export := &exports[i]
+		export.Attempts++
+		export.LastError = ""
+		if err := assembleDataExport(export); err != nil {
+			export.LastError = err.Error()
+			if export.Attempts >= DataExportMaxAttempts {
+				export.Status = domains.DataExportFailed
+			} else {
+				export.NextAttemptAt = time.Now().Add(dataExportRetryDelay)
+			}
+		}
+		if err := repositories.DataExportRepository.UpdateDataExport(export); err != nil {
+			return i, err
+		}
+	}
+	return len(exports), nil
+}
+
+// assembleDataExport collects data of user of export into its archive and makes it ready
+func assembleDataExport(export *domains.DataExport) error {
+	data, err := repositories.DataExportRepository.CollectUserData(export.UserID)
+	if err != nil {
+		return fmt.Errorf("collecting data: %s", err.Message())
+	}
+	if data == nil {
+		return fmt.Errorf("user %d does not exist", export.UserID)
+	}
+	var archive []byte
+	var archiveErr error
+	if export.Format == domains.DataExportZIP {
+		archive, archiveErr = zipDataExport(data)
+	} else {
+		archive, archiveErr = json.MarshalIndent(data, "", "  ")
+	}
+	if archiveErr != nil {
+		return archiveErr
+	}
+	now := time.Now()
+	expiresAt := now.Add(DataExportTTL)
+	export.Archive = archive
+	export.Status = domains.DataExportReady
+	export.CompletedAt = &now
+	export.ExpiresAt = &expiresAt
+	return nil
+}
+
+// zipDataExport writes each part of data to a json file of its own
+func zipDataExport(data *domains.DataExportArchive) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	files := []struct {
+		name string
+		part interface{}
+	}{
+		{"profile.json", data.Profile},
+		{"sessions.json", data.Sessions},
+		{"audit_entries.json", data.AuditEntries},
+		{"codes.json", data.Codes},
+	}
+	for _, file := range files {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: data.ExportedAt})
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.part); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// DataExportRepositoryMock keeps exports in memory, ids start from 1. Data of users is data, nil for unknown users
+type DataExportRepositoryMock struct {
+	exports []*domains.DataExport
+	audits  []*domains.AuditEntry
+	data    map[uint]*domains.DataExportArchive
+}
+
+func (m *DataExportRepositoryMock) CreateDataExport(export *domains.DataExport, audit *domains.AuditEntry) rest_errors.RestErr {
+	export.ID = uint(len(m.exports) + 1)
+	e := *export
+	m.exports = append(m.exports, &e)
+	m.audits = append(m.audits, audit)
+	return nil
+}
+
+func (m *DataExportRepositoryMock) GetDataExport(id uint) (*domains.DataExport, rest_errors.RestErr) {
+	export, err := m.GetDataExportArchive(id)
+	if export != nil {
+		export.Archive = nil
+	}
+	return export, err
+}
+
+func (m *DataExportRepositoryMock) GetDataExportArchive(id uint) (*domains.DataExport, rest_errors.RestErr) {
+	for _, export := range m.exports {
+		if export.ID == id {
+			e := *export
+			return &e, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *DataExportRepositoryMock) ClaimDataExports(limit int, lease time.Duration) ([]domains.DataExport, rest_errors.RestErr) {
+	exports := []domains.DataExport{}
+	now := time.Now()
+	for _, e := range m.exports {
+		if e.Status == domains.DataExportPending && !e.NextAttemptAt.After(now) && len(exports) < limit {
+			e.NextAttemptAt = now.Add(lease)
+			exports = append(exports, *e)
+		}
+	}
+	return exports, nil
+}
+
+func (m *DataExportRepositoryMock) UpdateDataExport(export *domains.DataExport) rest_errors.RestErr {
+	for i, e := range m.exports {
+		if e.ID == export.ID {
+			updated := *export
+			m.exports[i] = &updated
+		}
+	}
+	return nil
+}
+
+func (m *DataExportRepositoryMock) DeleteExpiredDataExports(at time.Time) (int64, rest_errors.RestErr) {
+	return 0, nil
+}
+
+func (m *DataExportRepositoryMock) CollectUserData(userID uint) (*domains.DataExportArchive, rest_errors.RestErr) {
+	return m.data[userID], nil
+}
+
+// newDataExportTest makes user 3 known, it has a session and a code
+func newDataExportTest() *DataExportRepositoryMock {
+	getUserFunc = func(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+		if id != 3 {
+			return nil, nil
+		}
+		return &domains.PublicUser{ID: 3, Phone: "+989122334344", Active: true}, nil
+	}
+	repositories.UserRepository = &UserRespositoryMock{}
+	repo := &DataExportRepositoryMock{data: map[uint]*domains.DataExportArchive{
+		3: {
+			ExportedAt: time.Now(),
+			Profile:    domains.PublicUser{ID: 3, Phone: "+989122334344"},
+			Sessions:   []domains.ExportedSession{{Session: domains.Session{Device: "Chrome on Android"}}},
+			Codes:      []domains.ExportedCode{{Purpose: VERIFICATION}},
+		},
+	}}
+	repositories.DataExportRepository = repo
+	return repo
+}
+
+// tokenOf returns token of download link
+func tokenOf(t *testing.T, link string) string {
+	u, err := url.Parse(link)
+	assert.Nil(t, err)
+	return u.Query().Get("token")
+}
+
+func TestRequestDataExport(t *testing.T) {
+	repo := newDataExportTest()
+
+	res, err := DataExportService.Request(3, domains.CreateDataExportRequest{}, domains.Actor{UserID: 3})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, res.Export.ID)
+	assert.Equal(t, domains.DataExportJSON, res.Export.Format)
+	assert.Equal(t, domains.DataExportPending, res.Export.Status)
+	assert.True(t, strings.Contains(res.DownloadURL, "/v1/exports/1/download?token="))
+	assert.NotEqual(t, tokenOf(t, res.DownloadURL), repo.exports[0].TokenHash)
+	assert.Equal(t, AuditExportRequested, repo.audits[0].Action)
+	assert.EqualValues(t, 3, *repo.audits[0].TargetID)
+}
+
+func TestRequestDataExportOfUnknownUser(t *testing.T) {
+	repo := newDataExportTest()
+
+	res, err := DataExportService.Request(7, domains.CreateDataExportRequest{}, domains.Actor{UserID: 1})
+	assert.Nil(t, res)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusNotFound, err.Status())
+	assert.Empty(t, repo.exports)
+}
+
+func TestGetDataExportOfOtherUser(t *testing.T) {
+	newDataExportTest()
+	res, _ := DataExportService.Request(3, domains.CreateDataExportRequest{}, domains.Actor{UserID: 3})
+
+	export, err := DataExportService.Get(res.Export.ID, 4)
+	assert.Nil(t, export)
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.DataExportNotFoundErrorMessage, err.Message())
+
+	// admins get exports of any user
+	export, err = DataExportService.Get(res.Export.ID, 0)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, export.UserID)
+}
+
+func TestExportAndDownloadJSON(t *testing.T) {
+	newDataExportTest()
+	res, _ := DataExportService.Request(3, domains.CreateDataExportRequest{}, domains.Actor{UserID: 3})
+	token := tokenOf(t, res.DownloadURL)
+
+	_, err := DataExportService.Download(res.Export.ID, token)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusConflict, err.Status())
+
+	n, err := DataExportService.Export()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = DataExportService.Download(res.Export.ID, "wrong")
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusNotFound, err.Status())
+
+	export, err := DataExportService.Download(res.Export.ID, token)
+	assert.Nil(t, err)
+	assert.Equal(t, domains.DataExportReady, export.Status)
+	assert.WithinDuration(t, time.Now().Add(DataExportTTL), *export.ExpiresAt, time.Minute)
+	archive := domains.DataExportArchive{}
+	assert.Nil(t, json.Unmarshal(export.Archive, &archive))
+	assert.EqualValues(t, 3, archive.Profile.ID)
+	assert.Len(t, archive.Sessions, 1)
+	assert.Len(t, archive.Codes, 1)
+}
+
+func TestExportZIP(t *testing.T) {
+	newDataExportTest()
+	res, _ := DataExportService.Request(3, domains.CreateDataExportRequest{Format: domains.DataExportZIP}, domains.Actor{UserID: 1})
+
+	_, err := DataExportService.Export()
+	assert.Nil(t, err)
+
+	export, err := DataExportService.Download(res.Export.ID, tokenOf(t, res.DownloadURL))
+	assert.Nil(t, err)
+	r, zipErr := zip.NewReader(bytes.NewReader(export.Archive), int64(len(export.Archive)))
+	assert.Nil(t, zipErr)
+	names := []string{}
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"profile.json", "sessions.json", "audit_entries.json", "codes.json"}, names)
+}
+
+func TestExportFailsAfterMaxAttempts(t *testing.T) {
+	repo := newDataExportTest()
+	DataExportService.Request(3, domains.CreateDataExportRequest{}, domains.Actor{UserID: 3})
+	// user is purged before its export is assembled
+	delete(repo.data, 3)
+
+	for i := 1; i <= DataExportMaxAttempts; i++ {
+		n, err := DataExportService.Export()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, i, repo.exports[0].Attempts)
+		assert.NotEmpty(t, repo.exports[0].LastError)
+		repo.exports[0].NextAttemptAt = time.Now()
+	}
+	assert.Equal(t, domains.DataExportFailed, repo.exports[0].Status)
+	assert.Nil(t, repo.exports[0].Archive)
+}
+
+func TestDownloadExpiredDataExport(t *testing.T) {
+	repo := newDataExportTest()
+	res, _ := DataExportService.Request(3, domains.CreateDataExportRequest{}, domains.Actor{UserID: 3})
+	DataExportService.Export()
+	expired := time.Now().Add(-time.Second)
+	repo.exports[0].ExpiresAt = &expired
+
+	export, err := DataExportService.Download(res.Export.ID, tokenOf(t, res.DownloadURL))
+	assert.Nil(t, export)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusNotFound, err.Status())
+}
@@ -1,11 +1,23 @@
 package services
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
 	"github.com/alidevjimmy/go-rest-utils/rest_errors"
 	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
 	"github.com/golang-jwt/jwt"
 )
 
+const (
+	// envJwtSecret is the HMAC key tokens are signed with
+	envJwtSecret = "JWT_SECRET"
+)
+
 type jwtService struct{}
 
 type jwtInterface interface {
@@ -17,11 +29,76 @@ var (
 	JwtService jwtInterface = &jwtService{}
 )
 
+// GenerateJwtToken signs data by HS256, exp may be time.Time or unix seconds
 func (*jwtService) GenerateJwtToken(data jwt.MapClaims) (string, rest_errors.RestErr) {
-
-	return "", nil
+	claims := jwt.MapClaims{}
+	for k, v := range data {
+		claims[k] = v
+	}
+	switch exp := claims["exp"].(type) {
+	case time.Time:
+		claims["exp"] = exp.Unix()
+	case int64, int, float64, nil:
+	default:
+		return "", errors.NewInternalServerError(fmt.Errorf("jwt: invalid exp %v", exp))
+	}
+	secret, err := jwtSecret()
+	if err != nil {
+		return "", err
+	}
+	token, signErr := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	if signErr != nil {
+		return "", errors.NewInternalServerError(signErr)
+	}
+	return token, nil
 }
 
+// VerifyJwtToken checks signature and expiry of token and returns its claims, exp is required
 func (*jwtService) VerifyJwtToken(token string) (*domains.Jwt, rest_errors.RestErr) {
-	return nil, nil
+	secret, err := jwtSecret()
+	if err != nil {
+		return nil, err
+	}
+	claims := jwt.MapClaims{}
+	_, parseErr := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("jwt: unexpected signing method %v", t.Header["alg"])
+		}
+		return secret, nil
+	})
+	if parseErr != nil {
+		return nil, errors.NewInternalServerError(parseErr)
+	}
+	// tokens without exp never expire, none are issued so none are accepted
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, errors.NewInternalServerError(fmt.Errorf("jwt: missing or past exp"))
+	}
+	sub, ok := claims["sub"].(string)
+	if !ok || sub == "" {
+		return nil, errors.NewInternalServerError(fmt.Errorf("jwt: missing sub"))
+	}
+	j := &domains.Jwt{Sub: sub}
+	j.Scope, _ = claims["scope"].(string)
+	j.ClientID, _ = claims["client_id"].(string)
+	if sid, ok := claims["sid"].(string); ok {
+		if id, err := strconv.ParseUint(sid, 10, 64); err == nil {
+			j.SessionID = uint(id)
+		}
+	}
+	switch exp := claims["exp"].(type) {
+	case float64:
+		j.Exp = time.Unix(int64(exp), 0)
+	case json.Number:
+		v, _ := exp.Int64()
+		j.Exp = time.Unix(v, 0)
+	}
+	return j, nil
+}
+
+func jwtSecret() ([]byte, rest_errors.RestErr) {
+	secret := os.Getenv(envJwtSecret)
+	if secret == "" {
+		return nil, errors.NewInternalServerError(fmt.Errorf("jwt: %s is not set", envJwtSecret))
+	}
+	return []byte(secret), nil
 }
@@ -5,6 +5,7 @@ import (
 	"github.com/golang-jwt/jwt"
 	"github.com/stretchr/testify/assert"
 	"net/http"
+	"os"
 	"testing"
 	"time"
 )
@@ -91,3 +92,26 @@ func TestVerifyJwtTokenUnableToUnMarshal(t *testing.T) {
 	assert.Equal(t, errors.InternalServerErrorMessage, err1.Message())
 	assert.Equal(t, http.StatusInternalServerError, err1.Status())
 }
+
+func TestVerifyJwtTokenRequiresExp(t *testing.T) {
+	os.Setenv(envJwtSecret, Secret)
+	defer os.Unsetenv(envJwtSecret)
+	for _, claims := range []jwt.MapClaims{
+		{"sub": "1"},
+		{"sub": "1", "exp": time.Now().Add(-time.Minute).Unix()},
+	} {
+		tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(Secret))
+		assert.Nil(t, err)
+
+		j, err1 := JwtService.VerifyJwtToken(tokenString)
+		assert.Nil(t, j)
+		assert.NotNil(t, err1)
+	}
+
+	token, err := JwtService.GenerateJwtToken(jwt.MapClaims{"sub": "1", "exp": time.Now().Add(time.Minute)})
+	assert.Nil(t, err)
+	j, err1 := JwtService.VerifyJwtToken(token)
+	assert.Nil(t, err1)
+	assert.Equal(t, "1", j.Sub)
+	assert.False(t, j.Exp.IsZero())
+}
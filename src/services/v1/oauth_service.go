@@ -0,0 +1,584 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/crypto"
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	TokenTypeBearer = "Bearer"
+
+	ResponseTypeCode = "code"
+
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeRefreshToken      = "refresh_token"
+
+	CodeChallengeMethodS256 = "S256"
+
+	ScopeOpenID        = "openid"
+	ScopeProfile       = "profile"
+	ScopePhone         = "phone"
+	ScopeOfflineAccess = "offline_access"
+	ScopeIntrospect    = "introspect"
+
+	AccessTokenTTL       = time.Hour
+	IDTokenTTL           = time.Hour
+	AuthorizationCodeTTL = 5 * time.Minute
+	RefreshTokenTTL      = 30 * 24 * time.Hour
+)
+
+var (
+	OAuthService oauthServiceInterface = &oauthService{}
+)
+
+type oauthServiceInterface interface {
+	Introspect(token string) (*domains.IntrospectionResponse, rest_errors.RestErr)
+	Authorize(userID uint, req domains.AuthorizeRequest) (*domains.AuthorizeResponse, rest_errors.RestErr)
+	Consent(userID uint, req domains.ConsentRequest) (*domains.AuthorizeResponse, rest_errors.RestErr)
+	Token(req domains.TokenRequest) (*domains.TokenResponse, rest_errors.RestErr)
+	UserInfo(token string) (*domains.UserInfo, rest_errors.RestErr)
+	Discovery() *domains.DiscoveryDocument
+	JWKS() (*domains.JWKS, rest_errors.RestErr)
+}
+
+type oauthService struct{}
+
+// AccessToken signs a token of sub, clientID and scope are empty for first party login.
+// Tokens of users signing in are made by SessionService.Start instead, so they can be revoked
+func AccessToken(sub, clientID, scope string, now time.Time) (string, rest_errors.RestErr) {
+	return JwtService.GenerateJwtToken(accessTokenClaims(sub, clientID, scope, now))
+}
+
+func accessTokenClaims(sub, clientID, scope string, now time.Time) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"sub": sub,
+		"iss": Issuer(),
+		"iat": now.Unix(),
+		"exp": now.Add(AccessTokenTTL),
+	}
+	if clientID != "" {
+		claims["client_id"] = clientID
+	}
+	if scope != "" {
+		claims["scope"] = scope
+	}
+	return claims
+}
+
+// Introspect tells resource servers whether token is active and who it belongs to.
+// Tokens which fail verification, whose session is revoked or whose user is gone are inactive, not errors
+func (*oauthService) Introspect(token string) (*domains.IntrospectionResponse, rest_errors.RestErr) {
+	inactive := &domains.IntrospectionResponse{Active: false}
+	j, err := JwtService.VerifyJwtToken(token)
+	if err != nil || j == nil {
+		return inactive, nil
+	}
+	res := &domains.IntrospectionResponse{
+		Active:    true,
+		Sub:       j.Sub,
+		Scope:     j.Scope,
+		TokenType: TokenTypeBearer,
+	}
+	if !j.Exp.IsZero() {
+		res.Exp = j.Exp.Unix()
+	}
+	// client credentials tokens belong to the client itself
+	if j.ClientID != "" && j.Sub == j.ClientID {
+		return res, nil
+	}
+	id, convErr := strconv.ParseUint(j.Sub, 10, 64)
+	if convErr != nil {
+		return inactive, nil
+	}
+	if j.SessionID != 0 {
+		if err := SessionService.Check(uint(id), j.SessionID); err != nil {
+			if err.Status() == http.StatusUnauthorized {
+				return inactive, nil
+			}
+			return nil, err
+		}
+	}
+	user, err := repositories.UserRepository.GetUserByID(uint(id))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return inactive, nil
+	}
+	res.Username = user.Username
+	res.UserActive = &user.Active
+	res.UserBlocked = &user.Blocked
+	return res, nil
+}
+
+// Authorize starts authorization code flow for signed in user, a code is issued right away
+// when user already granted requested scopes to client, otherwise consent is asked
+func (*oauthService) Authorize(userID uint, req domains.AuthorizeRequest) (*domains.AuthorizeResponse, rest_errors.RestErr) {
+	client, redirect, err := checkAuthorize(req)
+	if err != nil || redirect != nil {
+		return redirect, err
+	}
+	scopes := strings.Fields(req.Scope)
+	consent, err := repositories.OAuthRepository.GetConsent(userID, client.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	if consent == nil || !containsAll(strings.Fields(consent.Scope), scopes) {
+		return &domains.AuthorizeResponse{ConsentRequired: true, ClientName: client.Name, Scopes: scopes}, nil
+	}
+	return issueCode(userID, req)
+}
+
+// Consent records answer of user to consent screen and finishes authorization
+func (*oauthService) Consent(userID uint, req domains.ConsentRequest) (*domains.AuthorizeResponse, rest_errors.RestErr) {
+	client, redirect, err := checkAuthorize(req.AuthorizeRequest)
+	if err != nil || redirect != nil {
+		return redirect, err
+	}
+	if !req.Approve {
+		return redirectError(req.AuthorizeRequest, errors.AccessDenied), nil
+	}
+	consent, err := repositories.OAuthRepository.GetConsent(userID, client.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	if consent == nil {
+		consent = &domains.Consent{UserID: userID, ClientID: client.ClientID}
+	}
+	consent.Scope = strings.Join(union(strings.Fields(consent.Scope), strings.Fields(req.Scope)), " ")
+	if err := repositories.OAuthRepository.SaveConsent(consent); err != nil {
+		return nil, err
+	}
+	return issueCode(userID, req.AuthorizeRequest)
+}
+
+// Token exchanges a grant for tokens, see RFC 6749 section 4
+func (*oauthService) Token(req domains.TokenRequest) (*domains.TokenResponse, rest_errors.RestErr) {
+	client, err := authenticateClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	switch req.GrantType {
+	case GrantTypeAuthorizationCode, GrantTypeRefreshToken, GrantTypeClientCredentials:
+	default:
+		return nil, errors.NewBadRequestError(errors.UnsupportedGrantType)
+	}
+	if !client.HasGrantType(req.GrantType) {
+		return nil, errors.NewBadRequestError(errors.UnauthorizedClient)
+	}
+	switch req.GrantType {
+	case GrantTypeAuthorizationCode:
+		return exchangeCode(client, req)
+	case GrantTypeRefreshToken:
+		return refresh(client, req)
+	default:
+		return clientCredentials(client, req)
+	}
+}
+
+// UserInfo returns claims of owner of token released by its scopes
+func (*oauthService) UserInfo(token string) (*domains.UserInfo, rest_errors.RestErr) {
+	j, err := JwtService.VerifyJwtToken(token)
+	if err != nil || j == nil {
+		return nil, errors.NewUnauthorizedError(errors.InvalidToken)
+	}
+	scopes := strings.Fields(j.Scope)
+	if !containsAll(scopes, []string{ScopeOpenID}) {
+		return nil, errors.NewUnauthorizedError(errors.InvalidToken)
+	}
+	user, err := userOf(j.Sub)
+	if err != nil {
+		return nil, err
+	}
+	info := userInfo(user, scopes)
+	return &info, nil
+}
+
+// Discovery is OpenID Connect discovery document of this provider
+func (*oauthService) Discovery() *domains.DiscoveryDocument {
+	iss := Issuer()
+	return &domains.DiscoveryDocument{
+		Issuer:                            iss,
+		AuthorizationEndpoint:             iss + "/v1/oauth/authorize",
+		TokenEndpoint:                     iss + "/v1/oauth/token",
+		UserinfoEndpoint:                  iss + "/v1/oauth/userinfo",
+		JwksURI:                           iss + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             iss + "/v1/introspect",
+		ScopesSupported:                   []string{ScopeOpenID, ScopeProfile, ScopePhone, ScopeOfflineAccess, ScopeIntrospect},
+		ResponseTypesSupported:            []string{ResponseTypeCode},
+		GrantTypesSupported:               []string{GrantTypeAuthorizationCode, GrantTypeClientCredentials, GrantTypeRefreshToken},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{CodeChallengeMethodS256},
+		ClaimsSupported: []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce",
+			"name", "given_name", "family_name", "preferred_username", "phone_number", "phone_number_verified"},
+	}
+}
+
+// JWKS publishes keys id tokens can be verified with
+func (*oauthService) JWKS() (*domains.JWKS, rest_errors.RestErr) {
+	key, err := oidcSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	return &domains.JWKS{Keys: []domains.JWK{publicJWK(&key.PublicKey)}}, nil
+}
+
+// checkAuthorize validates req, errors which must not be sent to redirect_uri are returned as err,
+// the rest are returned as a redirect carrying error
+func checkAuthorize(req domains.AuthorizeRequest) (*domains.Client, *domains.AuthorizeResponse, rest_errors.RestErr) {
+	client, err := repositories.ClientRepository.GetClientByClientID(req.ClientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if client == nil {
+		return nil, nil, errors.NewBadRequestError(errors.InvalidClient)
+	}
+	if !client.HasRedirectURI(req.RedirectURI) {
+		return nil, nil, errors.NewBadRequestError(errors.InvalidRedirectURI)
+	}
+	switch {
+	case req.ResponseType != ResponseTypeCode:
+		return nil, redirectError(req, errors.UnsupportedResponseType), nil
+	case !client.HasGrantType(GrantTypeAuthorizationCode):
+		return nil, redirectError(req, errors.UnauthorizedClient), nil
+	case !client.HasScopes(strings.Fields(req.Scope)):
+		return nil, redirectError(req, errors.InvalidScope), nil
+	case req.CodeChallenge != "" && req.CodeChallengeMethod != CodeChallengeMethodS256:
+		return nil, redirectError(req, errors.InvalidRequest), nil
+	case client.Public && req.CodeChallenge == "":
+		return nil, redirectError(req, errors.InvalidRequest), nil
+	}
+	return client, nil, nil
+}
+
+func issueCode(userID uint, req domains.AuthorizeRequest) (*domains.AuthorizeResponse, rest_errors.RestErr) {
+	code, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	err = repositories.OAuthRepository.CreateAuthorizationCode(&domains.AuthorizationCode{
+		CodeHash:            crypto.GenerateSha256(code),
+		ClientID:            req.ClientID,
+		UserID:              userID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		AuthTime:            now,
+		ExpiresAt:           now.Add(AuthorizationCodeTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &domains.AuthorizeResponse{RedirectTo: redirectURI(req.RedirectURI, url.Values{"code": {code}}, req.State)}, nil
+}
+
+func redirectError(req domains.AuthorizeRequest, code errors.Code) *domains.AuthorizeResponse {
+	return &domains.AuthorizeResponse{RedirectTo: redirectURI(req.RedirectURI, url.Values{"error": {string(code)}}, req.State)}
+}
+
+func redirectURI(base string, params url.Values, state string) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return base
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	if state != "" {
+		q.Set("state", state)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// authenticateClient checks secret of confidential clients, public clients only name themselves
+func authenticateClient(clientID, secret string) (*domains.Client, rest_errors.RestErr) {
+	if secret != "" {
+		return ClientService.Authenticate(clientID, secret)
+	}
+	if clientID == "" {
+		return nil, errors.NewUnauthorizedError(errors.InvalidClient)
+	}
+	client, err := repositories.ClientRepository.GetClientByClientID(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil || !client.Public {
+		return nil, errors.NewUnauthorizedError(errors.InvalidClient)
+	}
+	return client, nil
+}
+
+func exchangeCode(client *domains.Client, req domains.TokenRequest) (*domains.TokenResponse, rest_errors.RestErr) {
+	if req.Code == "" || req.RedirectURI == "" {
+		return nil, errors.NewBadRequestError(errors.InvalidRequest)
+	}
+	code, err := repositories.OAuthRepository.ConsumeAuthorizationCode(crypto.GenerateSha256(req.Code))
+	if err != nil {
+		return nil, err
+	}
+	invalid := errors.NewBadRequestError(errors.InvalidGrant)
+	if code == nil || code.ClientID != client.ClientID || code.RedirectURI != req.RedirectURI || time.Now().After(code.ExpiresAt) {
+		return nil, invalid
+	}
+	if code.CodeChallenge != "" && !verifyPKCE(code.CodeChallenge, req.CodeVerifier) {
+		return nil, invalid
+	}
+	return issueTokens(client, code.UserID, code.Scope, code.Nonce, code.AuthTime)
+}
+
+func refresh(client *domains.Client, req domains.TokenRequest) (*domains.TokenResponse, rest_errors.RestErr) {
+	if req.RefreshToken == "" {
+		return nil, errors.NewBadRequestError(errors.InvalidRequest)
+	}
+	next, token, err := newRefreshToken(client.ClientID, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	current, err := repositories.OAuthRepository.RotateRefreshToken(crypto.GenerateSha256(req.RefreshToken), client.ClientID, next)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return nil, errors.NewBadRequestError(errors.InvalidGrant)
+	}
+	scope := current.Scope
+	if req.Scope != "" {
+		if !containsAll(strings.Fields(current.Scope), strings.Fields(req.Scope)) {
+			return nil, errors.NewBadRequestError(errors.InvalidScope)
+		}
+		scope = req.Scope
+	}
+	sub := strconv.FormatUint(uint64(current.UserID), 10)
+	res, err := accessTokenResponse(sub, client.ClientID, scope)
+	if err != nil {
+		return nil, err
+	}
+	res.RefreshToken = token
+	if containsAll(strings.Fields(scope), []string{ScopeOpenID}) {
+		user, err := userOf(sub)
+		if err != nil {
+			return nil, err
+		}
+		if res.IDToken, err = idToken(client.ClientID, user, strings.Fields(scope), "", time.Time{}); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func clientCredentials(client *domains.Client, req domains.TokenRequest) (*domains.TokenResponse, rest_errors.RestErr) {
+	if client.Public {
+		return nil, errors.NewBadRequestError(errors.UnauthorizedClient)
+	}
+	scope := req.Scope
+	if scope == "" {
+		scope = client.Scopes
+	}
+	if !client.HasScopes(strings.Fields(scope)) {
+		return nil, errors.NewBadRequestError(errors.InvalidScope)
+	}
+	res, err := accessTokenResponse(client.ClientID, client.ClientID, scope)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// issueTokens answers a code exchange, refresh token is issued only to clients allowed to refresh
+func issueTokens(client *domains.Client, userID uint, scope, nonce string, authTime time.Time) (*domains.TokenResponse, rest_errors.RestErr) {
+	sub := strconv.FormatUint(uint64(userID), 10)
+	res, err := accessTokenResponse(sub, client.ClientID, scope)
+	if err != nil {
+		return nil, err
+	}
+	scopes := strings.Fields(scope)
+	if containsAll(scopes, []string{ScopeOpenID}) {
+		user, err := userOf(sub)
+		if err != nil {
+			return nil, err
+		}
+		if res.IDToken, err = idToken(client.ClientID, user, scopes, nonce, authTime); err != nil {
+			return nil, err
+		}
+	}
+	if client.HasGrantType(GrantTypeRefreshToken) {
+		next, token, err := newRefreshToken(client.ClientID, userID, scope)
+		if err != nil {
+			return nil, err
+		}
+		if err := repositories.OAuthRepository.CreateRefreshToken(next); err != nil {
+			return nil, err
+		}
+		res.RefreshToken = token
+	}
+	return res, nil
+}
+
+func accessTokenResponse(sub, clientID, scope string) (*domains.TokenResponse, rest_errors.RestErr) {
+	token, err := AccessToken(sub, clientID, scope, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &domains.TokenResponse{
+		AccessToken: token,
+		TokenType:   TokenTypeBearer,
+		ExpiresIn:   int64(AccessTokenTTL / time.Second),
+		Scope:       scope,
+	}, nil
+}
+
+// newRefreshToken returns row to store and token to hand out, user and scope of a rotated token
+// are copied from the one it replaces
+func newRefreshToken(clientID string, userID uint, scope string) (*domains.RefreshToken, string, rest_errors.RestErr) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	return &domains.RefreshToken{
+		TokenHash: crypto.GenerateSha256(token),
+		ClientID:  clientID,
+		UserID:    userID,
+		Scope:     scope,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}, token, nil
+}
+
+// idToken signs an OpenID Connect id token by RS256, auth_time is left out when it is unknown
+func idToken(clientID string, user *domains.PublicUser, scopes []string, nonce string, authTime time.Time) (string, rest_errors.RestErr) {
+	key, err := oidcSigningKey()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": Issuer(),
+		"sub": strconv.FormatUint(uint64(user.ID), 10),
+		"aud": clientID,
+		"iat": now.Unix(),
+		"exp": now.Add(IDTokenTTL).Unix(),
+	}
+	if !authTime.IsZero() {
+		claims["auth_time"] = authTime.Unix()
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	info := userInfo(user, scopes)
+	for k, v := range map[string]interface{}{
+		"name":               info.Name,
+		"given_name":         info.GivenName,
+		"family_name":        info.FamilyName,
+		"preferred_username": info.PreferredUsername,
+		"phone_number":       info.PhoneNumber,
+	} {
+		if v != "" {
+			claims[k] = v
+		}
+	}
+	if info.PhoneNumberVerified != nil {
+		claims["phone_number_verified"] = *info.PhoneNumberVerified
+	}
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = keyID(&key.PublicKey)
+	signed, signErr := t.SignedString(key)
+	if signErr != nil {
+		return "", errors.NewInternalServerError(signErr)
+	}
+	return signed, nil
+}
+
+func userInfo(user *domains.PublicUser, scopes []string) domains.UserInfo {
+	info := domains.UserInfo{Sub: strconv.FormatUint(uint64(user.ID), 10)}
+	if containsAll(scopes, []string{ScopeProfile}) {
+		info.Name = strings.TrimSpace(user.Name + " " + user.Family)
+		info.GivenName = user.Name
+		info.FamilyName = user.Family
+		info.PreferredUsername = user.Username
+	}
+	if containsAll(scopes, []string{ScopePhone}) {
+		verified := user.Active
+		info.PhoneNumber = user.Phone
+		info.PhoneNumberVerified = &verified
+	}
+	return info
+}
+
+func userOf(sub string) (*domains.PublicUser, rest_errors.RestErr) {
+	id, convErr := strconv.ParseUint(sub, 10, 64)
+	if convErr != nil {
+		return nil, errors.NewUnauthorizedError(errors.InvalidToken)
+	}
+	user, err := repositories.UserRepository.GetUserByID(uint(id))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.NewNotFoundError(errors.UserNotFound)
+	}
+	return user, nil
+}
+
+// verifyPKCE checks verifier against an S256 challenge, see RFC 7636
+func verifyPKCE(challenge, verifier string) bool {
+	if verifier == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+func randomToken() (string, rest_errors.RestErr) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.NewInternalServerError(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func containsAll(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if h == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func union(a, b []string) []string {
+	out := append([]string{}, a...)
+	for _, s := range b {
+		if !containsAll(out, []string{s}) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
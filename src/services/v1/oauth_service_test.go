@@ -0,0 +1,454 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/crypto"
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	getClientByClientIDFunc      func(clientID string) (*domains.Client, rest_errors.RestErr)
+	createClientFunc             func(client *domains.Client) rest_errors.RestErr
+	createAuthorizationCodeFunc  func(code *domains.AuthorizationCode) rest_errors.RestErr
+	consumeAuthorizationCodeFunc func(codeHash string) (*domains.AuthorizationCode, rest_errors.RestErr)
+	createRefreshTokenFunc       func(token *domains.RefreshToken) rest_errors.RestErr
+	rotateRefreshTokenFunc       func(tokenHash, clientID string, next *domains.RefreshToken) (*domains.RefreshToken, rest_errors.RestErr)
+	getConsentFunc               func(userID uint, clientID string) (*domains.Consent, rest_errors.RestErr)
+	saveConsentFunc              func(consent *domains.Consent) rest_errors.RestErr
+)
+
+type ClientRepositoryMock struct{}
+
+func (*ClientRepositoryMock) GetClientByClientID(clientID string) (*domains.Client, rest_errors.RestErr) {
+	return getClientByClientIDFunc(clientID)
+}
+
+func (*ClientRepositoryMock) CreateClient(client *domains.Client, audit *domains.AuditEntry) rest_errors.RestErr {
+	return createClientFunc(client)
+}
+
+type OAuthRepositoryMock struct{}
+
+func (*OAuthRepositoryMock) CreateAuthorizationCode(code *domains.AuthorizationCode) rest_errors.RestErr {
+	return createAuthorizationCodeFunc(code)
+}
+
+func (*OAuthRepositoryMock) ConsumeAuthorizationCode(codeHash string) (*domains.AuthorizationCode, rest_errors.RestErr) {
+	return consumeAuthorizationCodeFunc(codeHash)
+}
+
+func (*OAuthRepositoryMock) CreateRefreshToken(token *domains.RefreshToken) rest_errors.RestErr {
+	return createRefreshTokenFunc(token)
+}
+
+func (*OAuthRepositoryMock) RotateRefreshToken(tokenHash, clientID string, next *domains.RefreshToken) (*domains.RefreshToken, rest_errors.RestErr) {
+	return rotateRefreshTokenFunc(tokenHash, clientID, next)
+}
+
+func (*OAuthRepositoryMock) GetConsent(userID uint, clientID string) (*domains.Consent, rest_errors.RestErr) {
+	return getConsentFunc(userID, clientID)
+}
+
+func (*OAuthRepositoryMock) SaveConsent(consent *domains.Consent) rest_errors.RestErr {
+	return saveConsentFunc(consent)
+}
+
+const (
+	testRedirectURI  = "https://app.example/callback"
+	testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+func publicClient() *domains.Client {
+	return &domains.Client{
+		ClientID:     "spa",
+		Name:         "Single page app",
+		Scopes:       "openid profile phone",
+		RedirectURIs: testRedirectURI,
+		GrantTypes:   "authorization_code refresh_token",
+		Public:       true,
+	}
+}
+
+func authorizeRequest() domains.AuthorizeRequest {
+	sum := sha256.Sum256([]byte(testCodeVerifier))
+	return domains.AuthorizeRequest{
+		ResponseType:        ResponseTypeCode,
+		ClientID:            "spa",
+		RedirectURI:         testRedirectURI,
+		Scope:               "openid profile",
+		State:               "xyz",
+		Nonce:               "n-0S6",
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(sum[:]),
+		CodeChallengeMethod: CodeChallengeMethodS256,
+	}
+}
+
+func mockOAuth(client *domains.Client, consent *domains.Consent) {
+	getClientByClientIDFunc = func(clientID string) (*domains.Client, rest_errors.RestErr) {
+		if clientID != client.ClientID {
+			return nil, nil
+		}
+		return client, nil
+	}
+	getConsentFunc = func(userID uint, clientID string) (*domains.Consent, rest_errors.RestErr) {
+		return consent, nil
+	}
+	repositories.ClientRepository = &ClientRepositoryMock{}
+	repositories.OAuthRepository = &OAuthRepositoryMock{}
+}
+
+func redirectQuery(t *testing.T, res *domains.AuthorizeResponse) url.Values {
+	u, err := url.Parse(res.RedirectTo)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(res.RedirectTo, testRedirectURI))
+	return u.Query()
+}
+
+func TestIntrospectInvalidToken(t *testing.T) {
+	verifyJwtFunc = func(token string) (*domains.Jwt, rest_errors.RestErr) {
+		return nil, errors.NewInternalServerError(nil)
+	}
+	JwtService = &JwtServiceMock{}
+
+	res, err := OAuthService.Introspect("token")
+	assert.Nil(t, err)
+	assert.Equal(t, &domains.IntrospectionResponse{Active: false}, res)
+}
+
+func TestIntrospectUserDoesNotExist(t *testing.T) {
+	verifyJwtFunc = func(token string) (*domains.Jwt, rest_errors.RestErr) {
+		return &domains.Jwt{Sub: "1", Exp: time.Now().Add(time.Hour)}, nil
+	}
+	getUserFunc = func(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+		return nil, nil
+	}
+	JwtService = &JwtServiceMock{}
+	repositories.UserRepository = &UserRespositoryMock{}
+
+	res, err := OAuthService.Introspect("token")
+	assert.Nil(t, err)
+	assert.False(t, res.Active)
+}
+
+func TestIntrospect(t *testing.T) {
+	exp := time.Now().Add(time.Hour)
+	verifyJwtFunc = func(token string) (*domains.Jwt, rest_errors.RestErr) {
+		return &domains.Jwt{Sub: "1", Exp: exp, Scope: "openid profile"}, nil
+	}
+	getUserFunc = func(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+		assert.EqualValues(t, 1, id)
+		return &domains.PublicUser{ID: id, Username: "ali", Active: true, Blocked: true}, nil
+	}
+	JwtService = &JwtServiceMock{}
+	repositories.UserRepository = &UserRespositoryMock{}
+
+	res, err := OAuthService.Introspect("token")
+	assert.Nil(t, err)
+	assert.True(t, res.Active)
+	assert.Equal(t, "1", res.Sub)
+	assert.Equal(t, exp.Unix(), res.Exp)
+	assert.Equal(t, "openid profile", res.Scope)
+	assert.Equal(t, "ali", res.Username)
+	assert.True(t, *res.UserActive)
+	assert.True(t, *res.UserBlocked)
+}
+
+func TestAuthenticateClientWrongSecret(t *testing.T) {
+	getClientByClientIDFunc = func(clientID string) (*domains.Client, rest_errors.RestErr) {
+		return &domains.Client{ClientID: clientID, SecretHash: crypto.GenerateSha256("secret")}, nil
+	}
+	repositories.ClientRepository = &ClientRepositoryMock{}
+
+	client, err := ClientService.Authenticate("gateway", "wrong")
+	assert.Nil(t, client)
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.InvalidClientErrorMessage, err.Message())
+
+	client, err = ClientService.Authenticate("gateway", "secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "gateway", client.ClientID)
+}
+
+func TestAuthorizeUnregisteredRedirectURI(t *testing.T) {
+	mockOAuth(publicClient(), nil)
+	req := authorizeRequest()
+	req.RedirectURI = "https://evil.example/callback"
+
+	res, err := OAuthService.Authorize(1, req)
+	assert.Nil(t, res)
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.InvalidRedirectURIErrorMessage, err.Message())
+}
+
+func TestAuthorizePublicClientRequiresPKCE(t *testing.T) {
+	mockOAuth(publicClient(), nil)
+	req := authorizeRequest()
+	req.CodeChallenge, req.CodeChallengeMethod = "", ""
+
+	res, err := OAuthService.Authorize(1, req)
+	assert.Nil(t, err)
+	q := redirectQuery(t, res)
+	assert.Equal(t, "invalid_request", q.Get("error"))
+	assert.Equal(t, "xyz", q.Get("state"))
+}
+
+func TestAuthorizeScopeNotAllowed(t *testing.T) {
+	mockOAuth(publicClient(), nil)
+	req := authorizeRequest()
+	req.Scope = "openid introspect"
+
+	res, err := OAuthService.Authorize(1, req)
+	assert.Nil(t, err)
+	assert.Equal(t, "invalid_scope", redirectQuery(t, res).Get("error"))
+}
+
+func TestAuthorizeAsksConsent(t *testing.T) {
+	mockOAuth(publicClient(), &domains.Consent{UserID: 1, ClientID: "spa", Scope: "openid"})
+
+	res, err := OAuthService.Authorize(1, authorizeRequest())
+	assert.Nil(t, err)
+	assert.True(t, res.ConsentRequired)
+	assert.Equal(t, "Single page app", res.ClientName)
+	assert.Equal(t, []string{"openid", "profile"}, res.Scopes)
+	assert.Empty(t, res.RedirectTo)
+}
+
+func TestConsentDenied(t *testing.T) {
+	mockOAuth(publicClient(), nil)
+
+	res, err := OAuthService.Consent(1, domains.ConsentRequest{AuthorizeRequest: authorizeRequest(), Approve: false})
+	assert.Nil(t, err)
+	assert.Equal(t, "access_denied", redirectQuery(t, res).Get("error"))
+}
+
+func TestConsentSavesScopesAndIssuesCode(t *testing.T) {
+	mockOAuth(publicClient(), &domains.Consent{UserID: 1, ClientID: "spa", Scope: "phone"})
+	var saved *domains.Consent
+	saveConsentFunc = func(consent *domains.Consent) rest_errors.RestErr {
+		saved = consent
+		return nil
+	}
+	createAuthorizationCodeFunc = func(code *domains.AuthorizationCode) rest_errors.RestErr {
+		return nil
+	}
+
+	res, err := OAuthService.Consent(1, domains.ConsentRequest{AuthorizeRequest: authorizeRequest(), Approve: true})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, redirectQuery(t, res).Get("code"))
+	assert.Equal(t, "phone openid profile", saved.Scope)
+}
+
+// TestAuthorizationCodeFlow runs authorize, code exchange and refresh of a public client with PKCE
+func TestAuthorizationCodeFlow(t *testing.T) {
+	mockOAuth(publicClient(), &domains.Consent{UserID: 1, ClientID: "spa", Scope: "openid profile"})
+	codes := map[string]*domains.AuthorizationCode{}
+	createAuthorizationCodeFunc = func(code *domains.AuthorizationCode) rest_errors.RestErr {
+		codes[code.CodeHash] = code
+		return nil
+	}
+	consumeAuthorizationCodeFunc = func(codeHash string) (*domains.AuthorizationCode, rest_errors.RestErr) {
+		code := codes[codeHash]
+		delete(codes, codeHash)
+		return code, nil
+	}
+	refreshTokens := map[string]*domains.RefreshToken{}
+	createRefreshTokenFunc = func(token *domains.RefreshToken) rest_errors.RestErr {
+		refreshTokens[token.TokenHash] = token
+		return nil
+	}
+	rotateRefreshTokenFunc = func(tokenHash, clientID string, next *domains.RefreshToken) (*domains.RefreshToken, rest_errors.RestErr) {
+		current := refreshTokens[tokenHash]
+		if current == nil || current.ClientID != clientID {
+			return nil, nil
+		}
+		delete(refreshTokens, tokenHash)
+		next.UserID, next.Scope = current.UserID, current.Scope
+		refreshTokens[next.TokenHash] = next
+		return current, nil
+	}
+	getUserFunc = func(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{ID: id, Username: "ali", Name: "Ali", Family: "Ahmadi", Active: true}, nil
+	}
+	repositories.UserRepository = &UserRespositoryMock{}
+	var accessClaims jwt.MapClaims
+	generateJwtFunc = func(data jwt.MapClaims) (string, rest_errors.RestErr) {
+		accessClaims = data
+		return "access-token", nil
+	}
+	JwtService = &JwtServiceMock{}
+
+	res, err := OAuthService.Authorize(1, authorizeRequest())
+	assert.Nil(t, err)
+	q := redirectQuery(t, res)
+	assert.Equal(t, "xyz", q.Get("state"))
+	code := q.Get("code")
+	assert.NotEmpty(t, code)
+
+	tokens, err := OAuthService.Token(domains.TokenRequest{
+		GrantType:    GrantTypeAuthorizationCode,
+		Code:         code,
+		RedirectURI:  testRedirectURI,
+		CodeVerifier: testCodeVerifier,
+		ClientID:     "spa",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "access-token", tokens.AccessToken)
+	assert.Equal(t, TokenTypeBearer, tokens.TokenType)
+	assert.Equal(t, "openid profile", tokens.Scope)
+	assert.Equal(t, "1", accessClaims["sub"])
+	assert.Equal(t, "spa", accessClaims["client_id"])
+	assert.NotEmpty(t, tokens.RefreshToken)
+
+	keys, err := OAuthService.JWKS()
+	assert.Nil(t, err)
+	idClaims := jwt.MapClaims{}
+	_, parseErr := jwt.ParseWithClaims(tokens.IDToken, idClaims, func(tk *jwt.Token) (interface{}, error) {
+		assert.Equal(t, keys.Keys[0].Kid, tk.Header["kid"])
+		key, err := oidcSigningKey()
+		assert.Nil(t, err)
+		return &key.PublicKey, nil
+	})
+	assert.Nil(t, parseErr)
+	assert.Equal(t, "1", idClaims["sub"])
+	assert.Equal(t, "spa", idClaims["aud"])
+	assert.Equal(t, "n-0S6", idClaims["nonce"])
+	assert.Equal(t, "ali", idClaims["preferred_username"])
+	assert.Nil(t, idClaims["phone_number"])
+
+	// codes are single use
+	_, err = OAuthService.Token(domains.TokenRequest{GrantType: GrantTypeAuthorizationCode, Code: code, RedirectURI: testRedirectURI,
+		CodeVerifier: testCodeVerifier, ClientID: "spa"})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.InvalidGrantErrorMessage, err.Message())
+
+	refreshed, err := OAuthService.Token(domains.TokenRequest{GrantType: GrantTypeRefreshToken, RefreshToken: tokens.RefreshToken, ClientID: "spa"})
+	assert.Nil(t, err)
+	assert.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+	assert.NotEmpty(t, refreshed.IDToken)
+
+	// rotated refresh token is revoked
+	_, err = OAuthService.Token(domains.TokenRequest{GrantType: GrantTypeRefreshToken, RefreshToken: tokens.RefreshToken, ClientID: "spa"})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.InvalidGrantErrorMessage, err.Message())
+}
+
+func TestTokenWrongCodeVerifier(t *testing.T) {
+	mockOAuth(publicClient(), nil)
+	challenge := authorizeRequest().CodeChallenge
+	consumeAuthorizationCodeFunc = func(codeHash string) (*domains.AuthorizationCode, rest_errors.RestErr) {
+		assert.Equal(t, crypto.GenerateSha256("the-code"), codeHash)
+		return &domains.AuthorizationCode{ClientID: "spa", UserID: 1, RedirectURI: testRedirectURI, CodeChallenge: challenge,
+			CodeChallengeMethod: CodeChallengeMethodS256, ExpiresAt: time.Now().Add(time.Minute)}, nil
+	}
+
+	res, err := OAuthService.Token(domains.TokenRequest{GrantType: GrantTypeAuthorizationCode, Code: "the-code",
+		RedirectURI: testRedirectURI, CodeVerifier: "wrong-verifier", ClientID: "spa"})
+	assert.Nil(t, res)
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.InvalidGrantErrorMessage, err.Message())
+}
+
+func TestTokenPublicClientCannotUseClientCredentials(t *testing.T) {
+	mockOAuth(publicClient(), nil)
+
+	res, err := OAuthService.Token(domains.TokenRequest{GrantType: GrantTypeClientCredentials, ClientID: "spa"})
+	assert.Nil(t, res)
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.UnauthorizedClientErrorMessage, err.Message())
+}
+
+func TestTokenUnsupportedGrantType(t *testing.T) {
+	mockOAuth(publicClient(), nil)
+
+	res, err := OAuthService.Token(domains.TokenRequest{GrantType: "password", ClientID: "spa"})
+	assert.Nil(t, res)
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.UnsupportedGrantTypeErrorMessage, err.Message())
+}
+
+func TestTokenClientCredentials(t *testing.T) {
+	mockOAuth(&domains.Client{ClientID: "gateway", SecretHash: crypto.GenerateSha256("secret"), Scopes: "introspect",
+		GrantTypes: "client_credentials"}, nil)
+	generateJwtFunc = func(data jwt.MapClaims) (string, rest_errors.RestErr) {
+		assert.Equal(t, "gateway", data["sub"])
+		assert.Equal(t, "gateway", data["client_id"])
+		assert.Equal(t, "introspect", data["scope"])
+		return "access-token", nil
+	}
+	JwtService = &JwtServiceMock{}
+
+	res, err := OAuthService.Token(domains.TokenRequest{GrantType: GrantTypeClientCredentials, ClientID: "gateway", ClientSecret: "secret"})
+	assert.Nil(t, err)
+	assert.Equal(t, "access-token", res.AccessToken)
+	assert.Empty(t, res.RefreshToken)
+	assert.Empty(t, res.IDToken)
+}
+
+func TestIntrospectClientCredentialsToken(t *testing.T) {
+	verifyJwtFunc = func(token string) (*domains.Jwt, rest_errors.RestErr) {
+		return &domains.Jwt{Sub: "gateway", ClientID: "gateway", Scope: "introspect"}, nil
+	}
+	JwtService = &JwtServiceMock{}
+
+	res, err := OAuthService.Introspect("token")
+	assert.Nil(t, err)
+	assert.True(t, res.Active)
+	assert.Equal(t, "gateway", res.Sub)
+	assert.Nil(t, res.UserActive)
+}
+
+func TestUserInfoRequiresOpenIDScope(t *testing.T) {
+	verifyJwtFunc = func(token string) (*domains.Jwt, rest_errors.RestErr) {
+		return &domains.Jwt{Sub: "1"}, nil
+	}
+	JwtService = &JwtServiceMock{}
+
+	res, err := OAuthService.UserInfo("token")
+	assert.Nil(t, res)
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.InvalidTokenErrorMessage, err.Message())
+}
+
+func TestUserInfoReleasesClaimsByScope(t *testing.T) {
+	verifyJwtFunc = func(token string) (*domains.Jwt, rest_errors.RestErr) {
+		return &domains.Jwt{Sub: "1", Scope: "openid phone"}, nil
+	}
+	getUserFunc = func(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{ID: id, Username: "ali", Phone: "09120000000", Active: true}, nil
+	}
+	JwtService = &JwtServiceMock{}
+	repositories.UserRepository = &UserRespositoryMock{}
+
+	res, err := OAuthService.UserInfo("token")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", res.Sub)
+	assert.Equal(t, "09120000000", res.PhoneNumber)
+	assert.True(t, *res.PhoneNumberVerified)
+	assert.Empty(t, res.PreferredUsername)
+}
+
+func TestCreatePublicClientHasNoSecret(t *testing.T) {
+	createClientFunc = func(client *domains.Client) rest_errors.RestErr {
+		assert.Empty(t, client.SecretHash)
+		assert.Equal(t, "authorization_code refresh_token", client.GrantTypes)
+		return nil
+	}
+	repositories.ClientRepository = &ClientRepositoryMock{}
+
+	res, err := ClientService.Create(domains.CreateClientRequest{Name: "spa", RedirectURIs: []string{testRedirectURI},
+		GrantTypes: []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken}, Scopes: []string{"openid"}, Public: true}, domains.Actor{UserID: 1})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, res.Client.ClientID)
+	assert.Empty(t, res.ClientSecret)
+}
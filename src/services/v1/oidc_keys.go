@@ -0,0 +1,95 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+)
+
+const (
+	// envOIDCSigningKey is PEM of RSA key id tokens are signed with
+	envOIDCSigningKey = "OIDC_SIGNING_KEY"
+	// envOIDCIssuer is public base url of this service
+	envOIDCIssuer = "OIDC_ISSUER"
+	DefaultIssuer = "http://localhost:8080"
+
+	signingKeyBits = 2048
+)
+
+var (
+	signingKeyOnce sync.Once
+	signingKey     *rsa.PrivateKey
+	signingKeyErr  error
+)
+
+// Issuer is iss of every token this service signs
+func Issuer() string {
+	if iss := os.Getenv(envOIDCIssuer); iss != "" {
+		return strings.TrimSuffix(iss, "/")
+	}
+	return DefaultIssuer
+}
+
+// oidcSigningKey loads key from OIDC_SIGNING_KEY once, without it a key is generated
+// and id tokens do not survive restarts
+func oidcSigningKey() (*rsa.PrivateKey, rest_errors.RestErr) {
+	signingKeyOnce.Do(func() {
+		if raw := os.Getenv(envOIDCSigningKey); raw != "" {
+			signingKey, signingKeyErr = parseSigningKey([]byte(raw))
+			return
+		}
+		signingKey, signingKeyErr = rsa.GenerateKey(rand.Reader, signingKeyBits)
+	})
+	if signingKeyErr != nil {
+		return nil, errors.NewInternalServerError(signingKeyErr)
+	}
+	return signingKey, nil
+}
+
+func parseSigningKey(raw []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("oidc: %s is not PEM", envOIDCSigningKey)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("oidc: %s is not an RSA key", envOIDCSigningKey)
+	}
+	return rsaKey, nil
+}
+
+// keyID is derived from modulus so it changes only when key does
+func keyID(pub *rsa.PublicKey) string {
+	sum := sha256.Sum256(pub.N.Bytes())
+	return base64.RawURLEncoding.EncodeToString(sum[:])[:16]
+}
+
+func publicJWK(pub *rsa.PublicKey) domains.JWK {
+	return domains.JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Kid: keyID(pub),
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+	"github.com/alidevjimmy/user_microservice_t/utils/broker"
+)
+
+const (
+	// envOutboxBrokerURL is where events are posted, events are delivered in process when it is not set
+	envOutboxBrokerURL = "OUTBOX_BROKER_URL"
+
+	OutboxRelayInterval = time.Second
+	outboxBatchSize     = 100
+	// outboxLease is how long a relay has to publish events it took before another relay may take them
+	outboxLease         = time.Minute
+	outboxMaxRetryDelay = 10 * time.Minute
+)
+
+var (
+	OutboxRelay outboxRelayInterface = &outboxRelay{}
+)
+
+type outboxRelayInterface interface {
+	Relay(ctx context.Context, b broker.Broker) (int, rest_errors.RestErr)
+}
+
+type outboxRelay struct{}
+
+// OutboxBroker returns broker configured by environment, see envOutboxBrokerURL
+func OutboxBroker() broker.Broker {
+	if url := os.Getenv(envOutboxBrokerURL); url != "" {
+		return broker.NewHTTP(url)
+	}
+	return broker.NewLocal()
+}
+
+// RunOutboxRelay relays events to b every interval until ctx is done, onError is told of failures of the outbox itself
+func RunOutboxRelay(ctx context.Context, b broker.Broker, interval time.Duration, onError func(rest_errors.RestErr)) {
+	for {
+		n, err := OutboxRelay.Relay(ctx, b)
+		if err != nil {
+			onError(err)
+		}
+		// a full batch means more events are waiting
+		if err == nil && n == outboxBatchSize && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Relay publishes a batch of due events and returns how many were published.
+// Events failing to publish are retried later with growing delay
+func (*outboxRelay) Relay(ctx context.Context, b broker.Broker) (int, rest_errors.RestErr) {
+	events, err := repositories.OutboxRepository.ClaimOutboxEvents(outboxBatchSize, outboxLease)
+	if err != nil {
+		return 0, err
+	}
+	published := 0
+	for _, event := range events {
+		body, jsonErr := json.Marshal(domains.Event{
+			ID:         event.ID,
+			Type:       event.Type,
+			UserID:     event.UserID,
+			OccurredAt: event.CreatedAt,
+			Data:       json.RawMessage(event.Payload),
+		})
+		if jsonErr != nil {
+			return published, errors.NewInternalServerError(jsonErr)
+		}
+		msg := broker.Message{
+			ID:    strconv.FormatUint(uint64(event.ID), 10),
+			Topic: event.Type,
+			Key:   strconv.FormatUint(uint64(event.UserID), 10),
+			Body:  body,
+		}
+		if pubErr := b.Publish(ctx, msg); pubErr != nil {
+			retryAt := time.Now().Add(outboxRetryDelay(event.Attempts))
+			if err := repositories.OutboxRepository.MarkOutboxEventFailed(event.ID, pubErr.Error(), retryAt); err != nil {
+				return published, err
+			}
+			continue
+		}
+		if err := repositories.OutboxRepository.MarkOutboxEventPublished(event.ID, time.Now()); err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, nil
+}
+
+// outboxRetryDelay doubles from a second by attempts made, up to outboxMaxRetryDelay
+func outboxRetryDelay(attempts int) time.Duration {
+	if attempts >= 10 {
+		return outboxMaxRetryDelay
+	}
+	delay := time.Second << uint(attempts)
+	if delay > outboxMaxRetryDelay {
+		return outboxMaxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	goerrors "errors"
+	"testing"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+	"github.com/alidevjimmy/user_microservice_t/utils/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+// OutboxRepositoryMock keeps events in memory, claiming takes every due event
+type OutboxRepositoryMock struct {
+	events []*domains.OutboxEvent
+}
+
+func (m *OutboxRepositoryMock) ClaimOutboxEvents(limit int, lease time.Duration) ([]domains.OutboxEvent, rest_errors.RestErr) {
+	events := []domains.OutboxEvent{}
+	for _, event := range m.events {
+		if event.PublishedAt == nil && !event.NextAttemptAt.After(time.Now()) && len(events) < limit {
+			event.NextAttemptAt = time.Now().Add(lease)
+			events = append(events, *event)
+		}
+	}
+	return events, nil
+}
+
+func (m *OutboxRepositoryMock) MarkOutboxEventPublished(id uint, at time.Time) rest_errors.RestErr {
+	m.events[id-1].PublishedAt = &at
+	return nil
+}
+
+func (m *OutboxRepositoryMock) MarkOutboxEventFailed(id uint, reason string, retryAt time.Time) rest_errors.RestErr {
+	m.events[id-1].Attempts++
+	m.events[id-1].LastError = reason
+	m.events[id-1].NextAttemptAt = retryAt
+	return nil
+}
+
+// failingBroker fails every publish while down
+type failingBroker struct {
+	down bool
+	*broker.Local
+}
+
+func (b *failingBroker) Publish(ctx context.Context, m broker.Message) error {
+	if b.down {
+		return goerrors.New("broker is down")
+	}
+	return b.Local.Publish(ctx, m)
+}
+
+func newOutboxTest(types ...string) *OutboxRepositoryMock {
+	repo := &OutboxRepositoryMock{}
+	for i, eventType := range types {
+		repo.events = append(repo.events, &domains.OutboxEvent{
+			ID: uint(i + 1), Type: eventType, UserID: 7, Payload: `{"id":7}`, CreatedAt: time.Now(),
+		})
+	}
+	repositories.OutboxRepository = repo
+	return repo
+}
+
+func TestRelayOutbox(t *testing.T) {
+	repo := newOutboxTest(domains.EventUserVerified, domains.EventUserBlocked)
+	b := broker.NewLocal()
+
+	n, err := OutboxRelay.Relay(context.Background(), b)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	messages := b.Messages()
+	assert.Len(t, messages, 2)
+	assert.Equal(t, "1", messages[0].ID)
+	assert.Equal(t, domains.EventUserVerified, messages[0].Topic)
+	assert.Equal(t, "7", messages[0].Key)
+	event := new(domains.Event)
+	assert.Nil(t, json.Unmarshal(messages[1].Body, event))
+	assert.Equal(t, domains.EventUserBlocked, event.Type)
+	assert.EqualValues(t, 7, event.UserID)
+	assert.JSONEq(t, `{"id":7}`, string(event.Data))
+	assert.NotNil(t, repo.events[1].PublishedAt)
+
+	n, err = OutboxRelay.Relay(context.Background(), b)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestRelayOutboxRetriesLater(t *testing.T) {
+	repo := newOutboxTest(domains.EventPasswordChanged)
+	b := &failingBroker{down: true, Local: broker.NewLocal()}
+
+	n, err := OutboxRelay.Relay(context.Background(), b)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 1, repo.events[0].Attempts)
+	assert.Equal(t, "broker is down", repo.events[0].LastError)
+	assert.Nil(t, repo.events[0].PublishedAt)
+
+	b.down = false
+	n, _ = OutboxRelay.Relay(context.Background(), b)
+	assert.Equal(t, 0, n, "event waits for its retry time")
+	repo.events[0].NextAttemptAt = time.Now()
+	n, _ = OutboxRelay.Relay(context.Background(), b)
+	assert.Equal(t, 1, n)
+}
+
+func TestOutboxRetryDelay(t *testing.T) {
+	assert.Equal(t, time.Second, outboxRetryDelay(0))
+	assert.Equal(t, 8*time.Second, outboxRetryDelay(3))
+	assert.Equal(t, outboxMaxRetryDelay, outboxRetryDelay(20))
+}
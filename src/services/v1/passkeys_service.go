@@ -0,0 +1,326 @@
+package services
+
+import (
+	"encoding/base64"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/crypto"
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+	"github.com/alidevjimmy/user_microservice_t/utils/phone"
+	"github.com/alidevjimmy/user_microservice_t/utils/webauthn"
+)
+
+const (
+	// envWebAuthnRPID is the domain passkeys are scoped to, host of Issuer by default
+	envWebAuthnRPID = "WEBAUTHN_RP_ID"
+	// envWebAuthnOrigins is comma separated origins of pages running ceremonies, Issuer by default
+	envWebAuthnOrigins = "WEBAUTHN_ORIGINS"
+	envWebAuthnRPName  = "WEBAUTHN_RP_NAME"
+
+	CeremonyRegistration = "registration"
+	CeremonyLogin        = "login"
+
+	PasskeyChallengeTTL = 5 * time.Minute
+
+	credentialTypePublicKey = "public-key"
+	residentKeyPreferred    = "preferred"
+	attestationNone         = "none"
+)
+
+var (
+	PasskeyService passkeyServiceInterface = &passkeyService{}
+
+	// relyingParty verifies ceremonies, it is configured by environment unless SetRelyingParty is called
+	relyingParty *webauthn.RelyingParty
+)
+
+type passkeyServiceInterface interface {
+	StartRegistration(user *domains.PublicUser) (*domains.PasskeyCreationOptions, rest_errors.RestErr)
+	FinishRegistration(userID uint, req domains.PasskeyRegistrationRequest, actor domains.Actor) (*domains.Passkey, rest_errors.RestErr)
+	StartLogin(req domains.PasskeyLoginStartRequest) (*domains.PasskeyRequestOptions, rest_errors.RestErr)
+	FinishLogin(req domains.PasskeyLoginRequest, device domains.Device) (*domains.LoginResponse, rest_errors.RestErr)
+	List(userID uint) ([]domains.Passkey, rest_errors.RestErr)
+	Delete(userID, id uint, actor domains.Actor) rest_errors.RestErr
+}
+
+type passkeyService struct{}
+
+// SetRelyingParty replaces relying party configured by environment
+func SetRelyingParty(config webauthn.Config) {
+	relyingParty = webauthn.New(config)
+}
+
+func getRelyingParty() *webauthn.RelyingParty {
+	if relyingParty == nil {
+		config := webauthn.Config{
+			RPID:             os.Getenv(envWebAuthnRPID),
+			RPName:           os.Getenv(envWebAuthnRPName),
+			UserVerification: webauthn.UserVerificationRequired,
+		}
+		if config.RPID == "" {
+			if u, err := url.Parse(Issuer()); err == nil {
+				config.RPID = u.Hostname()
+			}
+		}
+		if config.RPName == "" {
+			config.RPName = config.RPID
+		}
+		for _, origin := range strings.Split(os.Getenv(envWebAuthnOrigins), ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				config.Origins = append(config.Origins, origin)
+			}
+		}
+		if len(config.Origins) == 0 {
+			config.Origins = []string{Issuer()}
+		}
+		relyingParty = webauthn.New(config)
+	}
+	return relyingParty
+}
+
+// StartRegistration returns options for registering a new passkey of user, passkeys user has are excluded
+func (*passkeyService) StartRegistration(user *domains.PublicUser) (*domains.PasskeyCreationOptions, rest_errors.RestErr) {
+	passkeys, err := repositories.PasskeyRepository.GetPasskeysByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := newPasskeyChallenge(CeremonyRegistration, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	config := getRelyingParty().Config()
+	return &domains.PasskeyCreationOptions{
+		Challenge: challenge,
+		RP:        domains.PasskeyRelyingParty{ID: config.RPID, Name: config.RPName},
+		User: domains.PasskeyUser{
+			ID:          userHandle(user.ID),
+			Name:        user.Username,
+			DisplayName: strings.TrimSpace(user.Name + " " + user.Family),
+		},
+		PubKeyCredParams: []domains.PasskeyCredentialParameter{
+			{Type: credentialTypePublicKey, Alg: webauthn.AlgES256},
+			{Type: credentialTypePublicKey, Alg: webauthn.AlgEdDSA},
+			{Type: credentialTypePublicKey, Alg: webauthn.AlgRS256},
+		},
+		Timeout:            PasskeyChallengeTTL.Milliseconds(),
+		ExcludeCredentials: credentialDescriptors(passkeys),
+		AuthenticatorSelection: domains.PasskeyAuthenticatorSelection{
+			ResidentKey:      residentKeyPreferred,
+			UserVerification: config.UserVerification,
+		},
+		Attestation: attestationNone,
+	}, nil
+}
+
+// FinishRegistration verifies response of authenticator and stores the new passkey of user
+func (*passkeyService) FinishRegistration(userID uint, req domains.PasskeyRegistrationRequest, actor domains.Actor) (*domains.Passkey, rest_errors.RestErr) {
+	fields, ok := decodeBase64URL(req.Response.ClientDataJSON, req.Response.AttestationObject)
+	if !ok {
+		return nil, errors.NewBadRequestError(errors.InvalidPasskey)
+	}
+	clientDataJSON, attestationObject := fields[0], fields[1]
+	challenge, err := consumePasskeyChallenge(CeremonyRegistration, clientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.UserID != userID {
+		return nil, errors.NewBadRequestError(errors.InvalidPasskey)
+	}
+	credential, verifyErr := getRelyingParty().VerifyRegistration(base64Challenge(clientDataJSON), clientDataJSON, attestationObject)
+	if verifyErr != nil {
+		return nil, errors.NewBadRequestError(errors.InvalidPasskey)
+	}
+	credentialID := base64.RawURLEncoding.EncodeToString(credential.ID)
+	existing, err := repositories.PasskeyRepository.GetPasskeyByCredentialID(credentialID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, errors.NewBadRequestError(errors.PasskeyAlreadyRegistered)
+	}
+	passkey := &domains.Passkey{
+		UserID:         userID,
+		Name:           req.Name,
+		CredentialID:   credentialID,
+		PublicKey:      credential.PublicKey,
+		SignCount:      credential.SignCount,
+		BackupEligible: credential.BackupEligible,
+	}
+	audit := actor.Audit(AuditPasskeyRegistered, userID, domains.AuditChanges{
+		"name":          {After: passkey.Name},
+		"credential_id": {After: passkey.CredentialID},
+	})
+	if err := repositories.PasskeyRepository.CreatePasskey(passkey, audit); err != nil {
+		return nil, err
+	}
+	return passkey, nil
+}
+
+// StartLogin returns options for signing in by passkey. Unknown users get the same options as
+// discoverable sign in, so whether a user exists is not revealed
+func (*passkeyService) StartLogin(req domains.PasskeyLoginStartRequest) (*domains.PasskeyRequestOptions, rest_errors.RestErr) {
+	var userID uint
+	passkeys := []domains.Passkey{}
+	if req.PhoneOrUsername != "" {
+		user, err := userByPhoneOrUsername(req.PhoneOrUsername)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil {
+			if passkeys, err = repositories.PasskeyRepository.GetPasskeysByUserID(user.ID); err != nil {
+				return nil, err
+			}
+			if len(passkeys) > 0 {
+				userID = user.ID
+			}
+		}
+	}
+	challenge, err := newPasskeyChallenge(CeremonyLogin, userID)
+	if err != nil {
+		return nil, err
+	}
+	config := getRelyingParty().Config()
+	return &domains.PasskeyRequestOptions{
+		Challenge:        challenge,
+		RPID:             config.RPID,
+		Timeout:          PasskeyChallengeTTL.Milliseconds(),
+		AllowCredentials: credentialDescriptors(passkeys),
+		UserVerification: config.UserVerification,
+	}, nil
+}
+
+// FinishLogin verifies assertion of a passkey and starts a session on device like UserService.Login
+func (*passkeyService) FinishLogin(req domains.PasskeyLoginRequest, device domains.Device) (*domains.LoginResponse, rest_errors.RestErr) {
+	invalid := errors.NewUnauthorizedError(errors.InvalidPasskey)
+	fields, ok := decodeBase64URL(req.Response.ClientDataJSON, req.Response.AuthenticatorData, req.Response.Signature)
+	if !ok {
+		return nil, invalid
+	}
+	clientDataJSON, authData, signature := fields[0], fields[1], fields[2]
+	challenge, err := consumePasskeyChallenge(CeremonyLogin, clientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	passkey, err := repositories.PasskeyRepository.GetPasskeyByCredentialID(req.ID)
+	if err != nil {
+		return nil, err
+	}
+	if passkey == nil || (challenge.UserID != 0 && challenge.UserID != passkey.UserID) {
+		return nil, invalid
+	}
+	if req.Response.UserHandle != "" && req.Response.UserHandle != userHandle(passkey.UserID) {
+		return nil, invalid
+	}
+	credential := webauthn.Credential{PublicKey: passkey.PublicKey, SignCount: passkey.SignCount}
+	signCount, verifyErr := getRelyingParty().VerifyAssertion(base64Challenge(clientDataJSON), credential, clientDataJSON, authData, signature)
+	if verifyErr != nil {
+		return nil, invalid
+	}
+	if err := repositories.PasskeyRepository.UpdatePasskeySignCount(passkey.ID, signCount, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := checkAccountOf(passkey.UserID, AccountUseSession); err != nil {
+		return nil, err
+	}
+	return SessionService.Start(passkey.UserID, device)
+}
+
+func (*passkeyService) List(userID uint) ([]domains.Passkey, rest_errors.RestErr) {
+	return repositories.PasskeyRepository.GetPasskeysByUserID(userID)
+}
+
+func (*passkeyService) Delete(userID, id uint, actor domains.Actor) rest_errors.RestErr {
+	audit := actor.Audit(AuditPasskeyDeleted, userID, domains.AuditChanges{"passkey_id": {Before: id}})
+	deleted, err := repositories.PasskeyRepository.DeletePasskey(userID, id, audit)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return errors.NewNotFoundError(errors.PasskeyNotFound)
+	}
+	return nil
+}
+
+// newPasskeyChallenge starts ceremony of user and returns its challenge
+func newPasskeyChallenge(ceremony string, userID uint) (string, rest_errors.RestErr) {
+	challenge, genErr := webauthn.NewChallenge()
+	if genErr != nil {
+		return "", errors.NewInternalServerError(genErr)
+	}
+	err := repositories.PasskeyRepository.CreatePasskeyChallenge(&domains.PasskeyChallenge{
+		ChallengeHash: crypto.GenerateSha256(challenge),
+		Ceremony:      ceremony,
+		UserID:        userID,
+		ExpiresAt:     time.Now().Add(PasskeyChallengeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// consumePasskeyChallenge finds the live challenge clientDataJSON answers, a challenge is used once
+func consumePasskeyChallenge(ceremony string, clientDataJSON []byte) (*domains.PasskeyChallenge, rest_errors.RestErr) {
+	challenge := base64Challenge(clientDataJSON)
+	if challenge == "" {
+		return nil, errors.NewBadRequestError(errors.InvalidPasskey)
+	}
+	state, err := repositories.PasskeyRepository.ConsumePasskeyChallenge(crypto.GenerateSha256(challenge), ceremony)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, errors.NewBadRequestError(errors.InvalidPasskey)
+	}
+	return state, nil
+}
+
+// base64Challenge returns challenge clientDataJSON claims to answer, it is verified by the relying party
+func base64Challenge(clientDataJSON []byte) string {
+	cd, err := webauthn.ParseClientData(clientDataJSON)
+	if err != nil {
+		return ""
+	}
+	return cd.Challenge
+}
+
+// decodeBase64URL decodes binary fields of a credential, browsers send them as unpadded base64url
+func decodeBase64URL(fields ...string) ([][]byte, bool) {
+	decoded := make([][]byte, len(fields))
+	for i, field := range fields {
+		b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(field, "="))
+		if err != nil {
+			return nil, false
+		}
+		decoded[i] = b
+	}
+	return decoded, true
+}
+
+// userHandle is the opaque WebAuthn user id of user
+func userHandle(userID uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(userID), 10)))
+}
+
+func credentialDescriptors(passkeys []domains.Passkey) []domains.PasskeyCredentialDescriptor {
+	descriptors := make([]domains.PasskeyCredentialDescriptor, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		descriptors = append(descriptors, domains.PasskeyCredentialDescriptor{Type: credentialTypePublicKey, ID: passkey.CredentialID})
+	}
+	return descriptors
+}
+
+// userByPhoneOrUsername finds user the way UserService.Login does, nil if there is none
+func userByPhoneOrUsername(phoneOrUsername string) (*domains.PublicUser, rest_errors.RestErr) {
+	if p, err := phone.Normalize(phoneOrUsername); err == nil {
+		return repositories.UserRepository.GetUserByPhone(p)
+	}
+	return repositories.UserRepository.GetUserByUsername(phoneOrUsername)
+}
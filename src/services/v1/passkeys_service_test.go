@@ -0,0 +1,269 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+	"github.com/alidevjimmy/user_microservice_t/utils/webauthn"
+	"github.com/alidevjimmy/user_microservice_t/utils/webauthn/webauthntest"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+// PasskeyRepositoryMock keeps passkeys and challenges in memory
+type PasskeyRepositoryMock struct {
+	passkeys   []domains.Passkey
+	challenges map[string]*domains.PasskeyChallenge
+}
+
+func (m *PasskeyRepositoryMock) GetPasskeyByCredentialID(credentialID string) (*domains.Passkey, rest_errors.RestErr) {
+	for i := range m.passkeys {
+		if m.passkeys[i].CredentialID == credentialID {
+			passkey := m.passkeys[i]
+			return &passkey, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *PasskeyRepositoryMock) GetPasskeysByUserID(userID uint) ([]domains.Passkey, rest_errors.RestErr) {
+	passkeys := []domains.Passkey{}
+	for _, passkey := range m.passkeys {
+		if passkey.UserID == userID {
+			passkeys = append(passkeys, passkey)
+		}
+	}
+	return passkeys, nil
+}
+
+func (m *PasskeyRepositoryMock) CreatePasskey(passkey *domains.Passkey, audit *domains.AuditEntry) rest_errors.RestErr {
+	passkey.ID = uint(len(m.passkeys) + 1)
+	m.passkeys = append(m.passkeys, *passkey)
+	return nil
+}
+
+func (m *PasskeyRepositoryMock) UpdatePasskeySignCount(id uint, signCount uint32, usedAt time.Time) rest_errors.RestErr {
+	m.passkeys[id-1].SignCount = signCount
+	m.passkeys[id-1].LastUsedAt = &usedAt
+	return nil
+}
+
+func (m *PasskeyRepositoryMock) DeletePasskey(userID, id uint, audit *domains.AuditEntry) (bool, rest_errors.RestErr) {
+	kept := m.passkeys[:0]
+	for _, passkey := range m.passkeys {
+		if passkey.UserID != userID || passkey.ID != id {
+			kept = append(kept, passkey)
+		}
+	}
+	deleted := len(kept) != len(m.passkeys)
+	m.passkeys = kept
+	return deleted, nil
+}
+
+func (m *PasskeyRepositoryMock) CreatePasskeyChallenge(challenge *domains.PasskeyChallenge) rest_errors.RestErr {
+	m.challenges[challenge.ChallengeHash] = challenge
+	return nil
+}
+
+func (m *PasskeyRepositoryMock) ConsumePasskeyChallenge(challengeHash, ceremony string) (*domains.PasskeyChallenge, rest_errors.RestErr) {
+	challenge := m.challenges[challengeHash]
+	if challenge == nil || challenge.Ceremony != ceremony {
+		return nil, nil
+	}
+	delete(m.challenges, challengeHash)
+	return challenge, nil
+}
+
+func newPasskeyTest(t *testing.T) *PasskeyRepositoryMock {
+	SetRelyingParty(webauthn.Config{RPID: testRPID, RPName: "Example", Origins: []string{testOrigin}, UserVerification: webauthn.UserVerificationRequired})
+	t.Cleanup(func() {
+		relyingParty = nil
+		getUserByUsernameFunc = nil
+	})
+	repo := &PasskeyRepositoryMock{challenges: map[string]*domains.PasskeyChallenge{}}
+	repositories.PasskeyRepository = repo
+	repositories.SessionRepository = &SessionRepositoryMock{}
+	repositories.UserRepository = &UserRespositoryMock{}
+	getUserFunc = func(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{ID: id, Active: true}, nil
+	}
+	generateJwtFunc = func(data jwt.MapClaims) (string, rest_errors.RestErr) {
+		return "token-of-" + data["sub"].(string), nil
+	}
+	JwtService = &JwtServiceMock{}
+	return repo
+}
+
+func registerPasskey(t *testing.T, a *webauthntest.Authenticator, user *domains.PublicUser) (*domains.Passkey, rest_errors.RestErr) {
+	options, err := PasskeyService.StartRegistration(user)
+	assert.Nil(t, err)
+	clientData, attestation := a.Create(options.RP.ID, testOrigin, options.Challenge)
+	return PasskeyService.FinishRegistration(user.ID, domains.PasskeyRegistrationRequest{
+		Name: "laptop",
+		ID:   webauthntest.Base64(a.ID),
+		Response: domains.PasskeyAttestationResponse{
+			ClientDataJSON:    webauthntest.Base64(clientData),
+			AttestationObject: webauthntest.Base64(attestation),
+		},
+	}, domains.Actor{UserID: user.ID})
+}
+
+func passkeyAssertion(a *webauthntest.Authenticator, challenge string) domains.PasskeyLoginRequest {
+	clientData, authData, signature := a.Get(testRPID, testOrigin, challenge)
+	return domains.PasskeyLoginRequest{
+		ID: webauthntest.Base64(a.ID),
+		Response: domains.PasskeyAssertionResponse{
+			ClientDataJSON:    webauthntest.Base64(clientData),
+			AuthenticatorData: webauthntest.Base64(authData),
+			Signature:         webauthntest.Base64(signature),
+		},
+	}
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	repo := newPasskeyTest(t)
+	a := webauthntest.NewAuthenticator()
+
+	passkey, err := registerPasskey(t, a, &domains.PublicUser{ID: 4, Username: "ali"})
+	assert.Nil(t, err)
+	assert.Equal(t, "laptop", passkey.Name)
+	assert.Equal(t, webauthntest.Base64(a.ID), passkey.CredentialID)
+	assert.Equal(t, a.PublicKey(), passkey.PublicKey)
+
+	getUserByUsernameFunc = func(username string) (*domains.PublicUser, rest_errors.RestErr) {
+		assert.Equal(t, "ali", username)
+		return &domains.PublicUser{ID: 4, Username: username}, nil
+	}
+	repositories.UserRepository = &UserRespositoryMock{}
+	options, err := PasskeyService.StartLogin(domains.PasskeyLoginStartRequest{PhoneOrUsername: "ali"})
+	assert.Nil(t, err)
+	assert.Equal(t, testRPID, options.RPID)
+	assert.Equal(t, []domains.PasskeyCredentialDescriptor{{Type: "public-key", ID: passkey.CredentialID}}, options.AllowCredentials)
+
+	res, err := PasskeyService.FinishLogin(passkeyAssertion(a, options.Challenge), domains.Device{})
+	assert.Nil(t, err)
+	assert.Equal(t, "token-of-4", res.Token)
+	assert.EqualValues(t, 1, repo.passkeys[0].SignCount)
+	assert.NotNil(t, repo.passkeys[0].LastUsedAt)
+}
+
+func TestPasskeyDiscoverableLogin(t *testing.T) {
+	newPasskeyTest(t)
+	a := webauthntest.NewAuthenticator()
+	_, err := registerPasskey(t, a, &domains.PublicUser{ID: 4})
+	assert.Nil(t, err)
+
+	options, err := PasskeyService.StartLogin(domains.PasskeyLoginStartRequest{})
+	assert.Nil(t, err)
+	assert.Empty(t, options.AllowCredentials)
+
+	req := passkeyAssertion(a, options.Challenge)
+	req.Response.UserHandle = userHandle(4)
+	res, err := PasskeyService.FinishLogin(req, domains.Device{})
+	assert.Nil(t, err)
+	assert.Equal(t, "token-of-4", res.Token)
+}
+
+func TestPasskeyLoginChallengeIsSingleUse(t *testing.T) {
+	newPasskeyTest(t)
+	a := webauthntest.NewAuthenticator()
+	_, err := registerPasskey(t, a, &domains.PublicUser{ID: 4})
+	assert.Nil(t, err)
+
+	options, err := PasskeyService.StartLogin(domains.PasskeyLoginStartRequest{})
+	assert.Nil(t, err)
+	_, err = PasskeyService.FinishLogin(passkeyAssertion(a, options.Challenge), domains.Device{})
+	assert.Nil(t, err)
+	_, err = PasskeyService.FinishLogin(passkeyAssertion(a, options.Challenge), domains.Device{})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.InvalidPasskeyErrorMessage, err.Message())
+}
+
+func TestPasskeyLoginOfOtherUser(t *testing.T) {
+	newPasskeyTest(t)
+	a := webauthntest.NewAuthenticator()
+	_, err := registerPasskey(t, a, &domains.PublicUser{ID: 4})
+	assert.Nil(t, err)
+	_, err = registerPasskey(t, webauthntest.NewAuthenticator(), &domains.PublicUser{ID: 5})
+	assert.Nil(t, err)
+
+	getUserByUsernameFunc = func(username string) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{ID: 5, Username: username}, nil
+	}
+	repositories.UserRepository = &UserRespositoryMock{}
+	options, err := PasskeyService.StartLogin(domains.PasskeyLoginStartRequest{PhoneOrUsername: "reza"})
+	assert.Nil(t, err)
+
+	_, err = PasskeyService.FinishLogin(passkeyAssertion(a, options.Challenge), domains.Device{})
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, err.Status())
+}
+
+func TestPasskeyLoginClonedAuthenticator(t *testing.T) {
+	newPasskeyTest(t)
+	a := webauthntest.NewAuthenticator()
+	_, err := registerPasskey(t, a, &domains.PublicUser{ID: 4})
+	assert.Nil(t, err)
+	options, _ := PasskeyService.StartLogin(domains.PasskeyLoginStartRequest{})
+	_, err = PasskeyService.FinishLogin(passkeyAssertion(a, options.Challenge), domains.Device{})
+	assert.Nil(t, err)
+
+	a.SignCount = 0
+	options, _ = PasskeyService.StartLogin(domains.PasskeyLoginStartRequest{})
+	_, err = PasskeyService.FinishLogin(passkeyAssertion(a, options.Challenge), domains.Device{})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.InvalidPasskeyErrorMessage, err.Message())
+}
+
+func TestPasskeyRegisteredTwice(t *testing.T) {
+	newPasskeyTest(t)
+	a := webauthntest.NewAuthenticator()
+	_, err := registerPasskey(t, a, &domains.PublicUser{ID: 4})
+	assert.Nil(t, err)
+
+	_, err = registerPasskey(t, a, &domains.PublicUser{ID: 4})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.PasskeyAlreadyRegisteredErrorMessage, err.Message())
+}
+
+func TestPasskeyRegistrationChallengeOfOtherUser(t *testing.T) {
+	newPasskeyTest(t)
+	a := webauthntest.NewAuthenticator()
+	options, err := PasskeyService.StartRegistration(&domains.PublicUser{ID: 4})
+	assert.Nil(t, err)
+	clientData, attestation := a.Create(testRPID, testOrigin, options.Challenge)
+
+	_, err = PasskeyService.FinishRegistration(5, domains.PasskeyRegistrationRequest{
+		ID: webauthntest.Base64(a.ID),
+		Response: domains.PasskeyAttestationResponse{
+			ClientDataJSON:    webauthntest.Base64(clientData),
+			AttestationObject: webauthntest.Base64(attestation),
+		},
+	}, domains.Actor{UserID: 5})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.InvalidPasskeyErrorMessage, err.Message())
+}
+
+func TestDeletePasskey(t *testing.T) {
+	newPasskeyTest(t)
+	passkey, err := registerPasskey(t, webauthntest.NewAuthenticator(), &domains.PublicUser{ID: 4})
+	assert.Nil(t, err)
+
+	err = PasskeyService.Delete(5, passkey.ID, domains.Actor{UserID: 5})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.PasskeyNotFoundErrorMessage, err.Message())
+	assert.Nil(t, PasskeyService.Delete(4, passkey.ID, domains.Actor{UserID: 4}))
+	passkeys, err := PasskeyService.List(4)
+	assert.Nil(t, err)
+	assert.Empty(t, passkeys)
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+)
+
+const (
+	// SessionTTL is how long a login lasts, it is the lifetime of its token
+	SessionTTL = AccessTokenTTL
+
+	// sessionTouchInterval limits how often last seen time of a session is written
+	sessionTouchInterval = time.Minute
+	maxUserAgentLength   = 512
+)
+
+var (
+	SessionService sessionServiceInterface = &sessionService{}
+
+	// browsers and systems recognized in user agents, checked in order since user agents name several
+	userAgentBrowsers = []struct{ token, name string }{
+		{"Edg", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"}, {"FxiOS/", "Firefox"},
+		{"CriOS/", "Chrome"}, {"Chrome/", "Chrome"}, {"Safari/", "Safari"},
+	}
+	userAgentSystems = []struct{ token, name string }{
+		{"Android", "Android"}, {"iPhone", "iOS"}, {"iPad", "iOS"}, {"Windows", "Windows"},
+		{"Mac OS X", "macOS"}, {"Linux", "Linux"},
+	}
+)
+
+type sessionServiceInterface interface {
+	Start(userID uint, device domains.Device) (*domains.LoginResponse, rest_errors.RestErr)
+	Check(userID, id uint) rest_errors.RestErr
+	List(userID, currentID uint) ([]domains.Session, rest_errors.RestErr)
+	Revoke(userID, id uint, actor domains.Actor) rest_errors.RestErr
+	RevokeAll(userID uint, actor domains.Actor) (*domains.RevokeSessionsResponse, rest_errors.RestErr)
+	RevokeOthers(userID, currentID uint, actor domains.Actor) (*domains.RevokeSessionsResponse, rest_errors.RestErr)
+}
+
+type sessionService struct{}
+
+// Start records a login of user on device and returns its token
+func (*sessionService) Start(userID uint, device domains.Device) (*domains.LoginResponse, rest_errors.RestErr) {
+	now := time.Now()
+	userAgent := device.UserAgent
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	session := &domains.Session{
+		UserID:     userID,
+		UserAgent:  userAgent,
+		Device:     deviceName(device.UserAgent),
+		IP:         device.IP,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(SessionTTL),
+	}
+	if err := repositories.SessionRepository.CreateSession(session); err != nil {
+		return nil, err
+	}
+	claims := accessTokenClaims(strconv.FormatUint(uint64(userID), 10), "", "", now)
+	claims["sid"] = strconv.FormatUint(uint64(session.ID), 10)
+	token, err := JwtService.GenerateJwtToken(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &domains.LoginResponse{Token: token}, nil
+}
+
+// Check makes sure session of user is live and remembers it was seen
+func (*sessionService) Check(userID, id uint) rest_errors.RestErr {
+	session, err := repositories.SessionRepository.GetSession(id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if session == nil || session.UserID != userID || session.RevokedAt != nil || now.After(session.ExpiresAt) {
+		return errors.NewUnauthorizedError(errors.InvalidToken)
+	}
+	if now.Sub(session.LastSeenAt) > sessionTouchInterval {
+		return repositories.SessionRepository.TouchSession(id, now)
+	}
+	return nil
+}
+
+// List returns live sessions of user, currentID is marked as the session asking
+func (*sessionService) List(userID, currentID uint) ([]domains.Session, rest_errors.RestErr) {
+	sessions, err := repositories.SessionRepository.GetSessionsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = currentID != 0 && sessions[i].ID == currentID
+	}
+	return sessions, nil
+}
+
+// Revoke logs user out of session, its token stops working
+func (*sessionService) Revoke(userID, id uint, actor domains.Actor) rest_errors.RestErr {
+	audit := actor.Audit(AuditSessionRevoked, userID, domains.AuditChanges{"session_id": {After: id}})
+	revoked, err := repositories.SessionRepository.RevokeSession(userID, id, audit)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return errors.NewNotFoundError(errors.SessionNotFound)
+	}
+	return nil
+}
+
+// RevokeAll logs user out everywhere
+func (*sessionService) RevokeAll(userID uint, actor domains.Actor) (*domains.RevokeSessionsResponse, rest_errors.RestErr) {
+	return revokeSessions(userID, 0, actor)
+}
+
+// RevokeOthers logs user out everywhere but session currentID
+func (*sessionService) RevokeOthers(userID, currentID uint, actor domains.Actor) (*domains.RevokeSessionsResponse, rest_errors.RestErr) {
+	return revokeSessions(userID, currentID, actor)
+}
+
+func revokeSessions(userID, exceptID uint, actor domains.Actor) (*domains.RevokeSessionsResponse, rest_errors.RestErr) {
+	revoked, err := repositories.SessionRepository.RevokeSessions(userID, exceptID, actor.Audit(AuditSessionsRevoked, userID, nil))
+	if err != nil {
+		return nil, err
+	}
+	return &domains.RevokeSessionsResponse{Revoked: revoked}, nil
+}
+
+// deviceName summarizes userAgent as browser and system, e.g. "Chrome on Android".
+// Other clients are named by first product of their user agent, e.g. "okhttp"
+func deviceName(userAgent string) string {
+	var browser, system string
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, s := range userAgentSystems {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	fields := strings.Fields(userAgent)
+	if len(fields) == 0 {
+		return ""
+	}
+	product := strings.SplitN(fields[0], "/", 2)[0]
+	if len(product) > 64 {
+		product = product[:64]
+	}
+	return product
+}
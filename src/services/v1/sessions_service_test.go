@@ -0,0 +1,197 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+// SessionRepositoryMock keeps sessions and audit entries of revoking them in memory
+type SessionRepositoryMock struct {
+	sessions []*domains.Session
+	audits   []*domains.AuditEntry
+}
+
+func (m *SessionRepositoryMock) CreateSession(session *domains.Session) rest_errors.RestErr {
+	session.ID = uint(len(m.sessions) + 1)
+	m.sessions = append(m.sessions, session)
+	return nil
+}
+
+func (m *SessionRepositoryMock) GetSession(id uint) (*domains.Session, rest_errors.RestErr) {
+	if id == 0 || int(id) > len(m.sessions) {
+		return nil, nil
+	}
+	session := *m.sessions[id-1]
+	return &session, nil
+}
+
+func (m *SessionRepositoryMock) GetSessionsByUserID(userID uint) ([]domains.Session, rest_errors.RestErr) {
+	sessions := []domains.Session{}
+	for _, session := range m.sessions {
+		if session.UserID == userID && m.live(session) {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *SessionRepositoryMock) TouchSession(id uint, at time.Time) rest_errors.RestErr {
+	m.sessions[id-1].LastSeenAt = at
+	return nil
+}
+
+func (m *SessionRepositoryMock) RevokeSession(userID, id uint, audit *domains.AuditEntry) (bool, rest_errors.RestErr) {
+	for _, session := range m.sessions {
+		if session.ID == id && session.UserID == userID && m.live(session) {
+			now := time.Now()
+			session.RevokedAt = &now
+			m.audits = append(m.audits, audit)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *SessionRepositoryMock) RevokeSessions(userID, exceptID uint, audit *domains.AuditEntry) (int64, rest_errors.RestErr) {
+	var revoked int64
+	for _, session := range m.sessions {
+		if session.UserID == userID && session.ID != exceptID && m.live(session) {
+			now := time.Now()
+			session.RevokedAt = &now
+			revoked++
+		}
+	}
+	if revoked > 0 {
+		m.audits = append(m.audits, audit)
+	}
+	return revoked, nil
+}
+
+func (m *SessionRepositoryMock) live(session *domains.Session) bool {
+	return session.RevokedAt == nil && time.Now().Before(session.ExpiresAt)
+}
+
+// newSessionTest keeps sessions in memory and makes tokens carrying their claims
+func newSessionTest() *SessionRepositoryMock {
+	repo := &SessionRepositoryMock{}
+	repositories.SessionRepository = repo
+	generateJwtFunc = func(data jwt.MapClaims) (string, rest_errors.RestErr) {
+		return "token-of-" + data["sub"].(string) + "-" + data["sid"].(string), nil
+	}
+	JwtService = &JwtServiceMock{}
+	return repo
+}
+
+func TestStartSession(t *testing.T) {
+	repo := newSessionTest()
+
+	res, err := SessionService.Start(4, domains.Device{
+		UserAgent: "Mozilla/5.0 (Linux; Android 13; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Mobile Safari/537.36",
+		IP:        "192.0.2.10",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "token-of-4-1", res.Token)
+	session := repo.sessions[0]
+	assert.EqualValues(t, 4, session.UserID)
+	assert.Equal(t, "Chrome on Android", session.Device)
+	assert.Equal(t, "192.0.2.10", session.IP)
+	assert.WithinDuration(t, time.Now().Add(SessionTTL), session.ExpiresAt, time.Minute)
+}
+
+func TestCheckSession(t *testing.T) {
+	repo := newSessionTest()
+	_, err := SessionService.Start(4, domains.Device{})
+	assert.Nil(t, err)
+
+	assert.Nil(t, SessionService.Check(4, 1))
+	err = SessionService.Check(5, 1)
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.InvalidTokenErrorMessage, err.Message())
+	err = SessionService.Check(4, 2)
+	assert.NotNil(t, err)
+
+	repo.sessions[0].LastSeenAt = time.Now().Add(-time.Hour)
+	assert.Nil(t, SessionService.Check(4, 1))
+	assert.WithinDuration(t, time.Now(), repo.sessions[0].LastSeenAt, time.Minute)
+
+	repo.sessions[0].ExpiresAt = time.Now().Add(-time.Second)
+	assert.NotNil(t, SessionService.Check(4, 1))
+}
+
+func TestRevokeSession(t *testing.T) {
+	repo := newSessionTest()
+	for i := 0; i < 2; i++ {
+		_, err := SessionService.Start(4, domains.Device{})
+		assert.Nil(t, err)
+	}
+
+	sessions, err := SessionService.List(4, 2)
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 2)
+	assert.False(t, sessions[0].Current)
+	assert.True(t, sessions[1].Current)
+
+	admin := domains.Actor{UserID: 1, IP: "10.0.0.1", RequestID: "req-1"}
+	err = SessionService.Revoke(5, 1, admin)
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.SessionNotFoundErrorMessage, err.Message())
+	assert.Empty(t, repo.audits)
+	assert.Nil(t, SessionService.Revoke(4, 1, admin))
+	assert.NotNil(t, SessionService.Check(4, 1))
+	assert.Nil(t, SessionService.Check(4, 2))
+	assert.Len(t, repo.audits, 1)
+	assert.Equal(t, AuditSessionRevoked, repo.audits[0].Action)
+	assert.EqualValues(t, 1, *repo.audits[0].ActorID)
+	assert.EqualValues(t, 4, *repo.audits[0].TargetID)
+	assert.Equal(t, "10.0.0.1", repo.audits[0].IP)
+	assert.Equal(t, "req-1", repo.audits[0].RequestID)
+
+	res, err := SessionService.RevokeAll(4, domains.Actor{UserID: 4})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, res.Revoked)
+	assert.NotNil(t, SessionService.Check(4, 2))
+	assert.Len(t, repo.audits, 2)
+	assert.Equal(t, AuditSessionsRevoked, repo.audits[1].Action)
+}
+
+func TestGetUserOfRevokedSession(t *testing.T) {
+	newSessionTest()
+	_, err := SessionService.Start(1, domains.Device{})
+	assert.Nil(t, err)
+	verifyJwtFunc = func(token string) (*domains.Jwt, rest_errors.RestErr) {
+		return &domains.Jwt{Sub: "1", SessionID: 1}, nil
+	}
+	getUserFunc = func(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{ID: id, Active: true}, nil
+	}
+	repositories.UserRepository = &UserRespositoryMock{}
+
+	user, err := UserService.GetUser("token")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, user.SessionID)
+
+	assert.Nil(t, SessionService.Revoke(1, 1, domains.Actor{UserID: 1}))
+	user, err = UserService.GetUser("token")
+	assert.Nil(t, user)
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.InvalidTokenErrorMessage, err.Message())
+}
+
+func TestDeviceName(t *testing.T) {
+	for userAgent, device := range map[string]string{
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1": "Safari on iOS",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36 Edg/118.0.2088.46":       "Edge on Windows",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/118.0":                                                                  "Firefox on Linux",
+		"okhttp/4.11.0": "okhttp",
+		"":              "",
+	} {
+		assert.Equal(t, device, deviceName(userAgent), userAgent)
+	}
+}
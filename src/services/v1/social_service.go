@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/crypto"
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+	"github.com/alidevjimmy/user_microservice_t/utils/oidc"
+	"github.com/alidevjimmy/user_microservice_t/utils/phone"
+)
+
+const (
+	// envSocialProviders is comma separated names of providers, each configured by
+	// SOCIAL_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET and optionally _REDIRECT_URI and _SCOPES
+	envSocialProviders = "SOCIAL_PROVIDERS"
+
+	SocialLoginStateTTL = 10 * time.Minute
+	socialTimeout       = 10 * time.Second
+)
+
+var (
+	SocialService socialServiceInterface = &socialService{}
+
+	// socialProviders are providers users may sign in with, by name
+	socialProviders = map[string]*oidc.Provider{}
+)
+
+type socialServiceInterface interface {
+	Providers() []string
+	Start(provider string, linkUserID uint) (*domains.SocialLoginResponse, rest_errors.RestErr)
+	Callback(provider string, req domains.SocialCallbackRequest, device domains.Device) (*domains.LoginResponse, rest_errors.RestErr)
+	Identities(userID uint) ([]domains.Identity, rest_errors.RestErr)
+	Unlink(userID uint, provider string, actor domains.Actor) rest_errors.RestErr
+}
+
+type socialService struct{}
+
+// RegisterSocialProvider lets users sign in with provider name
+func RegisterSocialProvider(name string, config oidc.Config) {
+	socialProviders[name] = oidc.NewProvider(config, nil)
+}
+
+// LoadSocialProviders registers providers configured by environment, see envSocialProviders
+func LoadSocialProviders() error {
+	for _, name := range strings.Split(os.Getenv(envSocialProviders), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		env := func(key string) string {
+			return os.Getenv("SOCIAL_" + strings.ToUpper(name) + "_" + key)
+		}
+		config := oidc.Config{
+			Issuer:       env("ISSUER"),
+			ClientID:     env("CLIENT_ID"),
+			ClientSecret: env("CLIENT_SECRET"),
+			RedirectURI:  env("REDIRECT_URI"),
+			Scopes:       strings.Fields(env("SCOPES")),
+		}
+		if config.Issuer == "" || config.ClientID == "" {
+			return fmt.Errorf("social: issuer and client id of %s are required", name)
+		}
+		if config.RedirectURI == "" {
+			config.RedirectURI = Issuer() + "/v1/social/" + name + "/callback"
+		}
+		RegisterSocialProvider(name, config)
+	}
+	return nil
+}
+
+// Providers lists names of providers sorted
+func (*socialService) Providers() []string {
+	names := make([]string, 0, len(socialProviders))
+	for name := range socialProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Start begins sign in at provider, linkUserID is the signed in user linking a new identity or zero
+func (*socialService) Start(provider string, linkUserID uint) (*domains.SocialLoginResponse, rest_errors.RestErr) {
+	p, ok := socialProviders[provider]
+	if !ok {
+		return nil, errors.NewNotFoundError(errors.UnknownProvider)
+	}
+	var values [3]string
+	for i := range values {
+		v, err := oidc.RandomString()
+		if err != nil {
+			return nil, errors.NewInternalServerError(err)
+		}
+		values[i] = v
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+	ctx, cancel := context.WithTimeout(context.Background(), socialTimeout)
+	defer cancel()
+	authURL, urlErr := p.AuthCodeURL(ctx, state, nonce, oidc.CodeChallengeS256(verifier))
+	if urlErr != nil {
+		return nil, errors.NewInternalServerError(urlErr)
+	}
+	err := repositories.IdentityRepository.CreateSocialLoginState(&domains.SocialLoginState{
+		StateHash:    crypto.GenerateSha256(state),
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(SocialLoginStateTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &domains.SocialLoginResponse{RedirectTo: authURL}, nil
+}
+
+// Callback finishes sign in at provider and returns a token of user owning the identity.
+// Identities nobody linked are linked to the account having the same verified phone number
+func (*socialService) Callback(provider string, req domains.SocialCallbackRequest, device domains.Device) (*domains.LoginResponse, rest_errors.RestErr) {
+	p, ok := socialProviders[provider]
+	if !ok {
+		return nil, errors.NewNotFoundError(errors.UnknownProvider)
+	}
+	state, err := repositories.IdentityRepository.ConsumeSocialLoginState(crypto.GenerateSha256(req.State))
+	if err != nil {
+		return nil, err
+	}
+	if state == nil || state.Provider != provider {
+		return nil, errors.NewBadRequestError(errors.InvalidState)
+	}
+	if req.Error != "" || req.Code == "" {
+		return nil, errors.NewUnauthorizedError(errors.SocialLoginFailed)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), socialTimeout)
+	defer cancel()
+	claims, exErr := p.Exchange(ctx, req.Code, state.CodeVerifier, state.Nonce)
+	if exErr != nil {
+		return nil, errors.NewUnauthorizedError(errors.SocialLoginFailed)
+	}
+
+	identity, err := repositories.IdentityRepository.GetIdentity(provider, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	var userID uint
+	switch {
+	case state.LinkUserID != 0:
+		if identity != nil && identity.UserID != state.LinkUserID {
+			return nil, errors.NewBadRequestError(errors.IdentityAlreadyLinked)
+		}
+		userID = state.LinkUserID
+	case identity != nil:
+		userID = identity.UserID
+	default:
+		user, err := userByVerifiedPhone(claims)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, errors.NewNotFoundError(errors.IdentityNotLinked)
+		}
+		userID = user.ID
+	}
+	if err := checkAccountOf(userID, AccountUseSession); err != nil {
+		return nil, err
+	}
+	if identity == nil {
+		// identity is linked by the user signing in with it
+		actor := domains.Actor{UserID: userID, IP: device.IP, RequestID: device.RequestID}
+		audit := actor.Audit(AuditIdentityLinked, userID, domains.AuditChanges{
+			"provider": {After: provider},
+			"subject":  {After: claims.Subject},
+		})
+		err := repositories.IdentityRepository.CreateIdentity(&domains.Identity{
+			UserID:   userID,
+			Provider: provider,
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		}, audit)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return SessionService.Start(userID, device)
+}
+
+// Identities lists identities linked to user
+func (*socialService) Identities(userID uint) ([]domains.Identity, rest_errors.RestErr) {
+	return repositories.IdentityRepository.GetIdentitiesByUserID(userID)
+}
+
+// Unlink removes identities of provider from user
+func (*socialService) Unlink(userID uint, provider string, actor domains.Actor) rest_errors.RestErr {
+	audit := actor.Audit(AuditIdentityUnlinked, userID, domains.AuditChanges{"provider": {Before: provider}})
+	deleted, err := repositories.IdentityRepository.DeleteIdentity(userID, provider, audit)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return errors.NewNotFoundError(errors.IdentityNotFound)
+	}
+	return nil
+}
+
+// userByVerifiedPhone finds the active account whose phone provider verified, nil if there is none
+func userByVerifiedPhone(claims *oidc.Claims) (*domains.PublicUser, rest_errors.RestErr) {
+	if !claims.PhoneNumberVerified || claims.PhoneNumber == "" {
+		return nil, nil
+	}
+	p, normErr := phone.Normalize(claims.PhoneNumber)
+	if normErr != nil {
+		return nil, nil
+	}
+	user, err := repositories.UserRepository.GetUserByPhone(p)
+	if err != nil {
+		return nil, err
+	}
+	// phones of inactive users are not verified by us yet
+	if user == nil || !user.Active {
+		return nil, nil
+	}
+	return user, nil
+}
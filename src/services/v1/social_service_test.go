@@ -0,0 +1,218 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+	"github.com/alidevjimmy/user_microservice_t/utils/oidc"
+	"github.com/alidevjimmy/user_microservice_t/utils/oidc/oidctest"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSocialCallback = "http://localhost:8080/v1/social/mock/callback"
+
+// IdentityRepositoryMock keeps identities and states in memory
+type IdentityRepositoryMock struct {
+	identities []domains.Identity
+	states     map[string]*domains.SocialLoginState
+}
+
+func (m *IdentityRepositoryMock) GetIdentity(provider, subject string) (*domains.Identity, rest_errors.RestErr) {
+	for i := range m.identities {
+		if m.identities[i].Provider == provider && m.identities[i].Subject == subject {
+			return &m.identities[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *IdentityRepositoryMock) GetIdentitiesByUserID(userID uint) ([]domains.Identity, rest_errors.RestErr) {
+	identities := []domains.Identity{}
+	for _, identity := range m.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func (m *IdentityRepositoryMock) CreateIdentity(identity *domains.Identity, audit *domains.AuditEntry) rest_errors.RestErr {
+	m.identities = append(m.identities, *identity)
+	return nil
+}
+
+func (m *IdentityRepositoryMock) DeleteIdentity(userID uint, provider string, audit *domains.AuditEntry) (bool, rest_errors.RestErr) {
+	kept := m.identities[:0]
+	for _, identity := range m.identities {
+		if identity.UserID != userID || identity.Provider != provider {
+			kept = append(kept, identity)
+		}
+	}
+	deleted := len(kept) != len(m.identities)
+	m.identities = kept
+	return deleted, nil
+}
+
+func (m *IdentityRepositoryMock) CreateSocialLoginState(state *domains.SocialLoginState) rest_errors.RestErr {
+	m.states[state.StateHash] = state
+	return nil
+}
+
+func (m *IdentityRepositoryMock) ConsumeSocialLoginState(stateHash string) (*domains.SocialLoginState, rest_errors.RestErr) {
+	state := m.states[stateHash]
+	delete(m.states, stateHash)
+	return state, nil
+}
+
+// newSocialTest registers mock provider and returns it with the repository identities are kept in
+func newSocialTest(t *testing.T) (*oidctest.Provider, *IdentityRepositoryMock) {
+	op := oidctest.NewProvider()
+	t.Cleanup(op.Close)
+	RegisterSocialProvider("mock", op.Config(testSocialCallback))
+	t.Cleanup(func() { delete(socialProviders, "mock") })
+
+	repo := &IdentityRepositoryMock{states: map[string]*domains.SocialLoginState{}}
+	repositories.IdentityRepository = repo
+	repositories.SessionRepository = &SessionRepositoryMock{}
+	repositories.UserRepository = &UserRespositoryMock{}
+	getUserFunc = func(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{ID: id, Active: true}, nil
+	}
+	generateJwtFunc = func(data jwt.MapClaims) (string, rest_errors.RestErr) {
+		return "token-of-" + data["sub"].(string), nil
+	}
+	JwtService = &JwtServiceMock{}
+	return op, repo
+}
+
+// signInAt runs the browser part of the flow and returns what provider sent back
+func signInAt(t *testing.T, op *oidctest.Provider, linkUserID uint) domains.SocialCallbackRequest {
+	res, err := SocialService.Start("mock", linkUserID)
+	assert.Nil(t, err)
+	q, getErr := op.Callback(res.RedirectTo)
+	assert.Nil(t, getErr)
+	return domains.SocialCallbackRequest{Code: q.Get("code"), State: q.Get("state")}
+}
+
+func TestSocialStartUnknownProvider(t *testing.T) {
+	res, err := SocialService.Start("unknown", 0)
+	assert.Nil(t, res)
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.UnknownProviderErrorMessage, err.Message())
+}
+
+func TestSocialLoginLinkedIdentity(t *testing.T) {
+	op, repo := newSocialTest(t)
+	repo.identities = []domains.Identity{{UserID: 7, Provider: "mock", Subject: "google-7"}}
+	op.SignIn(oidc.Claims{Subject: "google-7"})
+
+	res, err := SocialService.Callback("mock", signInAt(t, op, 0), domains.Device{})
+	assert.Nil(t, err)
+	assert.Equal(t, "token-of-7", res.Token)
+}
+
+func TestSocialLoginOfBlockedUser(t *testing.T) {
+	op, repo := newSocialTest(t)
+	repo.identities = []domains.Identity{{UserID: 7, Provider: "mock", Subject: "google-7"}}
+	op.SignIn(oidc.Claims{Subject: "google-7"})
+	getUserFunc = func(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{ID: id, Active: true, Blocked: true}, nil
+	}
+
+	_, err := SocialService.Callback("mock", signInAt(t, op, 0), domains.Device{})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.AccountBlockedErrorMessage, err.Message())
+}
+
+func TestSocialLoginStateIsSingleUse(t *testing.T) {
+	op, repo := newSocialTest(t)
+	repo.identities = []domains.Identity{{UserID: 7, Provider: "mock", Subject: "google-7"}}
+	op.SignIn(oidc.Claims{Subject: "google-7"})
+
+	req := signInAt(t, op, 0)
+	_, err := SocialService.Callback("mock", req, domains.Device{})
+	assert.Nil(t, err)
+	_, err = SocialService.Callback("mock", req, domains.Device{})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.InvalidStateErrorMessage, err.Message())
+}
+
+func TestSocialLoginProviderError(t *testing.T) {
+	op, _ := newSocialTest(t)
+
+	req := signInAt(t, op, 0)
+	req.Code, req.Error = "", "access_denied"
+	_, err := SocialService.Callback("mock", req, domains.Device{})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.SocialLoginFailedErrorMessage, err.Message())
+}
+
+func TestSocialLoginUnlinkedIdentity(t *testing.T) {
+	op, repo := newSocialTest(t)
+	op.SignIn(oidc.Claims{Subject: "google-8", Email: "new@example.com"})
+
+	_, err := SocialService.Callback("mock", signInAt(t, op, 0), domains.Device{})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.IdentityNotLinkedErrorMessage, err.Message())
+	assert.Empty(t, repo.identities)
+}
+
+func TestSocialLoginLinksVerifiedPhone(t *testing.T) {
+	op, repo := newSocialTest(t)
+	op.SignIn(oidc.Claims{Subject: "google-9", PhoneNumber: "+98 912 123 4567", PhoneNumberVerified: true})
+	getUserByPhoneFunc = func(phone string) (*domains.PublicUser, rest_errors.RestErr) {
+		assert.Equal(t, "+989121234567", phone)
+		return &domains.PublicUser{ID: 9, Phone: phone, Active: true}, nil
+	}
+	repositories.UserRepository = &UserRespositoryMock{}
+
+	res, err := SocialService.Callback("mock", signInAt(t, op, 0), domains.Device{})
+	assert.Nil(t, err)
+	assert.Equal(t, "token-of-9", res.Token)
+	assert.Equal(t, []domains.Identity{{UserID: 9, Provider: "mock", Subject: "google-9"}}, repo.identities)
+}
+
+func TestSocialLoginDoesNotLinkInactiveAccount(t *testing.T) {
+	op, repo := newSocialTest(t)
+	op.SignIn(oidc.Claims{Subject: "google-9", PhoneNumber: "09121234567", PhoneNumberVerified: true})
+	getUserByPhoneFunc = func(phone string) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{ID: 9, Phone: phone, Active: false}, nil
+	}
+	repositories.UserRepository = &UserRespositoryMock{}
+
+	_, err := SocialService.Callback("mock", signInAt(t, op, 0), domains.Device{})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.IdentityNotLinkedErrorMessage, err.Message())
+	assert.Empty(t, repo.identities)
+}
+
+func TestSocialLinkIdentity(t *testing.T) {
+	op, _ := newSocialTest(t)
+	op.SignIn(oidc.Claims{Subject: "google-3", Email: "ali@example.com"})
+
+	res, err := SocialService.Callback("mock", signInAt(t, op, 3), domains.Device{})
+	assert.Nil(t, err)
+	assert.Equal(t, "token-of-3", res.Token)
+	identities, err := SocialService.Identities(3)
+	assert.Nil(t, err)
+	assert.Equal(t, []domains.Identity{{UserID: 3, Provider: "mock", Subject: "google-3", Email: "ali@example.com"}}, identities)
+
+	assert.Nil(t, SocialService.Unlink(3, "mock", domains.Actor{UserID: 3}))
+	err = SocialService.Unlink(3, "mock", domains.Actor{UserID: 3})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.IdentityNotFoundErrorMessage, err.Message())
+}
+
+func TestSocialLinkIdentityOfOtherUser(t *testing.T) {
+	op, repo := newSocialTest(t)
+	repo.identities = []domains.Identity{{UserID: 7, Provider: "mock", Subject: "google-7"}}
+	op.SignIn(oidc.Claims{Subject: "google-7"})
+
+	_, err := SocialService.Callback("mock", signInAt(t, op, 3), domains.Device{})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.IdentityAlreadyLinkedErrorMessage, err.Message())
+}
@@ -1,69 +1,644 @@
 package services
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
 	"github.com/alidevjimmy/go-rest-utils/rest_errors"
 	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+	"github.com/alidevjimmy/user_microservice_t/utils/persian"
+	"github.com/alidevjimmy/user_microservice_t/utils/phone"
+	"github.com/alidevjimmy/user_microservice_t/validators/v1"
 )
 
 var (
 	UserService userServiceInterface = &userService{}
 )
 
+const (
+	// envConfirmOldPhone set to true makes phone changes confirmed by a code sent to the old phone as well
+	envConfirmOldPhone = "PHONE_CHANGE_CONFIRM_OLD"
+
+	DefaultUsersPageSize = 20
+	MaxUsersByIDs        = 100
+
+	// envDeletionGracePeriod is how long deleted accounts may be restored by logging in, e.g. 720h
+	envDeletionGracePeriod     = "ACCOUNT_DELETION_GRACE_PERIOD"
+	DefaultDeletionGracePeriod = 30 * 24 * time.Hour
+	AccountPurgeInterval       = time.Hour
+	accountPurgeBatchSize      = 100
+
+	BlockExpiryInterval  = time.Minute
+	blockExpiryBatchSize = 100
+	// blockExpiredReason is the reason audit log gives for blocks lifted by RunBlockExpiry
+	blockExpiredReason = "block expired"
+)
+
 type userServiceInterface interface {
 	Register(body domains.RegisterRequest) (*domains.RegisterResponse, rest_errors.RestErr)
-	Login(body domains.LoginRequest) (*domains.LoginResponse, rest_errors.RestErr)
+	Login(body domains.LoginRequest, device domains.Device) (*domains.LoginResponse, rest_errors.RestErr)
 	GetUser(token string) (*domains.PublicUser, rest_errors.RestErr)
-	GetUsers(params domains.GetUsersRequest) ([]domains.PublicUser, rest_errors.RestErr)
-	UpdateUserActiveState(userId uint) (*domains.PublicUser, rest_errors.RestErr)
-	UpdateUserBlockState(userId uint) (*domains.PublicUser, rest_errors.RestErr)
-	UpdateUser(userId, token string, body domains.UpdateUserRequest) (*domains.PublicUser, rest_errors.RestErr)
-	ChangeForgotPassword(body domains.ChangePasswordRequest) (*domains.PublicUser, rest_errors.RestErr)
-	VerifyUser(body domains.VerifyUserRequest) (*domains.PublicUser, rest_errors.RestErr)
+	GetUserByID(id uint) (*domains.PublicUser, rest_errors.RestErr)
+	GetUsersByIDs(ids []uint) ([]domains.PublicUser, rest_errors.RestErr)
+	GetUsers(params domains.GetUsersRequest) (*domains.GetUsersResponse, rest_errors.RestErr)
+	SearchUsers(params domains.SearchUsersRequest) ([]domains.PublicUser, rest_errors.RestErr)
+	SetActiveState(userId uint, versions domains.Versions, active bool, reason string, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr)
+	Block(userId uint, versions domains.Versions, req domains.BlockUserRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr)
+	Unblock(userId uint, versions domains.Versions, reason string, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr)
+	LiftExpiredBlocks() (int, rest_errors.RestErr)
+	DeleteAccount(user *domains.PublicUser, body domains.DeleteAccountRequest, actor domains.Actor) (*domains.DeleteAccountResponse, rest_errors.RestErr)
+	PurgeDeletedAccounts() (int, rest_errors.RestErr)
+	UpdateUser(caller *domains.PublicUser, userId string, versions domains.Versions, body domains.UpdateUserRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr)
+	ChangeForgotPassword(body domains.ChangePasswordRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr)
+	UpdatePassword(user *domains.PublicUser, body domains.UpdatePasswordRequest, actor domains.Actor) rest_errors.RestErr
+	VerifyUser(body domains.VerifyUserRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr)
+	StartPhoneChange(user *domains.PublicUser, body domains.ChangePhoneRequest) rest_errors.RestErr
+	ChangePhone(user *domains.PublicUser, body domains.ConfirmPhoneChangeRequest, actor domains.Actor, device domains.Device) (*domains.LoginResponse, rest_errors.RestErr)
 }
 
 type userService struct{}
 
 func (*userService) Register(body domains.RegisterRequest) (*domains.RegisterResponse, rest_errors.RestErr) {
+	p, err := NormalizePhone(body.Phone)
+	if err != nil {
+		return nil, err
+	}
+	body.Phone = p
+	if err := checkUsername(body.Username, 0); err != nil {
+		return nil, err
+	}
 	return nil, nil
 }
 
-func (*userService) Login(body domains.LoginRequest) (*domains.LoginResponse, rest_errors.RestErr) {
-	return nil, nil
+// Login checks credentials and returns an access token of user. Wrong passwords are counted,
+// MaxFailedLogins of them lock the user. Accounts deleted in grace period are restored
+func (*userService) Login(body domains.LoginRequest, device domains.Device) (*domains.LoginResponse, rest_errors.RestErr) {
+	if body.PhoneOrUsername == "" {
+		return nil, errors.NewBadRequestError(errors.PhoneOrUsernameRequired)
+	}
+	if body.Password == "" {
+		return nil, errors.NewBadRequestError(errors.PasswordIsRequired)
+	}
+	body.PhoneOrUsername = phone.NormalizeOrKeep(body.PhoneOrUsername)
+	user, err := repositories.UserRepository.GetUserByPhoneOrUsernameAndPassword(body.PhoneOrUsername, body.Password)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		// logging in within grace period undoes deleting account
+		audit := domains.Actor{IP: device.IP, RequestID: device.RequestID}.Audit(AuditUserRestored, 0, nil)
+		user, err = repositories.UserRepository.RestoreUser(body.PhoneOrUsername, body.Password, time.Now().Add(-deletionGracePeriod()), audit)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if user == nil {
+		lockedUntil, err := repositories.UserRepository.RecordFailedLogin(body.PhoneOrUsername, MaxFailedLogins, LoginLockDuration)
+		if err != nil {
+			return nil, err
+		}
+		if lockedUntil != nil {
+			return nil, errors.NewAccountLockedError(lockedUntil)
+		}
+		return nil, errors.NewUnauthorizedError(errors.InvalidCredentials)
+	}
+	public := user.Public()
+	if err := CheckAccount(&public, AccountUsePassword); err != nil {
+		return nil, err
+	}
+	if user.FailedLogins > 0 {
+		if err := repositories.UserRepository.ResetFailedLogins(user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return SessionService.Start(user.ID, device)
 }
 
-// GetUser returns single user by its jwt token
+// GetUser returns single user by its jwt token, tokens of revoked or expired sessions and of users
+// refused by CheckAccount are refused. Only session tokens of first party login are accepted, access tokens
+// issued to oauth clients are for userinfo and introspection only
 func (*userService) GetUser(token string) (*domains.PublicUser, rest_errors.RestErr) {
-	return nil, nil
+	j, err := JwtService.VerifyJwtToken(token)
+	if err != nil || j == nil || j.ClientID != "" || j.SessionID == 0 {
+		return nil, errors.NewUnauthorizedError(errors.InvalidToken)
+	}
+	id, convErr := strconv.ParseUint(j.Sub, 10, 64)
+	if convErr != nil {
+		return nil, errors.NewUnauthorizedError(errors.InvalidToken)
+	}
+	if err := SessionService.Check(uint(id), j.SessionID); err != nil {
+		return nil, err
+	}
+	user, err := repositories.UserRepository.GetUserByID(uint(id))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.NewNotFoundError(errors.UserNotFound)
+	}
+	if err := CheckAccount(user, AccountUseSession); err != nil {
+		return nil, err
+	}
+	user.SessionID = j.SessionID
+	return user, nil
 }
 
-// GetUsers returns all users by filter
-func (*userService) GetUsers(params domains.GetUsersRequest) ([]domains.PublicUser, rest_errors.RestErr) {
-	return nil, nil
+// GetUserByID returns single user by its id
+func (*userService) GetUserByID(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+	user, err := repositories.UserRepository.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.NewNotFoundError(errors.UserNotFound)
+	}
+	return user, nil
 }
 
-// UpdateUserActiveState makes state of active field of user opposite
-func (*userService) UpdateUserActiveState(userId uint) (*domains.PublicUser, rest_errors.RestErr) {
-	return nil, nil
+// GetUsersByIDs returns users having any of ids, at most MaxUsersByIDs ids are accepted
+func (*userService) GetUsersByIDs(ids []uint) ([]domains.PublicUser, rest_errors.RestErr) {
+	if len(ids) == 0 {
+		return []domains.PublicUser{}, nil
+	}
+	if len(ids) > MaxUsersByIDs {
+		return nil, errors.NewBadRequestError(errors.InvalidInput)
+	}
+	return repositories.UserRepository.GetUsersByIDs(ids)
 }
 
-// UpdateUserBlockState makes state of blocked field of user opposite
-func (*userService) UpdateUserBlockState(userId uint) (*domains.PublicUser, rest_errors.RestErr) {
-	return nil, nil
+// GetUsers returns a page of users by filter with total count of matched users
+func (*userService) GetUsers(params domains.GetUsersRequest) (*domains.GetUsersResponse, rest_errors.RestErr) {
+	if params.CreatedFrom != nil && params.CreatedTo != nil && params.CreatedFrom.After(*params.CreatedTo) {
+		return nil, errors.NewBadRequestError(errors.InvalidCreatedRange)
+	}
+	if params.Limit == 0 {
+		params.Limit = DefaultUsersPageSize
+	}
+	var cursor *domains.UsersCursor
+	if params.Cursor != "" {
+		c, err := DecodeUsersCursor(params.Cursor, params.Sort, params.Order)
+		if err != nil {
+			return nil, err
+		}
+		cursor = c
+	}
+	// one extra row tells whether there is a next page
+	users, err := repositories.UserRepository.GetUsers(params, cursor, params.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+	total, err := repositories.UserRepository.CountUsers(params)
+	if err != nil {
+		return nil, err
+	}
+	res := &domains.GetUsersResponse{Users: users, Total: total}
+	if len(users) > params.Limit {
+		res.Users = users[:params.Limit]
+		res.NextCursor = EncodeUsersCursor(res.Users[params.Limit-1], params.Sort, params.Order)
+	}
+	return res, nil
 }
 
-func (*userService) UpdateUser(userId, token string, body domains.UpdateUserRequest) (*domains.PublicUser, rest_errors.RestErr) {
-	// check token.sub and userId are same
-	return nil, nil
+// SearchUsers finds users by partial name, family, username or phone typed on any keyboard
+func (*userService) SearchUsers(params domains.SearchUsersRequest) ([]domains.PublicUser, rest_errors.RestErr) {
+	query := persian.Normalize(params.Query)
+	if len([]rune(query)) < 2 {
+		return nil, errors.NewBadRequestError(errors.SearchQueryTooShort)
+	}
+	if params.Limit == 0 {
+		params.Limit = DefaultUsersPageSize
+	}
+	return repositories.UserRepository.SearchUsers(query, params.Limit)
+}
+
+// SetActiveState activates or deactivates user, setting the state user is in already changes nothing.
+// Non empty versions are the ones of user the change may be made against, it fails with 412 if user changed since
+func (*userService) SetActiveState(userId uint, versions domains.Versions, active bool, reason string, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
+	audit := actor.Audit(AuditUserActiveState, userId, domains.AuditChanges{"reason": {After: reason}})
+	user, err := repositories.UserRepository.SetActiveState(userId, versions, active, audit)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.NewNotFoundError(errors.UserNotFound)
+	}
+	return user, nil
+}
+
+// Block keeps user from logging in, reason is told to user. Block with Until is lifted by RunBlockExpiry.
+// Non empty versions are checked like SetActiveState does
+func (*userService) Block(userId uint, versions domains.Versions, req domains.BlockUserRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
+	if req.Until != nil {
+		if !req.Until.After(time.Now()) {
+			return nil, errors.NewBadRequestError(errors.BlockExpiryInPast)
+		}
+		// database keeps microseconds, finer times would never equal the stored one
+		until := req.Until.Truncate(time.Microsecond)
+		req.Until = &until
+	}
+	audit := actor.Audit(AuditUserBlockState, userId, domains.AuditChanges{"reason": {After: req.Reason}})
+	user, err := repositories.UserRepository.SetBlockState(userId, versions, true, req.Reason, req.Until, audit)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.NewNotFoundError(errors.UserNotFound)
+	}
+	return user, nil
+}
+
+// Unblock lifts block of user, unblocking a user who is not blocked changes nothing.
+// Non empty versions are checked like SetActiveState does
+func (*userService) Unblock(userId uint, versions domains.Versions, reason string, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
+	audit := actor.Audit(AuditUserBlockState, userId, domains.AuditChanges{"reason": {After: reason}})
+	user, err := repositories.UserRepository.SetBlockState(userId, versions, false, "", nil, audit)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.NewNotFoundError(errors.UserNotFound)
+	}
+	return user, nil
+}
+
+// LiftExpiredBlocks unblocks a batch of users whose block expired and returns how many it unblocked
+func (*userService) LiftExpiredBlocks() (int, rest_errors.RestErr) {
+	now := time.Now()
+	ids, err := repositories.UserRepository.GetExpiredBlocks(now, blockExpiryBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	lifted := 0
+	for _, id := range ids {
+		audit := domains.Actor{}.Audit(AuditUserBlockState, id, domains.AuditChanges{"reason": {After: blockExpiredReason}})
+		ok, err := repositories.UserRepository.LiftExpiredBlock(id, now, audit)
+		if err != nil {
+			return lifted, err
+		}
+		if ok {
+			lifted++
+		}
+	}
+	return lifted, nil
+}
+
+// RunBlockExpiry lifts expired blocks every interval until ctx is done
+func RunBlockExpiry(ctx context.Context, interval time.Duration, onError func(rest_errors.RestErr)) {
+	for {
+		n, err := UserService.LiftExpiredBlocks()
+		if err != nil {
+			onError(err)
+		}
+		// a full batch means more blocks have expired
+		if err == nil && n == blockExpiryBatchSize && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// DeleteAccount deletes account of user knowing its password and logs it out everywhere. Logging in before
+// PurgeAt restores the account, RunAccountPurge removes it after that
+func (*userService) DeleteAccount(user *domains.PublicUser, body domains.DeleteAccountRequest, actor domains.Actor) (*domains.DeleteAccountResponse, rest_errors.RestErr) {
+	if err := checkPassword(user, body.Password); err != nil {
+		return nil, err
+	}
+	deleted, err := repositories.UserRepository.DeleteUser(user.ID, actor.Audit(AuditUserDeleted, user.ID, nil))
+	if err != nil {
+		return nil, err
+	}
+	if !deleted {
+		return nil, errors.NewNotFoundError(errors.UserNotFound)
+	}
+	if _, err := SessionService.RevokeAll(user.ID, actor); err != nil {
+		return nil, err
+	}
+	return &domains.DeleteAccountResponse{PurgeAt: time.Now().Add(deletionGracePeriod())}, nil
+}
+
+// PurgeDeletedAccounts removes a batch of accounts deleted longer than grace period ago and returns how many
+func (*userService) PurgeDeletedAccounts() (int, rest_errors.RestErr) {
+	deletedBefore := time.Now().Add(-deletionGracePeriod())
+	ids, err := repositories.UserRepository.GetPurgeableUsers(deletedBefore, accountPurgeBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, id := range ids {
+		ok, err := repositories.UserRepository.PurgeUser(id, deletedBefore, domains.Actor{}.Audit(AuditUserPurged, id, nil))
+		if err != nil {
+			return purged, err
+		}
+		if ok {
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// RunAccountPurge purges deleted accounts every interval until ctx is done
+func RunAccountPurge(ctx context.Context, interval time.Duration, onError func(rest_errors.RestErr)) {
+	for {
+		n, err := UserService.PurgeDeletedAccounts()
+		if err != nil {
+			onError(err)
+		}
+		// a full batch means more accounts are due
+		if err == nil && n == accountPurgeBatchSize && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// deletionGracePeriod is how long deleted accounts are kept, see envDeletionGracePeriod
+func deletionGracePeriod() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(envDeletionGracePeriod)); err == nil && d > 0 {
+		return d
+	}
+	return DefaultDeletionGracePeriod
+}
+
+// UpdateUser changes profile of user by non empty fields of body, caller is the signed in user and only admins
+// update others. Non empty versions are the ones of user the change may be made against, it fails with 412 if
+// user changed since so concurrent updates do not overwrite each other
+func (*userService) UpdateUser(caller *domains.PublicUser, userId string, versions domains.Versions, body domains.UpdateUserRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
+	id, convErr := strconv.ParseUint(userId, 10, 64)
+	if convErr != nil {
+		return nil, errors.NewBadRequestError(errors.InvalidInput)
+	}
+	if caller == nil || (caller.ID != uint(id) && !caller.IsAdmin) {
+		return nil, errors.NewError(errors.UserUpdateForbidden, http.StatusForbidden)
+	}
+	if body.Username != "" {
+		if err := checkUsername(body.Username, uint(id)); err != nil {
+			return nil, err
+		}
+	}
+	user, err := repositories.UserRepository.UpdateUser(uint(id), versions, body, actor.Audit(AuditUserUpdated, uint(id), nil))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.NewNotFoundError(errors.UserNotFound)
+	}
+	return user, nil
 }
 
 // ChangeForgotPassword helps people who forgot their password using verification code
-func (*userService) ChangeForgotPassword(body domains.ChangePasswordRequest) (*domains.PublicUser, rest_errors.RestErr) {
-	// return token
-	return nil, nil
+func (*userService) ChangeForgotPassword(body domains.ChangePasswordRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
+	p, err := NormalizePhone(body.Phone)
+	if err != nil {
+		return nil, err
+	}
+	body.Phone = p
+	if err := checkAccountOfPhone(body.Phone, AccountUsePasswordReset); err != nil {
+		return nil, err
+	}
+	if _, err := CodeService.Verify(body.Phone, body.Code, RESETPASSWORD); err != nil {
+		return nil, err
+	}
+	return repositories.UserRepository.UpdatePasswordByPhone(body.NewPassword, body.Phone, actor.Audit(AuditPasswordReset, 0, nil))
+}
+
+// UpdatePassword changes password of user knowing its current password and logs user out of its other sessions
+func (*userService) UpdatePassword(user *domains.PublicUser, body domains.UpdatePasswordRequest, actor domains.Actor) rest_errors.RestErr {
+	if !validators.IsValidPassword(body.NewPassword) {
+		return errors.NewBadRequestError(errors.WeakPassword)
+	}
+	if err := checkPassword(user, body.CurrentPassword); err != nil {
+		return err
+	}
+	updated, err := repositories.UserRepository.UpdatePassword(user.ID, body.NewPassword, actor.Audit(AuditPasswordChanged, user.ID, nil))
+	if err != nil {
+		return err
+	}
+	if updated == nil {
+		return errors.NewNotFoundError(errors.UserNotFound)
+	}
+	_, err = SessionService.RevokeOthers(user.ID, user.SessionID, actor)
+	return err
 }
 
 // ActiveUser Change user active state to true using verification code
-func (*userService) VerifyUser(body domains.VerifyUserRequest) (*domains.PublicUser, rest_errors.RestErr) {
-	// return token
-	return nil, nil
+func (*userService) VerifyUser(body domains.VerifyUserRequest, actor domains.Actor) (*domains.PublicUser, rest_errors.RestErr) {
+	p, err := NormalizePhone(body.Phone)
+	if err != nil {
+		return nil, err
+	}
+	body.Phone = p
+	if err := checkAccountOfPhone(body.Phone, AccountUseVerification); err != nil {
+		return nil, err
+	}
+	if _, err := CodeService.Verify(body.Phone, body.Code, VERIFICATION); err != nil {
+		return nil, err
+	}
+	return repositories.UserRepository.UpdateActiveStateByPhone(body.Phone, actor.Audit(AuditUserVerified, 0, nil))
+}
+
+// StartPhoneChange sends a code to the new phone of user, and to its current phone if envConfirmOldPhone is set
+func (*userService) StartPhoneChange(user *domains.PublicUser, body domains.ChangePhoneRequest) rest_errors.RestErr {
+	p, err := NormalizePhone(body.Phone)
+	if err != nil {
+		return err
+	}
+	if err := checkNewPhone(p, user); err != nil {
+		return err
+	}
+	if err := CodeService.Send(domains.SendCodeRequest{Phone: p, Reason: CHANGEPHONE}); err != nil {
+		return err
+	}
+	if confirmOnOldPhone() {
+		return CodeService.Send(domains.SendCodeRequest{Phone: user.Phone, Reason: CHANGEPHONE})
+	}
+	return nil
+}
+
+// ChangePhone changes phone of user by codes StartPhoneChange sent. Every session of user is revoked,
+// the returned token is of a new session on device
+func (*userService) ChangePhone(user *domains.PublicUser, body domains.ConfirmPhoneChangeRequest, actor domains.Actor, device domains.Device) (*domains.LoginResponse, rest_errors.RestErr) {
+	p, err := NormalizePhone(body.Phone)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNewPhone(p, user); err != nil {
+		return nil, err
+	}
+	if _, err := CodeService.Verify(p, body.Code, CHANGEPHONE); err != nil {
+		return nil, err
+	}
+	if confirmOnOldPhone() {
+		if _, err := CodeService.Verify(user.Phone, body.OldCode, CHANGEPHONE); err != nil {
+			return nil, err
+		}
+	}
+	changed, err := repositories.UserRepository.UpdatePhone(user.ID, p, actor.Audit(AuditPhoneChanged, user.ID, nil))
+	if err != nil {
+		return nil, err
+	}
+	if changed == nil {
+		return nil, errors.NewNotFoundError(errors.UserNotFound)
+	}
+	if _, err := SessionService.RevokeAll(user.ID, actor); err != nil {
+		return nil, err
+	}
+	return SessionService.Start(user.ID, device)
+}
+
+// EncodeUsersCursor makes an opaque cursor pointing after user in the given sort and order
+func EncodeUsersCursor(user domains.PublicUser, sort, order string) string {
+	sort, order = usersSortOf(sort, order)
+	c := domains.UsersCursor{Sort: sort, Order: order, ID: user.ID}
+	switch sort {
+	case "created_at":
+		c.Value = user.CreatedAt.UTC()
+	case "username":
+		c.Value = user.Username
+	case "name":
+		c.Value = user.Name
+	case "family":
+		c.Value = user.Family
+	case "age":
+		c.Value = user.Age
+	default:
+		c.Value = user.ID
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeUsersCursor parses a cursor made by EncodeUsersCursor, cursors made in another sort or order are refused
+func DecodeUsersCursor(cursor, sort, order string) (*domains.UsersCursor, rest_errors.RestErr) {
+	invalid := errors.NewBadRequestError(errors.InvalidCursor)
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, invalid
+	}
+	raw := struct {
+		domains.UsersCursor
+		Value json.RawMessage `json:"v"`
+	}{}
+	if err := json.Unmarshal(b, &raw); err != nil || raw.ID == 0 {
+		return nil, invalid
+	}
+	c := raw.UsersCursor
+	if sort, order = usersSortOf(sort, order); c.Sort != sort || c.Order != order {
+		return nil, invalid
+	}
+	switch sort {
+	case "created_at":
+		var v time.Time
+		err = json.Unmarshal(raw.Value, &v)
+		c.Value = v
+	case "age", "id":
+		var v uint
+		err = json.Unmarshal(raw.Value, &v)
+		c.Value = v
+	default:
+		var v string
+		err = json.Unmarshal(raw.Value, &v)
+		c.Value = v
+	}
+	if err != nil {
+		return nil, invalid
+	}
+	return &c, nil
+}
+
+// usersSortOf fills in defaults of sort and order of GetUsersRequest
+func usersSortOf(sort, order string) (string, string) {
+	if sort == "" {
+		sort = "id"
+	}
+	if order == "" {
+		order = "asc"
+	}
+	return sort, order
+}
+
+// NormalizePhone converts raw to E.164 form which phones are stored and looked up by
+func NormalizePhone(raw string) (string, rest_errors.RestErr) {
+	p, err := phone.Normalize(raw)
+	switch err {
+	case nil:
+		return p, nil
+	case phone.ErrNotMobile:
+		return "", errors.NewBadRequestError(errors.PhoneIsNotMobile)
+	default:
+		return "", errors.NewBadRequestError(errors.InvalidPhone)
+	}
+}
+
+// checkPassword makes sure password is the current password of signed in user. Wrong passwords count as
+// failed logins so a stolen token is not enough to guess the password
+func checkPassword(user *domains.PublicUser, password string) rest_errors.RestErr {
+	current, err := repositories.UserRepository.GetUserByPhoneOrUsernameAndPassword(user.Phone, password)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.ID != user.ID {
+		lockedUntil, err := repositories.UserRepository.RecordFailedLogin(user.Phone, MaxFailedLogins, LoginLockDuration)
+		if err != nil {
+			return err
+		}
+		if lockedUntil != nil {
+			return errors.NewAccountLockedError(lockedUntil)
+		}
+		return errors.NewBadRequestError(errors.WrongCurrentPassword)
+	}
+	public := current.Public()
+	return CheckAccount(&public, AccountUsePassword)
+}
+
+// checkNewPhone makes sure user may change its phone to phone
+func checkNewPhone(phone string, user *domains.PublicUser) rest_errors.RestErr {
+	if phone == user.Phone {
+		return errors.NewBadRequestError(errors.PhoneUnchanged)
+	}
+	owner, err := repositories.UserRepository.GetUserByPhone(phone)
+	if err != nil {
+		return err
+	}
+	if owner != nil {
+		return errors.NewBadRequestError(errors.DuplicatePhone)
+	}
+	return nil
+}
+
+// confirmOnOldPhone tells whether phone changes need a code sent to the old phone too, see envConfirmOldPhone
+func confirmOnOldPhone() bool {
+	return os.Getenv(envConfirmOldPhone) == "true"
+}
+
+// checkUsername makes sure username is well-formed, not reserved and not taken by anyone but userID
+func checkUsername(username string, userID uint) rest_errors.RestErr {
+	if !validators.IsValidUsername(username) {
+		return errors.NewBadRequestError(errors.InvalidUsername)
+	}
+	if validators.IsReservedUsername(username) {
+		return errors.NewBadRequestError(errors.UsernameIsReserved)
+	}
+	owner, err := repositories.UserRepository.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if owner != nil && owner.ID != userID {
+		return errors.NewBadRequestError(errors.DuplicateUsername)
+	}
+	return nil
 }
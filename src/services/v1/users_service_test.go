@@ -2,6 +2,7 @@ package services
 
 import (
 	"net/http"
+	"os"
 	"testing"
 	"time"
 
@@ -33,13 +34,26 @@ var (
 	generateJwtFunc                         func(data jwt.MapClaims) (string, rest_errors.RestErr)
 	verifyJwtFunc                           func(token string) (*domains.Jwt, rest_errors.RestErr)
 	getUserFunc                             func(id uint) (*domains.PublicUser, rest_errors.RestErr)
-	getUsersFunc                            func(params domains.GetUsersRequest) ([]domains.PublicUser, rest_errors.RestErr)
-	updateUserActiveStateByIdFunc           func(userId uint) (*domains.PublicUser, rest_errors.RestErr)
-	updateUserActiveStateByPhoneFunc        func(phone string) (*domains.PublicUser, rest_errors.RestErr)
-	updateUserBlockStateFunc                func(userId uint) (*domains.PublicUser, rest_errors.RestErr)
-	updateUserFunc                          func(userId uint, body domains.UpdateUserRequest) (*domains.PublicUser, rest_errors.RestErr)
+	getUsersByIDsFunc                       func(ids []uint) ([]domains.PublicUser, rest_errors.RestErr)
+	getUsersFunc                            func(params domains.GetUsersRequest, cursor *domains.UsersCursor, limit int) ([]domains.PublicUser, rest_errors.RestErr)
+	countUsersFunc                          func(params domains.GetUsersRequest) (int64, rest_errors.RestErr)
+	searchUsersFunc                         func(query string, limit int) ([]domains.PublicUser, rest_errors.RestErr)
+	setActiveStateFunc                      func(userId uint, active bool, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr)
+	updateUserActiveStateByPhoneFunc        func(phone string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr)
+	setBlockStateFunc                       func(userId uint, blocked bool, reason string, until *time.Time, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr)
+	getExpiredBlocksFunc                    func(at time.Time, limit int) ([]uint, rest_errors.RestErr)
+	liftExpiredBlockFunc                    func(userId uint, at time.Time, audit *domains.AuditEntry) (bool, rest_errors.RestErr)
+	recordFailedLoginFunc                   func(pou string, maxFailures int, lockFor time.Duration) (*time.Time, rest_errors.RestErr)
+	resetFailedLoginsFunc                   func(userId uint) rest_errors.RestErr
+	deleteUserFunc                          func(userId uint, audit *domains.AuditEntry) (bool, rest_errors.RestErr)
+	restoreUserFunc                         func(pou, password string, deletedSince time.Time, audit *domains.AuditEntry) (*domains.User, rest_errors.RestErr)
+	getPurgeableUsersFunc                   func(deletedBefore time.Time, limit int) ([]uint, rest_errors.RestErr)
+	purgeUserFunc                           func(userId uint, deletedBefore time.Time, audit *domains.AuditEntry) (bool, rest_errors.RestErr)
+	updatePasswordFunc                      func(userId uint, newPass string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr)
+	updatePhoneFunc                         func(userId uint, phone string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr)
+	updateUserFunc                          func(userId uint, versions domains.Versions, body domains.UpdateUserRequest, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr)
 	verifyCodeFunc                          func(phone string, code, reason int) (bool, rest_errors.RestErr)
-	updatePasswordByPhoneFunc               func(newPass, phone string) (*domains.PublicUser, rest_errors.RestErr)
+	updatePasswordByPhoneFunc               func(newPass, phone string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr)
 	getUserByPhoneFunc                      func(phone string) (*domains.PublicUser, rest_errors.RestErr)
 	getUserByUsernameFunc                   func(username string) (*domains.PublicUser, rest_errors.RestErr)
 	getUserByPhoneOrUsernameAndPasswordFunc func(pou, password string) (*domains.PublicUser, rest_errors.RestErr)
@@ -78,42 +92,119 @@ func (*UserRespositoryMock) GetUserByID(id uint) (*domains.PublicUser, rest_erro
 	return getUserFunc(id)
 }
 
+func (*UserRespositoryMock) GetUsersByIDs(ids []uint) ([]domains.PublicUser, rest_errors.RestErr) {
+	return getUsersByIDsFunc(ids)
+}
+
 func (*UserRespositoryMock) GetUserByPhone(phone string) (*domains.PublicUser, rest_errors.RestErr) {
-	return nil, nil
+	if getUserByPhoneFunc == nil {
+		return nil, nil
+	}
+	return getUserByPhoneFunc(phone)
 }
 
 func (*UserRespositoryMock) GetUserByUsername(username string) (*domains.PublicUser, rest_errors.RestErr) {
-	return nil, nil
+	if getUserByUsernameFunc == nil {
+		return nil, nil
+	}
+	return getUserByUsernameFunc(username)
 }
 
 func (*UserRespositoryMock) GetUserByPhoneOrUsernameAndPassword(pou, password string) (*domains.User, rest_errors.RestErr) {
-	return nil, nil
+	if getUserByPhoneOrUsernameAndPasswordFunc == nil {
+		return nil, nil
+	}
+	pu, err := getUserByPhoneOrUsernameAndPasswordFunc(pou, password)
+	if pu == nil {
+		return nil, err
+	}
+	u := &domains.User{Phone: pu.Phone, Username: pu.Username, Active: pu.Active, Blocked: pu.Blocked,
+		BlockReason: pu.BlockReason, BlockedUntil: pu.BlockedUntil, DeactivatedAt: pu.DeactivatedAt, LockedUntil: pu.LockedUntil}
+	u.ID = pu.ID
+	return u, err
+}
+
+func (u *UserRespositoryMock) GetUsers(params domains.GetUsersRequest, cursor *domains.UsersCursor, limit int) ([]domains.PublicUser, rest_errors.RestErr) {
+	return getUsersFunc(params, cursor, limit)
+}
+
+func (u *UserRespositoryMock) CountUsers(params domains.GetUsersRequest) (int64, rest_errors.RestErr) {
+	return countUsersFunc(params)
+}
+
+func (u *UserRespositoryMock) SearchUsers(query string, limit int) ([]domains.PublicUser, rest_errors.RestErr) {
+	return searchUsersFunc(query, limit)
+}
+
+func (u *UserRespositoryMock) SetBlockState(userId uint, versions domains.Versions, blocked bool, reason string, until *time.Time, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+	return setBlockStateFunc(userId, blocked, reason, until, audit)
+}
+
+func (u *UserRespositoryMock) GetExpiredBlocks(at time.Time, limit int) ([]uint, rest_errors.RestErr) {
+	return getExpiredBlocksFunc(at, limit)
 }
 
-func (u *UserRespositoryMock) GetUsers(params domains.GetUsersRequest) ([]domains.PublicUser, rest_errors.RestErr) {
-	return getUsersFunc(params)
+func (u *UserRespositoryMock) LiftExpiredBlock(userId uint, at time.Time, audit *domains.AuditEntry) (bool, rest_errors.RestErr) {
+	return liftExpiredBlockFunc(userId, at, audit)
 }
 
-func (u *UserRespositoryMock) UpdateBlockState(userId uint) (*domains.PublicUser, rest_errors.RestErr) {
-	return updateUserBlockStateFunc(userId)
+func (u *UserRespositoryMock) RecordFailedLogin(pou string, maxFailures int, lockFor time.Duration) (*time.Time, rest_errors.RestErr) {
+	if recordFailedLoginFunc == nil {
+		return nil, nil
+	}
+	return recordFailedLoginFunc(pou, maxFailures, lockFor)
+}
+
+func (u *UserRespositoryMock) ResetFailedLogins(userId uint) rest_errors.RestErr {
+	if resetFailedLoginsFunc == nil {
+		return nil
+	}
+	return resetFailedLoginsFunc(userId)
+}
+
+func (u *UserRespositoryMock) DeleteUser(userId uint, audit *domains.AuditEntry) (bool, rest_errors.RestErr) {
+	return deleteUserFunc(userId, audit)
+}
+
+func (u *UserRespositoryMock) RestoreUser(pou, password string, deletedSince time.Time, audit *domains.AuditEntry) (*domains.User, rest_errors.RestErr) {
+	if restoreUserFunc == nil {
+		return nil, nil
+	}
+	return restoreUserFunc(pou, password, deletedSince, audit)
 }
 
-func (u *UserRespositoryMock) UpdateUser(userId uint, body domains.UpdateUserRequest) (*domains.PublicUser, rest_errors.RestErr) {
-	return updateUserFunc(userId, body)
+func (u *UserRespositoryMock) GetPurgeableUsers(deletedBefore time.Time, limit int) ([]uint, rest_errors.RestErr) {
+	return getPurgeableUsersFunc(deletedBefore, limit)
+}
+
+func (u *UserRespositoryMock) PurgeUser(userId uint, deletedBefore time.Time, audit *domains.AuditEntry) (bool, rest_errors.RestErr) {
+	return purgeUserFunc(userId, deletedBefore, audit)
+}
+
+func (u *UserRespositoryMock) UpdateUser(userId uint, versions domains.Versions, body domains.UpdateUserRequest, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+	return updateUserFunc(userId, versions, body, audit)
 }
 
 func (u *UserRespositoryMock) ChangeForgotPassword(body domains.ChangePasswordRequest) (*domains.PublicUser, rest_errors.RestErr) {
 	return nil, nil
 }
-func (u *UserRespositoryMock) UpdatePasswordByPhone(newPass, phone string) (*domains.PublicUser, rest_errors.RestErr) {
-	return updatePasswordByPhoneFunc(newPass, phone)
+func (u *UserRespositoryMock) UpdatePasswordByPhone(newPass, phone string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+	return updatePasswordByPhoneFunc(newPass, phone, audit)
 }
 
-func (u *UserRespositoryMock) UpdateActiveStateById(userId uint) (*domains.PublicUser, rest_errors.RestErr) {
-	return updateUserActiveStateByIdFunc(userId)
+func (u *UserRespositoryMock) SetActiveState(userId uint, versions domains.Versions, active bool, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+	return setActiveStateFunc(userId, active, audit)
+}
+func (u *UserRespositoryMock) UpdatePassword(userId uint, newPass string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+	return updatePasswordFunc(userId, newPass, audit)
 }
-func (u *UserRespositoryMock) UpdateActiveStateByPhone(phone string) (*domains.PublicUser, rest_errors.RestErr) {
-	return updateUserActiveStateByPhoneFunc(phone)
+
+func (u *UserRespositoryMock) UpdatePhone(userId uint, phone string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+	return updatePhoneFunc(userId, phone, audit)
+}
+
+func (u *UserRespositoryMock) UpdateActiveStateByPhone(phone string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+	return updateUserActiveStateByPhoneFunc(phone, audit)
 }
 
 func TestRegisterCanInsertDuplicatedPhone(t *testing.T) {
@@ -152,7 +243,7 @@ func TestRegisterCanInsertDuplicatedUsername(t *testing.T) {
 
 func TestRegisterFailToSendVerificationCode(t *testing.T) {
 	sendCodeFunc = func(body domains.SendCodeRequest) rest_errors.RestErr {
-		return rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+		return errors.NewInternalServerError(nil)
 	}
 
 	CodeService = &CodeServiceMock{}
@@ -167,7 +258,7 @@ func TestRegisterFailToSendVerificationCode(t *testing.T) {
 func TestRegisterFailToGenerateJwtToken(t *testing.T) {
 	// mock jwt service
 	generateJwtFunc = func(data jwt.MapClaims) (string, rest_errors.RestErr) {
-		return "", rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+		return "", errors.NewInternalServerError(nil)
 	}
 
 	JwtService = &JwtServiceMock{}
@@ -188,6 +279,54 @@ func TestRegisterUsernameOnlyCanContainUnderlineAndEnglishWordsAndNumbers(t *tes
 	assert.Nil(t, rr)
 }
 
+func TestRegisterReservedUsername(t *testing.T) {
+	body := RegisterRequest
+	body.Username = "Support"
+	rr, err := UserService.Register(body)
+	assert.Nil(t, rr)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.Status())
+	assert.Equal(t, errors.UsernameIsReservedErrorMessage, err.Message())
+}
+
+func TestRegisterDuplicatedUsernameIgnoresCase(t *testing.T) {
+	getUserByUsernameFunc = func(username string) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{
+			ID:       uint(1),
+			Username: "Test_User",
+		}, nil
+	}
+	defer func() { getUserByUsernameFunc = nil }()
+
+	repositories.UserRepository = &UserRespositoryMock{}
+
+	body := RegisterRequest
+	body.Username = "test_user"
+	rr, err := UserService.Register(body)
+	assert.Nil(t, rr)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.Status())
+	assert.Equal(t, errors.DuplicateUsernameErrorMessage, err.Message())
+}
+
+func TestUpdateUserKeepsOwnUsername(t *testing.T) {
+	getUserByUsernameFunc = func(username string) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{
+			ID:       uint(1),
+			Username: "test_user",
+		}, nil
+	}
+	defer func() { getUserByUsernameFunc = nil }()
+	updateUserFunc = func(userId uint, versions domains.Versions, body domains.UpdateUserRequest, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{ID: userId, Username: body.Username}, nil
+	}
+
+	repositories.UserRepository = &UserRespositoryMock{}
+
+	_, err := UserService.UpdateUser(&domains.PublicUser{ID: 1}, "1", nil, domains.UpdateUserRequest{Username: "Test_User"}, domains.Actor{UserID: 1})
+	assert.Nil(t, err)
+}
+
 // login tests
 
 func TestLoginSeccessfully(t *testing.T) {
@@ -199,15 +338,16 @@ func TestLoginSeccessfully(t *testing.T) {
 	}
 
 	repositories.UserRepository = &UserRespositoryMock{}
+	repositories.SessionRepository = &SessionRepositoryMock{}
 
-	lr, err := UserService.Login(loginRequest)
+	lr, err := UserService.Login(loginRequest, domains.Device{})
 	assert.NotNil(t, lr)
 	assert.Nil(t, err)
 }
 
 func TestLoginPhoneOrUsernameRequired(t *testing.T) {
 	loginRequest.PhoneOrUsername = ""
-	rr, err := UserService.Login(loginRequest)
+	rr, err := UserService.Login(loginRequest, domains.Device{})
 	assert.Nil(t, rr)
 	assert.NotNil(t, err)
 	assert.Equal(t, http.StatusBadRequest, err.Status())
@@ -216,7 +356,7 @@ func TestLoginPhoneOrUsernameRequired(t *testing.T) {
 
 func TestLoginPasswordRequired(t *testing.T) {
 	loginRequest.Password = ""
-	rr, err := UserService.Login(loginRequest)
+	rr, err := UserService.Login(loginRequest, domains.Device{})
 	assert.Nil(t, rr)
 	assert.NotNil(t, err)
 	assert.Equal(t, http.StatusBadRequest, err.Status())
@@ -232,7 +372,8 @@ func TestLoginWithPhone(t *testing.T) {
 	}
 
 	repositories.UserRepository = &UserRespositoryMock{}
-	lr, err := UserService.Login(loginRequest)
+	repositories.SessionRepository = &SessionRepositoryMock{}
+	lr, err := UserService.Login(loginRequest, domains.Device{})
 	assert.NotNil(t, lr)
 	assert.Nil(t, err)
 }
@@ -247,7 +388,8 @@ func TestLoginWithUsername(t *testing.T) {
 
 	loginRequest.Password = RegisterRequest.Password
 	loginRequest.PhoneOrUsername = RegisterRequest.Username
-	lr, err := UserService.Login(loginRequest)
+	repositories.SessionRepository = &SessionRepositoryMock{}
+	lr, err := UserService.Login(loginRequest, domains.Device{})
 	assert.NotNil(t, lr)
 	assert.Nil(t, err)
 }
@@ -255,7 +397,7 @@ func TestLoginWithUsername(t *testing.T) {
 func TestLoginFailToGenerateJwtToken(t *testing.T) {
 	// mock jwt service
 	generateJwtFunc = func(data jwt.MapClaims) (string, rest_errors.RestErr) {
-		return "", rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+		return "", errors.NewInternalServerError(nil)
 	}
 
 	JwtService = &JwtServiceMock{}
@@ -286,7 +428,7 @@ func TestGetUserFailToGetDataFromRepository(t *testing.T) {
 	JwtService = &JwtServiceMock{}
 
 	getUserFunc = func(id uint) (*domains.PublicUser, rest_errors.RestErr) {
-		return nil, rest_errors.NewNotFoundError(errors.InternalServerErrorMessage)
+		return nil, errors.NewNotFoundError(errors.InternalServer)
 	}
 
 	repositories.UserRepository = &UserRespositoryMock{}
@@ -321,10 +463,14 @@ func TestGetUserNotFound(t *testing.T) {
 }
 
 func TestGetUserSuccessfully(t *testing.T) {
+	newSessionTest()
+	_, sErr := SessionService.Start(1, domains.Device{})
+	assert.Nil(t, sErr)
 	verifyJwtFunc = func(token string) (*domains.Jwt, rest_errors.RestErr) {
 		return &domains.Jwt{
-			Sub: "1",
-			Exp: time.Now().Add(time.Hour),
+			Sub:       "1",
+			SessionID: 1,
+			Exp:       time.Now().Add(time.Hour),
 		}, nil
 	}
 
@@ -336,6 +482,7 @@ func TestGetUserSuccessfully(t *testing.T) {
 			Phone:    RegisterRequest.Phone,
 			Username: RegisterRequest.Username,
 			Age:      RegisterRequest.Age,
+			Active:   true,
 		}, nil
 	}
 
@@ -346,14 +493,41 @@ func TestGetUserSuccessfully(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestGetUserRefusesTokensWithoutSession(t *testing.T) {
+	getUserFunc = func(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+		t.Fatal("token without session reached repository")
+		return nil, nil
+	}
+	repositories.UserRepository = &UserRespositoryMock{}
+	JwtService = &JwtServiceMock{}
+
+	for _, j := range []domains.Jwt{
+		// access token of an oauth client
+		{Sub: "1", ClientID: "client", Scope: "openid profile"},
+		{Sub: "1", ClientID: "client", SessionID: 1},
+		{Sub: "1"},
+	} {
+		j := j
+		verifyJwtFunc = func(token string) (*domains.Jwt, rest_errors.RestErr) {
+			return &j, nil
+		}
+		gu, err := UserService.GetUser("some token")
+		assert.Nil(t, gu)
+		assert.NotNil(t, err)
+		assert.Equal(t, http.StatusUnauthorized, err.Status())
+		assert.Equal(t, errors.InvalidTokenErrorMessage, err.Message())
+	}
+}
+
 func TestFailToGetUsersFromRepository(t *testing.T) {
-	getUsersFunc = func(params domains.GetUsersRequest) ([]domains.PublicUser, rest_errors.RestErr) {
-		return []domains.PublicUser{}, rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+	getUsersFunc = func(params domains.GetUsersRequest, cursor *domains.UsersCursor, limit int) ([]domains.PublicUser, rest_errors.RestErr) {
+		return []domains.PublicUser{}, errors.NewInternalServerError(nil)
 	}
 
 	repositories.UserRepository = &UserRespositoryMock{}
 
-	gu, err := UserService.GetUsers(domains.GetUsersRequest{Active: true, Blocked: false})
+	active, blocked := true, false
+	gu, err := UserService.GetUsers(domains.GetUsersRequest{Active: &active, Blocked: &blocked})
 	assert.NotNil(t, err)
 	assert.Nil(t, gu)
 	assert.Equal(t, http.StatusInternalServerError, err.Status())
@@ -361,25 +535,151 @@ func TestFailToGetUsersFromRepository(t *testing.T) {
 }
 
 func TestGetUsersSuccessfully(t *testing.T) {
-	getUsersFunc = func(params domains.GetUsersRequest) ([]domains.PublicUser, rest_errors.RestErr) {
+	getUsersFunc = func(params domains.GetUsersRequest, cursor *domains.UsersCursor, limit int) ([]domains.PublicUser, rest_errors.RestErr) {
 		return []domains.PublicUser{}, nil
 	}
+	countUsersFunc = func(params domains.GetUsersRequest) (int64, rest_errors.RestErr) {
+		return 0, nil
+	}
 
 	repositories.UserRepository = &UserRespositoryMock{}
 
-	gu, err := UserService.GetUsers(domains.GetUsersRequest{Active: true, Blocked: false})
+	active, blocked := true, false
+	gu, err := UserService.GetUsers(domains.GetUsersRequest{Active: &active, Blocked: &blocked})
 	assert.NotNil(t, gu)
 	assert.Nil(t, err)
 }
 
-func TestFailToUpdateUserActiveState(t *testing.T) {
-	updateUserActiveStateByIdFunc = func(userId uint) (*domains.PublicUser, rest_errors.RestErr) {
-		return nil, rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+func TestGetUsersReturnsNextCursorWhenMoreUsersExist(t *testing.T) {
+	getUsersFunc = func(params domains.GetUsersRequest, cursor *domains.UsersCursor, limit int) ([]domains.PublicUser, rest_errors.RestErr) {
+		assert.Nil(t, cursor)
+		assert.Equal(t, 3, limit)
+		return []domains.PublicUser{{ID: 1}, {ID: 2}, {ID: 3}}, nil
+	}
+	countUsersFunc = func(params domains.GetUsersRequest) (int64, rest_errors.RestErr) {
+		return 5, nil
+	}
+
+	repositories.UserRepository = &UserRespositoryMock{}
+
+	gu, err := UserService.GetUsers(domains.GetUsersRequest{Limit: 2})
+	assert.Nil(t, err)
+	assert.Len(t, gu.Users, 2)
+	assert.EqualValues(t, 5, gu.Total)
+	assert.NotEqual(t, "", gu.NextCursor)
+
+	getUsersFunc = func(params domains.GetUsersRequest, cursor *domains.UsersCursor, limit int) ([]domains.PublicUser, rest_errors.RestErr) {
+		assert.NotNil(t, cursor)
+		assert.EqualValues(t, 2, cursor.ID)
+		return []domains.PublicUser{{ID: 3}}, nil
+	}
+	gu, err = UserService.GetUsers(domains.GetUsersRequest{Limit: 2, Cursor: gu.NextCursor})
+	assert.Nil(t, err)
+	assert.Len(t, gu.Users, 1)
+	assert.Equal(t, "", gu.NextCursor)
+}
+
+func TestGetUsersInvalidCursor(t *testing.T) {
+	gu, err := UserService.GetUsers(domains.GetUsersRequest{Cursor: "not a cursor"})
+	assert.Nil(t, gu)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.Status())
+	assert.Equal(t, errors.InvalidCursorErrorMessage, err.Message())
+}
+
+func TestGetUsersCursorOfAnotherSortOrOrder(t *testing.T) {
+	cursor := EncodeUsersCursor(domains.PublicUser{ID: 2, Age: 30}, "age", "desc")
+	for _, params := range []domains.GetUsersRequest{
+		{Sort: "age", Cursor: cursor},
+		{Sort: "name", Order: "desc", Cursor: cursor},
+		{Cursor: cursor},
+	} {
+		gu, err := UserService.GetUsers(params)
+		assert.Nil(t, gu)
+		assert.NotNil(t, err)
+		assert.Equal(t, errors.InvalidCursorErrorMessage, err.Message())
+	}
+}
+
+func TestDecodeUsersCursorKeepsValueType(t *testing.T) {
+	created := time.Date(2021, 3, 4, 5, 6, 7, 8, time.UTC)
+	user := domains.PublicUser{ID: 2, Age: 30, Username: "ali", CreatedAt: created}
+
+	c, err := DecodeUsersCursor(EncodeUsersCursor(user, "age", ""), "age", "asc")
+	assert.Nil(t, err)
+	assert.Equal(t, uint(30), c.Value)
+	c, err = DecodeUsersCursor(EncodeUsersCursor(user, "created_at", "desc"), "created_at", "desc")
+	assert.Nil(t, err)
+	assert.Equal(t, created, c.Value)
+	c, err = DecodeUsersCursor(EncodeUsersCursor(user, "username", "asc"), "username", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "ali", c.Value)
+	c, err = DecodeUsersCursor(EncodeUsersCursor(user, "", ""), "id", "asc")
+	assert.Nil(t, err)
+	assert.Equal(t, uint(2), c.Value)
+	assert.EqualValues(t, 2, c.ID)
+}
+
+func TestGetUsersInvalidCreatedRange(t *testing.T) {
+	from, to := time.Now(), time.Now().Add(-time.Hour)
+	gu, err := UserService.GetUsers(domains.GetUsersRequest{CreatedFrom: &from, CreatedTo: &to})
+	assert.Nil(t, gu)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.Status())
+	assert.Equal(t, errors.InvalidCreatedRangeErrorMessage, err.Message())
+}
+
+func TestSearchUsersNormalizesQuery(t *testing.T) {
+	searchUsersFunc = func(query string, limit int) ([]domains.PublicUser, rest_errors.RestErr) {
+		assert.Equal(t, "علی کاظمی 0912", query)
+		assert.Equal(t, DefaultUsersPageSize, limit)
+		return []domains.PublicUser{{ID: 1}}, nil
+	}
+
+	repositories.UserRepository = &UserRespositoryMock{}
+
+	users, err := UserService.SearchUsers(domains.SearchUsersRequest{Query: " علي  كاظمى ۰۹۱۲"})
+	assert.Nil(t, err)
+	assert.Len(t, users, 1)
+}
+
+func TestSearchUsersQueryTooShort(t *testing.T) {
+	users, err := UserService.SearchUsers(domains.SearchUsersRequest{Query: "\u200cا "})
+	assert.Nil(t, users)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.Status())
+	assert.Equal(t, errors.SearchQueryTooShortErrorMessage, err.Message())
+}
+
+func TestGetUserByIDNotFound(t *testing.T) {
+	getUserFunc = func(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+		return nil, nil
+	}
+
+	repositories.UserRepository = &UserRespositoryMock{}
+
+	u, err := UserService.GetUserByID(uint(1))
+	assert.Nil(t, u)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusNotFound, err.Status())
+	assert.Equal(t, errors.UserNotFoundError, err.Message())
+}
+
+func TestGetUsersByIDsTooMany(t *testing.T) {
+	users, err := UserService.GetUsersByIDs(make([]uint, MaxUsersByIDs+1))
+	assert.Nil(t, users)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.Status())
+}
+
+func TestFailToSetActiveState(t *testing.T) {
+	setActiveStateFunc = func(userId uint, active bool, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+		return nil, errors.NewInternalServerError(nil)
 	}
 
 	repositories.UserRepository = &UserRespositoryMock{}
 
-	gu, err := UserService.UpdateUserActiveState(uint(1))
+	gu, err := UserService.SetActiveState(uint(1), nil, false, "left the company", domains.Actor{})
 
 	assert.NotNil(t, err)
 	assert.Nil(t, gu)
@@ -387,29 +687,34 @@ func TestFailToUpdateUserActiveState(t *testing.T) {
 	assert.Equal(t, errors.InternalServerErrorMessage, err.Message())
 }
 
-func TestSuccessfullyUpdateUserActiveState(t *testing.T) {
-	updateUserActiveStateByIdFunc = func(userId uint) (*domains.PublicUser, rest_errors.RestErr) {
+func TestSuccessfullySetActiveState(t *testing.T) {
+	var audit *domains.AuditEntry
+	setActiveStateFunc = func(userId uint, active bool, a *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+		audit = a
 		return &domains.PublicUser{
-			ID: 1,
+			ID:     userId,
+			Active: active,
 		}, nil
 	}
 
 	repositories.UserRepository = &UserRespositoryMock{}
 
-	u, err := UserService.UpdateUserActiveState(uint(1))
+	u, err := UserService.SetActiveState(uint(1), nil, true, "verified by support", domains.Actor{})
 
-	assert.NotNil(t, u)
 	assert.Nil(t, err)
+	assert.True(t, u.Active)
+	assert.Equal(t, AuditUserActiveState, audit.Action)
+	assert.Equal(t, "verified by support", audit.Changes["reason"].After)
 }
 
-func TestFailToUpdateUserBlockState(t *testing.T) {
-	updateUserBlockStateFunc = func(userId uint) (*domains.PublicUser, rest_errors.RestErr) {
-		return nil, rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+func TestFailToBlockUser(t *testing.T) {
+	setBlockStateFunc = func(userId uint, blocked bool, reason string, until *time.Time, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+		return nil, errors.NewInternalServerError(nil)
 	}
 
 	repositories.UserRepository = &UserRespositoryMock{}
 
-	gu, err := UserService.UpdateUserBlockState(uint(1))
+	gu, err := UserService.Block(uint(1), nil, domains.BlockUserRequest{Reason: "spam"}, domains.Actor{})
 
 	assert.NotNil(t, err)
 	assert.Nil(t, gu)
@@ -417,31 +722,191 @@ func TestFailToUpdateUserBlockState(t *testing.T) {
 	assert.Equal(t, errors.InternalServerErrorMessage, err.Message())
 }
 
-func TestSuccessfullyUpdateUserBlockState(t *testing.T) {
-	updateUserBlockStateFunc = func(userId uint) (*domains.PublicUser, rest_errors.RestErr) {
-		return &domains.PublicUser{
-			ID: 1,
-		}, nil
+func TestBlockUserUntilPast(t *testing.T) {
+	until := time.Now().Add(-time.Minute)
+	gu, err := UserService.Block(uint(1), nil, domains.BlockUserRequest{Reason: "spam", Until: &until}, domains.Actor{})
+
+	assert.Nil(t, gu)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.Status())
+	assert.Equal(t, errors.BlockExpiryInPastErrorMessage, err.Message())
+}
+
+func TestBlockUserIsAudited(t *testing.T) {
+	var audit *domains.AuditEntry
+	var blockedUntil *time.Time
+	setBlockStateFunc = func(userId uint, blocked bool, reason string, until *time.Time, a *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+		audit, blockedUntil = a, until
+		return &domains.PublicUser{ID: userId, Blocked: blocked, BlockReason: reason, BlockedUntil: until}, nil
+	}
+	repositories.UserRepository = &UserRespositoryMock{}
+
+	until := time.Now().Add(24 * time.Hour)
+	u, err := UserService.Block(7, nil, domains.BlockUserRequest{Reason: "spam", Until: &until},
+		domains.Actor{UserID: 1, IP: "10.0.0.1", RequestID: "req-1"})
+	assert.Nil(t, err)
+	assert.True(t, u.Blocked)
+	assert.Equal(t, "spam", u.BlockReason)
+	assert.WithinDuration(t, until, *blockedUntil, time.Microsecond)
+	assert.Equal(t, AuditUserBlockState, audit.Action)
+	assert.EqualValues(t, 1, *audit.ActorID)
+	assert.EqualValues(t, 7, *audit.TargetID)
+	assert.Nil(t, audit.ActorAPIKeyID)
+	assert.Equal(t, "10.0.0.1", audit.IP)
+	assert.Equal(t, "req-1", audit.RequestID)
+	assert.Equal(t, "spam", audit.Changes["reason"].After)
+}
+
+func TestUnblockUser(t *testing.T) {
+	setBlockStateFunc = func(userId uint, blocked bool, reason string, until *time.Time, a *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+		assert.False(t, blocked)
+		assert.Empty(t, reason)
+		assert.Nil(t, until)
+		return &domains.PublicUser{ID: userId}, nil
 	}
+	repositories.UserRepository = &UserRespositoryMock{}
 
+	u, err := UserService.Unblock(7, nil, "appeal accepted", domains.Actor{UserID: 1})
+	assert.Nil(t, err)
+	assert.False(t, u.Blocked)
+}
+
+func TestSetActiveStateOfUnknownUser(t *testing.T) {
+	setActiveStateFunc = func(userId uint, active bool, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+		return nil, nil
+	}
 	repositories.UserRepository = &UserRespositoryMock{}
 
-	u, err := UserService.UpdateUserBlockState(uint(1))
+	u, err := UserService.SetActiveState(7, nil, true, "verified by support", domains.Actor{APIKeyID: 2})
+	assert.Nil(t, u)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusNotFound, err.Status())
+}
+
+func TestLiftExpiredBlocks(t *testing.T) {
+	getExpiredBlocksFunc = func(at time.Time, limit int) ([]uint, rest_errors.RestErr) {
+		return []uint{3, 4}, nil
+	}
+	var audits []*domains.AuditEntry
+	liftExpiredBlockFunc = func(userId uint, at time.Time, audit *domains.AuditEntry) (bool, rest_errors.RestErr) {
+		audits = append(audits, audit)
+		// user 4 was blocked again meanwhile
+		return userId == 3, nil
+	}
+	repositories.UserRepository = &UserRespositoryMock{}
 
-	assert.NotNil(t, u)
+	n, err := UserService.LiftExpiredBlocks()
 	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Len(t, audits, 2)
+	assert.Nil(t, audits[0].ActorID)
+	assert.EqualValues(t, 3, *audits[0].TargetID)
+	assert.Equal(t, blockExpiredReason, audits[0].Changes["reason"].After)
+}
+
+func TestLoginOfBlockedUser(t *testing.T) {
+	until := time.Now().Add(time.Hour)
+	getUserByPhoneOrUsernameAndPasswordFunc = func(pou, password string) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{ID: uint(1), Phone: pou, Active: true, Blocked: true, BlockReason: "spam", BlockedUntil: &until}, nil
+	}
+	repositories.UserRepository = &UserRespositoryMock{}
+	newSessionTest()
+
+	lr, err := UserService.Login(domains.LoginRequest{PhoneOrUsername: "test_user", Password: "password"}, domains.Device{})
+	assert.Nil(t, lr)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusForbidden, err.Status())
+	aerr, ok := err.(*errors.AccountError)
+	assert.True(t, ok)
+	assert.Equal(t, "spam", aerr.Reason)
+	assert.Equal(t, &until, aerr.Until)
+
+	// expired blocks do not wait for RunBlockExpiry
+	until = time.Now().Add(-time.Second)
+	lr, err = UserService.Login(domains.LoginRequest{PhoneOrUsername: "test_user", Password: "password"}, domains.Device{})
+	assert.Nil(t, err)
+	assert.NotNil(t, lr)
+}
+
+func TestLoginLocksAfterFailedLogins(t *testing.T) {
+	getUserByPhoneOrUsernameAndPasswordFunc = func(pou, password string) (*domains.PublicUser, rest_errors.RestErr) {
+		return nil, nil
+	}
+	var lockedUntil *time.Time
+	recordFailedLoginFunc = func(pou string, maxFailures int, lockFor time.Duration) (*time.Time, rest_errors.RestErr) {
+		assert.Equal(t, "test_user", pou)
+		assert.Equal(t, MaxFailedLogins, maxFailures)
+		assert.Equal(t, LoginLockDuration, lockFor)
+		return lockedUntil, nil
+	}
+	t.Cleanup(func() { recordFailedLoginFunc = nil })
+	repositories.UserRepository = &UserRespositoryMock{}
+
+	_, err := UserService.Login(domains.LoginRequest{PhoneOrUsername: "test_user", Password: "wrong"}, domains.Device{})
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, err.Status())
+	assert.Equal(t, errors.InvalidCredentialsErrorMessage, err.Message())
+
+	until := time.Now().Add(LoginLockDuration)
+	lockedUntil = &until
+	_, err = UserService.Login(domains.LoginRequest{PhoneOrUsername: "test_user", Password: "wrong"}, domains.Device{})
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusForbidden, err.Status())
+	assert.Equal(t, errors.AccountLockedErrorMessage, err.Message())
+	assert.Equal(t, &until, err.(*errors.AccountError).Until)
+}
+
+func TestLoginOfLockedUser(t *testing.T) {
+	until := time.Now().Add(time.Minute)
+	getUserByPhoneOrUsernameAndPasswordFunc = func(pou, password string) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{ID: uint(1), Phone: pou, Active: true, LockedUntil: &until}, nil
+	}
+	repositories.UserRepository = &UserRespositoryMock{}
+	newSessionTest()
+
+	// the right password does not open a locked account
+	lr, err := UserService.Login(domains.LoginRequest{PhoneOrUsername: "test_user", Password: "password"}, domains.Device{})
+	assert.Nil(t, lr)
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.AccountLockedErrorMessage, err.Message())
+
+	until = time.Now().Add(-time.Second)
+	lr, err = UserService.Login(domains.LoginRequest{PhoneOrUsername: "test_user", Password: "password"}, domains.Device{})
+	assert.Nil(t, err)
+	assert.NotNil(t, lr)
+}
+
+func TestGetUserOfDeactivatedUser(t *testing.T) {
+	newSessionTest()
+	_, sErr := SessionService.Start(1, domains.Device{})
+	assert.Nil(t, sErr)
+	verifyJwtFunc = func(token string) (*domains.Jwt, rest_errors.RestErr) {
+		return &domains.Jwt{Sub: "1", SessionID: 1}, nil
+	}
+	JwtService = &JwtServiceMock{}
+	deactivatedAt := time.Now()
+	getUserFunc = func(id uint) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{ID: id, DeactivatedAt: &deactivatedAt}, nil
+	}
+	repositories.UserRepository = &UserRespositoryMock{}
+
+	pu, err := UserService.GetUser("token")
+	assert.Nil(t, pu)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusForbidden, err.Status())
+	assert.Equal(t, errors.AccountDeactivatedErrorMessage, err.Message())
 }
 
 func TestFailToUpdateUser(t *testing.T) {
-	updateUserFunc = func(userId uint, body domains.UpdateUserRequest) (*domains.PublicUser, rest_errors.RestErr) {
-		return nil, rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+	updateUserFunc = func(userId uint, versions domains.Versions, body domains.UpdateUserRequest, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+		return nil, errors.NewInternalServerError(nil)
 	}
 
 	repositories.UserRepository = &UserRespositoryMock{}
 	body := domains.UpdateUserRequest{
 		Username: RegisterRequest.Username,
 	}
-	gu, err := UserService.UpdateUser("", "", body)
+	gu, err := UserService.UpdateUser(&domains.PublicUser{ID: 1}, "1", nil, body, domains.Actor{UserID: 1})
 
 	assert.NotNil(t, err)
 	assert.Nil(t, gu)
@@ -450,7 +915,7 @@ func TestFailToUpdateUser(t *testing.T) {
 }
 
 func TestSuccessfullyUpdateUser(t *testing.T) {
-	updateUserFunc = func(userId uint, body domains.UpdateUserRequest) (*domains.PublicUser, rest_errors.RestErr) {
+	updateUserFunc = func(userId uint, versions domains.Versions, body domains.UpdateUserRequest, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
 		return &domains.PublicUser{
 			ID: 1,
 		}, nil
@@ -462,15 +927,75 @@ func TestSuccessfullyUpdateUser(t *testing.T) {
 		Username: RegisterRequest.Username,
 	}
 
-	u, err := UserService.UpdateUser("", "", body)
+	u, err := UserService.UpdateUser(&domains.PublicUser{ID: 1}, "1", nil, body, domains.Actor{UserID: 1})
 
 	assert.NotNil(t, u)
 	assert.Nil(t, err)
 }
 
+func TestUpdateUserPassesVersionAndAudits(t *testing.T) {
+	var gotVersions domains.Versions
+	var audit *domains.AuditEntry
+	updateUserFunc = func(userId uint, versions domains.Versions, body domains.UpdateUserRequest, a *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+		gotVersions, audit = versions, a
+		return &domains.PublicUser{ID: userId, Name: body.Name, Version: versions[0] + 1}, nil
+	}
+	repositories.UserRepository = &UserRespositoryMock{}
+
+	u, err := UserService.UpdateUser(&domains.PublicUser{ID: 1}, "1", domains.Versions{4}, domains.UpdateUserRequest{Name: "Ali"}, domains.Actor{UserID: 1})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 5, u.Version)
+	assert.Equal(t, domains.Versions{4}, gotVersions)
+	assert.Equal(t, AuditUserUpdated, audit.Action)
+	assert.EqualValues(t, 1, *audit.TargetID)
+}
+
+func TestUpdateUserVersionMismatch(t *testing.T) {
+	updateUserFunc = func(userId uint, versions domains.Versions, body domains.UpdateUserRequest, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+		return nil, errors.NewError(errors.UserVersionMismatch, http.StatusPreconditionFailed)
+	}
+	repositories.UserRepository = &UserRespositoryMock{}
+
+	u, err := UserService.UpdateUser(&domains.PublicUser{ID: 1}, "1", domains.Versions{3}, domains.UpdateUserRequest{Name: "Ali"}, domains.Actor{UserID: 1})
+	assert.Nil(t, u)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusPreconditionFailed, err.Status())
+	assert.Equal(t, errors.UserVersionMismatchErrorMessage, err.Message())
+}
+
+func TestUpdateOtherUser(t *testing.T) {
+	updateUserFunc = func(userId uint, versions domains.Versions, body domains.UpdateUserRequest, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{ID: userId, Name: body.Name}, nil
+	}
+	repositories.UserRepository = &UserRespositoryMock{}
+
+	u, err := UserService.UpdateUser(&domains.PublicUser{ID: 2}, "1", nil, domains.UpdateUserRequest{Name: "Ali"}, domains.Actor{UserID: 2})
+	assert.Nil(t, u)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusForbidden, err.Status())
+	assert.Equal(t, errors.UserUpdateForbiddenErrorMessage, err.Message())
+
+	// admins update any user
+	u, err = UserService.UpdateUser(&domains.PublicUser{ID: 2, IsAdmin: true}, "1", nil, domains.UpdateUserRequest{Name: "Ali"}, domains.Actor{UserID: 2})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, u.ID)
+}
+
+func TestUpdateUserNotFound(t *testing.T) {
+	updateUserFunc = func(userId uint, versions domains.Versions, body domains.UpdateUserRequest, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+		return nil, nil
+	}
+	repositories.UserRepository = &UserRespositoryMock{}
+
+	u, err := UserService.UpdateUser(&domains.PublicUser{ID: 7}, "7", nil, domains.UpdateUserRequest{Name: "Ali"}, domains.Actor{UserID: 7})
+	assert.Nil(t, u)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusNotFound, err.Status())
+}
+
 func TestChangePasswordFailToVerifyCode(t *testing.T) {
 	verifyCodeFunc = func(phone string, code, reason int) (bool, rest_errors.RestErr) {
-		return false, rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+		return false, errors.NewInternalServerError(nil)
 	}
 
 	CodeService = &CodeServiceMock{}
@@ -479,7 +1004,7 @@ func TestChangePasswordFailToVerifyCode(t *testing.T) {
 		Code:        231231,
 		NewPassword: "new",
 	}
-	u, err := UserService.ChangeForgotPassword(body)
+	u, err := UserService.ChangeForgotPassword(body, domains.Actor{})
 	assert.NotNil(t, err)
 	assert.Nil(t, u)
 	assert.Equal(t, http.StatusInternalServerError, err.Status())
@@ -497,7 +1022,7 @@ func TestChangePasswordInvalidCode(t *testing.T) {
 		Code:        231231,
 		NewPassword: "new",
 	}
-	u, err := UserService.ChangeForgotPassword(body)
+	u, err := UserService.ChangeForgotPassword(body, domains.Actor{})
 	assert.NotNil(t, err)
 	assert.Nil(t, u)
 	assert.Equal(t, http.StatusNotFound, err.Status())
@@ -511,8 +1036,8 @@ func TestChangePasswordFailToUpdatePassword(t *testing.T) {
 
 	CodeService = &CodeServiceMock{}
 
-	updatePasswordByPhoneFunc = func(newPass, phone string) (*domains.PublicUser, rest_errors.RestErr) {
-		return nil, rest_errors.NewInternalServerError(errors.InternalServerErrorMessage, nil)
+	updatePasswordByPhoneFunc = func(newPass, phone string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+		return nil, errors.NewInternalServerError(nil)
 	}
 	repositories.UserRepository = &UserRespositoryMock{}
 	body := domains.ChangePasswordRequest{
@@ -520,7 +1045,7 @@ func TestChangePasswordFailToUpdatePassword(t *testing.T) {
 		Code:        231231,
 		NewPassword: "new",
 	}
-	u, err := UserService.ChangeForgotPassword(body)
+	u, err := UserService.ChangeForgotPassword(body, domains.Actor{})
 	assert.NotNil(t, err)
 	assert.Nil(t, u)
 	assert.Equal(t, http.StatusNotFound, err.Status())
@@ -534,7 +1059,7 @@ func TestChangePasswordSuccessfully(t *testing.T) {
 
 	CodeService = &CodeServiceMock{}
 
-	updatePasswordByPhoneFunc = func(newPass, phone string) (*domains.PublicUser, rest_errors.RestErr) {
+	updatePasswordByPhoneFunc = func(newPass, phone string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
 		return &domains.PublicUser{}, nil
 	}
 
@@ -544,7 +1069,7 @@ func TestChangePasswordSuccessfully(t *testing.T) {
 		Code:        231231,
 		NewPassword: "new",
 	}
-	u, err := UserService.ChangeForgotPassword(body)
+	u, err := UserService.ChangeForgotPassword(body, domains.Actor{})
 	assert.Nil(t, err)
 	assert.NotNil(t, u)
 }
@@ -559,7 +1084,7 @@ func TestActiveUserInvalidCode(t *testing.T) {
 		Phone: "092312",
 		Code:  23123,
 	}
-	u, err := UserService.VerifyUser(body)
+	u, err := UserService.VerifyUser(body, domains.Actor{})
 	assert.NotNil(t, err)
 	assert.Nil(t, u)
 	assert.Equal(t, http.StatusNotFound, err.Status())
@@ -573,7 +1098,7 @@ func TestVerifyUserFailToUpdate(t *testing.T) {
 
 	CodeService = &CodeServiceMock{}
 
-	updateUserActiveStateByPhoneFunc = func(phone string) (*domains.PublicUser, rest_errors.RestErr) {
+	updateUserActiveStateByPhoneFunc = func(phone string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
 		return nil, nil
 	}
 	repositories.UserRepository = &UserRespositoryMock{}
@@ -581,7 +1106,7 @@ func TestVerifyUserFailToUpdate(t *testing.T) {
 		Phone: "092312",
 		Code:  23123,
 	}
-	u, err := UserService.VerifyUser(body)
+	u, err := UserService.VerifyUser(body, domains.Actor{})
 	assert.NotNil(t, err)
 	assert.Nil(t, u)
 	assert.Equal(t, http.StatusNotFound, err.Status())
@@ -595,7 +1120,7 @@ func TestVerifyUserSuccessfully(t *testing.T) {
 
 	CodeService = &CodeServiceMock{}
 
-	updateUserActiveStateByPhoneFunc = func(phone string) (*domains.PublicUser, rest_errors.RestErr) {
+	updateUserActiveStateByPhoneFunc = func(phone string, audit *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
 		return &domains.PublicUser{}, nil
 	}
 
@@ -605,7 +1130,289 @@ func TestVerifyUserSuccessfully(t *testing.T) {
 		Phone: "092312",
 		Code:  23123,
 	}
-	u, err := UserService.VerifyUser(body)
+	u, err := UserService.VerifyUser(body, domains.Actor{})
 	assert.Nil(t, err)
 	assert.NotNil(t, u)
 }
+
+func TestNormalizePhone(t *testing.T) {
+	p, err := NormalizePhone("۰۹۱۲ ۲۳۳ ۴۳۴۴")
+	assert.Nil(t, err)
+	assert.Equal(t, "+989122334344", p)
+}
+
+func TestNormalizePhoneNotMobile(t *testing.T) {
+	p, err := NormalizePhone("02122334344")
+	assert.Equal(t, "", p)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.Status())
+	assert.Equal(t, errors.PhoneIsNotMobileErrorMessage, err.Message())
+}
+
+func TestNormalizePhoneInvalid(t *testing.T) {
+	p, err := NormalizePhone("phone")
+	assert.Equal(t, "", p)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.Status())
+	assert.Equal(t, errors.InvalidPhoneErrorMessage, err.Message())
+}
+
+// newPhoneChangeTest gives user 3 a session and records codes sent
+func newPhoneChangeTest(t *testing.T) (*SessionRepositoryMock, *[]domains.SendCodeRequest) {
+	repo := newSessionTest()
+	_, err := SessionService.Start(3, domains.Device{})
+	assert.Nil(t, err)
+	sent := &[]domains.SendCodeRequest{}
+	sendCodeFunc = func(body domains.SendCodeRequest) rest_errors.RestErr {
+		*sent = append(*sent, body)
+		return nil
+	}
+	verifyCodeFunc = func(phone string, code, reason int) (bool, rest_errors.RestErr) {
+		assert.Equal(t, CHANGEPHONE, reason)
+		if code != 12345 {
+			return false, errors.NewNotFoundError(errors.CodeOrPhoneDoesNotExist)
+		}
+		return true, nil
+	}
+	CodeService = &CodeServiceMock{}
+	getUserByPhoneFunc = nil
+	repositories.UserRepository = &UserRespositoryMock{}
+	t.Cleanup(func() {
+		CodeService = &codeService{}
+		os.Unsetenv(envConfirmOldPhone)
+	})
+	return repo, sent
+}
+
+func TestStartPhoneChange(t *testing.T) {
+	_, sent := newPhoneChangeTest(t)
+	user := &domains.PublicUser{ID: 3, Phone: "+989122334344", Active: true}
+
+	assert.Nil(t, UserService.StartPhoneChange(user, domains.ChangePhoneRequest{Phone: "0912 123 4567"}))
+	assert.Equal(t, []domains.SendCodeRequest{{Phone: "+989121234567", Reason: CHANGEPHONE}}, *sent)
+
+	*sent = nil
+	os.Setenv(envConfirmOldPhone, "true")
+	assert.Nil(t, UserService.StartPhoneChange(user, domains.ChangePhoneRequest{Phone: "09121234567"}))
+	assert.Equal(t, []domains.SendCodeRequest{
+		{Phone: "+989121234567", Reason: CHANGEPHONE},
+		{Phone: "+989122334344", Reason: CHANGEPHONE},
+	}, *sent)
+}
+
+func TestStartPhoneChangeToTakenPhone(t *testing.T) {
+	_, sent := newPhoneChangeTest(t)
+	user := &domains.PublicUser{ID: 3, Phone: "+989122334344", Active: true}
+	getUserByPhoneFunc = func(phone string) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{ID: 4, Phone: phone}, nil
+	}
+
+	err := UserService.StartPhoneChange(user, domains.ChangePhoneRequest{Phone: "09121234567"})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.DuplicatePhoneErrorMessage, err.Message())
+
+	err = UserService.StartPhoneChange(user, domains.ChangePhoneRequest{Phone: "09122334344"})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.PhoneUnchangedErrorMessage, err.Message())
+	assert.Empty(t, *sent)
+}
+
+func TestChangePhone(t *testing.T) {
+	repo, _ := newPhoneChangeTest(t)
+	user := &domains.PublicUser{ID: 3, Phone: "+989122334344", Active: true}
+	var audit *domains.AuditEntry
+	updatePhoneFunc = func(userId uint, phone string, a *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+		assert.EqualValues(t, 3, userId)
+		assert.Equal(t, "+989121234567", phone)
+		audit = a
+		return &domains.PublicUser{ID: userId, Phone: phone, Active: true}, nil
+	}
+
+	_, err := UserService.ChangePhone(user, domains.ConfirmPhoneChangeRequest{Phone: "09121234567", Code: 1}, domains.Actor{UserID: 3}, domains.Device{})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.CodeOrPhoneDoesNotExistsErrorMessage, err.Message())
+	assert.Nil(t, audit)
+
+	res, err := UserService.ChangePhone(user, domains.ConfirmPhoneChangeRequest{Phone: "09121234567", Code: 12345}, domains.Actor{UserID: 3}, domains.Device{})
+	assert.Nil(t, err)
+	assert.Equal(t, "token-of-3-2", res.Token)
+	assert.Equal(t, AuditPhoneChanged, audit.Action)
+	// sessions opened by the old phone are logged out, the new token is the only one working
+	assert.NotNil(t, repo.sessions[0].RevokedAt)
+	assert.Nil(t, repo.sessions[1].RevokedAt)
+}
+
+func TestChangePhoneConfirmedOnOldPhone(t *testing.T) {
+	newPhoneChangeTest(t)
+	os.Setenv(envConfirmOldPhone, "true")
+	user := &domains.PublicUser{ID: 3, Phone: "+989122334344", Active: true}
+	updatePhoneFunc = func(userId uint, phone string, a *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+		return &domains.PublicUser{ID: userId, Phone: phone, Active: true}, nil
+	}
+
+	_, err := UserService.ChangePhone(user, domains.ConfirmPhoneChangeRequest{Phone: "09121234567", Code: 12345}, domains.Actor{UserID: 3}, domains.Device{})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.CodeOrPhoneDoesNotExistsErrorMessage, err.Message())
+
+	res, err := UserService.ChangePhone(user, domains.ConfirmPhoneChangeRequest{Phone: "09121234567", Code: 12345, OldCode: 12345}, domains.Actor{UserID: 3}, domains.Device{})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, res.Token)
+}
+
+// newUpdatePasswordTest logs user 3 in twice, current password of user is "password1"
+func newUpdatePasswordTest(t *testing.T) (*SessionRepositoryMock, *domains.PublicUser) {
+	repo := newSessionTest()
+	for i := 0; i < 2; i++ {
+		_, err := SessionService.Start(3, domains.Device{})
+		assert.Nil(t, err)
+	}
+	getUserByPhoneOrUsernameAndPasswordFunc = func(pou, password string) (*domains.PublicUser, rest_errors.RestErr) {
+		if password != "password1" {
+			return nil, nil
+		}
+		return &domains.PublicUser{ID: 3, Phone: pou, Active: true}, nil
+	}
+	repositories.UserRepository = &UserRespositoryMock{}
+	t.Cleanup(func() { recordFailedLoginFunc = nil })
+	return repo, &domains.PublicUser{ID: 3, Phone: "+989122334344", Active: true, SessionID: 2}
+}
+
+func TestUpdatePassword(t *testing.T) {
+	repo, user := newUpdatePasswordTest(t)
+	var audit *domains.AuditEntry
+	updatePasswordFunc = func(userId uint, newPass string, a *domains.AuditEntry) (*domains.PublicUser, rest_errors.RestErr) {
+		assert.EqualValues(t, 3, userId)
+		assert.Equal(t, "password2", newPass)
+		audit = a
+		return &domains.PublicUser{ID: userId}, nil
+	}
+
+	err := UserService.UpdatePassword(user, domains.UpdatePasswordRequest{CurrentPassword: "password1", NewPassword: "password2"}, domains.Actor{UserID: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, AuditPasswordChanged, audit.Action)
+	// the session changing password stays, others are logged out
+	assert.NotNil(t, repo.sessions[0].RevokedAt)
+	assert.Nil(t, repo.sessions[1].RevokedAt)
+}
+
+func TestUpdatePasswordWeakPassword(t *testing.T) {
+	_, user := newUpdatePasswordTest(t)
+
+	err := UserService.UpdatePassword(user, domains.UpdatePasswordRequest{CurrentPassword: "password1", NewPassword: "password"}, domains.Actor{UserID: 3})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.WeakPasswordErrorMessage, err.Message())
+}
+
+func TestUpdatePasswordWrongCurrentPassword(t *testing.T) {
+	repo, user := newUpdatePasswordTest(t)
+	var lockedUntil *time.Time
+	recordFailedLoginFunc = func(pou string, maxFailures int, lockFor time.Duration) (*time.Time, rest_errors.RestErr) {
+		assert.Equal(t, user.Phone, pou)
+		return lockedUntil, nil
+	}
+
+	err := UserService.UpdatePassword(user, domains.UpdatePasswordRequest{CurrentPassword: "wrong", NewPassword: "password2"}, domains.Actor{UserID: 3})
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.Status())
+	assert.Equal(t, errors.WrongCurrentPasswordErrorMessage, err.Message())
+
+	until := time.Now().Add(LoginLockDuration)
+	lockedUntil = &until
+	err = UserService.UpdatePassword(user, domains.UpdatePasswordRequest{CurrentPassword: "wrong", NewPassword: "password2"}, domains.Actor{UserID: 3})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.AccountLockedErrorMessage, err.Message())
+	assert.Nil(t, repo.sessions[0].RevokedAt)
+}
+
+func TestDeleteAccount(t *testing.T) {
+	repo, user := newUpdatePasswordTest(t)
+	var audit *domains.AuditEntry
+	deleteUserFunc = func(userId uint, a *domains.AuditEntry) (bool, rest_errors.RestErr) {
+		assert.EqualValues(t, 3, userId)
+		audit = a
+		return true, nil
+	}
+
+	res, err := UserService.DeleteAccount(user, domains.DeleteAccountRequest{Password: "password1"}, domains.Actor{UserID: 3})
+	assert.Nil(t, err)
+	assert.WithinDuration(t, time.Now().Add(DefaultDeletionGracePeriod), res.PurgeAt, time.Minute)
+	assert.Equal(t, AuditUserDeleted, audit.Action)
+	// deleted accounts are logged out everywhere
+	assert.NotNil(t, repo.sessions[0].RevokedAt)
+	assert.NotNil(t, repo.sessions[1].RevokedAt)
+}
+
+func TestDeleteAccountWrongPassword(t *testing.T) {
+	repo, user := newUpdatePasswordTest(t)
+	deleteUserFunc = func(userId uint, a *domains.AuditEntry) (bool, rest_errors.RestErr) {
+		t.Fatal("account of wrong password is deleted")
+		return false, nil
+	}
+
+	res, err := UserService.DeleteAccount(user, domains.DeleteAccountRequest{Password: "wrong"}, domains.Actor{UserID: 3})
+	assert.Nil(t, res)
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.WrongCurrentPasswordErrorMessage, err.Message())
+	assert.Nil(t, repo.sessions[0].RevokedAt)
+}
+
+func TestDeletionGracePeriod(t *testing.T) {
+	os.Setenv(envDeletionGracePeriod, "48h")
+	t.Cleanup(func() { os.Unsetenv(envDeletionGracePeriod) })
+	assert.Equal(t, 48*time.Hour, deletionGracePeriod())
+
+	os.Setenv(envDeletionGracePeriod, "a month")
+	assert.Equal(t, DefaultDeletionGracePeriod, deletionGracePeriod())
+}
+
+func TestLoginRestoresDeletedAccount(t *testing.T) {
+	getUserByPhoneOrUsernameAndPasswordFunc = func(pou, password string) (*domains.PublicUser, rest_errors.RestErr) {
+		return nil, nil
+	}
+	var audit *domains.AuditEntry
+	restoreUserFunc = func(pou, password string, deletedSince time.Time, a *domains.AuditEntry) (*domains.User, rest_errors.RestErr) {
+		assert.Equal(t, "test_user", pou)
+		assert.WithinDuration(t, time.Now().Add(-DefaultDeletionGracePeriod), deletedSince, time.Minute)
+		audit = a
+		if password != "password" {
+			return nil, nil
+		}
+		return &domains.User{Model: gorm.Model{ID: 1}, Phone: "+989122334344", Active: true}, nil
+	}
+	t.Cleanup(func() { restoreUserFunc = nil })
+	repositories.UserRepository = &UserRespositoryMock{}
+	newSessionTest()
+
+	lr, err := UserService.Login(domains.LoginRequest{PhoneOrUsername: "test_user", Password: "password"}, domains.Device{IP: "1.2.3.4"})
+	assert.Nil(t, err)
+	assert.NotNil(t, lr)
+	assert.Equal(t, AuditUserRestored, audit.Action)
+	assert.Equal(t, "1.2.3.4", audit.IP)
+
+	lr, err = UserService.Login(domains.LoginRequest{PhoneOrUsername: "test_user", Password: "wrong"}, domains.Device{})
+	assert.Nil(t, lr)
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.InvalidCredentialsErrorMessage, err.Message())
+}
+
+func TestPurgeDeletedAccounts(t *testing.T) {
+	getPurgeableUsersFunc = func(deletedBefore time.Time, limit int) ([]uint, rest_errors.RestErr) {
+		assert.WithinDuration(t, time.Now().Add(-DefaultDeletionGracePeriod), deletedBefore, time.Minute)
+		return []uint{3, 4}, nil
+	}
+	var audits []*domains.AuditEntry
+	purgeUserFunc = func(userId uint, deletedBefore time.Time, audit *domains.AuditEntry) (bool, rest_errors.RestErr) {
+		audits = append(audits, audit)
+		// user 4 was restored meanwhile
+		return userId == 3, nil
+	}
+	repositories.UserRepository = &UserRespositoryMock{}
+
+	n, err := UserService.PurgeDeletedAccounts()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Len(t, audits, 2)
+	assert.Equal(t, AuditUserPurged, audits[0].Action)
+	assert.Nil(t, audits[0].ActorID)
+	assert.EqualValues(t, 3, *audits[0].TargetID)
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+	"github.com/alidevjimmy/user_microservice_t/utils/broker"
+)
+
+const (
+	WebhookSecretPrefix = "whsec_"
+
+	// HeaderWebhookID is id of event, it is the same on every attempt so receivers can drop repeated ones
+	HeaderWebhookID    = "X-Webhook-Id"
+	HeaderWebhookEvent = "X-Webhook-Event"
+	// HeaderWebhookSignature is t=<unix time>,v1=<hex of HMAC-SHA256 of "<unix time>.<body>" by secret of webhook>
+	HeaderWebhookSignature = "X-Webhook-Signature"
+
+	WebhookDeliveryInterval = time.Second
+	// WebhookMaxAttempts is how many times a delivery is tried before it is dead, dead deliveries are sent only if replayed
+	WebhookMaxAttempts = 8
+
+	DefaultWebhookDeliveriesPageSize = 50
+
+	webhookBatchSize = 50
+	// webhookLease is how long a worker has to send deliveries it took before another worker may take them
+	webhookLease         = 2 * time.Minute
+	webhookTimeout       = 10 * time.Second
+	webhookRetryDelay    = 30 * time.Second
+	webhookMaxRetryDelay = 2 * time.Hour
+)
+
+var (
+	WebhookService webhookServiceInterface = &webhookService{}
+
+	// webhookClient sends deliveries, it does not follow redirects so a delivery goes only where it is configured to
+	webhookClient = &http.Client{
+		Timeout: webhookTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+)
+
+type webhookServiceInterface interface {
+	Create(req domains.CreateWebhookRequest, actor domains.Actor) (*domains.CreateWebhookResponse, rest_errors.RestErr)
+	List() ([]domains.Webhook, rest_errors.RestErr)
+	Delete(id uint, actor domains.Actor) rest_errors.RestErr
+	Deliveries(webhookID uint, params domains.GetWebhookDeliveriesRequest) (*domains.GetWebhookDeliveriesResponse, rest_errors.RestErr)
+	Replay(deliveryID uint, actor domains.Actor) (*domains.WebhookDelivery, rest_errors.RestErr)
+	Enqueue(event domains.Event, body []byte) rest_errors.RestErr
+	Deliver(ctx context.Context) (int, rest_errors.RestErr)
+}
+
+type webhookService struct{}
+
+// webhookBroker queues events published by outbox relay for webhooks subscribed to them
+type webhookBroker struct{}
+
+// WebhookBroker returns broker which queues events for webhooks, see RunWebhookDeliveries for sending them
+func WebhookBroker() broker.Broker {
+	return webhookBroker{}
+}
+
+func (webhookBroker) Publish(ctx context.Context, m broker.Message) error {
+	event := domains.Event{}
+	if err := json.Unmarshal(m.Body, &event); err != nil {
+		return err
+	}
+	if err := WebhookService.Enqueue(event, m.Body); err != nil {
+		return fmt.Errorf("webhooks: %s", err.Message())
+	}
+	return nil
+}
+
+// RunWebhookDeliveries sends due deliveries every interval until ctx is done, onError is told of failures of
+// the queue itself
+func RunWebhookDeliveries(ctx context.Context, interval time.Duration, onError func(rest_errors.RestErr)) {
+	for {
+		n, err := WebhookService.Deliver(ctx)
+		if err != nil {
+			onError(err)
+		}
+		// a full batch means more deliveries are waiting
+		if err == nil && n == webhookBatchSize && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// SignWebhook returns value of HeaderWebhookSignature for body sent at
+func SignWebhook(secret string, at time.Time, body []byte) string {
+	t := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Create makes a webhook with a new signing secret, secret is returned once
+func (*webhookService) Create(req domains.CreateWebhookRequest, actor domains.Actor) (*domains.CreateWebhookResponse, rest_errors.RestErr) {
+	secret, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	webhook := &domains.Webhook{
+		URL:         req.URL,
+		Description: req.Description,
+		Events:      strings.Join(req.Events, " "),
+		Secret:      WebhookSecretPrefix + secret,
+		CreatedBy:   actor.UserID,
+	}
+	audit := actor.Audit(AuditWebhookCreated, 0, domains.AuditChanges{
+		"url":    {After: webhook.URL},
+		"events": {After: webhook.Events},
+	})
+	if err := repositories.WebhookRepository.CreateWebhook(webhook, audit); err != nil {
+		return nil, err
+	}
+	return &domains.CreateWebhookResponse{Webhook: *webhook, Secret: webhook.Secret}, nil
+}
+
+func (*webhookService) List() ([]domains.Webhook, rest_errors.RestErr) {
+	return repositories.WebhookRepository.GetWebhooks()
+}
+
+// Delete removes webhook, deliveries waiting for it are dropped and the log of sent ones is kept
+func (*webhookService) Delete(id uint, actor domains.Actor) rest_errors.RestErr {
+	audit := actor.Audit(AuditWebhookDeleted, 0, domains.AuditChanges{"webhook_id": {Before: id}})
+	deleted, err := repositories.WebhookRepository.DeleteWebhook(id, audit)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return errors.NewNotFoundError(errors.WebhookNotFound)
+	}
+	return nil
+}
+
+// Deliveries returns a page of deliveries of webhook, newest first
+func (*webhookService) Deliveries(webhookID uint, params domains.GetWebhookDeliveriesRequest) (*domains.GetWebhookDeliveriesResponse, rest_errors.RestErr) {
+	webhook, err := repositories.WebhookRepository.GetWebhook(webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if webhook == nil {
+		return nil, errors.NewNotFoundError(errors.WebhookNotFound)
+	}
+	if params.Limit == 0 {
+		params.Limit = DefaultWebhookDeliveriesPageSize
+	}
+	beforeID, err := decodeCursor(params.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	// one extra row tells whether there is a next page
+	deliveries, err := repositories.WebhookRepository.GetWebhookDeliveries(webhookID, params.Status, beforeID, params.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+	res := &domains.GetWebhookDeliveriesResponse{Deliveries: deliveries}
+	if len(deliveries) > params.Limit {
+		res.Deliveries = deliveries[:params.Limit]
+		res.NextCursor = encodeCursor(res.Deliveries[params.Limit-1].ID)
+	}
+	return res, nil
+}
+
+// Replay sends delivery again as soon as possible with a fresh count of attempts, dead deliveries included
+func (*webhookService) Replay(deliveryID uint, actor domains.Actor) (*domains.WebhookDelivery, rest_errors.RestErr) {
+	audit := actor.Audit(AuditWebhookReplayed, 0, domains.AuditChanges{"delivery_id": {After: deliveryID}})
+	delivery, err := repositories.WebhookRepository.ReplayWebhookDelivery(deliveryID, audit)
+	if err != nil {
+		return nil, err
+	}
+	if delivery == nil {
+		return nil, errors.NewNotFoundError(errors.WebhookDeliveryNotFound)
+	}
+	return delivery, nil
+}
+
+// Enqueue queues event for every webhook subscribed to its type, body is sent as it is
+func (*webhookService) Enqueue(event domains.Event, body []byte) rest_errors.RestErr {
+	webhooks, err := repositories.WebhookRepository.GetWebhooks()
+	if err != nil {
+		return err
+	}
+	deliveries := []domains.WebhookDelivery{}
+	now := time.Now()
+	for _, webhook := range webhooks {
+		if !subscribed(webhook, event.Type) {
+			continue
+		}
+		deliveries = append(deliveries, domains.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       string(body),
+			Status:        domains.WebhookDeliveryPending,
+			NextAttemptAt: now,
+		})
+	}
+	return repositories.WebhookRepository.CreateWebhookDeliveries(deliveries)
+}
+
+// Deliver sends a batch of due deliveries and returns how many were taken. A failed delivery is retried
+// later with growing delay until WebhookMaxAttempts, then it is dead
+func (*webhookService) Deliver(ctx context.Context) (int, rest_errors.RestErr) {
+	deliveries, err := repositories.WebhookRepository.ClaimWebhookDeliveries(webhookBatchSize, webhookLease)
+	if err != nil {
+		return 0, err
+	}
+	webhooks := map[uint]*domains.Webhook{}
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		webhook, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			if webhook, err = repositories.WebhookRepository.GetWebhook(delivery.WebhookID); err != nil {
+				return i, err
+			}
+			webhooks[delivery.WebhookID] = webhook
+		}
+		if webhook == nil {
+			delivery.Status = domains.WebhookDeliveryDead
+			delivery.LastError = "webhook is deleted"
+		} else {
+			sendWebhook(ctx, webhook, delivery)
+		}
+		if err := repositories.WebhookRepository.UpdateWebhookDelivery(delivery); err != nil {
+			return i, err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// sendWebhook posts delivery to webhook once and records the outcome in delivery
+func sendWebhook(ctx context.Context, webhook *domains.Webhook, delivery *domains.WebhookDelivery) {
+	delivery.Attempts++
+	delivery.LastStatusCode = 0
+	delivery.LastError = ""
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err == nil {
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(HeaderWebhookID, strconv.FormatUint(uint64(delivery.EventID), 10))
+		req.Header.Set(HeaderWebhookEvent, delivery.EventType)
+		req.Header.Set(HeaderWebhookSignature, SignWebhook(webhook.Secret, time.Now(), body))
+		var res *http.Response
+		if res, err = webhookClient.Do(req); err == nil {
+			res.Body.Close()
+			delivery.LastStatusCode = res.StatusCode
+			if res.StatusCode >= 200 && res.StatusCode <= 299 {
+				now := time.Now()
+				delivery.Status = domains.WebhookDeliverySucceeded
+				delivery.DeliveredAt = &now
+				return
+			}
+			err = fmt.Errorf("%s answered %s", webhook.URL, res.Status)
+		}
+	}
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= WebhookMaxAttempts {
+		delivery.Status = domains.WebhookDeliveryDead
+		return
+	}
+	delivery.NextAttemptAt = time.Now().Add(webhookRetryDelayOf(delivery.Attempts))
+}
+
+// webhookRetryDelayOf doubles webhookRetryDelay by attempts made after the first, up to webhookMaxRetryDelay
+func webhookRetryDelayOf(attempts int) time.Duration {
+	if attempts > 12 {
+		return webhookMaxRetryDelay
+	}
+	delay := webhookRetryDelay << uint(attempts-1)
+	if delay > webhookMaxRetryDelay {
+		return webhookMaxRetryDelay
+	}
+	return delay
+}
+
+// subscribed reports whether webhook wants events of type, webhook with no events wants all of them
+func subscribed(webhook domains.Webhook, eventType string) bool {
+	if webhook.Events == "" {
+		return true
+	}
+	for _, e := range strings.Fields(webhook.Events) {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
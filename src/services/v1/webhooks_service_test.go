@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alidevjimmy/go-rest-utils/rest_errors"
+	"github.com/alidevjimmy/user_microservice_t/domains/v1"
+	"github.com/alidevjimmy/user_microservice_t/errors/v1"
+	repositories "github.com/alidevjimmy/user_microservice_t/repositories/postgres/v1"
+	"github.com/alidevjimmy/user_microservice_t/utils/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+// WebhookRepositoryMock keeps webhooks and their deliveries in memory, ids start from 1
+type WebhookRepositoryMock struct {
+	webhooks   []*domains.Webhook
+	deliveries []*domains.WebhookDelivery
+	audits     []*domains.AuditEntry
+}
+
+func (m *WebhookRepositoryMock) CreateWebhook(webhook *domains.Webhook, audit *domains.AuditEntry) rest_errors.RestErr {
+	webhook.ID = uint(len(m.webhooks) + 1)
+	m.webhooks = append(m.webhooks, webhook)
+	m.audits = append(m.audits, audit)
+	return nil
+}
+
+func (m *WebhookRepositoryMock) GetWebhook(id uint) (*domains.Webhook, rest_errors.RestErr) {
+	for _, webhook := range m.webhooks {
+		if webhook.ID == id && !webhook.DeletedAt.Valid {
+			w := *webhook
+			return &w, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *WebhookRepositoryMock) GetWebhooks() ([]domains.Webhook, rest_errors.RestErr) {
+	webhooks := []domains.Webhook{}
+	for _, webhook := range m.webhooks {
+		if !webhook.DeletedAt.Valid {
+			webhooks = append(webhooks, *webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (m *WebhookRepositoryMock) DeleteWebhook(id uint, audit *domains.AuditEntry) (bool, rest_errors.RestErr) {
+	for _, webhook := range m.webhooks {
+		if webhook.ID == id && !webhook.DeletedAt.Valid {
+			webhook.DeletedAt.Time, webhook.DeletedAt.Valid = time.Now(), true
+			m.audits = append(m.audits, audit)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *WebhookRepositoryMock) CreateWebhookDeliveries(deliveries []domains.WebhookDelivery) rest_errors.RestErr {
+	for i := range deliveries {
+		duplicate := false
+		for _, d := range m.deliveries {
+			duplicate = duplicate || d.WebhookID == deliveries[i].WebhookID && d.EventID == deliveries[i].EventID
+		}
+		if !duplicate {
+			delivery := deliveries[i]
+			delivery.ID = uint(len(m.deliveries) + 1)
+			m.deliveries = append(m.deliveries, &delivery)
+		}
+	}
+	return nil
+}
+
+func (m *WebhookRepositoryMock) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]domains.WebhookDelivery, rest_errors.RestErr) {
+	deliveries := []domains.WebhookDelivery{}
+	now := time.Now()
+	for _, d := range m.deliveries {
+		if d.Status == domains.WebhookDeliveryPending && !d.NextAttemptAt.After(now) && len(deliveries) < limit {
+			d.NextAttemptAt = now.Add(lease)
+			deliveries = append(deliveries, *d)
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *WebhookRepositoryMock) UpdateWebhookDelivery(delivery *domains.WebhookDelivery) rest_errors.RestErr {
+	d := *delivery
+	m.deliveries[delivery.ID-1] = &d
+	return nil
+}
+
+func (m *WebhookRepositoryMock) GetWebhookDeliveries(webhookID uint, status string, beforeID uint, limit int) ([]domains.WebhookDelivery, rest_errors.RestErr) {
+	deliveries := []domains.WebhookDelivery{}
+	for i := len(m.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		d := m.deliveries[i]
+		if d.WebhookID == webhookID && (status == "" || d.Status == status) && (beforeID == 0 || d.ID < beforeID) {
+			deliveries = append(deliveries, *d)
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *WebhookRepositoryMock) ReplayWebhookDelivery(id uint, audit *domains.AuditEntry) (*domains.WebhookDelivery, rest_errors.RestErr) {
+	if id == 0 || int(id) > len(m.deliveries) {
+		return nil, nil
+	}
+	d := m.deliveries[id-1]
+	d.Status, d.Attempts, d.NextAttemptAt = domains.WebhookDeliveryPending, 0, time.Now()
+	m.audits = append(m.audits, audit)
+	delivery := *d
+	return &delivery, nil
+}
+
+// webhookReceiver answers deliveries with status and keeps requests it got
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(r.status)
+}
+
+func newWebhookTest(t *testing.T, status int) (*WebhookRepositoryMock, *webhookReceiver, *domains.CreateWebhookResponse) {
+	repo := &WebhookRepositoryMock{}
+	repositories.WebhookRepository = repo
+	receiver := &webhookReceiver{status: status}
+	srv := httptest.NewServer(receiver)
+	t.Cleanup(srv.Close)
+
+	res, err := WebhookService.Create(domains.CreateWebhookRequest{URL: srv.URL, Events: []string{domains.EventUserBlocked}},
+		domains.Actor{UserID: 1})
+	assert.Nil(t, err)
+	return repo, receiver, res
+}
+
+// publishEvent publishes event the way outbox relay does
+func publishEvent(t *testing.T, id uint, eventType string) {
+	body, err := json.Marshal(domains.Event{ID: id, Type: eventType, UserID: 4, OccurredAt: time.Now(), Data: json.RawMessage(`{}`)})
+	assert.Nil(t, err)
+	assert.Nil(t, WebhookBroker().Publish(context.Background(), broker.Message{Topic: eventType, Body: body}))
+}
+
+func TestDeliverSignedWebhook(t *testing.T) {
+	repo, receiver, webhook := newWebhookTest(t, http.StatusOK)
+	assert.Regexp(t, "^"+WebhookSecretPrefix, webhook.Secret)
+	assert.Equal(t, AuditWebhookCreated, repo.audits[0].Action)
+
+	publishEvent(t, 1, domains.EventUserBlocked)
+	publishEvent(t, 2, domains.EventUserVerified)
+	// relay publishes at least once, a repeated event is not delivered again
+	publishEvent(t, 1, domains.EventUserBlocked)
+	assert.Len(t, repo.deliveries, 1)
+
+	n, err := WebhookService.Deliver(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Len(t, receiver.requests, 1)
+	req := receiver.requests[0]
+	assert.Equal(t, "1", req.Header.Get(HeaderWebhookID))
+	assert.Equal(t, domains.EventUserBlocked, req.Header.Get(HeaderWebhookEvent))
+	signature := req.Header.Get(HeaderWebhookSignature)
+	var at int64
+	_, scanErr := fmt.Sscanf(signature, "t=%d,", &at)
+	assert.Nil(t, scanErr)
+	assert.Equal(t, SignWebhook(webhook.Secret, time.Unix(at, 0), receiver.bodies[0]), signature)
+	assert.NotEqual(t, SignWebhook("whsec_other", time.Unix(at, 0), receiver.bodies[0]), signature)
+
+	delivery := repo.deliveries[0]
+	assert.Equal(t, domains.WebhookDeliverySucceeded, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusOK, delivery.LastStatusCode)
+	assert.NotNil(t, delivery.DeliveredAt)
+}
+
+func TestWebhookRetriesAndDies(t *testing.T) {
+	repo, receiver, _ := newWebhookTest(t, http.StatusInternalServerError)
+	publishEvent(t, 3, domains.EventUserBlocked)
+
+	for attempt := 1; attempt <= WebhookMaxAttempts; attempt++ {
+		n, err := WebhookService.Deliver(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+		delivery := repo.deliveries[0]
+		assert.Equal(t, attempt, delivery.Attempts)
+		assert.Equal(t, http.StatusInternalServerError, delivery.LastStatusCode)
+		assert.NotEmpty(t, delivery.LastError)
+		if attempt < WebhookMaxAttempts {
+			assert.Equal(t, domains.WebhookDeliveryPending, delivery.Status)
+			assert.WithinDuration(t, time.Now().Add(webhookRetryDelayOf(attempt)), delivery.NextAttemptAt, time.Minute)
+			// not due yet
+			n, err = WebhookService.Deliver(context.Background())
+			assert.Nil(t, err)
+			assert.Equal(t, 0, n)
+			delivery.NextAttemptAt = time.Now()
+		}
+	}
+	assert.Equal(t, domains.WebhookDeliveryDead, repo.deliveries[0].Status)
+	assert.Len(t, receiver.requests, WebhookMaxAttempts)
+
+	dead, err := WebhookService.Deliveries(1, domains.GetWebhookDeliveriesRequest{Status: domains.WebhookDeliveryDead})
+	assert.Nil(t, err)
+	assert.Len(t, dead.Deliveries, 1)
+
+	receiver.status = http.StatusNoContent
+	replayed, err := WebhookService.Replay(1, domains.Actor{UserID: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, domains.WebhookDeliveryPending, replayed.Status)
+	assert.Equal(t, AuditWebhookReplayed, repo.audits[1].Action)
+	_, err = WebhookService.Deliver(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, domains.WebhookDeliverySucceeded, repo.deliveries[0].Status)
+	assert.Equal(t, 1, repo.deliveries[0].Attempts)
+
+	_, err = WebhookService.Replay(2, domains.Actor{UserID: 1})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.WebhookDeliveryNotFoundErrorMessage, err.Message())
+}
+
+func TestDeliveryOfDeletedWebhookDies(t *testing.T) {
+	repo, receiver, webhook := newWebhookTest(t, http.StatusOK)
+	// delivery is kept by mock as if a worker had taken it while webhook was deleted
+	publishEvent(t, 5, domains.EventUserBlocked)
+	assert.Nil(t, WebhookService.Delete(webhook.Webhook.ID, domains.Actor{UserID: 1}))
+	err := WebhookService.Delete(webhook.Webhook.ID, domains.Actor{UserID: 1})
+	assert.NotNil(t, err)
+	assert.Equal(t, errors.WebhookNotFoundErrorMessage, err.Message())
+
+	_, err = WebhookService.Deliver(context.Background())
+	assert.Nil(t, err)
+	assert.Empty(t, receiver.requests)
+	assert.Equal(t, domains.WebhookDeliveryDead, repo.deliveries[0].Status)
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	assert.Equal(t, webhookRetryDelay, webhookRetryDelayOf(1))
+	assert.Equal(t, 4*webhookRetryDelay, webhookRetryDelayOf(3))
+	assert.Equal(t, webhookMaxRetryDelay, webhookRetryDelayOf(40))
+}
+
+func TestSubscribed(t *testing.T) {
+	assert.True(t, subscribed(domains.Webhook{}, domains.EventUserBlocked))
+	assert.True(t, subscribed(domains.Webhook{Events: "UserVerified UserBlocked"}, domains.EventUserBlocked))
+	assert.False(t, subscribed(domains.Webhook{Events: "UserVerified"}, domains.EventUserBlocked))
+}
@@ -0,0 +1,113 @@
+// Package broker carries domain events to other services. Outbox relay publishes to a Broker,
+// Local delivers messages in process and HTTP posts them to an endpoint
+package broker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	HeaderMessageID = "X-Message-Id"
+	HeaderTopic     = "X-Message-Topic"
+	HeaderKey       = "X-Message-Key"
+)
+
+// Message is an event as sent to broker. Delivery is at least once, consumers drop IDs they saw
+type Message struct {
+	ID    string
+	Topic string
+	// Key groups messages of one entity, messages of a key are published in the order they happened
+	Key  string
+	Body []byte
+}
+
+type Broker interface {
+	Publish(ctx context.Context, m Message) error
+}
+
+// Local delivers messages to subscribers of this process and keeps them, it is meant for tests
+// and services running as a single instance
+type Local struct {
+	mu       sync.Mutex
+	handlers map[string][]func(Message)
+	messages []Message
+}
+
+func NewLocal() *Local {
+	return &Local{handlers: map[string][]func(Message){}}
+}
+
+// Subscribe calls handler with every later message of topic, empty topic subscribes to all
+func (l *Local) Subscribe(topic string, handler func(Message)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.handlers[topic] = append(l.handlers[topic], handler)
+}
+
+func (l *Local) Publish(ctx context.Context, m Message) error {
+	l.mu.Lock()
+	l.messages = append(l.messages, m)
+	handlers := append(append([]func(Message){}, l.handlers[""]...), l.handlers[m.Topic]...)
+	l.mu.Unlock()
+	for _, handler := range handlers {
+		handler(m)
+	}
+	return nil
+}
+
+// Messages returns messages published so far, oldest first
+func (l *Local) Messages() []Message {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Message{}, l.messages...)
+}
+
+// HTTP posts each message as json body to URL, id, topic and key are sent as headers.
+// Any 2xx status means the message is taken
+type HTTP struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewHTTP(url string) *HTTP {
+	return &HTTP{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (h *HTTP) Publish(ctx context.Context, m Message) error {
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(m.Body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderMessageID, m.ID)
+	req.Header.Set(HeaderTopic, m.Topic)
+	req.Header.Set(HeaderKey, m.Key)
+	res, err := h.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("broker: %s answered %s", h.URL, res.Status)
+	}
+	return nil
+}
+
+// Multi publishes each message to all of its brokers in order and stops at the first failure,
+// a failed message is published again to every broker so consumers must drop IDs they saw
+type Multi []Broker
+
+func (m Multi) Publish(ctx context.Context, msg Message) error {
+	for _, b := range m {
+		if err := b.Publish(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package broker
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalDeliversToSubscribers(t *testing.T) {
+	b := NewLocal()
+	var all, blocked []string
+	b.Subscribe("", func(m Message) { all = append(all, m.ID) })
+	b.Subscribe("UserBlocked", func(m Message) { blocked = append(blocked, m.ID) })
+
+	assert.Nil(t, b.Publish(context.Background(), Message{ID: "1", Topic: "UserVerified"}))
+	assert.Nil(t, b.Publish(context.Background(), Message{ID: "2", Topic: "UserBlocked"}))
+	assert.Equal(t, []string{"1", "2"}, all)
+	assert.Equal(t, []string{"2"}, blocked)
+	assert.Len(t, b.Messages(), 2)
+}
+
+func TestHTTPPostsMessage(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	status := http.StatusAccepted
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	b := NewHTTP(srv.URL)
+
+	err := b.Publish(context.Background(), Message{ID: "7", Topic: "UserBlocked", Key: "3", Body: []byte(`{"user_id":3}`)})
+	assert.Nil(t, err)
+	assert.Equal(t, "7", got.Header.Get(HeaderMessageID))
+	assert.Equal(t, "UserBlocked", got.Header.Get(HeaderTopic))
+	assert.Equal(t, "3", got.Header.Get(HeaderKey))
+	assert.JSONEq(t, `{"user_id":3}`, string(body))
+
+	status = http.StatusInternalServerError
+	assert.NotNil(t, b.Publish(context.Background(), Message{ID: "8"}))
+}
+
+func TestMultiStopsAtFailure(t *testing.T) {
+	first, last := NewLocal(), NewLocal()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	assert.Nil(t, Multi{first, last}.Publish(context.Background(), Message{ID: "1"}))
+	assert.NotNil(t, Multi{first, NewHTTP(srv.URL), last}.Publish(context.Background(), Message{ID: "2"}))
+	assert.Len(t, first.Messages(), 2)
+	assert.Len(t, last.Messages(), 1)
+}
@@ -0,0 +1,309 @@
+// Package oidc is a minimal OpenID Connect relying party: discovery, authorization code flow
+// with PKCE and verification of RS256 id tokens
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	DiscoveryPath = "/.well-known/openid-configuration"
+
+	ScopeOpenID = "openid"
+
+	// leeway tolerates clock skew between this service and provider
+	leeway = time.Minute
+	// maxBody limits what is read from provider
+	maxBody = 1 << 20
+)
+
+var (
+	ErrInvalidToken = errors.New("oidc: invalid id token")
+	ErrNonce        = errors.New("oidc: nonce does not match")
+)
+
+type (
+	// Config is how this service is registered at a provider
+	Config struct {
+		Issuer       string
+		ClientID     string
+		ClientSecret string
+		RedirectURI  string
+		Scopes       []string
+	}
+
+	// Metadata is the part of discovery document a relying party needs
+	Metadata struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JwksURI               string `json:"jwks_uri"`
+	}
+
+	// Claims are verified claims of an id token
+	Claims struct {
+		Subject             string `json:"sub"`
+		Email               string `json:"email,omitempty"`
+		EmailVerified       bool   `json:"email_verified,omitempty"`
+		Name                string `json:"name,omitempty"`
+		GivenName           string `json:"given_name,omitempty"`
+		FamilyName          string `json:"family_name,omitempty"`
+		PhoneNumber         string `json:"phone_number,omitempty"`
+		PhoneNumberVerified bool   `json:"phone_number_verified,omitempty"`
+		Nonce               string `json:"nonce,omitempty"`
+	}
+
+	// Provider talks to one provider, metadata and keys are fetched on first use and cached
+	Provider struct {
+		config Config
+		client *http.Client
+
+		mu       sync.Mutex
+		metadata *Metadata
+		keys     map[string]*rsa.PublicKey
+	}
+
+	tokenResponse struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+)
+
+// NewProvider does not touch network, client defaults to a client with a timeout
+func NewProvider(config Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{ScopeOpenID}
+	}
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	return &Provider{config: config, client: client}
+}
+
+// AuthCodeURL is where user agent is sent to sign in at provider
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(m.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.config.ClientID)
+	q.Set("redirect_uri", p.config.RedirectURI)
+	q.Set("scope", strings.Join(p.config.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Exchange redeems code at token endpoint and returns verified claims of id token
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURI},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	tr := new(tokenResponse)
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxBody)).Decode(tr); err != nil {
+		return nil, fmt.Errorf("oidc: token response: %w", err)
+	}
+	if res.StatusCode != http.StatusOK || tr.Error != "" {
+		return nil, fmt.Errorf("oidc: token endpoint answered %d %s %s", res.StatusCode, tr.Error, tr.ErrorDescription)
+	}
+	if tr.IDToken == "" {
+		return nil, fmt.Errorf("oidc: token response has no id_token")
+	}
+	return p.Verify(ctx, tr.IDToken, nonce)
+}
+
+// Verify checks signature, issuer, audience, expiry and nonce of raw
+func (p *Provider) Verify(ctx context.Context, raw, nonce string) (*Claims, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mc := jwt.MapClaims{}
+	parser := &jwt.Parser{ValidMethods: []string{jwt.SigningMethodRS256.Alg()}, SkipClaimsValidation: true}
+	_, err = parser.ParseWithClaims(raw, mc, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, m, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	now := time.Now()
+	switch {
+	case !mc.VerifyIssuer(m.Issuer, true):
+		return nil, fmt.Errorf("%w: issuer", ErrInvalidToken)
+	case !hasAudience(mc["aud"], p.config.ClientID):
+		return nil, fmt.Errorf("%w: audience", ErrInvalidToken)
+	case !mc.VerifyExpiresAt(now.Add(-leeway).Unix(), true):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	case !mc.VerifyIssuedAt(now.Add(leeway).Unix(), false):
+		return nil, fmt.Errorf("%w: issued in future", ErrInvalidToken)
+	}
+	b, err := json.Marshal(mc)
+	if err != nil {
+		return nil, err
+	}
+	claims := new(Claims)
+	if err := json.Unmarshal(b, claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidToken)
+	}
+	if claims.Nonce != nonce {
+		return nil, ErrNonce
+	}
+	return claims, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+	m := new(Metadata)
+	if err := p.get(ctx, p.config.Issuer+DiscoveryPath, m); err != nil {
+		return nil, err
+	}
+	if m.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("oidc: issuer %q of discovery document is not %q", m.Issuer, p.config.Issuer)
+	}
+	p.metadata = m
+	return m, nil
+}
+
+// key returns signing key kid, keys are fetched again once when kid is unknown so providers can rotate
+func (p *Provider) key(ctx context.Context, m *Metadata, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	set := new(jwks)
+	if err := p.get(ctx, m.JwksURI, set); err != nil {
+		return nil, err
+	}
+	p.keys = map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		p.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	k, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("oidc: unknown key %q", kid)
+	}
+	return k, nil
+}
+
+func (p *Provider) get(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	res, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxBody))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: GET %s answered %d", u, res.StatusCode)
+	}
+	return json.Unmarshal(body, v)
+}
+
+func hasAudience(aud interface{}, clientID string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == clientID
+	case []interface{}:
+		for _, v := range a {
+			if s, ok := v.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RandomString is an unguessable url safe string, used for state, nonce and code verifier
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallengeS256 derives PKCE challenge of verifier, see RFC 7636
+func CodeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
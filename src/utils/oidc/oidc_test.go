@@ -0,0 +1,67 @@
+package oidc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alidevjimmy/user_microservice_t/utils/oidc"
+	"github.com/alidevjimmy/user_microservice_t/utils/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+)
+
+const redirectURI = "https://service.example/callback"
+
+func signIn(t *testing.T, op *oidctest.Provider, rp *oidc.Provider, nonce, verifier string) string {
+	authURL, err := rp.AuthCodeURL(context.Background(), "state", nonce, oidc.CodeChallengeS256(verifier))
+	assert.Nil(t, err)
+	q, err := op.Callback(authURL)
+	assert.Nil(t, err)
+	assert.Equal(t, "state", q.Get("state"))
+	return q.Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	op := oidctest.NewProvider()
+	defer op.Close()
+	op.SignIn(oidc.Claims{Subject: "42", Email: "ali@example.com", EmailVerified: true})
+	rp := oidc.NewProvider(op.Config(redirectURI), nil)
+
+	code := signIn(t, op, rp, "nonce", "verifier")
+	claims, err := rp.Exchange(context.Background(), code, "verifier", "nonce")
+	assert.Nil(t, err)
+	assert.Equal(t, "42", claims.Subject)
+	assert.Equal(t, "ali@example.com", claims.Email)
+	assert.True(t, claims.EmailVerified)
+}
+
+func TestExchangeWrongNonce(t *testing.T) {
+	op := oidctest.NewProvider()
+	defer op.Close()
+	rp := oidc.NewProvider(op.Config(redirectURI), nil)
+
+	code := signIn(t, op, rp, "nonce", "verifier")
+	_, err := rp.Exchange(context.Background(), code, "verifier", "other-nonce")
+	assert.Equal(t, oidc.ErrNonce, err)
+}
+
+func TestExchangeWrongVerifier(t *testing.T) {
+	op := oidctest.NewProvider()
+	defer op.Close()
+	rp := oidc.NewProvider(op.Config(redirectURI), nil)
+
+	code := signIn(t, op, rp, "nonce", "verifier")
+	_, err := rp.Exchange(context.Background(), code, "other-verifier", "nonce")
+	assert.NotNil(t, err)
+}
+
+func TestExchangeTokenOfOtherClient(t *testing.T) {
+	op := oidctest.NewProvider()
+	defer op.Close()
+	op.Audience = "other-client"
+	rp := oidc.NewProvider(op.Config(redirectURI), nil)
+
+	code := signIn(t, op, rp, "nonce", "verifier")
+	_, err := rp.Exchange(context.Background(), code, "verifier", "nonce")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "audience")
+}
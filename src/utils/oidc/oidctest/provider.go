@@ -0,0 +1,207 @@
+// Package oidctest runs an OpenID Connect provider in process, so social login is tested offline
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/alidevjimmy/user_microservice_t/utils/oidc"
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	ClientID     = "test-client"
+	ClientSecret = "test-secret"
+
+	AuthorizePath = "/authorize"
+	TokenPath     = "/token"
+	JWKSPath      = "/jwks"
+
+	keyID = "test-key"
+)
+
+type (
+	// Provider signs in whoever User is at the moment, without asking anything
+	Provider struct {
+		*httptest.Server
+
+		mu    sync.Mutex
+		user  oidc.Claims
+		key   *rsa.PrivateKey
+		codes map[string]grant
+		// Audience overrides aud of id tokens, to test tokens issued to other clients
+		Audience string
+	}
+
+	grant struct {
+		redirectURI   string
+		nonce         string
+		codeChallenge string
+		user          oidc.Claims
+	}
+)
+
+// NewProvider starts a provider, callers must Close it
+func NewProvider() *Provider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	p := &Provider{key: key, codes: map[string]grant{}, user: oidc.Claims{Subject: "subject"}}
+	mux := http.NewServeMux()
+	mux.HandleFunc(oidc.DiscoveryPath, p.discovery)
+	mux.HandleFunc(AuthorizePath, p.authorize)
+	mux.HandleFunc(TokenPath, p.token)
+	mux.HandleFunc(JWKSPath, p.jwks)
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+// Config is how a relying party redirecting to redirectURI is registered at p
+func (p *Provider) Config(redirectURI string) oidc.Config {
+	return oidc.Config{
+		Issuer:       p.URL,
+		ClientID:     ClientID,
+		ClientSecret: ClientSecret,
+		RedirectURI:  redirectURI,
+		Scopes:       []string{oidc.ScopeOpenID, "email", "phone"},
+	}
+}
+
+// SignIn makes user the one signed in at p
+func (p *Provider) SignIn(user oidc.Claims) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.user = user
+}
+
+// Callback follows authURL like a browser would and returns query provider sends to redirect uri
+func (p *Provider) Callback(authURL string) (url.Values, error) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(authURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	loc, err := res.Location()
+	if err != nil {
+		return nil, err
+	}
+	return loc.Query(), nil
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, oidc.Metadata{
+		Issuer:                p.URL,
+		AuthorizationEndpoint: p.URL + AuthorizePath,
+		TokenEndpoint:         p.URL + TokenPath,
+		JwksURI:               p.URL + JWKSPath,
+	})
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || q.Get("client_id") != ClientID || q.Get("response_type") != "code" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	code, err := oidc.RandomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	p.mu.Lock()
+	p.codes[code] = grant{redirectURI: q.Get("redirect_uri"), nonce: q.Get("nonce"), codeChallenge: q.Get("code_challenge"), user: p.user}
+	p.mu.Unlock()
+	rq := redirect.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	redirect.RawQuery = rq.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	id, _ = url.QueryUnescape(id)
+	secret, _ = url.QueryUnescape(secret)
+	if id != ClientID || secret != ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	p.mu.Lock()
+	g, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+	if !ok || g.redirectURI != r.PostForm.Get("redirect_uri") || g.codeChallenge != oidc.CodeChallengeS256(r.PostForm.Get("code_verifier")) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	idToken, err := p.idToken(g)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"use": "sig",
+		"alg": "RS256",
+		"kid": keyID,
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
+
+func (p *Provider) idToken(g grant) (string, error) {
+	b, err := json.Marshal(g.user)
+	if err != nil {
+		return "", err
+	}
+	claims := jwt.MapClaims{}
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return "", err
+	}
+	aud := ClientID
+	if p.Audience != "" {
+		aud = p.Audience
+	}
+	now := time.Now()
+	claims["iss"] = p.URL
+	claims["aud"] = aud
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(time.Hour).Unix()
+	claims["nonce"] = g.nonce
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = keyID
+	return t.SignedString(p.key)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
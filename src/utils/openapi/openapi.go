@@ -0,0 +1,381 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Version = "3.0.3"
+
+	InBody   = "body"
+	InQuery  = "query"
+	InPath   = "path"
+	InHeader = "header"
+
+	MIMEApplicationJSON = "application/json"
+	MIMEApplicationForm = "application/x-www-form-urlencoded"
+)
+
+var (
+	echoParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+	timeType  = reflect.TypeOf(time.Time{})
+)
+
+type (
+	// Document is an OpenAPI 3 document, only parts this service uses are modeled
+	Document struct {
+		OpenAPI    string              `json:"openapi"`
+		Info       Info                `json:"info"`
+		Paths      map[string]PathItem `json:"paths"`
+		Components Components          `json:"components"`
+		patterns   map[string]string
+	}
+
+	Info struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	}
+
+	Components struct {
+		Schemas         map[string]*Schema         `json:"schemas"`
+		SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+	}
+
+	SecurityScheme struct {
+		Type   string `json:"type"`
+		Scheme string `json:"scheme,omitempty"`
+		In     string `json:"in,omitempty"`
+		Name   string `json:"name,omitempty"`
+	}
+
+	// PathItem maps lower case http methods to operations
+	PathItem map[string]*Operation
+
+	Operation struct {
+		OperationID string                `json:"operationId"`
+		Summary     string                `json:"summary,omitempty"`
+		Tags        []string              `json:"tags,omitempty"`
+		Parameters  []Parameter           `json:"parameters,omitempty"`
+		RequestBody *RequestBody          `json:"requestBody,omitempty"`
+		Responses   map[string]Response   `json:"responses"`
+		Security    []map[string][]string `json:"security,omitempty"`
+	}
+
+	Parameter struct {
+		Name     string  `json:"name"`
+		In       string  `json:"in"`
+		Required bool    `json:"required,omitempty"`
+		Schema   *Schema `json:"schema"`
+	}
+
+	RequestBody struct {
+		Required bool                 `json:"required"`
+		Content  map[string]MediaType `json:"content"`
+	}
+
+	MediaType struct {
+		Schema *Schema `json:"schema"`
+	}
+
+	Response struct {
+		Description string               `json:"description"`
+		Content     map[string]MediaType `json:"content,omitempty"`
+	}
+
+	Schema struct {
+		Ref        string             `json:"$ref,omitempty"`
+		Type       string             `json:"type,omitempty"`
+		Format     string             `json:"format,omitempty"`
+		Properties map[string]*Schema `json:"properties,omitempty"`
+		Required   []string           `json:"required,omitempty"`
+		Items      *Schema            `json:"items,omitempty"`
+		Enum       []string           `json:"enum,omitempty"`
+		Pattern    string             `json:"pattern,omitempty"`
+		Minimum    *float64           `json:"minimum,omitempty"`
+		Maximum    *float64           `json:"maximum,omitempty"`
+		MinLength  *uint64            `json:"minLength,omitempty"`
+		MaxLength  *uint64            `json:"maxLength,omitempty"`
+		Nullable   bool               `json:"nullable,omitempty"`
+	}
+
+	// Route describes one endpoint, Request and Response are zero values of domain structs
+	Route struct {
+		Method    string
+		Path      string
+		Name      string
+		Summary   string
+		Tag       string
+		Request   interface{}
+		RequestIn string
+		// RequestType is media type of request body, json by default
+		RequestType string
+		// Parameters are read by handler directly, not bound to Request
+		Parameters []Parameter
+		Response   interface{}
+		Status     int
+		Security   string
+		// AltSecurity are schemes accepted instead of Security
+		AltSecurity []string
+	}
+)
+
+// New makes an empty document, patterns maps custom validate tags to regular expressions they check
+func New(title, version string, patterns map[string]string) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Version: version},
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+		},
+		patterns: patterns,
+	}
+}
+
+// AddSecurityScheme documents an api key sent in header
+func (d *Document) AddSecurityScheme(name, header string) {
+	d.addSecurityScheme(name, &SecurityScheme{Type: "apiKey", In: "header", Name: header})
+}
+
+// AddBasicSecurityScheme documents http basic authentication
+func (d *Document) AddBasicSecurityScheme(name string) {
+	d.addSecurityScheme(name, &SecurityScheme{Type: "http", Scheme: "basic"})
+}
+
+func (d *Document) addSecurityScheme(name string, s *SecurityScheme) {
+	if d.Components.SecuritySchemes == nil {
+		d.Components.SecuritySchemes = map[string]*SecurityScheme{}
+	}
+	d.Components.SecuritySchemes[name] = s
+}
+
+// Add documents r, errors of every operation are described by errorBody
+func (d *Document) Add(r Route, errorBody interface{}) {
+	path, params := Path(r.Path)
+	op := &Operation{
+		OperationID: r.Name,
+		Summary:     r.Summary,
+		Responses:   map[string]Response{},
+	}
+	if r.Tag != "" {
+		op.Tags = []string{r.Tag}
+	}
+	for _, p := range params {
+		op.Parameters = append(op.Parameters, Parameter{Name: p, In: InPath, Required: true, Schema: &Schema{Type: "string"}})
+	}
+	if r.Request != nil {
+		switch r.RequestIn {
+		case InQuery:
+			op.Parameters = append(op.Parameters, d.queryParameters(reflect.TypeOf(r.Request))...)
+		default:
+			mime := r.RequestType
+			if mime == "" {
+				mime = MIMEApplicationJSON
+			}
+			op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{mime: {Schema: d.SchemaOf(r.Request)}}}
+		}
+	}
+	op.Parameters = append(op.Parameters, r.Parameters...)
+
+	status := r.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	res := Response{Description: http.StatusText(status)}
+	if r.Response != nil {
+		res.Content = jsonContent(d.SchemaOf(r.Response))
+	}
+	op.Responses[strconv.Itoa(status)] = res
+	if errorBody != nil {
+		op.Responses["default"] = Response{Description: "Error", Content: jsonContent(d.SchemaOf(errorBody))}
+	}
+	if r.Security != "" {
+		op.Security = []map[string][]string{{r.Security: {}}}
+	}
+	for _, alt := range r.AltSecurity {
+		op.Security = append(op.Security, map[string][]string{alt: {}})
+	}
+
+	item, ok := d.Paths[path]
+	if !ok {
+		item = PathItem{}
+		d.Paths[path] = item
+	}
+	item[strings.ToLower(r.Method)] = op
+}
+
+// Operations lists "METHOD path" of every documented operation
+func (d *Document) Operations() []string {
+	var ops []string
+	for path, item := range d.Paths {
+		for method := range item {
+			ops = append(ops, strings.ToUpper(method)+" "+path)
+		}
+	}
+	return ops
+}
+
+// Path converts echo path to OpenAPI template and returns names of its parameters
+func Path(echoPath string) (string, []string) {
+	var params []string
+	for _, m := range echoParam.FindAllStringSubmatch(echoPath, -1) {
+		params = append(params, m[1])
+	}
+	return echoParam.ReplaceAllString(echoPath, "{$1}"), params
+}
+
+// SchemaOf returns schema of v, structs are added to components and referenced
+func (d *Document) SchemaOf(v interface{}) *Schema {
+	return d.schemaOf(reflect.TypeOf(v))
+}
+
+func (d *Document) schemaOf(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Ptr {
+		s := d.schemaOf(t.Elem())
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	}
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if _, ok := d.Components.Schemas[t.Name()]; !ok {
+			s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+			// registered before fields so recursive types terminate
+			d.Components.Schemas[t.Name()] = s
+			d.addFields(s, t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: d.schemaOf(t.Elem())}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int:
+		return &Schema{Type: "integer"}
+	case reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		zero := 0.0
+		return &Schema{Type: "integer", Format: "int64", Minimum: &zero}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	default:
+		return &Schema{Type: "object"}
+	}
+}
+
+func (d *Document) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			d.addFields(s, f.Type)
+			continue
+		}
+		name := fieldName(f, "json")
+		if name == "" {
+			continue
+		}
+		prop, required := d.fieldSchema(f)
+		s.Properties[name] = prop
+		if required {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+func (d *Document) queryParameters(t reflect.Type) []Parameter {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var params []Parameter
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := fieldName(f, "query")
+		if name == "" {
+			continue
+		}
+		schema, required := d.fieldSchema(f)
+		params = append(params, Parameter{Name: name, In: InQuery, Required: required, Schema: schema})
+	}
+	return params
+}
+
+// fieldSchema describes f by its type and validate tag, and reports whether it is required
+func (d *Document) fieldSchema(f reflect.StructField) (*Schema, bool) {
+	s := d.schemaOf(f.Type)
+	required := false
+	for _, rule := range strings.Split(f.Tag.Get("validate"), ",") {
+		rule = strings.TrimSpace(rule)
+		tag, param := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			tag, param = rule[:i], rule[i+1:]
+		}
+		switch tag {
+		case "required":
+			required = true
+		case "min", "max":
+			limit(s, tag, param)
+		case "oneof":
+			s.Enum = strings.Fields(param)
+		default:
+			if pattern, ok := d.patterns[tag]; ok {
+				s.Pattern = pattern
+			}
+		}
+	}
+	return s, required
+}
+
+// limit sets length of strings or range of numbers by min and max rules
+func limit(s *Schema, tag, param string) {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+	if s.Type == "string" {
+		l := uint64(n)
+		if tag == "min" {
+			s.MinLength = &l
+		} else {
+			s.MaxLength = &l
+		}
+		return
+	}
+	if tag == "min" {
+		s.Minimum = &n
+	} else {
+		s.Maximum = &n
+	}
+}
+
+func fieldName(f reflect.StructField, tag string) string {
+	if f.PkgPath != "" {
+		return ""
+	}
+	for _, t := range []string{tag, "json"} {
+		name := strings.SplitN(f.Tag.Get(t), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+func jsonContent(s *Schema) map[string]MediaType {
+	return map[string]MediaType{MIMEApplicationJSON: {Schema: s}}
+}
@@ -0,0 +1,75 @@
+package openapi
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testItem struct {
+	ID uint `json:"id"`
+}
+
+type testRequest struct {
+	Name    string     `json:"name" query:"name" validate:"required,min=2,max=10"`
+	Age     int        `json:"age" query:"age" validate:"omitempty,min=1,max=100"`
+	Order   string     `json:"order" query:"order" validate:"omitempty,oneof=asc desc"`
+	Nick    string     `json:"nick" query:"nick" validate:"omitempty,nick"`
+	Since   *time.Time `json:"since" query:"since"`
+	Secret  string     `json:"-"`
+	private string
+}
+
+type testResponse struct {
+	Items []testItem `json:"items"`
+	Next  *testItem  `json:"next"`
+}
+
+func TestPath(t *testing.T) {
+	path, params := Path("/v1/users/:user_id/codes:code")
+	assert.Equal(t, "/v1/users/{user_id}/codes{code}", path)
+	assert.Equal(t, []string{"user_id", "code"}, params)
+}
+
+func TestSchemaOf(t *testing.T) {
+	d := New("test", "1", map[string]string{"nick": "^[a-z]+$"})
+	assert.Equal(t, "#/components/schemas/testRequest", d.SchemaOf(testRequest{}).Ref)
+
+	s := d.Components.Schemas["testRequest"]
+	assert.Len(t, s.Properties, 5)
+	assert.Equal(t, []string{"name"}, s.Required)
+	assert.EqualValues(t, 2, *s.Properties["name"].MinLength)
+	assert.EqualValues(t, 10, *s.Properties["name"].MaxLength)
+	assert.EqualValues(t, 100, *s.Properties["age"].Maximum)
+	assert.Equal(t, []string{"asc", "desc"}, s.Properties["order"].Enum)
+	assert.Equal(t, "^[a-z]+$", s.Properties["nick"].Pattern)
+	assert.Equal(t, "date-time", s.Properties["since"].Format)
+	assert.True(t, s.Properties["since"].Nullable)
+
+	d.SchemaOf(testResponse{})
+	items := d.Components.Schemas["testResponse"].Properties["items"]
+	assert.Equal(t, "array", items.Type)
+	assert.Equal(t, "#/components/schemas/testItem", items.Items.Ref)
+}
+
+func TestAdd(t *testing.T) {
+	d := New("test", "1", nil)
+	d.Add(Route{Method: http.MethodGet, Path: "/items/:id", Name: "getItems", Request: testRequest{}, RequestIn: InQuery, Response: testResponse{}}, nil)
+	d.Add(Route{Method: http.MethodPost, Path: "/items/:id", Name: "addItem", Request: testRequest{}, Status: http.StatusCreated, Security: "token"}, testItem{})
+
+	get := d.Paths["/items/{id}"]["get"]
+	assert.Nil(t, get.RequestBody)
+	assert.Len(t, get.Parameters, 6)
+	assert.Equal(t, Parameter{Name: "id", In: InPath, Required: true, Schema: &Schema{Type: "string"}}, get.Parameters[0])
+	assert.True(t, get.Parameters[1].Required)
+	assert.Contains(t, get.Responses, "200")
+
+	post := d.Paths["/items/{id}"]["post"]
+	assert.NotNil(t, post.RequestBody)
+	assert.Nil(t, post.Responses["201"].Content)
+	assert.Contains(t, post.Responses, "default")
+	assert.Equal(t, []map[string][]string{{"token": {}}}, post.Security)
+	assert.ElementsMatch(t, []string{"GET /items/{id}", "POST /items/{id}"}, d.Operations())
+}
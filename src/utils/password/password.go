@@ -0,0 +1,41 @@
+// Package password hashes passwords of users with bcrypt, each hash has a salt of its own.
+// Hashes of older versions were unsalted sha256, Check still accepts them and tells they need rehashing
+package password
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/alidevjimmy/go-rest-utils/crypto"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cost is the bcrypt cost of new hashes, hashes of a lower cost are rehashed at login
+const Cost = 12
+
+// Hash returns a salted hash of password
+func Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Check tells whether password is the one of hash, and whether hash should be replaced by Hash of password
+// because it is a legacy sha256 hash or of a lower cost
+func Check(hash, password string) (ok, rehash bool) {
+	if !isBcrypt(hash) {
+		ok = subtle.ConstantTimeCompare([]byte(hash), []byte(crypto.GenerateSha256(password))) == 1
+		return ok, ok
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return true, err == nil && cost < Cost
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
@@ -0,0 +1,42 @@
+package password
+
+import (
+	"testing"
+
+	"github.com/alidevjimmy/go-rest-utils/crypto"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashIsSalted(t *testing.T) {
+	a, err := Hash("secret123")
+	assert.Nil(t, err)
+	b, _ := Hash("secret123")
+	assert.NotEqual(t, a, b)
+
+	ok, rehash := Check(a, "secret123")
+	assert.True(t, ok)
+	assert.False(t, rehash)
+	ok, _ = Check(a, "secret124")
+	assert.False(t, ok)
+}
+
+func TestCheckLegacyHash(t *testing.T) {
+	legacy := crypto.GenerateSha256("secret123")
+
+	ok, rehash := Check(legacy, "secret123")
+	assert.True(t, ok)
+	assert.True(t, rehash)
+
+	ok, rehash = Check(legacy, "secret124")
+	assert.False(t, ok)
+	assert.False(t, rehash)
+}
+
+func TestCheckCheaperHash(t *testing.T) {
+	cheap, _ := bcrypt.GenerateFromPassword([]byte("secret123"), bcrypt.MinCost)
+
+	ok, rehash := Check(string(cheap), "secret123")
+	assert.True(t, ok)
+	assert.True(t, rehash)
+}
@@ -0,0 +1,45 @@
+package persian
+
+import (
+	"strings"
+	"unicode"
+)
+
+var (
+	// replacer unifies characters typed differently on Arabic and Persian keyboards
+	replacer = strings.NewReplacer(
+		"ي", "ی",
+		"ى", "ی",
+		"ئ", "ی",
+		"ك", "ک",
+		"ة", "ه",
+		"ۀ", "ه",
+		"أ", "ا",
+		"إ", "ا",
+		"ٱ", "ا",
+		"\u200c", "", // zero width non-joiner
+		"\u200d", "", // zero width joiner
+		"\u200f", "", // right-to-left mark
+		"\u0640", "", // tatweel
+		"\u064b", "", "\u064c", "", "\u064d", "", "\u064e", "", // diacritics
+		"\u064f", "", "\u0650", "", "\u0651", "", "\u0652", "",
+	)
+	digits = strings.NewReplacer(
+		"۰", "0", "۱", "1", "۲", "2", "۳", "3", "۴", "4",
+		"۵", "5", "۶", "6", "۷", "7", "۸", "8", "۹", "9",
+		"٠", "0", "١", "1", "٢", "2", "٣", "3", "٤", "4",
+		"٥", "5", "٦", "6", "٧", "7", "٨", "8", "٩", "9",
+	)
+)
+
+// Normalize makes s comparable regardless of keyboard: unifies arabic and persian letters,
+// removes ZWNJ and diacritics, converts digits to english, lowercases and collapses spaces
+func Normalize(s string) string {
+	s = ToEnglishDigits(replacer.Replace(s))
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), unicode.IsSpace), " ")
+}
+
+// ToEnglishDigits converts persian and arabic digits of s to english ones
+func ToEnglishDigits(s string) string {
+	return digits.Replace(s)
+}
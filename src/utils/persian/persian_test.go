@@ -0,0 +1,25 @@
+package persian
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeArabicLetters(t *testing.T) {
+	assert.Equal(t, "علی", Normalize("علي"))
+	assert.Equal(t, "کاظمی", Normalize("كاظمى"))
+}
+
+func TestNormalizeRemovesZwnj(t *testing.T) {
+	assert.Equal(t, "میخواهم", Normalize("می\u200cخواهم"))
+}
+
+func TestNormalizeDigitsCaseAndSpaces(t *testing.T) {
+	assert.Equal(t, "ali 0912", Normalize("  ALI   ۰٩۱۲ "))
+}
+
+func TestToEnglishDigits(t *testing.T) {
+	assert.Equal(t, "09123456789", ToEnglishDigits("۰۹۱۲۳۴۵۶۷۸۹"))
+	assert.Equal(t, "0912", ToEnglishDigits("٠٩١٢"))
+}
@@ -0,0 +1,108 @@
+package phone
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/alidevjimmy/user_microservice_t/utils/persian"
+)
+
+const (
+	IranCountryCode = "98"
+)
+
+var (
+	ErrInvalidNumber = errors.New("phone: invalid number")
+	ErrNotMobile     = errors.New("phone: not an iranian mobile number")
+
+	// iranMobile matches national significant number of iranian operators (MCI, Irancell, Rightel, ...)
+	iranMobile = regexp.MustCompile(`^9(0[1-5]|1[0-9]|2[0-2]|3[0-9]|41|9[0-9])[0-9]{7}$`)
+	e164       = regexp.MustCompile(`^[1-9][0-9]{7,14}$`)
+	separators = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "", "\u200c", "")
+)
+
+// Normalize parses raw in any common iranian (0912..., 98912..., 912...) or international
+// (+98912..., 0098912...) form, with persian or arabic digits, and returns it in E.164 form
+func Normalize(raw string) (string, error) {
+	s := separators.Replace(persian.ToEnglishDigits(strings.TrimSpace(raw)))
+	international := false
+	switch {
+	case strings.HasPrefix(s, "+"):
+		s, international = s[1:], true
+	case strings.HasPrefix(s, "00"):
+		s, international = s[2:], true
+	}
+	if s == "" || strings.TrimLeft(s, "0123456789") != "" {
+		return "", ErrInvalidNumber
+	}
+	if !international {
+		switch {
+		case strings.HasPrefix(s, "0"):
+			s = IranCountryCode + s[1:]
+		case len(s) == 12 && strings.HasPrefix(s, IranCountryCode):
+		case len(s) == 10 && strings.HasPrefix(s, "9"):
+			s = IranCountryCode + s
+		default:
+			return "", ErrInvalidNumber
+		}
+	}
+	if strings.HasPrefix(s, IranCountryCode) {
+		// people often keep the trunk zero after country code: +98 0912...
+		national := strings.TrimPrefix(s[len(IranCountryCode):], "0")
+		if !iranMobile.MatchString(national) {
+			return "", ErrNotMobile
+		}
+		return "+" + IranCountryCode + national, nil
+	}
+	if !e164.MatchString(s) {
+		return "", ErrInvalidNumber
+	}
+	return "+" + s, nil
+}
+
+// IsValid reports whether raw can be normalized
+func IsValid(raw string) bool {
+	_, err := Normalize(raw)
+	return err == nil
+}
+
+// NormalizeOrKeep normalizes raw and falls back to raw itself when it is not a phone number,
+// useful for lookups by values which may be a username as well
+func NormalizeOrKeep(raw string) string {
+	if p, err := Normalize(raw); err == nil {
+		return p
+	}
+	return raw
+}
+
+// Prefix returns what E.164 forms of numbers starting with raw start with, for searching by the beginning
+// of a number written in any form Normalize takes, e.g. 0912 gives +98912. False if raw is not such a beginning
+func Prefix(raw string) (string, bool) {
+	s := separators.Replace(persian.ToEnglishDigits(strings.TrimSpace(raw)))
+	international := false
+	switch {
+	case strings.HasPrefix(s, "+"):
+		s, international = s[1:], true
+	case strings.HasPrefix(s, "00"):
+		s, international = s[2:], true
+	}
+	if s == "" || strings.TrimLeft(s, "0123456789") != "" {
+		return "", false
+	}
+	if !international {
+		switch {
+		case strings.HasPrefix(s, "0"):
+			s = IranCountryCode + s[1:]
+		case strings.HasPrefix(s, IranCountryCode):
+		case strings.HasPrefix(s, "9"):
+			s = IranCountryCode + s
+		default:
+			return "", false
+		}
+	}
+	if strings.HasPrefix(s, IranCountryCode+"0") {
+		s = IranCountryCode + s[len(IranCountryCode)+1:]
+	}
+	return "+" + s, true
+}
@@ -0,0 +1,69 @@
+package phone
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeIranianForms(t *testing.T) {
+	for _, raw := range []string{
+		"09121234567",
+		"9121234567",
+		"989121234567",
+		"+989121234567",
+		"00989121234567",
+		"+98 0912 123 4567",
+		"0912-123-4567",
+		"۰۹۱۲۱۲۳۴۵۶۷",
+		"٠٩١٢١٢٣٤٥٦٧",
+	} {
+		p, err := Normalize(raw)
+		assert.Nil(t, err, raw)
+		assert.Equal(t, "+989121234567", p, raw)
+	}
+}
+
+func TestNormalizeInternational(t *testing.T) {
+	p, err := Normalize("+44 7911 123456")
+	assert.Nil(t, err)
+	assert.Equal(t, "+447911123456", p)
+}
+
+func TestNormalizeRejectsLandline(t *testing.T) {
+	_, err := Normalize("02188776655")
+	assert.Equal(t, ErrNotMobile, err)
+}
+
+func TestNormalizeRejectsGarbage(t *testing.T) {
+	for _, raw := range []string{"", "abc", "0912abc4567", "12345", "+1234"} {
+		_, err := Normalize(raw)
+		assert.NotNil(t, err, raw)
+	}
+}
+
+func TestNormalizeOrKeep(t *testing.T) {
+	assert.Equal(t, "+989121234567", NormalizeOrKeep("09121234567"))
+	assert.Equal(t, "test_user", NormalizeOrKeep("test_user"))
+}
+
+func TestPrefix(t *testing.T) {
+	for raw, want := range map[string]string{
+		"0912":        "+98912",
+		"۰۹۱۲ ۱۲":     "+9891212",
+		"912":         "+98912",
+		"98912":       "+98912",
+		"+98 0912":    "+98912",
+		"0098912":     "+98912",
+		"+4477":       "+4477",
+		"09121234567": "+989121234567",
+	} {
+		p, ok := Prefix(raw)
+		assert.True(t, ok, raw)
+		assert.Equal(t, want, p, raw)
+	}
+	for _, raw := range []string{"", "123", "ali", "0912a"} {
+		_, ok := Prefix(raw)
+		assert.False(t, ok, raw)
+	}
+}
@@ -0,0 +1,97 @@
+// Package sms sends text messages to phones. Kavenegar sends them through kavenegar.com,
+// Local keeps them in process for tests and development
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const KavenegarBaseURL = "https://api.kavenegar.com"
+
+// Message is a text sent to Receptor, a phone in E.164
+type Message struct {
+	Receptor string
+	Text     string
+}
+
+type Sender interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// Local keeps messages instead of sending them
+type Local struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewLocal() *Local {
+	return &Local{}
+}
+
+func (l *Local) Send(ctx context.Context, m Message) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, m)
+	return nil
+}
+
+// Messages returns messages sent so far, oldest first
+func (l *Local) Messages() []Message {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Message{}, l.messages...)
+}
+
+// Kavenegar sends messages from line Sender by account of APIKey, empty Sender uses the default line of the account
+type Kavenegar struct {
+	BaseURL string
+	APIKey  string
+	Sender  string
+	Client  *http.Client
+}
+
+func NewKavenegar(apiKey, sender string) *Kavenegar {
+	return &Kavenegar{BaseURL: KavenegarBaseURL, APIKey: apiKey, Sender: sender, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (k *Kavenegar) Send(ctx context.Context, m Message) error {
+	form := url.Values{"receptor": {m.Receptor}, "message": {m.Text}}
+	if k.Sender != "" {
+		form.Set("sender", k.Sender)
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/v1/%s/sms/send.json", k.BaseURL, url.PathEscape(k.APIKey)), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := k.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	// status of the api call is told in body as well, both must be 200
+	body := struct {
+		Return struct {
+			Status  int    `json:"status"`
+			Message string `json:"message"`
+		} `json:"return"`
+	}{}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("sms: kavenegar answered %s", res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return fmt.Errorf("sms: reading kavenegar answer: %v", err)
+	}
+	if body.Return.Status != http.StatusOK {
+		return fmt.Errorf("sms: kavenegar answered %d %s", body.Return.Status, body.Return.Message)
+	}
+	return nil
+}
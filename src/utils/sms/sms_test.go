@@ -0,0 +1,50 @@
+package sms
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalKeepsMessages(t *testing.T) {
+	s := NewLocal()
+	assert.Nil(t, s.Send(context.Background(), Message{Receptor: "+989121234567", Text: "12345"}))
+	assert.Equal(t, []Message{{Receptor: "+989121234567", Text: "12345"}}, s.Messages())
+}
+
+func TestKavenegarSends(t *testing.T) {
+	var got *http.Request
+	answer := `{"return":{"status":200,"message":"تایید شد"},"entries":[]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		got = r
+		w.Write([]byte(answer))
+	}))
+	defer srv.Close()
+	s := NewKavenegar("key", "1000596446")
+	s.BaseURL = srv.URL
+
+	assert.Nil(t, s.Send(context.Background(), Message{Receptor: "+989121234567", Text: "12345"}))
+	assert.Equal(t, "/v1/key/sms/send.json", got.URL.Path)
+	assert.Equal(t, "+989121234567", got.PostForm.Get("receptor"))
+	assert.Equal(t, "12345", got.PostForm.Get("message"))
+	assert.Equal(t, "1000596446", got.PostForm.Get("sender"))
+
+	// kavenegar tells failures in body too
+	answer = `{"return":{"status":418,"message":"اعتبار کافی نیست"},"entries":null}`
+	assert.NotNil(t, s.Send(context.Background(), Message{Receptor: "+989121234567", Text: "12345"}))
+}
+
+func TestKavenegarFails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	s := NewKavenegar("key", "")
+	s.BaseURL = srv.URL
+
+	assert.NotNil(t, s.Send(context.Background(), Message{Receptor: "+989121234567", Text: "12345"}))
+}
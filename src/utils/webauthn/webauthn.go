@@ -0,0 +1,350 @@
+// Package webauthn is a minimal WebAuthn relying party: it verifies passkey registration and
+// authentication ceremonies. Attestation statements are not checked, so any authenticator is accepted
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+)
+
+const (
+	// COSE algorithms of supported public keys
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+
+	UserVerificationRequired  = "required"
+	UserVerificationPreferred = "preferred"
+
+	// challengeSize is bytes of randomness in a challenge, at least 16 are required
+	challengeSize = 32
+	// maxCredentialIDSize is the largest credential id WebAuthn allows
+	maxCredentialIDSize = 1023
+
+	typeCreate = "webauthn.create"
+	typeGet    = "webauthn.get"
+
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagBackupEligible   = 0x08
+	flagAttestedData     = 0x40
+	flagExtensionData    = 0x80
+	authDataMinSize      = 37
+	attestedDataMinSize  = 18
+	rsaMinModulusBitSize = 2048
+
+	// COSE key parameters and values (RFC 8152)
+	coseKty        = 1
+	coseAlg        = 3
+	coseCrv        = -1
+	coseX          = -2
+	coseY          = -3
+	coseN          = -1
+	coseE          = -2
+	coseKtyOKP     = 1
+	coseKtyEC2     = 2
+	coseKtyRSA     = 3
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+)
+
+var (
+	ErrClientData        = errors.New("webauthn: client data does not match ceremony")
+	ErrAuthenticatorData = errors.New("webauthn: malformed authenticator data")
+	ErrRPID              = errors.New("webauthn: credential belongs to another relying party")
+	ErrUserPresence      = errors.New("webauthn: user presence or verification is missing")
+	ErrPublicKey         = errors.New("webauthn: unsupported public key")
+	ErrSignature         = errors.New("webauthn: invalid signature")
+	// ErrSignCount means the authenticator may be cloned, its counter did not increase
+	ErrSignCount = errors.New("webauthn: sign counter did not increase")
+)
+
+type (
+	// Config is who this service is to authenticators
+	Config struct {
+		// RPID is the domain credentials are scoped to
+		RPID   string
+		RPName string
+		// Origins are origins of pages allowed to run ceremonies, e.g. https://example.com
+		Origins []string
+		// UserVerification is UserVerificationRequired or UserVerificationPreferred
+		UserVerification string
+	}
+
+	// ClientData is what browser says about a ceremony
+	ClientData struct {
+		Type        string `json:"type"`
+		Challenge   string `json:"challenge"`
+		Origin      string `json:"origin"`
+		CrossOrigin bool   `json:"crossOrigin"`
+	}
+
+	// Credential is a registered public key credential
+	Credential struct {
+		ID []byte
+		// PublicKey is COSE encoded
+		PublicKey      []byte
+		SignCount      uint32
+		AAGUID         []byte
+		UserVerified   bool
+		BackupEligible bool
+	}
+
+	RelyingParty struct {
+		config Config
+	}
+
+	authenticatorData struct {
+		rpIDHash  []byte
+		flags     byte
+		signCount uint32
+		// credential is set only when flagAttestedData is
+		credential *Credential
+	}
+)
+
+func New(config Config) *RelyingParty {
+	return &RelyingParty{config: config}
+}
+
+func (rp *RelyingParty) Config() Config {
+	return rp.config
+}
+
+// NewChallenge returns a random base64url encoded challenge, each ceremony needs a new one
+func NewChallenge() (string, error) {
+	b := make([]byte, challengeSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ParseClientData decodes clientDataJSON without verifying it, e.g. to find challenge of a ceremony
+func ParseClientData(clientDataJSON []byte) (*ClientData, error) {
+	cd := new(ClientData)
+	if err := json.Unmarshal(clientDataJSON, cd); err != nil {
+		return nil, ErrClientData
+	}
+	return cd, nil
+}
+
+// VerifyRegistration checks response of navigator.credentials.create to challenge and returns the new credential
+func (rp *RelyingParty) VerifyRegistration(challenge string, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, typeCreate, challenge); err != nil {
+		return nil, err
+	}
+	item, rest, err := decodeCBOR(attestationObject)
+	if err != nil || len(rest) != 0 {
+		return nil, ErrAuthenticatorData
+	}
+	object, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrAuthenticatorData
+	}
+	raw, ok := object["authData"].([]byte)
+	if !ok {
+		return nil, ErrAuthenticatorData
+	}
+	data, err := parseAuthenticatorData(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(data); err != nil {
+		return nil, err
+	}
+	if data.credential == nil {
+		return nil, ErrAuthenticatorData
+	}
+	if _, _, err := parsePublicKey(data.credential.PublicKey); err != nil {
+		return nil, err
+	}
+	return data.credential, nil
+}
+
+// VerifyAssertion checks response of navigator.credentials.get to challenge made by credential
+// and returns the new sign counter to store
+func (rp *RelyingParty) VerifyAssertion(challenge string, credential Credential, clientDataJSON, authData, signature []byte) (uint32, error) {
+	if err := rp.verifyClientData(clientDataJSON, typeGet, challenge); err != nil {
+		return 0, err
+	}
+	data, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.verifyAuthenticatorData(data); err != nil {
+		return 0, err
+	}
+	if data.credential != nil {
+		return 0, ErrAuthenticatorData
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+	if err := verifySignature(credential.PublicKey, signed, signature); err != nil {
+		return 0, err
+	}
+	// authenticators not having a counter always send zero
+	if (data.signCount != 0 || credential.SignCount != 0) && data.signCount <= credential.SignCount {
+		return 0, ErrSignCount
+	}
+	return data.signCount, nil
+}
+
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, typ, challenge string) error {
+	cd, err := ParseClientData(clientDataJSON)
+	if err != nil {
+		return err
+	}
+	if cd.Type != typ || cd.CrossOrigin || challenge == "" ||
+		subtle.ConstantTimeCompare([]byte(cd.Challenge), []byte(challenge)) != 1 {
+		return ErrClientData
+	}
+	for _, origin := range rp.config.Origins {
+		if cd.Origin == origin {
+			return nil
+		}
+	}
+	return ErrClientData
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(data *authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.config.RPID))
+	if !bytes.Equal(data.rpIDHash, rpIDHash[:]) {
+		return ErrRPID
+	}
+	if data.flags&flagUserPresent == 0 {
+		return ErrUserPresence
+	}
+	if rp.config.UserVerification == UserVerificationRequired && data.flags&flagUserVerified == 0 {
+		return ErrUserPresence
+	}
+	return nil
+}
+
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < authDataMinSize {
+		return nil, ErrAuthenticatorData
+	}
+	data := &authenticatorData{
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	rest := raw[authDataMinSize:]
+	if data.flags&flagAttestedData != 0 {
+		if len(rest) < attestedDataMinSize {
+			return nil, ErrAuthenticatorData
+		}
+		aaguid := rest[:16]
+		size := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[attestedDataMinSize:]
+		if size == 0 || size > maxCredentialIDSize || size > len(rest) {
+			return nil, ErrAuthenticatorData
+		}
+		id := rest[:size]
+		_, after, err := decodeCBOR(rest[size:])
+		if err != nil {
+			return nil, ErrAuthenticatorData
+		}
+		data.credential = &Credential{
+			ID:             append([]byte{}, id...),
+			PublicKey:      append([]byte{}, rest[size:len(rest)-len(after)]...),
+			SignCount:      data.signCount,
+			AAGUID:         append([]byte{}, aaguid...),
+			UserVerified:   data.flags&flagUserVerified != 0,
+			BackupEligible: data.flags&flagBackupEligible != 0,
+		}
+		rest = after
+	}
+	if data.flags&flagExtensionData != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, ErrAuthenticatorData
+		}
+		rest = after
+	}
+	if len(rest) != 0 {
+		return nil, ErrAuthenticatorData
+	}
+	return data, nil
+}
+
+// parsePublicKey decodes a COSE key and returns it with its algorithm
+func parsePublicKey(cose []byte) (crypto.PublicKey, int64, error) {
+	item, _, err := decodeCBOR(cose)
+	if err != nil {
+		return nil, 0, ErrPublicKey
+	}
+	key, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, ErrPublicKey
+	}
+	kty, _ := key[int64(coseKty)].(int64)
+	alg, _ := key[int64(coseAlg)].(int64)
+	switch {
+	case kty == coseKtyEC2 && alg == AlgES256:
+		crv, _ := key[int64(coseCrv)].(int64)
+		x, _ := key[int64(coseX)].([]byte)
+		y, _ := key[int64(coseY)].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, ErrPublicKey
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, 0, ErrPublicKey
+		}
+		return pub, alg, nil
+	case kty == coseKtyRSA && alg == AlgRS256:
+		n, _ := key[int64(coseN)].([]byte)
+		e, _ := key[int64(coseE)].([]byte)
+		if len(e) == 0 || len(e) > 4 {
+			return nil, 0, ErrPublicKey
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < rsaMinModulusBitSize {
+			return nil, 0, ErrPublicKey
+		}
+		return pub, alg, nil
+	case kty == coseKtyOKP && alg == AlgEdDSA:
+		crv, _ := key[int64(coseCrv)].(int64)
+		x, _ := key[int64(coseX)].([]byte)
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, ErrPublicKey
+		}
+		return ed25519.PublicKey(x), alg, nil
+	}
+	return nil, 0, ErrPublicKey
+}
+
+func verifySignature(cose, signed, signature []byte) error {
+	pub, _, err := parsePublicKey(cose)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(signed)
+	ok := false
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(pub, digest[:], signature)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(pub, signed, signature)
+	}
+	if !ok {
+		return ErrSignature
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package webauthn_test
+
+import (
+	"testing"
+
+	"github.com/alidevjimmy/user_microservice_t/utils/webauthn"
+	"github.com/alidevjimmy/user_microservice_t/utils/webauthn/webauthntest"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	rpID   = "example.com"
+	origin = "https://example.com"
+)
+
+var rp = webauthn.New(webauthn.Config{RPID: rpID, RPName: "Example", Origins: []string{origin}, UserVerification: webauthn.UserVerificationRequired})
+
+func register(t *testing.T, a *webauthntest.Authenticator) *webauthn.Credential {
+	challenge, err := webauthn.NewChallenge()
+	assert.Nil(t, err)
+	clientData, attestation := a.Create(rpID, origin, challenge)
+	credential, err := rp.VerifyRegistration(challenge, clientData, attestation)
+	assert.Nil(t, err)
+	return credential
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	a := webauthntest.NewAuthenticator()
+	credential := register(t, a)
+	assert.Equal(t, a.ID, credential.ID)
+	assert.Equal(t, a.PublicKey(), credential.PublicKey)
+	assert.True(t, credential.UserVerified)
+
+	clientData, authData, signature := a.Get(rpID, origin, "challenge")
+	count, err := rp.VerifyAssertion("challenge", *credential, clientData, authData, signature)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, count)
+}
+
+func TestRegistrationWrongChallengeOrOrigin(t *testing.T) {
+	a := webauthntest.NewAuthenticator()
+
+	clientData, attestation := a.Create(rpID, origin, "challenge")
+	_, err := rp.VerifyRegistration("other-challenge", clientData, attestation)
+	assert.Equal(t, webauthn.ErrClientData, err)
+
+	clientData, attestation = a.Create(rpID, "https://example.com.evil", "challenge")
+	_, err = rp.VerifyRegistration("challenge", clientData, attestation)
+	assert.Equal(t, webauthn.ErrClientData, err)
+}
+
+func TestRegistrationOfOtherRelyingParty(t *testing.T) {
+	a := webauthntest.NewAuthenticator()
+
+	clientData, attestation := a.Create("evil.com", origin, "challenge")
+	_, err := rp.VerifyRegistration("challenge", clientData, attestation)
+	assert.Equal(t, webauthn.ErrRPID, err)
+}
+
+func TestRegistrationWithoutUserVerification(t *testing.T) {
+	a := webauthntest.NewAuthenticator()
+	a.UserVerified = false
+
+	clientData, attestation := a.Create(rpID, origin, "challenge")
+	_, err := rp.VerifyRegistration("challenge", clientData, attestation)
+	assert.Equal(t, webauthn.ErrUserPresence, err)
+}
+
+func TestRegistrationResponseIsNotAssertion(t *testing.T) {
+	a := webauthntest.NewAuthenticator()
+	credential := register(t, a)
+
+	clientData, attestation := a.Create(rpID, origin, "challenge")
+	_, err := rp.VerifyAssertion("challenge", *credential, clientData, attestation, nil)
+	assert.NotNil(t, err)
+}
+
+func TestAssertionOfOtherCredential(t *testing.T) {
+	credential := register(t, webauthntest.NewAuthenticator())
+
+	clientData, authData, signature := webauthntest.NewAuthenticator().Get(rpID, origin, "challenge")
+	_, err := rp.VerifyAssertion("challenge", *credential, clientData, authData, signature)
+	assert.Equal(t, webauthn.ErrSignature, err)
+}
+
+func TestAssertionSignCountMustIncrease(t *testing.T) {
+	a := webauthntest.NewAuthenticator()
+	credential := register(t, a)
+	credential.SignCount = 5
+
+	a.SignCount = 4
+	clientData, authData, signature := a.Get(rpID, origin, "challenge")
+	_, err := rp.VerifyAssertion("challenge", *credential, clientData, authData, signature)
+	assert.Equal(t, webauthn.ErrSignCount, err)
+}
+
+func TestMalformedAttestation(t *testing.T) {
+	a := webauthntest.NewAuthenticator()
+	clientData, attestation := a.Create(rpID, origin, "challenge")
+
+	for _, object := range [][]byte{nil, attestation[:len(attestation)-1], append(attestation, 0), {0xbf}, {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}} {
+		_, err := rp.VerifyRegistration("challenge", clientData, object)
+		assert.Equal(t, webauthn.ErrAuthenticatorData, err)
+	}
+}
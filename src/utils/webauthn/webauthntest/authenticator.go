@@ -0,0 +1,173 @@
+// Package webauthntest is a software authenticator, so passkey ceremonies are tested without a browser
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+
+	"github.com/alidevjimmy/user_microservice_t/utils/webauthn"
+)
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// Authenticator holds one ES256 credential and answers ceremonies of any relying party
+type Authenticator struct {
+	ID        []byte
+	SignCount uint32
+	// UserVerified is sent as UV flag, users are always present
+	UserVerified bool
+
+	key *ecdsa.PrivateKey
+}
+
+func NewAuthenticator() *Authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return &Authenticator{ID: id, UserVerified: true, key: key}
+}
+
+// Create answers navigator.credentials.create with attestation none
+func (a *Authenticator) Create(rpID, origin, challenge string) (clientDataJSON, attestationObject []byte) {
+	clientDataJSON = clientData("webauthn.create", origin, challenge)
+	authData := a.authenticatorData(rpID, flagAttestedData)
+	authData = append(authData, make([]byte, 16)...)
+	authData = append(authData, uint16Bytes(uint16(len(a.ID)))...)
+	authData = append(authData, a.ID...)
+	authData = append(authData, a.PublicKey()...)
+	attestationObject = encode(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	return clientDataJSON, attestationObject
+}
+
+// Get answers navigator.credentials.get, every answer increases SignCount
+func (a *Authenticator) Get(rpID, origin, challenge string) (clientDataJSON, authData, signature []byte) {
+	a.SignCount++
+	clientDataJSON = clientData("webauthn.get", origin, challenge)
+	authData = a.authenticatorData(rpID, 0)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return clientDataJSON, authData, signature
+}
+
+// PublicKey returns COSE encoded public key of credential
+func (a *Authenticator) PublicKey() []byte {
+	return encode(map[int]interface{}{
+		1:  2,
+		3:  webauthn.AlgES256,
+		-1: 1,
+		-2: padded(a.key.X.Bytes()),
+		-3: padded(a.key.Y.Bytes()),
+	})
+}
+
+func (a *Authenticator) authenticatorData(rpID string, flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	flags |= flagUserPresent
+	if a.UserVerified {
+		flags |= flagUserVerified
+	}
+	data := append(rpIDHash[:], flags)
+	return append(data, uint32Bytes(a.SignCount)...)
+}
+
+func clientData(typ, origin, challenge string) []byte {
+	b, err := json.Marshal(webauthn.ClientData{Type: typ, Challenge: challenge, Origin: origin})
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Base64 encodes b the way browsers send binary fields
+func Base64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func padded(b []byte) []byte {
+	return append(make([]byte, 32-len(b)), b...)
+}
+
+// encode writes v as CBOR, only types authenticators send are supported
+func encode(v interface{}) []byte {
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case map[int]interface{}:
+		keys := make([]int, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Ints(keys)
+		out := head(5, uint64(len(v)))
+		for _, k := range keys {
+			out = append(append(out, encode(k)...), encode(v[k])...)
+		}
+		return out
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := head(5, uint64(len(v)))
+		for _, k := range keys {
+			out = append(append(out, encode(k)...), encode(v[k])...)
+		}
+		return out
+	}
+	panic("webauthntest: can not encode value")
+}
+
+func head(major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major<<5 | 24, byte(arg)}
+	case arg <= 0xffff:
+		return append([]byte{major<<5 | 25}, uint16Bytes(uint16(arg))...)
+	}
+	return append([]byte{major<<5 | 26}, uint32Bytes(uint32(arg))...)
+}
+
+func uint16Bytes(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func uint32Bytes(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
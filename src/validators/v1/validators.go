@@ -0,0 +1,87 @@
+package validators
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	UsernameTag = "username"
+	PasswordTag = "password"
+
+	MinPasswordLength = 8
+	// MaxPasswordBytes is what bcrypt hashes of a password, the rest would be silently ignored.
+	// It is counted in bytes, so non latin passwords fit fewer characters
+	MaxPasswordBytes = 72
+
+	// envReservedUsernames is comma separated list of extra usernames nobody can register
+	envReservedUsernames = "RESERVED_USERNAMES"
+)
+
+var (
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,50}$`)
+
+	ReservedUsernames = reservedUsernames(
+		"admin", "administrator", "root", "support", "system", "sysadmin", "superuser",
+		"moderator", "staff", "help", "info", "security", "api", "www", "null", "anonymous",
+	)
+)
+
+// Register adds custom tags of this package to v
+func Register(v *validator.Validate) error {
+	err := v.RegisterValidation(UsernameTag, func(fl validator.FieldLevel) bool {
+		return IsValidUsername(fl.Field().String())
+	})
+	if err != nil {
+		return err
+	}
+	return v.RegisterValidation(PasswordTag, func(fl validator.FieldLevel) bool {
+		return IsValidPassword(fl.Field().String())
+	})
+}
+
+// Patterns returns regular expression behind each custom tag checking one
+func Patterns() map[string]string {
+	return map[string]string{UsernameTag: usernamePattern.String()}
+}
+
+// IsValidUsername reports whether username only contains english letters, numbers and underline
+func IsValidUsername(username string) bool {
+	return usernamePattern.MatchString(username)
+}
+
+// IsValidPassword reports whether password follows the password policy,
+// at least MinPasswordLength characters and at most MaxPasswordBytes bytes having both letters and digits
+func IsValidPassword(password string) bool {
+	if utf8.RuneCountInString(password) < MinPasswordLength || len(password) > MaxPasswordBytes {
+		return false
+	}
+	var letter, digit bool
+	for _, r := range password {
+		letter = letter || unicode.IsLetter(r)
+		digit = digit || unicode.IsDigit(r)
+	}
+	return letter && digit
+}
+
+// IsReservedUsername reports whether username is reserved, case-insensitively
+func IsReservedUsername(username string) bool {
+	_, ok := ReservedUsernames[strings.ToLower(username)]
+	return ok
+}
+
+func reservedUsernames(defaults ...string) map[string]struct{} {
+	names := append(defaults, strings.Split(os.Getenv(envReservedUsernames), ",")...)
+	reserved := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			reserved[name] = struct{}{}
+		}
+	}
+	return reserved
+}
@@ -0,0 +1,60 @@
+package validators
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsValidUsername(t *testing.T) {
+	for _, username := range []string{"test_user", "Ali123", "___"} {
+		assert.True(t, IsValidUsername(username), username)
+	}
+	for _, username := range []string{"sdff-dfd", "ab", "علی", "user name", "user@mail"} {
+		assert.False(t, IsValidUsername(username), username)
+	}
+}
+
+func TestIsValidPassword(t *testing.T) {
+	for _, password := range []string{"password1", "رمزعبور۱۲۳", "a1234567", strings.Repeat("رمز۱", 9)} {
+		assert.True(t, IsValidPassword(password), password)
+	}
+	for _, password := range []string{"pass1", "password", "12345678", strings.Repeat("a1", 37),
+		// 40 characters but 80 bytes, bcrypt would ignore the last ones
+		strings.Repeat("رمز۱", 10)} {
+		assert.False(t, IsValidPassword(password), password)
+	}
+}
+
+func TestIsReservedUsername(t *testing.T) {
+	assert.True(t, IsReservedUsername("admin"))
+	assert.True(t, IsReservedUsername("Support"))
+	assert.False(t, IsReservedUsername("test_user"))
+}
+
+func TestReservedUsernamesFromEnv(t *testing.T) {
+	os.Setenv(envReservedUsernames, " Owner ,,billing")
+	defer os.Unsetenv(envReservedUsernames)
+	reserved := reservedUsernames("root")
+	assert.Len(t, reserved, 3)
+	assert.Contains(t, reserved, "owner")
+	assert.Contains(t, reserved, "billing")
+	assert.Contains(t, reserved, "root")
+}
+
+func TestRegisterUsernameTag(t *testing.T) {
+	v := validator.New()
+	assert.Nil(t, Register(v))
+	assert.Nil(t, v.Var("test_user", UsernameTag))
+	assert.NotNil(t, v.Var("sdff-dfd", UsernameTag))
+}
+
+func TestRegisterPasswordTag(t *testing.T) {
+	v := validator.New()
+	assert.Nil(t, Register(v))
+	assert.Nil(t, v.Var("password1", PasswordTag))
+	assert.NotNil(t, v.Var("password", PasswordTag))
+}